@@ -0,0 +1,456 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+const (
+	// The file in debcomprt's data dir that configures the repos aliases are
+	// found in.
+	aliasSourcesFile = "alias-sources.json"
+	// The dir in debcomprt's data dir the alias sources are cloned into.
+	aliasSourcesDir = "alias-sources"
+	// Locked while an alias is synced and copied out of its source.
+	aliasSourcesLockFile = "alias-sources.lock"
+)
+
+// The files of an alias that each run a stage of a comprt's config: a script on
+// the host before the bootstrap, the comprt config file in the comprt and a
+// script on the host after the comprt is exited.
+var aliasStageFiles = []string{hostPreScript, comprtConfigFile, hostPostScript}
+
+var (
+	errUnknownAliasRef      = errors.New("not a branch, tag or commit of the repo")
+	errAliasSourceNotCloned = errors.New("has not been cloned yet, it cannot be used offline")
+)
+
+// A type used to describe a repo of aliases. When an alias is in multiple
+// sources, the source with the highest priority is used.
+type aliasSource struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Priority int    `json:"priority"`
+	// The private key used to access the source over SSH.
+	SSHKey string `json:"ssh_key,omitempty"`
+	// The env var with the token used to access the source over HTTP(S).
+	TokenEnv string `json:"token_env,omitempty"`
+	// The armored public keys the source's commits (or tags) must be signed by.
+	Keyring string `json:"keyring,omitempty"`
+}
+
+// Get where the alias source is cloned to.
+func (source aliasSource) repoPath() string {
+	// where the comprtconfigs repo was cloned to before multiple sources existed
+	if source.Name == comprtConfigsRepoName {
+		return filepath.Join(progDataDir, comprtConfigsRepoName)
+	}
+
+	return filepath.Join(progDataDir, aliasSourcesDir, source.Name)
+}
+
+// Read in the configured alias sources, ordered by priority (highest first).
+// Sources with the same priority keep the order they were configured in. The
+// comprtconfigs repo is always a source, unless a source by the same name is
+// configured in its place.
+func loadAliasSources() ([]aliasSource, error) {
+	var sources []aliasSource
+	sourcesBytes, err := os.ReadFile(filepath.Join(progDataDir, aliasSourcesFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	} else if err == nil {
+		if err := json.Unmarshal(sourcesBytes, &sources); err != nil {
+			return nil, fmt.Errorf("unable to parse %v: %w", aliasSourcesFile, err)
+		}
+	}
+
+	var names map[string]bool = make(map[string]bool)
+	for _, source := range sources {
+		if source.Name == "" || strings.ContainsAny(source.Name, "/.") || source.URL == "" {
+			return nil, fmt.Errorf("alias sources require a name (without '/' or '.') and a url, got %+v", source)
+		} else if names[source.Name] {
+			return nil, fmt.Errorf("alias source %v is configured more than once", source.Name)
+		}
+		names[source.Name] = true
+	}
+	if !names[comprtConfigsRepoName] {
+		sources = append(sources, aliasSource{Name: comprtConfigsRepoName, URL: comprtConfigsRepoUrl})
+	}
+
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].Priority > sources[j].Priority
+	})
+
+	return sources, nil
+}
+
+// Get the sources the alias could come from, along with the alias's name in
+// those sources. A qualified alias (e.g. 'comprtconfigs/altaria') only comes
+// from the source named.
+func aliasCandidates(alias string, sources []aliasSource) ([]aliasSource, string) {
+	if i := strings.Index(alias, "/"); i > 0 {
+		for _, source := range sources {
+			if source.Name == alias[:i] {
+				return []aliasSource{source}, alias[i+1:]
+			}
+		}
+	}
+
+	return sources, alias
+}
+
+// Clone the alias source if it has not been cloned yet, otherwise update it.
+// If a ref is passed in, the source is left on the ref instead. Offline, the
+// source is used as it was last cloned or updated.
+func syncAliasSource(source aliasSource, ref string, offline bool) error {
+	repoPath := source.repoPath()
+	if offline {
+		if _, err := os.Stat(repoPath); errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("alias source %v %w", source.Name, errAliasSourceNotCloned)
+		} else if err != nil {
+			return err
+		}
+
+		repo, err := git.PlainOpen(repoPath)
+		if err != nil {
+			return err
+		} else if ref == "" {
+			return checkoutDefaultBranch(repo)
+		} else if err := checkoutAliasRef(repo, ref); err != nil {
+			return fmt.Errorf("alias source %v: %w", source.Name, err)
+		}
+
+		return nil
+	}
+
+	auth, err := aliasSourceAuth(source)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(repoPath); errors.Is(err, fs.ErrNotExist) {
+		if err := retryWithTimeout(context.Background(), progRetryPolicy, func(attempt int, err error) {
+			infof("unable to clone %v (%v), trying again", source.URL, err)
+		}, func(ctx context.Context) error {
+			_, err := git.PlainCloneContext(ctx, repoPath, false, &git.CloneOptions{
+				URL:  source.URL,
+				Auth: auth,
+			})
+			if err != nil {
+				// a partial clone would otherwise cause the next attempt to fail
+				os.RemoveAll(repoPath)
+			}
+			return err
+		}); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if ref == "" {
+		var pullOpts git.PullOptions = git.PullOptions{RemoteName: "origin", Auth: auth}
+		repo, err := git.PlainOpen(repoPath)
+		if err != nil {
+			return err
+		}
+
+		if err := checkoutDefaultBranch(repo); err != nil {
+			return err
+		}
+
+		gitWorkingDir, err := repo.Worktree()
+		if err != nil {
+			return err
+		}
+		retryWithTimeout(context.Background(), progRetryPolicy, nil, func(ctx context.Context) error {
+			if err := gitWorkingDir.PullContext(ctx, &pullOpts); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+				return err
+			}
+			return nil
+		})
+	}
+
+	if ref != "" {
+		repo, err := git.PlainOpen(repoPath)
+		if err != nil {
+			return err
+		}
+
+		if err := retryWithTimeout(context.Background(), progRetryPolicy, func(attempt int, err error) {
+			infof("unable to fetch %v (%v), trying again", source.URL, err)
+		}, func(ctx context.Context) error {
+			return fetchAliasRefs(ctx, repo, auth)
+		}); err != nil {
+			return err
+		}
+
+		if err := checkoutAliasRef(repo, ref); err != nil {
+			return fmt.Errorf("alias source %v: %w", source.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Find the alias in the alias sources, cloning or updating a source only when
+// it is needed. If the source the alias is found in has a keyring (or one is
+// passed in), the source's checkout is verified against it. Returns the path to
+// the alias's dir.
+func findAlias(alias, ref string, offline bool, keyringPath string) (string, error) {
+	sources, err := loadAliasSources()
+	if err != nil {
+		return "", err
+	}
+
+	candidates, aliasName := aliasCandidates(alias, sources)
+	for _, source := range candidates {
+		if err := syncAliasSource(source, ref, offline); (errors.Is(err, errUnknownAliasRef) ||
+			errors.Is(err, errAliasSourceNotCloned)) && len(candidates) > 1 {
+			// the alias may be in another source that has the ref (or is cloned)
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		aliasPath := filepath.Join(source.repoPath(), aliasName)
+		if _, err := os.Stat(aliasPath); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		if keyringPath == "" {
+			keyringPath = source.Keyring
+		}
+		if keyringPath != "" {
+			if err := verifyAliasSource(source, keyringPath); err != nil {
+				return "", err
+			}
+		}
+
+		return aliasPath, nil
+	}
+
+	return "", fmt.Errorf("alias %v was not found in any alias source", alias)
+}
+
+// Find the alias (see findAlias) and copy it out of its source. The sources are
+// shared by every debcomprt on the host (e.g. the creates ran by apply), so they
+// are locked until the alias is copied, that way another debcomprt cannot check
+// out another ref of the source while this comprt is being created from it.
+func fetchAlias(alias string, pconfs *progConfigs) (string, error) {
+	unlock, err := lockProgDataFile(aliasSourcesLockFile)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	createPhases.start(aliasFetchPhase)
+	defer createPhases.stop()
+	aliasPath, err := findAlias(alias, pconfs.aliasRef, pconfs.offline, pconfs.aliasKeyringPath)
+	if err != nil {
+		return "", err
+	}
+	if pconfs.aliasCommit, err = aliasCommit(aliasPath); err != nil {
+		return "", err
+	}
+
+	aliasCopyDir, err := makeTempDir("", progname+"-alias-")
+	if err != nil {
+		return "", err
+	}
+	var aliasCopyPath string = filepath.Join(aliasCopyDir, filepath.Base(aliasPath))
+	if err := copyComprt(aliasPath, aliasCopyPath); err != nil {
+		os.RemoveAll(aliasCopyDir)
+		return "", err
+	}
+	pconfs.aliasCopyDir = aliasCopyDir
+
+	return aliasCopyPath, nil
+}
+
+// Fetch the branches and tags of an alias source's origin.
+func fetchAliasRefs(ctx context.Context, repo *git.Repository, auth transport.AuthMethod) error {
+	if err := repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		Auth:       auth,
+		Tags:       git.AllTags,
+	}); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+
+	return nil
+}
+
+// Check out the ref (a branch, tag or commit) of an alias source's repo,
+// leaving HEAD detached. Branches are resolved against origin, that way a stale
+// local branch is never used.
+func checkoutAliasRef(repo *git.Repository, ref string) error {
+	hash, err := repo.ResolveRevision(plumbing.Revision("refs/remotes/origin/" + ref))
+	if err != nil {
+		if hash, err = repo.ResolveRevision(plumbing.Revision(ref)); err != nil {
+			return fmt.Errorf("%v is %w (%v)", ref, errUnknownAliasRef, err)
+		}
+	}
+
+	gitWorkingDir, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return gitWorkingDir.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true})
+}
+
+// Check out an alias source's default branch if HEAD was left detached
+// (e.g. by a previous --alias-ref), as a detached HEAD cannot be pulled.
+func checkoutDefaultBranch(repo *git.Repository) error {
+	head, err := repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		// nothing has been checked out yet
+		return nil
+	} else if err != nil {
+		return err
+	} else if head.Name().IsBranch() {
+		return nil
+	}
+
+	// a clone only creates a local branch for the default branch
+	branches, err := repo.Branches()
+	if err != nil {
+		return err
+	}
+	defaultBranch, err := branches.Next()
+	branches.Close()
+	if err != nil {
+		return fmt.Errorf("unable to find the default branch of the repo: %w", err)
+	}
+
+	gitWorkingDir, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return gitWorkingDir.Checkout(&git.CheckoutOptions{Branch: defaultBranch.Name(), Force: true})
+}
+
+// Get the dir of a local alias (e.g. 'path:./myalias'). Returns false if the
+// alias is not a local alias.
+func localAliasPath(alias string) (string, bool) {
+	if !strings.HasPrefix(alias, localAliasPrefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(alias, localAliasPrefix), true
+}
+
+// Check that the local alias's dir has a comprt config file (or a host-side
+// script) in it. Returns the absolute path to the dir.
+func checkLocalAlias(aliasPath string) (string, error) {
+	absAliasPath, err := filepath.Abs(aliasPath)
+	if err != nil {
+		return "", err
+	}
+
+	if fileInfo, err := os.Stat(absAliasPath); err != nil {
+		return "", err
+	} else if !fileInfo.IsDir() {
+		return "", fmt.Errorf("local alias %v is not a dir", aliasPath)
+	}
+
+	// each stage of an alias is optional, but an alias needs at least one
+	for _, aliasFile := range aliasStageFiles {
+		if _, err := os.Stat(filepath.Join(absAliasPath, aliasFile)); err == nil {
+			return absAliasPath, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("local alias %v has none of: %v", aliasPath, strings.Join(aliasStageFiles, ", "))
+}
+
+// Verify the alias source's checkout was signed by a key in the keyring. Either
+// the checked out commit or a tag pointing to it must be signed, and the
+// checkout cannot have local changes.
+func verifyAliasSource(source aliasSource, keyringPath string) error {
+	keyringBytes, err := os.ReadFile(keyringPath)
+	if err != nil {
+		return err
+	}
+	var keyring string = string(keyringBytes)
+
+	repo, err := git.PlainOpen(source.repoPath())
+	if err != nil {
+		return err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	gitWorkingDir, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	status, err := gitWorkingDir.Status()
+	if err != nil {
+		return err
+	} else if !status.IsClean() {
+		return fmt.Errorf("alias source %v has local changes, its signature cannot be verified", source.Name)
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	if _, err := commit.Verify(keyring); err == nil {
+		return nil
+	}
+
+	tags, err := repo.TagObjects()
+	if err != nil {
+		return err
+	}
+	defer tags.Close()
+	for {
+		tag, err := tags.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if tag.Target != head.Hash() {
+			continue
+		} else if _, err := tag.Verify(keyring); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("commit %v of alias source %v is not signed by a key in %v", head.Hash(), source.Name, keyringPath)
+}
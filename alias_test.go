@@ -0,0 +1,365 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Create a comprtconfigs repo with an alias's comprt config file committed once
+// per version passed in. Returns the hashes of the commits.
+func createTestComprtConfigsRepo(repoPath string, versions []string) ([]plumbing.Hash, error) {
+	repo, err := git.PlainInit(repoPath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	gitWorkingDir, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(repoPath, "altaria"), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	var hashes []plumbing.Hash
+	for _, version := range versions {
+		if err := createTestFile(filepath.Join(repoPath, "altaria", comprtConfigFile), version); err != nil {
+			return nil, err
+		}
+		if _, err := gitWorkingDir.Add(filepath.Join("altaria", comprtConfigFile)); err != nil {
+			return nil, err
+		}
+
+		hash, err := gitWorkingDir.Commit(version, &git.CommitOptions{
+			Author: &object.Signature{Name: progname, Email: progname + "@localhost", When: time.Now()},
+		})
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, nil
+}
+
+func TestCheckoutAliasRef(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var originPath string = filepath.Join(tempDirPath, "origin")
+	hashes, err := createTestComprtConfigsRepo(originPath, []string{"v1", "v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	originRepo, err := git.PlainOpen(originPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := originRepo.CreateTag("v1.0.0", hashes[0], nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var clonePath string = filepath.Join(tempDirPath, comprtConfigsRepoName)
+	repo, err := git.PlainClone(clonePath, false, &git.CloneOptions{URL: originPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchAliasRefs(context.Background(), repo, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for ref, expected := range map[string]string{
+		"v1.0.0":               "v1",
+		hashes[0].String()[:7]: "v1",
+		"master":               "v2",
+		hashes[1].String():     "v2",
+	} {
+		if err := checkoutAliasRef(repo, ref); err != nil {
+			t.Fatal(err)
+		}
+
+		contents, err := os.ReadFile(filepath.Join(clonePath, "altaria", comprtConfigFile))
+		if err != nil {
+			t.Fatal(err)
+		} else if string(contents) != expected {
+			t.Fatalf("expected %q to be checked out for %v, got %q", expected, ref, contents)
+		}
+	}
+
+	if err := checkoutAliasRef(repo, "v9.9.9"); err == nil {
+		t.Fatal("a ref that does not exist was checked out")
+	}
+
+	// a detached HEAD should be put back on the default branch
+	if err := checkoutDefaultBranch(repo); err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	} else if head.Name() != plumbing.Master {
+		t.Fatalf("%v was checked out instead of the default branch", head.Name())
+	}
+}
+
+func TestGetProgDataLocalAlias(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var aliasPath string = filepath.Join(tempDirPath, "myalias")
+	if err := os.Mkdir(aliasPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := checkLocalAlias(aliasPath); err == nil {
+		t.Fatalf("a local alias without a %v file was accepted", comprtConfigFile)
+	}
+	// an alias can be only a host-side script
+	if err := createTestFile(filepath.Join(aliasPath, hostPostScript), "#!/bin/sh\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkLocalAlias(aliasPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(aliasPath, comprtConfigFile), "echo \"{{ .SHELL }}\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkLocalAlias(aliasPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var pconfs progConfigs
+	if err := getProgData(localAliasPrefix+aliasPath, false, &pconfs); err != nil {
+		t.Fatal(err)
+	}
+	if pconfs.comprtConfigPath != filepath.Join(aliasPath, comprtConfigFile) {
+		t.Fatalf("expected the local alias's %v to be used, got %v", comprtConfigFile, pconfs.comprtConfigPath)
+	}
+
+	// preprocessing renders a copy, leaving the local alias as is
+	pconfs = progConfigs{aliasEnvVars: []string{"SHELL=/bin/bash"}}
+	if err := getProgData(localAliasPrefix+aliasPath, true, &pconfs); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pconfs.preprocessedAliasDir)
+
+	contents, err := os.ReadFile(pconfs.comprtConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(contents) != "echo \"/bin/bash\"\n" {
+		t.Fatalf("unexpected preprocessed %v: %q", comprtConfigFile, contents)
+	}
+}
+
+func TestFindAliasAcrossSources(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	// both sources have the alias, the source with the higher priority should win
+	var lowPath, highPath string = filepath.Join(progDataDir, "low"), filepath.Join(progDataDir, "high")
+	if _, err := createTestComprtConfigsRepo(lowPath, []string{"low"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createTestComprtConfigsRepo(highPath, []string{"high"}); err != nil {
+		t.Fatal(err)
+	}
+	sourcesBytes, err := json.Marshal([]aliasSource{
+		{Name: "low", URL: lowPath, Priority: 10},
+		{Name: "high", URL: highPath, Priority: 20},
+		// keeps the comprtconfigs repo from being cloned over the network
+		{Name: comprtConfigsRepoName, URL: lowPath},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(progDataDir, aliasSourcesFile), sourcesBytes, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := loadAliasSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, source := range sources {
+		names = append(names, source.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"high", "low", comprtConfigsRepoName}) {
+		t.Fatalf("alias sources were not ordered by priority: %v", names)
+	}
+
+	for alias, expected := range map[string]string{
+		"altaria":     "high",
+		"low/altaria": "low",
+	} {
+		aliasPath, err := findAlias(alias, "", false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents, err := os.ReadFile(filepath.Join(aliasPath, comprtConfigFile))
+		if err != nil {
+			t.Fatal(err)
+		} else if string(contents) != expected {
+			t.Fatalf("expected %v to come from the %v source, got %q", alias, expected, contents)
+		}
+	}
+
+	// sources are only cloned when needed
+	if _, err := os.Stat(aliasSource{Name: comprtConfigsRepoName}.repoPath()); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("an alias source that was not needed was cloned: %v", err)
+	}
+
+	if _, err := findAlias("swablu", "", false, ""); err == nil {
+		t.Fatal("an alias that is not in any source was found")
+	}
+}
+
+func TestFindAliasOffline(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var originPath string = filepath.Join(progDataDir, "origin")
+	if _, err := createTestComprtConfigsRepo(originPath, []string{"v1"}); err != nil {
+		t.Fatal(err)
+	}
+	sourcesBytes, err := json.Marshal([]aliasSource{{Name: comprtConfigsRepoName, URL: originPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(progDataDir, aliasSourcesFile), sourcesBytes, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := findAlias("altaria", "", true, ""); !errors.Is(err, errAliasSourceNotCloned) {
+		t.Fatalf("expected the alias to be missing offline, got: %v", err)
+	}
+	if _, err := findAlias("altaria", "", false, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// the origin being gone should not matter offline
+	if err := os.RemoveAll(originPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findAlias("altaria", "", true, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindAliasVerifiesSignatures(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	entity, err := openpgp.NewEntity(progname, "", progname+"@localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyring bytes.Buffer
+	keyringWriter, err := armor.Encode(&keyring, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(keyringWriter); err != nil {
+		t.Fatal(err)
+	}
+	keyringWriter.Close()
+	var keyringPath string = filepath.Join(progDataDir, "keyring.asc")
+	if err := createTestFile(keyringPath, keyring.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	// v1 is unsigned but has a signed tag, v2 is unsigned and v3 is signed
+	var originPath string = filepath.Join(progDataDir, "origin")
+	hashes, err := createTestComprtConfigsRepo(originPath, []string{"v1", "v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	originRepo, err := git.PlainOpen(originPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := &object.Signature{Name: progname, Email: progname + "@localhost", When: time.Now()}
+	if _, err := originRepo.CreateTag("v1.0.0", hashes[0], &git.CreateTagOptions{
+		Tagger:  signature,
+		Message: "v1.0.0",
+		SignKey: entity,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	gitWorkingDir, err := originRepo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(originPath, "altaria", comprtConfigFile), "v3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitWorkingDir.Add(filepath.Join("altaria", comprtConfigFile)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitWorkingDir.Commit("v3", &git.CommitOptions{Author: signature, SignKey: entity}); err != nil {
+		t.Fatal(err)
+	}
+
+	sourcesBytes, err := json.Marshal([]aliasSource{{Name: comprtConfigsRepoName, URL: originPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(progDataDir, aliasSourcesFile), sourcesBytes, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	for ref, verified := range map[string]bool{
+		"":                 true,
+		"v1.0.0":           true,
+		hashes[1].String(): false,
+	} {
+		if _, err := findAlias("altaria", ref, false, keyringPath); verified && err != nil {
+			t.Fatalf("%q was not verified: %v", ref, err)
+		} else if !verified && err == nil {
+			t.Fatalf("%q was verified without being signed", ref)
+		}
+	}
+
+	aliasPath, err := findAlias("altaria", "", false, keyringPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(aliasPath, comprtConfigFile), []byte("rm -rf /"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findAlias("altaria", "", true, keyringPath); err == nil {
+		t.Fatal("a checkout with local changes was verified")
+	}
+}
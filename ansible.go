@@ -0,0 +1,105 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ansiblePlaybookProgram = "ansible-playbook"
+
+	// The connection plugin that has ansible run its modules in a chroot on the
+	// host, for reference:
+	// https://docs.ansible.com/ansible/latest/collections/community/general/chroot_connection.html
+	ansibleChrootConnection = "community.general.chroot"
+
+	// Ansible runs its modules with the comprt's python.
+	ansiblePythonPkg = "python3"
+)
+
+// A type used to store an ansible playbook ran against a comprt.
+type ansiblePlaybook struct {
+	Playbook string `json:"playbook"`
+	// Passed to the playbook as extra vars, in the KEY=VALUE form.
+	ExtraVars []string `json:"extra_vars,omitempty"`
+}
+
+// Parse the playbooks passed in as paths.
+func parseAnsiblePlaybooks(values []string) ([]ansiblePlaybook, error) {
+	var playbooks []ansiblePlaybook
+	for _, value := range values {
+		absPlaybookPath, err := filepath.Abs(value)
+		if err != nil {
+			return nil, err
+		}
+		playbooks = append(playbooks, ansiblePlaybook{Playbook: absPlaybookPath})
+	}
+
+	return playbooks, nil
+}
+
+// Check the playbook can be ran against the comprt.
+func (playbook ansiblePlaybook) validate() error {
+	if _, err := os.Stat(playbook.Playbook); err != nil {
+		return err
+	}
+	for _, extraVar := range playbook.ExtraVars {
+		if i := strings.Index(extraVar, "="); i < 1 {
+			return fmt.Errorf("%v is not a properly formatted extra var of %v (e.g. KEY=VALUE)", extraVar, playbook.Playbook)
+		}
+	}
+
+	return nil
+}
+
+// Get the args that have ansible-playbook run the playbook against the comprt
+// at target, the comprt being its only host.
+func (playbook ansiblePlaybook) args(target string) []string {
+	var args []string = []string{"--inventory", target + ",", "--connection", ansibleChrootConnection}
+	for _, extraVar := range playbook.ExtraVars {
+		args = append(args, "--extra-vars", extraVar)
+	}
+
+	return append(args, playbook.Playbook)
+}
+
+// Run the playbooks against the comprt at target, stopping at the first one
+// that fails. Ansible's output goes through debcomprt's output (e.g. the build
+// log).
+func runAnsiblePlaybooks(playbooks []ansiblePlaybook, target string, quiet bool) error {
+	if len(playbooks) == 0 {
+		return nil
+	}
+
+	ansiblePlaybookPath, err := progExecutor.LookPath(ansiblePlaybookProgram)
+	if err != nil {
+		return err
+	}
+	for _, playbook := range playbooks {
+		ansibleCmd := exec.Command(ansiblePlaybookPath, playbook.args(target)...)
+		traceCommand(ansibleCmd)
+		ansibleCmd.Stdout, ansibleCmd.Stderr = buildLogOutput(quiet)
+		if err := progExecutor.Run(ansibleCmd); err != nil {
+			return fmt.Errorf("ansible playbook %v failed: %w", playbook.Playbook, err)
+		}
+	}
+
+	return nil
+}
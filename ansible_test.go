@@ -0,0 +1,104 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnsiblePlaybookValidate(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var playbookPath string = filepath.Join(tempDirPath, "site.yml")
+	if err := createTestFile(playbookPath, "- hosts: all\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (ansiblePlaybook{Playbook: playbookPath, ExtraVars: []string{"foo=bar"}}).validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, playbook := range []ansiblePlaybook{
+		{Playbook: filepath.Join(tempDirPath, "foo.yml")},
+		{Playbook: playbookPath, ExtraVars: []string{"foo"}},
+		{Playbook: playbookPath, ExtraVars: []string{"=bar"}},
+	} {
+		if err := playbook.validate(); err == nil {
+			t.Fatalf("%+v was accepted", playbook)
+		}
+	}
+}
+
+func TestAnsiblePlaybookArgs(t *testing.T) {
+	expected := []string{
+		"--inventory", "/srv/foo,",
+		"--connection", ansibleChrootConnection,
+		"--extra-vars", "foo=bar",
+		"/srv/site.yml",
+	}
+	actual := ansiblePlaybook{Playbook: "/srv/site.yml", ExtraVars: []string{"foo=bar"}}.args("/srv/foo")
+	if strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestComprtHooksRunPlaybooks(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// a stand-in for ansible-playbook that records what it was ran with
+	var argsPath string = filepath.Join(tempDirPath, "args")
+	var binDir string = filepath.Join(tempDirPath, "bin")
+	if err := os.Mkdir(binDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(binDir, ansiblePlaybookProgram), "#!/bin/sh\necho \"$*\" >> "+shellQuote(argsPath)+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	hooks, err := newComprtHooks(filepath.Join(tempDirPath, comprtConfigFile), nil, filepath.Join(tempDirPath, "foo"), testCodeCame, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks.playbooks = []ansiblePlaybook{{Playbook: "site.yml"}}
+
+	if err := hooks.run(preConfigHook); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(argsPath); err == nil {
+		t.Fatal("the playbooks were ran before the comprt config file")
+	}
+
+	if err := hooks.run(postConfigHook); err != nil {
+		t.Fatal(err)
+	}
+	args, err := os.ReadFile(argsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := strings.Join(hooks.playbooks[0].args(filepath.Join(tempDirPath, "foo")), " ") + "\n"; string(args) != expected {
+		t.Fatalf("expected %q, got %q", expected, args)
+	}
+}
@@ -0,0 +1,420 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: debcomprt.proto
+
+package debcomprtpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// ComprtsClient is the client API for Comprts service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ComprtsClient interface {
+	// Lists the comprts created on the host (see the inventory command).
+	ListComprts(ctx context.Context, in *ListComprtsRequest, opts ...grpc.CallOption) (*ListComprtsResponse, error)
+	CreateComprt(ctx context.Context, in *CreateComprtRequest, opts ...grpc.CallOption) (*Job, error)
+	DeleteComprt(ctx context.Context, in *DeleteComprtRequest, opts ...grpc.CallOption) (*Job, error)
+	// Runs a command in a comprt (see the provision command).
+	ExecComprt(ctx context.Context, in *ExecComprtRequest, opts ...grpc.CallOption) (*Job, error)
+	// Streams a comprt as a tarball.
+	ExportComprt(ctx context.Context, in *ExportComprtRequest, opts ...grpc.CallOption) (Comprts_ExportComprtClient, error)
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// Streams the job's output from the start, until the job finishes.
+	StreamJobOutput(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (Comprts_StreamJobOutputClient, error)
+}
+
+type comprtsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewComprtsClient(cc grpc.ClientConnInterface) ComprtsClient {
+	return &comprtsClient{cc}
+}
+
+func (c *comprtsClient) ListComprts(ctx context.Context, in *ListComprtsRequest, opts ...grpc.CallOption) (*ListComprtsResponse, error) {
+	out := new(ListComprtsResponse)
+	err := c.cc.Invoke(ctx, "/debcomprt.v1.Comprts/ListComprts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *comprtsClient) CreateComprt(ctx context.Context, in *CreateComprtRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, "/debcomprt.v1.Comprts/CreateComprt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *comprtsClient) DeleteComprt(ctx context.Context, in *DeleteComprtRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, "/debcomprt.v1.Comprts/DeleteComprt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *comprtsClient) ExecComprt(ctx context.Context, in *ExecComprtRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, "/debcomprt.v1.Comprts/ExecComprt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *comprtsClient) ExportComprt(ctx context.Context, in *ExportComprtRequest, opts ...grpc.CallOption) (Comprts_ExportComprtClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Comprts_ServiceDesc.Streams[0], "/debcomprt.v1.Comprts/ExportComprt", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &comprtsExportComprtClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Comprts_ExportComprtClient interface {
+	Recv() (*ExportChunk, error)
+	grpc.ClientStream
+}
+
+type comprtsExportComprtClient struct {
+	grpc.ClientStream
+}
+
+func (x *comprtsExportComprtClient) Recv() (*ExportChunk, error) {
+	m := new(ExportChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *comprtsClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, "/debcomprt.v1.Comprts/ListJobs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *comprtsClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, "/debcomprt.v1.Comprts/GetJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *comprtsClient) StreamJobOutput(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (Comprts_StreamJobOutputClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Comprts_ServiceDesc.Streams[1], "/debcomprt.v1.Comprts/StreamJobOutput", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &comprtsStreamJobOutputClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Comprts_StreamJobOutputClient interface {
+	Recv() (*JobOutput, error)
+	grpc.ClientStream
+}
+
+type comprtsStreamJobOutputClient struct {
+	grpc.ClientStream
+}
+
+func (x *comprtsStreamJobOutputClient) Recv() (*JobOutput, error) {
+	m := new(JobOutput)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ComprtsServer is the server API for Comprts service.
+// All implementations must embed UnimplementedComprtsServer
+// for forward compatibility
+type ComprtsServer interface {
+	// Lists the comprts created on the host (see the inventory command).
+	ListComprts(context.Context, *ListComprtsRequest) (*ListComprtsResponse, error)
+	CreateComprt(context.Context, *CreateComprtRequest) (*Job, error)
+	DeleteComprt(context.Context, *DeleteComprtRequest) (*Job, error)
+	// Runs a command in a comprt (see the provision command).
+	ExecComprt(context.Context, *ExecComprtRequest) (*Job, error)
+	// Streams a comprt as a tarball.
+	ExportComprt(*ExportComprtRequest, Comprts_ExportComprtServer) error
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// Streams the job's output from the start, until the job finishes.
+	StreamJobOutput(*GetJobRequest, Comprts_StreamJobOutputServer) error
+	mustEmbedUnimplementedComprtsServer()
+}
+
+// UnimplementedComprtsServer must be embedded to have forward compatible implementations.
+type UnimplementedComprtsServer struct {
+}
+
+func (UnimplementedComprtsServer) ListComprts(context.Context, *ListComprtsRequest) (*ListComprtsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListComprts not implemented")
+}
+func (UnimplementedComprtsServer) CreateComprt(context.Context, *CreateComprtRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateComprt not implemented")
+}
+func (UnimplementedComprtsServer) DeleteComprt(context.Context, *DeleteComprtRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteComprt not implemented")
+}
+func (UnimplementedComprtsServer) ExecComprt(context.Context, *ExecComprtRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExecComprt not implemented")
+}
+func (UnimplementedComprtsServer) ExportComprt(*ExportComprtRequest, Comprts_ExportComprtServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportComprt not implemented")
+}
+func (UnimplementedComprtsServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedComprtsServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedComprtsServer) StreamJobOutput(*GetJobRequest, Comprts_StreamJobOutputServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamJobOutput not implemented")
+}
+func (UnimplementedComprtsServer) mustEmbedUnimplementedComprtsServer() {}
+
+// UnsafeComprtsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ComprtsServer will
+// result in compilation errors.
+type UnsafeComprtsServer interface {
+	mustEmbedUnimplementedComprtsServer()
+}
+
+func RegisterComprtsServer(s grpc.ServiceRegistrar, srv ComprtsServer) {
+	s.RegisterService(&Comprts_ServiceDesc, srv)
+}
+
+func _Comprts_ListComprts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListComprtsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ComprtsServer).ListComprts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/debcomprt.v1.Comprts/ListComprts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ComprtsServer).ListComprts(ctx, req.(*ListComprtsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Comprts_CreateComprt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateComprtRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ComprtsServer).CreateComprt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/debcomprt.v1.Comprts/CreateComprt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ComprtsServer).CreateComprt(ctx, req.(*CreateComprtRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Comprts_DeleteComprt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteComprtRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ComprtsServer).DeleteComprt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/debcomprt.v1.Comprts/DeleteComprt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ComprtsServer).DeleteComprt(ctx, req.(*DeleteComprtRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Comprts_ExecComprt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecComprtRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ComprtsServer).ExecComprt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/debcomprt.v1.Comprts/ExecComprt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ComprtsServer).ExecComprt(ctx, req.(*ExecComprtRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Comprts_ExportComprt_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportComprtRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ComprtsServer).ExportComprt(m, &comprtsExportComprtServer{stream})
+}
+
+type Comprts_ExportComprtServer interface {
+	Send(*ExportChunk) error
+	grpc.ServerStream
+}
+
+type comprtsExportComprtServer struct {
+	grpc.ServerStream
+}
+
+func (x *comprtsExportComprtServer) Send(m *ExportChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Comprts_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ComprtsServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/debcomprt.v1.Comprts/ListJobs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ComprtsServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Comprts_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ComprtsServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/debcomprt.v1.Comprts/GetJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ComprtsServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Comprts_StreamJobOutput_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetJobRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ComprtsServer).StreamJobOutput(m, &comprtsStreamJobOutputServer{stream})
+}
+
+type Comprts_StreamJobOutputServer interface {
+	Send(*JobOutput) error
+	grpc.ServerStream
+}
+
+type comprtsStreamJobOutputServer struct {
+	grpc.ServerStream
+}
+
+func (x *comprtsStreamJobOutputServer) Send(m *JobOutput) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Comprts_ServiceDesc is the grpc.ServiceDesc for Comprts service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Comprts_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "debcomprt.v1.Comprts",
+	HandlerType: (*ComprtsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListComprts",
+			Handler:    _Comprts_ListComprts_Handler,
+		},
+		{
+			MethodName: "CreateComprt",
+			Handler:    _Comprts_CreateComprt_Handler,
+		},
+		{
+			MethodName: "DeleteComprt",
+			Handler:    _Comprts_DeleteComprt_Handler,
+		},
+		{
+			MethodName: "ExecComprt",
+			Handler:    _Comprts_ExecComprt_Handler,
+		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _Comprts_ListJobs_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _Comprts_GetJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExportComprt",
+			Handler:       _Comprts_ExportComprt_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamJobOutput",
+			Handler:       _Comprts_StreamJobOutput_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "debcomprt.proto",
+}
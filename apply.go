@@ -0,0 +1,370 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A type used to declare the comprts to create with the apply command.
+type applyFile struct {
+	Comprts []applyComprt `json:"comprts"`
+
+	// The dir of the file, relative paths in the file are relative to it.
+	dir string
+}
+
+// A type used to declare a comprt to create.
+type applyComprt struct {
+	// Used to prefix the comprt's output.
+	Name     string   `json:"name"`
+	CodeName string   `json:"codename"`
+	Target   string   `json:"target"`
+	Mirrors  []string `json:"mirrors,omitempty"`
+	// The create command's flags (e.g. '--alias=python3').
+	Flags []string `json:"flags,omitempty"`
+	// The args passed to debootstrap as is (e.g. '--variant=minbase').
+	Debootstrap []string `json:"debootstrap,omitempty"`
+	// The comprts created before this one, this one is not created if any of
+	// them fail.
+	After []string `json:"after,omitempty"`
+}
+
+// A number as json writes it, yaml numbers that are not (e.g. 0600) are kept as
+// strings.
+var reJsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// Decode the yaml into v, fields that are not known are an error. The yaml is
+// decoded by way of json, that way v's json tags are what name its fields in
+// either (json being yaml as well).
+func decodeStrictYaml(yamlBytes []byte, v interface{}) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal(yamlBytes, &node); err != nil {
+		return err
+	}
+	doc, err := yamlNodeValue(&node)
+	if err != nil {
+		return err
+	}
+	jsonBytes, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// Get the yaml node as a value json can encode. Scalars other than json's own
+// numbers, bools and null are kept as written, e.g. a mode of 0600 is the string
+// "0600" instead of the octal int 384.
+func yamlNodeValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) < 1 {
+			return nil, nil
+		}
+		return yamlNodeValue(node.Content[0])
+	case yaml.AliasNode:
+		return yamlNodeValue(node.Alias)
+	case yaml.SequenceNode:
+		var values []interface{} = []interface{}{}
+		for _, item := range node.Content {
+			value, err := yamlNodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case yaml.MappingNode:
+		var values map[string]interface{} = make(map[string]interface{})
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			var key *yaml.Node = node.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %v: a key must be a scalar", key.Line)
+			} else if _, ok := values[key.Value]; ok {
+				return nil, fmt.Errorf("line %v: %v is set more than once", key.Line, key.Value)
+			}
+			value, err := yamlNodeValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			values[key.Value] = value
+		}
+		return values, nil
+	}
+
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var value bool
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	case "!!int", "!!float":
+		if reJsonNumber.MatchString(node.Value) {
+			return json.Number(node.Value), nil
+		}
+	}
+	return node.Value, nil
+}
+
+// Read in the yaml file, fields that are not known are an error as they are
+// likely a typo.
+func loadApplyFile(applyPath string) (*applyFile, error) {
+	applyBytes, err := os.ReadFile(applyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var file applyFile
+	if err := decodeStrictYaml(applyBytes, &file); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %w", applyPath, err)
+	}
+
+	absApplyPath, err := filepath.Abs(applyPath)
+	if err != nil {
+		return nil, err
+	}
+	file.dir = filepath.Dir(absApplyPath)
+	for i := range file.Comprts {
+		if file.Comprts[i].Target != "" && !filepath.IsAbs(file.Comprts[i].Target) {
+			file.Comprts[i].Target = filepath.Join(file.dir, file.Comprts[i].Target)
+		}
+	}
+
+	if err := file.validate(); err != nil {
+		return nil, fmt.Errorf("%v: %w", applyPath, err)
+	}
+	return &file, nil
+}
+
+// Check the comprts can be created, each must have its own name and target and
+// the comprts created before another cannot depend on it.
+func (file *applyFile) validate() error {
+	if len(file.Comprts) < 1 {
+		return fmt.Errorf("no comprts are declared")
+	}
+
+	var names, targets map[string]bool = make(map[string]bool), make(map[string]bool)
+	for _, comprt := range file.Comprts {
+		if reCacheName.FindStringIndex(comprt.Name) == nil {
+			return fmt.Errorf("%q is not a valid comprt name", comprt.Name)
+		} else if names[comprt.Name] {
+			return fmt.Errorf("more than one comprt is named %v", comprt.Name)
+		} else if targets[comprt.Target] {
+			return fmt.Errorf("more than one comprt is created at %v", comprt.Target)
+		}
+		if _, err := comprt.args(); err != nil {
+			return fmt.Errorf("%v: %w", comprt.Name, err)
+		}
+		names[comprt.Name], targets[comprt.Target] = true, true
+	}
+
+	// a comprt is visited once every comprt it is after has been
+	var visited map[string]bool = make(map[string]bool)
+	for len(visited) < len(file.Comprts) {
+		var progressed bool
+		for _, comprt := range file.Comprts {
+			var ready bool = !visited[comprt.Name]
+			for _, name := range comprt.After {
+				if !names[name] {
+					return fmt.Errorf("%v is after %v, which is not declared", comprt.Name, name)
+				}
+				ready = ready && visited[name]
+			}
+			if ready {
+				visited[comprt.Name], progressed = true, true
+			}
+		}
+		if !progressed {
+			return fmt.Errorf("the comprts cannot be ordered, some are (indirectly) after themselves")
+		}
+	}
+
+	return nil
+}
+
+// Get the debcomprt args that create the comprt. Each comprt is given its own
+// lockfile, so comprts created together do not write over each other's.
+func (comprt applyComprt) args() ([]string, error) {
+	var flags []string = comprt.Flags
+	var lockfileSet bool
+	for _, flag := range flags {
+		lockfileSet = lockfileSet || flag == "--lockfile" || strings.HasPrefix(flag, "--lockfile=")
+	}
+	if !lockfileSet {
+		flags = append(append([]string{}, flags...), "--lockfile="+comprt.Name+".lock.json")
+	}
+
+	return createRequest{
+		CodeName:    comprt.CodeName,
+		Target:      comprt.Target,
+		Mirrors:     comprt.Mirrors,
+		Flags:       flags,
+		Debootstrap: comprt.Debootstrap,
+	}.args()
+}
+
+// A type used to write a comprt's output a line at a time, each line prefixed by
+// the comprt's name. The lines of comprts created together are interleaved.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	line   bytes.Buffer
+}
+
+func (writer *prefixWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		writer.line.WriteByte(b)
+		if b == '\n' {
+			if err := writer.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+// Write out what is left of the line (if anything).
+func (writer *prefixWriter) flush() error {
+	if writer.line.Len() == 0 {
+		return nil
+	}
+	if !bytes.HasSuffix(writer.line.Bytes(), []byte("\n")) {
+		writer.line.WriteByte('\n')
+	}
+
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	_, err := writer.w.Write(append([]byte(writer.prefix), writer.line.Bytes()...))
+	writer.line.Reset()
+	return err
+}
+
+// Create the comprt by running debcomprt (exe) with the global args (e.g.
+// --retries) and the create command.
+func runApplyComprt(exe string, globalArgs []string, comprt applyComprt, dir string, mu *sync.Mutex, w io.Writer) error {
+	args, err := comprt.args()
+	if err != nil {
+		return err
+	}
+
+	out := &prefixWriter{mu: mu, w: w, prefix: "[" + comprt.Name + "] "}
+	cmd := exec.Command(exe, append(append([]string{}, globalArgs...), args...)...)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err = cmd.Run()
+	out.flush()
+
+	return err
+}
+
+// Create the comprts, with at most parallel of them being created at once. A
+// comprt is only created once the comprts it is after have been, a comprt that
+// fails does not stop the comprts that are not after it.
+func (file *applyFile) apply(exe string, globalArgs []string, parallel int, w io.Writer) error {
+	type applyResult struct {
+		name string
+		err  error
+	}
+	var mu sync.Mutex
+	var results chan applyResult = make(chan applyResult)
+	var started, created, failed map[string]bool = make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	var finished, running int
+	var failures []string
+
+	report := func(format string, a ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "%s: "+format+"\n", append([]interface{}{progname}, a...)...)
+	}
+
+	for finished < len(file.Comprts) {
+		for _, comprt := range file.Comprts {
+			if started[comprt.Name] || running >= parallel {
+				continue
+			}
+
+			var ready bool = true
+			var failedBefore string
+			for _, name := range comprt.After {
+				if failed[name] {
+					failedBefore = name
+				} else if !created[name] {
+					ready = false
+				}
+			}
+			if failedBefore != "" {
+				started[comprt.Name], failed[comprt.Name] = true, true
+				finished++
+				failures = append(failures, comprt.Name)
+				report("skipped %v, %v was not created", comprt.Name, failedBefore)
+				continue
+			} else if !ready {
+				continue
+			}
+
+			started[comprt.Name] = true
+			running++
+			go func(comprt applyComprt, start time.Time) {
+				err := runApplyComprt(exe, globalArgs, comprt, file.dir, &mu, w)
+				if err == nil {
+					report("created %v (%v) in %v", comprt.Name, comprt.Target, time.Since(start).Round(time.Second))
+				} else {
+					report("unable to create %v (%v): %v", comprt.Name, comprt.Target, err)
+				}
+				results <- applyResult{comprt.Name, err}
+			}(comprt, time.Now())
+		}
+
+		if running == 0 {
+			continue
+		}
+		result := <-results
+		running--
+		finished++
+		if result.err != nil {
+			failed[result.name] = true
+			failures = append(failures, result.name)
+		} else {
+			created[result.name] = true
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%v of %v comprts were not created: %v", len(failures), len(file.Comprts), strings.Join(failures, ", "))
+	}
+	return nil
+}
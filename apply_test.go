@@ -0,0 +1,195 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadApplyFile(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// the targets are made by the creates
+	var applyPath string = filepath.Join(tempDirPath, "comprts.yaml")
+	if err := createTestFile(applyPath, `comprts:
+  - name: base
+    codename: `+testCodeCame+`
+    target: base
+  - name: py
+    codename: `+testCodeCame+`
+    target: py
+    flags: ["--alias=python3"]
+    debootstrap:
+      - --variant=minbase
+    after: [base]
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := loadApplyFile(applyPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if file.Comprts[1].Target != filepath.Join(tempDirPath, "py") {
+		t.Fatalf("expected the target to be relative to the file, got %v", file.Comprts[1].Target)
+	}
+
+	args, err := file.Comprts[1].args()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string = []string{"create", "--parents", "--alias=python3", "--lockfile=py.lock.json", testCodeCame, filepath.Join(tempDirPath, "py"), "--", "--variant=minbase"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("expected %v, got %v", expected, args)
+	}
+
+	// json is yaml too, and a field that is not known is likely a typo
+	if err := createTestFile(applyPath, `{"comprts": [{"name": "base", "codename": "`+testCodeCame+`", "target": "base"}]}`); err != nil {
+		t.Fatal(err)
+	} else if _, err := loadApplyFile(applyPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(applyPath, "comprts:\n  - name: base\n    codename: "+testCodeCame+"\n    target: base\n    aftr: [py]\n"); err != nil {
+		t.Fatal(err)
+	} else if _, err := loadApplyFile(applyPath); err == nil || !strings.Contains(err.Error(), "aftr") {
+		t.Fatalf("expected the unknown field to be an error, got %v", err)
+	}
+}
+
+func TestDecodeStrictYaml(t *testing.T) {
+	var v struct {
+		Mode    string            `json:"mode"`
+		Uid     int               `json:"uid"`
+		Created string            `json:"created"`
+		Sudo    bool              `json:"sudo"`
+		Labels  map[string]string `json:"labels"`
+	}
+	if err := decodeStrictYaml([]byte("mode: 0600\nuid: 2000\ncreated: 2021-01-01\nsudo: true\nlabels: {team: ci}\n"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Mode != "0600" || v.Uid != 2000 || v.Created != "2021-01-01" || !v.Sudo || v.Labels["team"] != "ci" {
+		t.Fatalf("the yaml was not decoded as written: %+v", v)
+	}
+
+	for _, contents := range []string{
+		"mode: 0600\nmode: 0644\n",
+		"uid: 2000\nuser: foo\n",
+		"uid: [2000\n",
+	} {
+		if err := decodeStrictYaml([]byte(contents), &v); err == nil {
+			t.Fatalf("expected an error decoding %q", contents)
+		}
+	}
+}
+
+func TestApplyFileValidate(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var a, b string = filepath.Join(tempDirPath, "a"), filepath.Join(tempDirPath, "b")
+	for _, tc := range []struct {
+		comprts []applyComprt
+		err     string
+	}{
+		{nil, "no comprts"},
+		{[]applyComprt{{Name: "a", CodeName: testCodeCame, Target: a}, {Name: "a", CodeName: testCodeCame, Target: b}}, "more than one comprt is named"},
+		{[]applyComprt{{Name: "a", CodeName: testCodeCame, Target: a}, {Name: "b", CodeName: testCodeCame, Target: a}}, "more than one comprt is created"},
+		{[]applyComprt{{Name: "a", CodeName: testCodeCame, Target: a, After: []string{"c"}}}, "not declared"},
+		{[]applyComprt{{Name: "a", CodeName: testCodeCame, Target: a, After: []string{"b"}}, {Name: "b", CodeName: testCodeCame, Target: b, After: []string{"a"}}}, "cannot be ordered"},
+		{[]applyComprt{{Name: "a", Target: a}}, "codename is required"},
+	} {
+		file := &applyFile{Comprts: tc.comprts}
+		if err := file.validate(); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("expected an error containing %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	writer := &prefixWriter{mu: &mu, w: &buf, prefix: "[py] "}
+
+	for _, p := range []string{"I: Retrieving ", "Release\nI: Val", "idating\n", "done"} {
+		if _, err := writer.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var expected string = "[py] I: Retrieving Release\n[py] I: Validating\n[py] done\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestApply(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// stands in for debcomprt, failing to create the comprt at bad
+	var exePath string = filepath.Join(tempDirPath, "debcomprt")
+	if err := createTestFile(exePath, `#!/bin/sh
+for arg; do target="$arg"; done
+echo "creating $target with $1"
+case "$target" in
+    */bad) exit 1 ;;
+esac
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	file := &applyFile{dir: tempDirPath, Comprts: []applyComprt{
+		{Name: "base", CodeName: testCodeCame, Target: filepath.Join(tempDirPath, "base")},
+		{Name: "bad", CodeName: testCodeCame, Target: filepath.Join(tempDirPath, "bad")},
+		{Name: "py", CodeName: testCodeCame, Target: filepath.Join(tempDirPath, "py"), After: []string{"base"}},
+		{Name: "node", CodeName: testCodeCame, Target: filepath.Join(tempDirPath, "node"), After: []string{"bad"}},
+	}}
+	var buf bytes.Buffer
+	err = file.apply(exePath, []string{"--retries=1"}, 2, &buf)
+	if err == nil || !strings.Contains(err.Error(), "2 of 4 comprts were not created") {
+		t.Fatalf("expected bad and node to not be created, got %v", err)
+	}
+
+	for _, line := range []string{
+		"[base] creating " + filepath.Join(tempDirPath, "base") + " with --retries=1",
+		"[py] creating " + filepath.Join(tempDirPath, "py") + " with --retries=1",
+		progname + ": skipped node, bad was not created",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Fatalf("expected the line %q in:\n%v", line, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "[node]") {
+		t.Fatalf("node was created after bad failed:\n%v", buf.String())
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	aptSourcesListDir = "/etc/apt/sources.list.d"
+	aptTrustedGpgDir  = "/etc/apt/trusted.gpg.d"
+)
+
+// Matches the names apt accepts for the files in sources.list.d and
+// trusted.gpg.d.
+var reAptRepoName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// A type used to describe a third-party apt repository to install into the
+// comprt.
+type aptRepo struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Suite      string   `json:"suite"`
+	Components []string `json:"components,omitempty"`
+	// The URL or path of the keyring (armored or not) that signs the repo.
+	Key string `json:"key,omitempty"`
+
+	// The key as fetched onto the host.
+	keyPath    string
+	keyArmored bool
+}
+
+// Parse a repo passed in as 'NAME=URL SUITE [COMPONENT...]' (e.g.
+// 'docker=https://download.docker.com/linux/debian buster stable').
+func parseAptRepo(value string) (aptRepo, error) {
+	i := strings.Index(value, "=")
+	if i < 1 {
+		return aptRepo{}, fmt.Errorf("%v is not a properly formatted repo (e.g. NAME=URL SUITE [COMPONENT...])", value)
+	}
+
+	fields := strings.Fields(value[i+1:])
+	if len(fields) < 2 {
+		return aptRepo{}, fmt.Errorf("%v is not a properly formatted repo (e.g. NAME=URL SUITE [COMPONENT...])", value)
+	}
+
+	return aptRepo{Name: value[:i], URL: fields[0], Suite: fields[1], Components: fields[2:]}, nil
+}
+
+// Set the keys of the repos from the keys passed in as 'NAME=URL|PATH'.
+func setAptRepoKeys(repos []aptRepo, keys []string) error {
+	for _, key := range keys {
+		i := strings.Index(key, "=")
+		if i < 1 {
+			return fmt.Errorf("%v is not a properly formatted repo key (e.g. NAME=URL|PATH)", key)
+		}
+
+		var found bool
+		for j := range repos {
+			if repos[j].Name == key[:i] {
+				repos[j].Key, found = key[i+1:], true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no repo is named %v for the key %v", key[:i], key[i+1:])
+		}
+	}
+
+	return nil
+}
+
+// Check that the repo can be installed into the comprt.
+func (repo aptRepo) validate() error {
+	if reAptRepoName.FindStringIndex(repo.Name) == nil {
+		return fmt.Errorf("%v is not a valid repo name", repo.Name)
+	} else if repo.URL == "" || repo.Suite == "" {
+		return fmt.Errorf("the repo %v needs both a url and a suite", repo.Name)
+	} else if strings.HasSuffix(repo.Suite, "/") && len(repo.Components) > 0 {
+		return fmt.Errorf("the repo %v has a flat suite, which cannot have components", repo.Name)
+	}
+
+	return nil
+}
+
+// Check whether the repo's key is fetched over http(s).
+func (repo aptRepo) keyIsURL() bool {
+	return strings.HasPrefix(repo.Key, "http://") || strings.HasPrefix(repo.Key, "https://")
+}
+
+// Get the path of the repo's sources file in the comprt.
+func (repo aptRepo) listPath() string {
+	return filepath.Join(aptSourcesListDir, repo.Name+".list")
+}
+
+// Get the contents of the repo's sources file.
+func (repo aptRepo) listContents() string {
+	return strings.Join(append([]string{"deb", repo.URL, repo.Suite}, repo.Components...), " ") + "\n"
+}
+
+// Get the path of the repo's key in the comprt, apt only reads armored keys
+// that end in '.asc'.
+func (repo aptRepo) trustedKeyPath() string {
+	if repo.keyArmored {
+		return filepath.Join(aptTrustedGpgDir, repo.Name+".asc")
+	}
+
+	return filepath.Join(aptTrustedGpgDir, repo.Name+".gpg")
+}
+
+// Fetch the keys of the repos onto the host, keys fetched over http(s) are
+// saved in the dir passed in.
+func fetchAptRepoKeys(repos []aptRepo, dir string) ([]aptRepo, error) {
+	var fetchedRepos []aptRepo
+	for _, repo := range repos {
+		if repo.Key == "" {
+			fetchedRepos = append(fetchedRepos, repo)
+			continue
+		}
+
+		repo.keyPath = repo.Key
+		if repo.keyIsURL() {
+			repo.keyPath = filepath.Join(dir, repo.Name+".key")
+			if err := downloadFile(repo.Key, repo.keyPath); err != nil {
+				return nil, fmt.Errorf("unable to fetch the key of the repo %v: %w", repo.Name, err)
+			}
+		}
+
+		key, err := os.ReadFile(repo.keyPath)
+		if err != nil {
+			return nil, err
+		}
+		repo.keyArmored = bytes.Contains(key, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----"))
+		fetchedRepos = append(fetchedRepos, repo)
+	}
+
+	return fetchedRepos, nil
+}
+
+// Download the URL into the file passed in.
+func downloadFile(url, path string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v returned %v", url, resp.Status)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Install the repo and its key (if it has one) into the comprt.
+func (repo aptRepo) write(target string) error {
+	for _, dir := range []string{aptSourcesListDir, aptTrustedGpgDir} {
+		if err := os.MkdirAll(filepath.Join(target, dir), os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	if repo.keyPath != "" {
+		key, err := os.ReadFile(repo.keyPath)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(target, repo.trustedKeyPath()), key, OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(
+		filepath.Join(target, repo.listPath()),
+		[]byte(repo.listContents()),
+		OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R,
+	)
+}
+
+// Get the mmdebstrap customize hooks that install the repo into the comprt, the
+// same as write does.
+func (repo aptRepo) mmdebstrapArgs() []string {
+	var args []string
+	if repo.keyPath != "" {
+		args = append(args, "--customize-hook=upload "+shellQuote(repo.keyPath)+" "+shellQuote(repo.trustedKeyPath()))
+	}
+
+	return append(args, fmt.Sprintf(
+		"--customize-hook=printf '%%s' %v > \"$1\"%v",
+		shellQuote(repo.listContents()),
+		shellQuote(repo.listPath()),
+	))
+}
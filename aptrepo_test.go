@@ -0,0 +1,126 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testArmoredKey = "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nmQINBFit2ioBEADhWpZ8/wvZ6hUTiXOwQHXMAlaFHcPH9hAtr4F1y2+OYdbtMuth\n-----END PGP PUBLIC KEY BLOCK-----\n"
+
+func TestParseAptRepo(t *testing.T) {
+	repos := []aptRepo{}
+	for _, value := range []string{
+		"docker=https://download.docker.com/linux/debian buster stable",
+		"obs=https://download.opensuse.org/repositories/home:/foo/Debian_10/ /",
+	} {
+		repo, err := parseAptRepo(value)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := repo.validate(); err != nil {
+			t.Fatal(err)
+		}
+		repos = append(repos, repo)
+	}
+
+	var expected []aptRepo = []aptRepo{
+		{Name: "docker", URL: "https://download.docker.com/linux/debian", Suite: "buster", Components: []string{"stable"}},
+		{Name: "obs", URL: "https://download.opensuse.org/repositories/home:/foo/Debian_10/", Suite: "/", Components: []string{}},
+	}
+	if !reflect.DeepEqual(repos, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, repos)
+	}
+
+	if err := setAptRepoKeys(repos, []string{"docker=https://download.docker.com/linux/debian/gpg"}); err != nil {
+		t.Fatal(err)
+	} else if repos[0].Key != "https://download.docker.com/linux/debian/gpg" {
+		t.Fatalf("the key was not set for the repo: %+v", repos[0])
+	}
+	if err := setAptRepoKeys(repos, []string{"dockr=./docker.gpg"}); err == nil {
+		t.Fatal("a key for a repo that does not exist was accepted")
+	}
+
+	for _, value := range []string{"https://download.docker.com/linux/debian buster", "docker=https://download.docker.com/linux/debian"} {
+		if _, err := parseAptRepo(value); err == nil {
+			t.Fatalf("an improperly formatted repo was accepted: %v", value)
+		}
+	}
+}
+
+func TestFetchAptRepoKeys(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gpg" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, testArmoredKey)
+	}))
+	defer server.Close()
+
+	var binaryKeyPath string = filepath.Join(tempDirPath, "obs.gpg")
+	if err := createTestFile(binaryKeyPath, "\x99\x02\x0d\x04"); err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := fetchAptRepoKeys([]aptRepo{
+		{Name: "docker", URL: "https://download.docker.com/linux/debian", Suite: "buster", Components: []string{"stable"}, Key: server.URL + "/gpg"},
+		{Name: "obs", URL: "https://download.opensuse.org/repositories/home:/foo/Debian_10/", Suite: "/", Key: binaryKeyPath},
+	}, tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var targetPath string = filepath.Join(tempDirPath, "target")
+	for _, repo := range repos {
+		if err := repo.write(targetPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, expected := range map[string]string{
+		"/etc/apt/trusted.gpg.d/docker.asc":   testArmoredKey,
+		"/etc/apt/trusted.gpg.d/obs.gpg":      "\x99\x02\x0d\x04",
+		"/etc/apt/sources.list.d/docker.list": "deb https://download.docker.com/linux/debian buster stable\n",
+		"/etc/apt/sources.list.d/obs.list":    "deb https://download.opensuse.org/repositories/home:/foo/Debian_10/ /\n",
+	} {
+		contents, err := os.ReadFile(filepath.Join(targetPath, path))
+		if err != nil {
+			t.Fatal(err)
+		} else if string(contents) != expected {
+			t.Fatalf("expected %q in %v, got %q", expected, path, contents)
+		}
+	}
+
+	if !strings.Contains(strings.Join(repos[1].mmdebstrapArgs(), "\n"), "--customize-hook=upload '"+binaryKeyPath+"' '/etc/apt/trusted.gpg.d/obs.gpg'") {
+		t.Fatalf("the key was not uploaded by mmdebstrap: %v", repos[1].mmdebstrapArgs())
+	}
+
+	if _, err := fetchAptRepoKeys([]aptRepo{{Name: "docker", Key: server.URL + "/nokey"}}, tempDirPath); err == nil {
+		t.Fatal("a key that could not be fetched was accepted")
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"runtime"
+	"strings"
+)
+
+// Mappings of golang's architecture names to debian's. For reference:
+// https://wiki.debian.org/SupportedArchitectures
+var debianArchMappings = map[string]string{
+	"386":      "i386",
+	"amd64":    "amd64",
+	"arm":      "armhf",
+	"arm64":    "arm64",
+	"mips64le": "mips64el",
+	"mipsle":   "mipsel",
+	"ppc64le":  "ppc64el",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// Get the debian architecture of the host.
+func hostDebianArch() string {
+	if arch, ok := debianArchMappings[runtime.GOARCH]; ok {
+		return arch
+	}
+
+	return runtime.GOARCH
+}
+
+// Get the debian architecture a comprt is created for, debootstrap defaults
+// to the host's architecture unless --arch is passed through to it.
+func comprtArch(passThroughFlags []string) string {
+	for _, flag := range passThroughFlags {
+		if strings.HasPrefix(flag, "--arch=") {
+			return strings.TrimPrefix(flag, "--arch=")
+		}
+	}
+
+	return hostDebianArch()
+}
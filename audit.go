@@ -0,0 +1,223 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// The file in debcomprt's data dir that operations on comprts are appended
+	// to, one json record per line.
+	auditLogFile = "audit.log"
+
+	auditSuccess = "success"
+	auditFailure = "failure"
+
+	redactedValue = "REDACTED"
+)
+
+// The commands that change (or run things in) a comprt, these are audited.
+var auditedCommands = []string{"boot", "chroot", "cleanup", "clone", "create", "delete", "export", "gc", "provision", "register-sbuild", "register-schroot", "restore", "snapshot", "upgrade"}
+
+// The names of the flags whose values are kept out of the audit log.
+var secretFlagNames = []string{"crypt-password", "password", "secret"}
+
+// Every name a secret flag can be passed by, its aliases (e.g. -p) are added from
+// the cli's flag definitions by setSecretFlags.
+var secretFlags = append([]string{}, secretFlagNames...)
+
+// Add the aliases of the secret flags defined by the app (and its commands) to
+// the flags kept out of the audit log.
+func setSecretFlags(app *cli.App) {
+	var flags []cli.Flag = append([]cli.Flag{}, app.Flags...)
+	var commands []*cli.Command = append([]*cli.Command{}, app.Commands...)
+	for len(commands) > 0 {
+		flags = append(flags, commands[0].Flags...)
+		commands = append(commands[1:], commands[0].Subcommands...)
+	}
+
+	for _, flag := range flags {
+		var names []string = flag.Names()
+		if len(names) < 1 || !stringInArr(names[0], &secretFlagNames) {
+			continue
+		}
+		for _, name := range names {
+			if !stringInArr(name, &secretFlags) {
+				secretFlags = append(secretFlags, name)
+			}
+		}
+	}
+}
+
+// A type used to record an operation on a comprt.
+type auditRecord struct {
+	Time time.Time `json:"time"`
+	// The user that ran debcomprt, the user that ran sudo if debcomprt was ran
+	// with it.
+	User    string   `json:"user"`
+	Uid     string   `json:"uid"`
+	Command string   `json:"command"`
+	Target  string   `json:"target,omitempty"`
+	Args    []string `json:"args"`
+	Result  string   `json:"result"`
+	Error   string   `json:"error,omitempty"`
+	// How long each phase of a create took, for the metrics of the serve command.
+	Phases []phaseDuration `json:"phases,omitempty"`
+	// The caches mounted by the operation that were warm and cold.
+	CacheHits   int `json:"cache_hits,omitempty"`
+	CacheMisses int `json:"cache_misses,omitempty"`
+}
+
+// Get the name of the user that ran debcomprt, the user that ran sudo is used if
+// debcomprt was ran with it.
+func auditUser(current *user.User) string {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" && current.Uid == fmt.Sprint(rootUid) {
+		return sudoUser + " (as " + current.Username + ")"
+	}
+
+	return current.Username
+}
+
+// Get the args with the values of the secret flags replaced (e.g. --password).
+func redactArgs(args []string) []string {
+	var redacted []string = append([]string{}, args...)
+	for i, arg := range redacted {
+		var name string = strings.TrimLeft(arg, "-")
+		if !strings.HasPrefix(arg, "-") || arg == "--" {
+			continue
+		}
+		if j := strings.Index(name, "="); j > -1 {
+			if stringInArr(name[:j], &secretFlags) {
+				redacted[i] = arg[:len(arg)-len(name)] + name[:j+1] + redactedValue
+			}
+		} else if stringInArr(name, &secretFlags) && i+1 < len(redacted) {
+			redacted[i+1] = redactedValue
+		}
+	}
+
+	return redacted
+}
+
+// Create the record of an operation, opErr being why the operation failed (nil
+// if it succeeded).
+func newAuditRecord(current *user.User, command, target string, args []string, opErr error) auditRecord {
+	var record auditRecord = auditRecord{
+		Time:    time.Now().UTC(),
+		User:    auditUser(current),
+		Uid:     current.Uid,
+		Command: command,
+		Target:  target,
+		Args:    redactArgs(args),
+		Result:  auditSuccess,
+	}
+	if target != "" {
+		if absTarget, err := filepath.Abs(target); err == nil {
+			record.Target = absTarget
+		}
+	}
+	if opErr != nil {
+		record.Result, record.Error = auditFailure, opErr.Error()
+	}
+
+	return record
+}
+
+// Append the record to the audit log at path. Only the owner can read the log, as
+// it shows what was ran on the host.
+func appendAuditRecord(path string, record auditRecord) error {
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return err
+	}
+	auditLog, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, OS_USER_R|OS_USER_W)
+	if err != nil {
+		return err
+	}
+	// a single write keeps the records of concurrent runs from interleaving
+	if _, err := auditLog.Write(append(recordBytes, '\n')); err != nil {
+		auditLog.Close()
+		return err
+	}
+
+	return auditLog.Close()
+}
+
+// Send the record to syslog (which journald also reads from).
+func syslogAuditRecord(record auditRecord) error {
+	writer, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_INFO, progname)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	var msg string = fmt.Sprintf(
+		"user=%v command=%v target=%v result=%v args=%q",
+		record.User,
+		record.Command,
+		record.Target,
+		record.Result,
+		strings.Join(record.Args, " "),
+	)
+	if record.Error != "" {
+		msg += fmt.Sprintf(" error=%q", record.Error)
+		return writer.Err(msg)
+	}
+
+	return writer.Info(msg)
+}
+
+// Get how long each phase of creating the comprt took. A comprt created in a
+// re-executed debcomprt has its phases in its metadata, otherwise they were timed
+// by this debcomprt.
+func auditedPhases(target string) []phaseDuration {
+	if metadata, err := readComprtMetadata(target); err == nil && metadata != nil && len(metadata.Phases) > 0 {
+		return metadata.Phases
+	}
+
+	return createPhases.phases()
+}
+
+// Audit the operation ran with the args, opErr being why it failed (nil if it
+// succeeded). Being unable to audit the operation is only warned about, the
+// operation has already been ran.
+func auditOperation(pconfs *progConfigs, current *user.User, args []string, opErr error) {
+	var record auditRecord = newAuditRecord(current, pconfs.command, pconfs.target, args, opErr)
+	record.CacheHits, record.CacheMisses = pconfs.cacheHits, pconfs.cacheMisses
+	if pconfs.command == "create" && opErr == nil {
+		record.Phases = auditedPhases(pconfs.target)
+	}
+	if err := appendAuditRecord(filepath.Join(progDataDir, auditLogFile), record); err != nil {
+		warnf("unable to audit the operation: %v", err)
+	}
+	if pconfs.syslog {
+		if err := syslogAuditRecord(record); err != nil {
+			warnf("unable to send the operation to syslog: %v", err)
+		}
+	}
+}
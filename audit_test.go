@@ -0,0 +1,126 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestRedactArgs(t *testing.T) {
+	var args []string = []string{"create", "--password", "hunter2", "--crypt-password=$6$foo", "--secret", "API_TOKEN=foo", "-q", "buster", "/srv/foo"}
+	var expected []string = []string{"create", "--password", redactedValue, "--crypt-password=" + redactedValue, "--secret", redactedValue, "-q", "buster", "/srv/foo"}
+	if redacted := redactArgs(args); !reflect.DeepEqual(redacted, expected) {
+		t.Fatalf("expected %v, got %v", expected, redacted)
+	} else if args[2] != "hunter2" {
+		t.Fatal("the args passed in were changed")
+	}
+}
+
+func TestRedactArgsAliases(t *testing.T) {
+	defer func(previous []string) { secretFlags = previous }(secretFlags)
+	setSecretFlags(&cli.App{
+		Commands: []*cli.Command{
+			{
+				Name: "create",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "crypt-password", Aliases: []string{"p"}},
+					&cli.BoolFlag{Name: "quiet", Aliases: []string{"q"}},
+				},
+			},
+		},
+	})
+
+	var args []string = []string{"create", "-p", "$6$foo", "-q", "buster", "/srv/foo"}
+	var expected []string = []string{"create", "-p", redactedValue, "-q", "buster", "/srv/foo"}
+	if redacted := redactArgs(args); !reflect.DeepEqual(redacted, expected) {
+		t.Fatalf("expected %v, got %v", expected, redacted)
+	}
+	args = []string{"create", "-p=$6$foo", "buster", "/srv/foo"}
+	expected = []string{"create", "-p=" + redactedValue, "buster", "/srv/foo"}
+	if redacted := redactArgs(args); !reflect.DeepEqual(redacted, expected) {
+		t.Fatalf("expected %v, got %v", expected, redacted)
+	}
+}
+
+func TestAuditUser(t *testing.T) {
+	var root *user.User = &user.User{Uid: "0", Username: "root"}
+	defer os.Unsetenv("SUDO_USER")
+
+	os.Unsetenv("SUDO_USER")
+	if name := auditUser(root); name != "root" {
+		t.Fatalf("expected root, got %v", name)
+	}
+
+	os.Setenv("SUDO_USER", "altaria")
+	if name := auditUser(root); name != "altaria (as root)" {
+		t.Fatalf("expected the user that ran sudo, got %v", name)
+	}
+}
+
+func TestAppendAuditRecord(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var current *user.User = &user.User{Uid: "0", Username: "root"}
+	var auditLogPath string = filepath.Join(tempDirPath, auditLogFile)
+	var records []auditRecord = []auditRecord{
+		newAuditRecord(current, "create", "/srv/foo", []string{"create", "buster", "/srv/foo"}, nil),
+		newAuditRecord(current, "chroot", "/srv/foo", []string{"chroot", "/srv/foo"}, errors.New("exited with status 1")),
+	}
+	for _, record := range records {
+		if err := appendAuditRecord(auditLogPath, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	auditLog, err := os.Open(auditLogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	if fileInfo, err := auditLog.Stat(); err != nil {
+		t.Fatal(err)
+	} else if fileInfo.Mode().Perm() != OS_USER_R|OS_USER_W {
+		t.Fatalf("expected the audit log to only be readable by its owner, got %v", fileInfo.Mode().Perm())
+	}
+
+	var i int
+	scanner := bufio.NewScanner(auditLog)
+	for ; scanner.Scan(); i++ {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		} else if record.Command != records[i].Command || record.Result != records[i].Result || record.Error != records[i].Error {
+			t.Fatalf("expected %+v, got %+v", records[i], record)
+		}
+	}
+	if i != len(records) {
+		t.Fatalf("expected %v records, got %v", len(records), i)
+	} else if records[1].Result != auditFailure {
+		t.Fatalf("a failed operation was recorded as %v", records[1].Result)
+	}
+}
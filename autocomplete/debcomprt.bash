@@ -0,0 +1,25 @@
+#!/bin/bash
+#
+# bash completion for debcomprt, to use it:
+#   source ./autocomplete/debcomprt.bash
+#
+# inspired by:
+# https://github.com/urfave/cli/blob/v2.3.0/autocomplete/bash_autocomplete
+
+_debcomprt_bash_autocomplete() {
+    if [ "${COMP_WORDS[0]}" != "source" ]; then
+        local cur opts
+        COMPREPLY=()
+        cur="${COMP_WORDS[COMP_CWORD]}"
+        if [[ "${cur}" == "-"* ]]; then
+            opts=$("${COMP_WORDS[@]:0:${COMP_CWORD}}" "${cur}" --generate-bash-completion)
+        else
+            opts=$("${COMP_WORDS[@]:0:${COMP_CWORD}}" --generate-bash-completion)
+        fi
+        # shellcheck disable=2207
+        COMPREPLY=($(compgen -W "${opts}" -- "${cur}"))
+        return 0
+    fi
+}
+
+complete -o bashdefault -o default -F _debcomprt_bash_autocomplete debcomprt
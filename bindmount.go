@@ -0,0 +1,183 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const readOnlyBindOption = "ro"
+
+// A type used to describe a host path bind mounted into the comprt.
+type bindMount struct {
+	hostPath   string
+	comprtPath string
+	readOnly   bool
+}
+
+// Parse a bind mount passed in as 'HOST_PATH[:COMPRT_PATH[:ro]]'. The comprt
+// path defaults to the host path.
+func parseBindMount(value string) (bindMount, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) > 3 || fields[0] == "" {
+		return bindMount{}, fmt.Errorf("%v is not a properly formatted bind mount (e.g. HOST_PATH[:COMPRT_PATH[:ro]])", value)
+	}
+
+	hostPath, err := filepath.Abs(fields[0])
+	if err != nil {
+		return bindMount{}, err
+	} else if _, err := os.Stat(hostPath); err != nil {
+		return bindMount{}, err
+	}
+
+	var bind bindMount = bindMount{hostPath: hostPath, comprtPath: hostPath}
+	if len(fields) > 1 && fields[1] != "" {
+		bind.comprtPath = filepath.Clean(fields[1])
+	}
+	if len(fields) > 2 {
+		if fields[2] != readOnlyBindOption {
+			return bindMount{}, fmt.Errorf("%v is not a bind mount option (only %v is)", fields[2], readOnlyBindOption)
+		}
+		bind.readOnly = true
+	}
+
+	if !filepath.IsAbs(bind.comprtPath) {
+		return bindMount{}, fmt.Errorf("the comprt path of the bind mount %v must be an absolute path", value)
+	} else if bind.comprtPath == "/" {
+		return bindMount{}, fmt.Errorf("the bind mount %v cannot be mounted over the comprt's root", value)
+	}
+
+	return bind, nil
+}
+
+// Parse the bind mounts passed in.
+func parseBindMounts(values []string) ([]bindMount, error) {
+	var binds []bindMount
+	for _, value := range values {
+		bind, err := parseBindMount(value)
+		if err != nil {
+			return nil, err
+		}
+		binds = append(binds, bind)
+	}
+
+	return binds, nil
+}
+
+// Check whether the path in the comprt is in (or is) one of the bind mounts.
+func inBindMount(comprtPath string, binds []bindMount) bool {
+	for _, bind := range binds {
+		if comprtPath == bind.comprtPath || strings.HasPrefix(comprtPath, bind.comprtPath+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Create the mount point of the bind mount in the comprt, matching the host
+// path being a dir or file. The mount point cannot go through a symlink, as the
+// symlink would be followed on the host instead of in the comprt.
+func (bind bindMount) createMountPoint(target string) (string, error) {
+	if err := checkComprtPath(target, bind.comprtPath); err != nil {
+		return "", err
+	}
+	var mountPoint string = filepath.Join(target, bind.comprtPath)
+
+	hostInfo, err := os.Stat(bind.hostPath)
+	if err != nil {
+		return "", err
+	}
+	if hostInfo.IsDir() {
+		return mountPoint, os.MkdirAll(mountPoint, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(mountPoint), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return "", err
+	}
+	mountPointFile, err := os.OpenFile(mountPoint, os.O_CREATE|os.O_RDONLY, OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R)
+	if err != nil {
+		return "", err
+	}
+
+	return mountPoint, mountPointFile.Close()
+}
+
+// Bind mount the host paths into the target. The comprt paths mounted are
+// returned, in the same form as mountChrootFileSystems.
+func mountBindMounts(binds []bindMount, target string) ([]string, error) {
+	var fileSystemsMounted []string
+	mounts, err := progExecutor.Mounts()
+	if err != nil {
+		return fileSystemsMounted, err
+	}
+	for _, bind := range binds {
+		// mounting over what a crashed run left mounted would hide it, leaving it
+		// mounted once this run unmounts
+		if mounted, err := isMountPointIn(target, bind.comprtPath, mounts); err != nil {
+			return fileSystemsMounted, err
+		} else if mounted {
+			return fileSystemsMounted, fmt.Errorf("%v is already mounted in %v (see the cleanup command)", bind.comprtPath, target)
+		}
+
+		mountPoint, err := bind.createMountPoint(target)
+		if err != nil {
+			return fileSystemsMounted, err
+		}
+
+		if err := progExecutor.Mount(bind.hostPath, mountPoint, "", syscall.MS_BIND, ""); err != nil {
+			return fileSystemsMounted, err
+		}
+		fileSystemsMounted = append(fileSystemsMounted, bind.comprtPath)
+
+		if err := progExecutor.Mount("", mountPoint, "", syscall.MS_PRIVATE, ""); err != nil {
+			return fileSystemsMounted, err
+		}
+		// a bind mount only becomes read-only once remounted
+		if bind.readOnly {
+			if err := progExecutor.Mount("", mountPoint, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+				return fileSystemsMounted, err
+			}
+		}
+	}
+
+	return fileSystemsMounted, nil
+}
+
+// Get the mmdebstrap customize hooks that bind mount the host paths into the
+// comprt and the hooks that unmount them, mmdebstrap's user namespace is able
+// to mount.
+func bindMountsMmdebstrapArgs(binds []bindMount) (mountArgs, unMountArgs []string) {
+	for _, bind := range binds {
+		var mountPoint string = `"$1"` + shellQuote(bind.comprtPath)
+		var mkMountPoint string = "mkdir -p " + mountPoint
+		if hostInfo, err := os.Stat(bind.hostPath); err == nil && !hostInfo.IsDir() {
+			mkMountPoint = `mkdir -p "$(dirname ` + mountPoint + `)" && touch ` + mountPoint
+		}
+
+		var mountCmd string = mkMountPoint + " && mount --bind --make-private " + shellQuote(bind.hostPath) + " " + mountPoint
+		if bind.readOnly {
+			mountCmd += " && mount -o bind,remount,ro " + mountPoint
+		}
+		mountArgs = append(mountArgs, "--customize-hook="+mountCmd)
+		unMountArgs = append([]string{"--customize-hook=umount " + mountPoint}, unMountArgs...)
+	}
+
+	return mountArgs, unMountArgs
+}
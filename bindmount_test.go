@@ -0,0 +1,117 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBindMount(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	binds, err := parseBindMounts([]string{tempDirPath, tempDirPath + ":/src", tempDirPath + ":/src:ro"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []bindMount = []bindMount{
+		{hostPath: tempDirPath, comprtPath: tempDirPath},
+		{hostPath: tempDirPath, comprtPath: "/src"},
+		{hostPath: tempDirPath, comprtPath: "/src", readOnly: true},
+	}
+	if !reflect.DeepEqual(binds, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, binds)
+	}
+
+	if !inBindMount("/src/debcomprt", binds) || inBindMount("/srcs", binds) {
+		t.Fatal("a path was not correctly found to be in a bind mount")
+	}
+
+	for _, value := range []string{
+		filepath.Join(tempDirPath, "foo"),
+		tempDirPath + ":src",
+		tempDirPath + ":/",
+		tempDirPath + ":/src:rw",
+		tempDirPath + ":/src:ro:foo",
+	} {
+		if _, err := parseBindMount(value); err == nil {
+			t.Fatalf("an invalid bind mount was accepted: %v", value)
+		}
+	}
+}
+
+func TestBindMountCreateMountPoint(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var hostFilePath, targetPath string = filepath.Join(tempDirPath, "ccache.conf"), filepath.Join(tempDirPath, "target")
+	if err := createTestFile(hostFilePath, "max_size = 5G\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(targetPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	mountPoint, err := bindMount{hostPath: tempDirPath, comprtPath: "/home/debcomprt/src"}.createMountPoint(targetPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if fileInfo, err := os.Stat(mountPoint); err != nil || !fileInfo.IsDir() {
+		t.Fatalf("a dir was not created for the bind mount of a dir: %v", err)
+	}
+
+	mountPoint, err = bindMount{hostPath: hostFilePath, comprtPath: "/etc/ccache.conf"}.createMountPoint(targetPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if fileInfo, err := os.Stat(mountPoint); err != nil || !fileInfo.Mode().IsRegular() {
+		t.Fatalf("a file was not created for the bind mount of a file: %v", err)
+	}
+
+	// an absolute symlink would be followed on the host
+	if err := os.Symlink("/etc", filepath.Join(targetPath, "mnt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (bindMount{hostPath: hostFilePath, comprtPath: "/mnt/ccache.conf"}).createMountPoint(targetPath); err == nil {
+		t.Fatal("a bind mount through a symlink in the comprt was accepted")
+	}
+}
+
+func TestBindMountsMmdebstrapArgs(t *testing.T) {
+	mountArgs, unMountArgs := bindMountsMmdebstrapArgs([]bindMount{
+		{hostPath: "/srv/src", comprtPath: "/src"},
+		{hostPath: "/var/cache/ccache", comprtPath: "/ccache", readOnly: true},
+	})
+
+	if !strings.Contains(mountArgs[0], `mount --bind --make-private '/srv/src' "$1"'/src'`) {
+		t.Fatalf("the bind mount was not mounted by mmdebstrap: %v", mountArgs)
+	} else if !strings.HasSuffix(mountArgs[1], `mount -o bind,remount,ro "$1"'/ccache'`) {
+		t.Fatalf("the read-only bind mount was not remounted by mmdebstrap: %v", mountArgs)
+	}
+
+	var expected []string = []string{`--customize-hook=umount "$1"'/ccache'`, `--customize-hook=umount "$1"'/src'`}
+	if !reflect.DeepEqual(unMountArgs, expected) {
+		t.Fatalf("expected %v, got %v", expected, unMountArgs)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const binfmtMiscDir = "/proc/sys/fs/binfmt_misc"
+
+// The dirs systemd-binfmt reads binfmt_misc registrations from, in the order
+// they take precedence. qemu-user-static installs its registrations into these.
+// For reference:
+// https://www.freedesktop.org/software/systemd/man/binfmt.d.html
+var binfmtConfDirs = []string{"/etc/binfmt.d", "/usr/lib/binfmt.d"}
+
+// Mappings of debian's architecture names to the names qemu-user-static registers
+// its binfmt_misc handlers under (e.g. qemu-aarch64).
+var qemuArchMappings = map[string]string{
+	"amd64":    "x86_64",
+	"arm64":    "aarch64",
+	"armel":    "arm",
+	"armhf":    "arm",
+	"i386":     "i386",
+	"mips64el": "mips64el",
+	"mipsel":   "mipsel",
+	"ppc64el":  "ppc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// A type used to store a binfmt_misc handler, as read from its entry in the
+// binfmt_misc dir. For reference:
+// https://docs.kernel.org/admin-guide/binfmt-misc.html
+type binfmtHandler struct {
+	enabled     bool
+	interpreter string
+	flags       string
+}
+
+// Read in the binfmt_misc handler from its entry (e.g.
+// /proc/sys/fs/binfmt_misc/qemu-aarch64).
+func readBinfmtHandler(path string) (*binfmtHandler, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var handler binfmtHandler
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "enabled":
+			handler.enabled = true
+		case strings.HasPrefix(line, "interpreter "):
+			handler.interpreter = strings.TrimPrefix(line, "interpreter ")
+		case strings.HasPrefix(line, "flags:"):
+			handler.flags = strings.TrimSpace(strings.TrimPrefix(line, "flags:"))
+		}
+	}
+
+	return &handler, scanner.Err()
+}
+
+// Check binaries of the architecture can be ran in a comprt, the error returned
+// says what to do about it. A foreign architecture needs binfmt_misc and a
+// qemu-user-static handler for it. The handler needs the F flag, otherwise its
+// interpreter is looked for inside of the comprt.
+func checkBinfmtHandler(binfmtDir, arch string) error {
+	if arch == hostDebianArch() {
+		return nil
+	}
+
+	status, err := os.ReadFile(filepath.Join(binfmtDir, "status"))
+	if err != nil {
+		return fmt.Errorf(
+			"binfmt_misc is not mounted at %v, which emulating %v needs, mount it (mount -t binfmt_misc binfmt_misc %v) after loading its module (modprobe binfmt_misc)",
+			binfmtDir,
+			arch,
+			binfmtDir,
+		)
+	} else if strings.TrimSpace(string(status)) != "enabled" {
+		return fmt.Errorf("binfmt_misc is disabled, which emulating %v needs, enable it (echo 1 > %v)", arch, filepath.Join(binfmtDir, "status"))
+	}
+
+	qemuArch, ok := qemuArchMappings[arch]
+	if !ok {
+		return fmt.Errorf("qemu does not emulate the %v architecture, a comprt of it cannot be created on this host", arch)
+	}
+	var handlerPath string = filepath.Join(binfmtDir, "qemu-"+qemuArch)
+	handler, err := readBinfmtHandler(handlerPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no qemu-%v binfmt_misc handler is registered to emulate %v, install one (e.g. apt-get install qemu-user-static)", qemuArch, arch)
+	} else if err != nil {
+		return err
+	}
+
+	if !handler.enabled {
+		return fmt.Errorf("the qemu-%v binfmt_misc handler is disabled, enable it (echo 1 > %v)", qemuArch, handlerPath)
+	} else if !strings.Contains(handler.flags, "F") {
+		return fmt.Errorf(
+			"the qemu-%v binfmt_misc handler is registered without the F flag, its interpreter (%v) would be looked for inside of the comprt, register it again with the F flag (see binfmt.d(5), qemu-user-static's handlers have it)",
+			qemuArch,
+			handler.interpreter,
+		)
+	}
+
+	return nil
+}
+
+// Read in the registration of the binfmt_misc handler (e.g. qemu-aarch64) from
+// the first binfmt.d dir that has one.
+func readBinfmtConf(confDirs []string, name string) (string, string, error) {
+	for _, dir := range confDirs {
+		var confPath string = filepath.Join(dir, name+".conf")
+		file, err := os.Open(confPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", "", err
+		}
+		defer file.Close()
+
+		// e.g. ':qemu-aarch64:M::\x7fELF...:...:/usr/libexec/qemu-binfmt/aarch64-binfmt-P:OCPF'
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, ";") {
+				return line, confPath, nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return "", "", err
+		}
+	}
+
+	return "", "", fs.ErrNotExist
+}
+
+// Make sure binaries of the architecture can be ran in a comprt. As root,
+// binfmt_misc is mounted and qemu-user-static's handler for the architecture is
+// registered from its binfmt.d conf, if either is missing. Otherwise (or if that
+// does not help) the error returned says what to do about it.
+func ensureBinfmt(binfmtDir string, confDirs []string, arch string) error {
+	err := checkBinfmtHandler(binfmtDir, arch)
+	if err == nil || os.Getuid() != rootUid {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(binfmtDir, "status")); errors.Is(err, fs.ErrNotExist) {
+		if err := progExecutor.Mount("binfmt_misc", binfmtDir, "binfmt_misc", 0, ""); err != nil {
+			return checkBinfmtHandler(binfmtDir, arch)
+		}
+	}
+
+	if qemuArch, ok := qemuArchMappings[arch]; ok {
+		if _, err := os.Stat(filepath.Join(binfmtDir, "qemu-"+qemuArch)); errors.Is(err, fs.ErrNotExist) {
+			registration, confPath, err := readBinfmtConf(confDirs, "qemu-"+qemuArch)
+			if err == nil {
+				if err := os.WriteFile(filepath.Join(binfmtDir, "register"), []byte(registration), 0); err != nil {
+					return fmt.Errorf("unable to register the qemu-%v binfmt_misc handler from %v: %w", qemuArch, confPath, err)
+				}
+				infof("registered the qemu-%v binfmt_misc handler from %v", qemuArch, confPath)
+			}
+		}
+	}
+
+	return checkBinfmtHandler(binfmtDir, arch)
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Get an architecture that is foreign to the host.
+func testForeignArch() string {
+	if hostDebianArch() == "s390x" {
+		return "arm64"
+	}
+
+	return "s390x"
+}
+
+func TestCheckBinfmtHandler(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var foreignArch string = testForeignArch()
+	var handlerPath string = filepath.Join(tempDirPath, "qemu-"+qemuArchMappings[foreignArch])
+	if err := createTestFile(filepath.Join(tempDirPath, "status"), "enabled\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		handler  string
+		expected string
+	}{
+		{"", "is registered"},
+		{"disabled\ninterpreter /usr/libexec/qemu-binfmt/foo\nflags: OCF\n", "is disabled"},
+		{"enabled\ninterpreter /usr/libexec/qemu-binfmt/foo\nflags: OC\n", "without the F flag"},
+	} {
+		os.Remove(handlerPath)
+		if tc.handler != "" {
+			if err := createTestFile(handlerPath, tc.handler); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := checkBinfmtHandler(tempDirPath, foreignArch); err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Fatalf("expected an error about %q, actual: %v", tc.expected, err)
+		}
+	}
+
+	if err := createTestFile(handlerPath, "enabled\ninterpreter /usr/libexec/qemu-binfmt/foo\nflags: POCF\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBinfmtHandler(tempDirPath, foreignArch); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBinfmtHandler(filepath.Join(tempDirPath, "foo"), hostDebianArch()); err != nil {
+		t.Fatalf("the native architecture needed emulation: %v", err)
+	}
+}
+
+func TestReadBinfmtConf(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	etcDir, libDir := filepath.Join(tempDirPath, "etc"), filepath.Join(tempDirPath, "lib")
+	if err := os.Mkdir(libDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(libDir, "qemu-aarch64.conf"), "# written by qemu-user-static\n:qemu-aarch64:M::foo:bar:/usr/libexec/qemu-binfmt/aarch64-binfmt-P:OCPF\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	registration, confPath, err := readBinfmtConf([]string{etcDir, libDir}, "qemu-aarch64")
+	if err != nil {
+		t.Fatal(err)
+	} else if registration != ":qemu-aarch64:M::foo:bar:/usr/libexec/qemu-binfmt/aarch64-binfmt-P:OCPF" {
+		t.Fatalf("unexpected registration: %v", registration)
+	} else if confPath != filepath.Join(libDir, "qemu-aarch64.conf") {
+		t.Fatalf("unexpected conf: %v", confPath)
+	}
+
+	if _, _, err := readBinfmtConf([]string{etcDir, libDir}, "qemu-s390x"); err == nil {
+		t.Fatal("a registration was found for a handler without a conf")
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	// The hidden argument used to have debcomprt re-execute itself to become a
+	// comprt's init process.
+	bootInitCmdName = "__boot"
+
+	autoBootBackend     = "auto"
+	nspawnBootBackend   = "nspawn"
+	internalBootBackend = "internal"
+
+	comprtInitPath = "/sbin/init"
+)
+
+// Determine the backend used to boot a comprt. systemd-nspawn is preferred as
+// it knows how to setup the environment systemd expects as a container.
+func resolveBootBackend(backend string) (string, error) {
+	switch backend {
+	case autoBootBackend:
+		if _, err := progExecutor.LookPath("systemd-nspawn"); err == nil {
+			return nspawnBootBackend, nil
+		}
+		return internalBootBackend, nil
+	case nspawnBootBackend, internalBootBackend:
+		return backend, nil
+	default:
+		return "", fmt.Errorf(
+			"%v is not a supported boot backend, use one of: %v, %v, %v",
+			backend,
+			autoBootBackend,
+			nspawnBootBackend,
+			internalBootBackend,
+		)
+	}
+}
+
+// Boot the comprt's init, so services installed in the comprt can be started.
+// The comprt runs until its init exits (e.g. 'poweroff' inside the comprt).
+func bootComprt(target, backend string) error {
+	if _, err := os.Stat(filepath.Join(target, comprtInitPath)); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%v was not found in %v, is an init system (e.g. systemd-sysv) installed?", comprtInitPath, target)
+	}
+
+	var bootCmd *exec.Cmd
+	switch backend {
+	case nspawnBootBackend:
+		nspawnPath, err := progExecutor.LookPath("systemd-nspawn")
+		if err != nil {
+			return err
+		}
+
+		bootCmd = exec.Command(nspawnPath, "--boot", "--directory", target, "--machine", filepath.Base(target))
+	case internalBootBackend:
+		bootCmd = exec.Command("/proc/self/exe", bootInitCmdName, target)
+		bootCmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags: syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC,
+		}
+	}
+	bootCmd.Stdin = os.Stdin
+	bootCmd.Stdout = os.Stdout
+	bootCmd.Stderr = os.Stderr
+
+	return progExecutor.Run(bootCmd)
+}
+
+// Setup the mounts needed by the comprt's init, chroot into the target and then
+// replace debcomprt with the init. This is expected to run as the first
+// process of a new PID namespace, that way the comprt's init is PID 1. Only
+// returns on error.
+func runBootInit(target string) error {
+	if os.Getpid() != 1 {
+		return fmt.Errorf("%s must be the first process of a PID namespace", bootInitCmdName)
+	}
+
+	if err := progExecutor.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+
+	if _, err := mountChrootFileSystems([]string{"/sys", "/dev", "/dev/pts"}, target); err != nil {
+		return err
+	}
+	// the host's /proc would show the processes outside of the comprt
+	if err := progExecutor.Mount("proc", filepath.Join(target, "/proc"), "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return err
+	}
+
+	if err := syscall.Sethostname([]byte(filepath.Base(target))); err != nil {
+		return err
+	}
+
+	// init replaces debcomprt, so the chroot is never exited
+	if _, err := progExecutor.Chroot(target); err != nil {
+		return err
+	}
+
+	// systemd will adjust its behavior when it knows it is in a container, for reference:
+	// https://systemd.io/CONTAINER_INTERFACE/
+	return syscall.Exec(comprtInitPath, []string{comprtInitPath}, []string{"container=" + progname})
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestResolveBootBackend(t *testing.T) {
+	backend, err := resolveBootBackend(autoBootBackend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := exec.LookPath("systemd-nspawn"); err == nil && backend != nspawnBootBackend {
+		t.Fatalf("%v was resolved as the boot backend with systemd-nspawn available", backend)
+	} else if err != nil && backend != internalBootBackend {
+		t.Fatalf("%v was resolved as the boot backend without systemd-nspawn available", backend)
+	}
+
+	if _, err := resolveBootBackend("foo"); err == nil {
+		t.Fatal("an unsupported boot backend was resolved without error")
+	}
+}
+
+func TestBootComprtWithoutInit(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if err := bootComprt(tempDirPath, internalBootBackend); err == nil {
+		t.Fatal("a comprt without an init was booted without error")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+const (
+	grubBootloader        = "grub"
+	systemdBootBootloader = "systemd-boot"
+
+	// Ubuntu has a single kernel flavor for every architecture it supports.
+	ubuntuKernelPkg = "linux-image-generic"
+)
+
+// Mappings of debian's architecture names to the flavor of debian's kernel
+// (e.g. linux-image-amd64) built for the architecture, only the architectures
+// that can be booted with EFI are mapped. For reference:
+// https://packages.debian.org/stable/linux-image-all
+var debianKernelFlavors = map[string]string{
+	"amd64":   "amd64",
+	"arm64":   "arm64",
+	"armhf":   "armmp",
+	"i386":    "686-pae",
+	"riscv64": "riscv64",
+}
+
+// Mappings of debian's architecture names to the names of the EFI
+// architectures grub's packages are built for (e.g. grub-efi-ia32-bin).
+var grubEfiArchs = map[string]string{
+	"amd64":   "amd64",
+	"arm64":   "arm64",
+	"armhf":   "arm",
+	"i386":    "ia32",
+	"riscv64": "riscv64",
+}
+
+// Check whether the codename is one of ubuntu's releases.
+func isUbuntuCodename(codeName string) bool {
+	var mirror string = defaultMirrorMappings[codeName]
+	return mirror == defaultUbuntuMirror || mirror == ubuntuArchiveMirror
+}
+
+// Get the packages that make a comprt of the codename and architecture
+// bootable: a kernel, initramfs-tools and the bootloader. Only the bootloader's
+// EFI binaries and tools are installed, installing the bootloader onto a disk is
+// left to whatever writes the comprt to one.
+func bootablePkgs(codeName, arch, bootloader string) ([]string, error) {
+	efiArch, ok := grubEfiArchs[arch]
+	if !ok {
+		return nil, fmt.Errorf("%v cannot be booted with EFI, which --bootable needs", arch)
+	}
+
+	var kernelPkg string = "linux-image-" + debianKernelFlavors[arch]
+	if isUbuntuCodename(codeName) && arch == "i386" {
+		return nil, fmt.Errorf("%v has no kernel for i386", codeName)
+	} else if isUbuntuCodename(codeName) {
+		kernelPkg = ubuntuKernelPkg
+	}
+
+	var pkgs []string = []string{kernelPkg, "initramfs-tools"}
+	switch bootloader {
+	case grubBootloader:
+		return append(pkgs, "grub-efi-"+efiArch+"-bin", "grub2-common"), nil
+	case systemdBootBootloader:
+		return append(pkgs, "systemd-boot"), nil
+	default:
+		return nil, fmt.Errorf("%v is not a supported bootloader, use either %v or %v", bootloader, grubBootloader, systemdBootBootloader)
+	}
+}
+
+// Generate the initramfs of every kernel installed in the comprt.
+func generateInitramfs(target string, quiet bool) (errs []error) {
+	exitChroot, errs := Chroot(target)
+	if errs != nil {
+		return
+	}
+	defer func() {
+		if err := exitChroot(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+
+	updateInitramfsPath, err := progExecutor.LookPath("update-initramfs")
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	updateInitramfsCmd := exec.Command(updateInitramfsPath, "-u", "-k", "all")
+	traceCommand(updateInitramfsCmd)
+	updateInitramfsCmd.Env = append(os.Environ(), aptNonInteractiveEnv...)
+	updateInitramfsCmd.Stdout, updateInitramfsCmd.Stderr = buildLogOutput(quiet)
+	if err := progExecutor.Run(updateInitramfsCmd); err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	return nil
+}
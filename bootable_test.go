@@ -0,0 +1,49 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBootablePkgs(t *testing.T) {
+	for _, tc := range []struct {
+		codeName   string
+		arch       string
+		bootloader string
+		expected   []string
+	}{
+		{testCodeCame, "amd64", grubBootloader, []string{"linux-image-amd64", "initramfs-tools", "grub-efi-amd64-bin", "grub2-common"}},
+		{testCodeCame, "i386", grubBootloader, []string{"linux-image-686-pae", "initramfs-tools", "grub-efi-ia32-bin", "grub2-common"}},
+		{"jammy", "arm64", systemdBootBootloader, []string{"linux-image-generic", "initramfs-tools", "systemd-boot"}},
+	} {
+		if pkgs, err := bootablePkgs(tc.codeName, tc.arch, tc.bootloader); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(pkgs, tc.expected) {
+			t.Fatalf("expected %v for %v %v, got %v", tc.expected, tc.codeName, tc.arch, pkgs)
+		}
+	}
+
+	for _, args := range [][]string{
+		{testCodeCame, "s390x", grubBootloader},
+		{"jammy", "i386", grubBootloader},
+		{testCodeCame, "amd64", "lilo"},
+	} {
+		if _, err := bootablePkgs(args[0], args[1], args[2]); err == nil {
+			t.Fatalf("expected an error for %v", args)
+		}
+	}
+}
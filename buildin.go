@@ -0,0 +1,98 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+const tmpfsBuildIn = "tmpfs"
+
+// Matches the sizes the tmpfs size mount option takes (e.g. 4G or 50%).
+var reTmpfsSize = regexp.MustCompile(`^[0-9]+[kKmMgG%]?$`)
+
+// Parse where the comprt is built passed in as 'tmpfs[:SIZE]'. The size of the
+// tmpfs is returned, an empty size is the kernel's default (half of the RAM).
+func parseBuildIn(value string) (string, error) {
+	fields := strings.SplitN(value, ":", 2)
+	if fields[0] != tmpfsBuildIn {
+		return "", fmt.Errorf("%v is not somewhere a comprt can be built in (only %v[:SIZE] is)", value, tmpfsBuildIn)
+	} else if len(fields) == 1 {
+		return "", nil
+	} else if reTmpfsSize.FindStringIndex(fields[1]) == nil {
+		return "", fmt.Errorf("%v is not a tmpfs size (e.g. 4G or 50%%)", fields[1])
+	}
+
+	return fields[1], nil
+}
+
+// Mount a tmpfs of the size passed in for the comprt to be built in. A func is
+// returned to unmount and remove it.
+func mountTmpfsBuildDir(size string) (string, func() error, error) {
+	buildDir, err := makeTempDir("", progname+"-build")
+	if err != nil {
+		return "", nil, err
+	}
+
+	var options string = "mode=0755"
+	if size != "" {
+		options += ",size=" + size
+	}
+	// debootstrap creates and uses device nodes in the comprt, so no nodev
+	if err := progExecutor.Mount("tmpfs", buildDir, "tmpfs", 0, options); err != nil {
+		os.Remove(buildDir)
+		return "", nil, err
+	}
+
+	return buildDir, func() error {
+		if err := progExecutor.Unmount(buildDir, 0); err != nil {
+			return err
+		}
+
+		return os.Remove(buildDir)
+	}, nil
+}
+
+// Sync the comprt built in the build dir to the target, keeping ownership,
+// permissions, hard links, ACLs and xattrs. rsync is used when installed,
+// otherwise tar.
+func syncBuildDir(buildDir, target string, quiet bool) error {
+	if rsyncPath, err := progExecutor.LookPath("rsync"); err == nil {
+		rsyncCmd := exec.Command(rsyncPath, "--archive", "--hard-links", "--acls", "--xattrs", "--numeric-ids", buildDir+"/", target+"/")
+		traceCommand(rsyncCmd)
+		if !quiet {
+			rsyncCmd.Stdout = os.Stdout
+			rsyncCmd.Stderr = os.Stderr
+		}
+		return progExecutor.Run(rsyncCmd)
+	}
+
+	tarPath, err := progExecutor.LookPath("tar")
+	if err != nil {
+		return err
+	}
+	var tarFlags []string = []string{"--numeric-owner", "--acls", "--xattrs", "--xattrs-include=*"}
+	createCmd := exec.Command(tarPath, append(tarFlags, "--directory", buildDir, "--create", "--file", "-", ".")...)
+	extractCmd := exec.Command(tarPath, append(tarFlags, "--directory", target, "--extract", "--preserve-permissions", "--file", "-")...)
+	traceCommand(createCmd)
+	traceCommand(extractCmd)
+	createCmd.Stderr, extractCmd.Stderr = os.Stderr, os.Stderr
+
+	return runPipe(createCmd, extractCmd)
+}
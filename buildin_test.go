@@ -0,0 +1,98 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestParseBuildIn(t *testing.T) {
+	for value, expected := range map[string]string{"tmpfs": "", "tmpfs:8G": "8G", "tmpfs:50%": "50%"} {
+		if size, err := parseBuildIn(value); err != nil {
+			t.Fatal(err)
+		} else if size != expected {
+			t.Fatalf("expected %q for %v, got %q", expected, value, size)
+		}
+	}
+
+	for _, value := range []string{"ramfs", "tmpfs:", "tmpfs:8 G", "tmpfs:lots"} {
+		if _, err := parseBuildIn(value); err == nil {
+			t.Fatalf("an invalid place to build in was accepted: %v", value)
+		}
+	}
+}
+
+func TestTmpfsBuildDirSync(t *testing.T) {
+	buildDir, unMountBuildDir, err := mountTmpfsBuildDir("16M")
+	if err != nil {
+		t.Skipf("unable to mount a tmpfs on this host: %v", err)
+	}
+	defer func() {
+		if unMountBuildDir != nil {
+			unMountBuildDir()
+		}
+	}()
+
+	var statfs syscall.Statfs_t
+	if err := syscall.Statfs(buildDir, &statfs); err != nil {
+		t.Fatal(err)
+	} else if statfs.Type != 0x01021994 { // TMPFS_MAGIC
+		t.Fatalf("%v is not a tmpfs", buildDir)
+	}
+
+	if err := os.MkdirAll(filepath.Join(buildDir, "usr", "bin"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(buildDir, "usr", "bin", "foo"), "#!/bin/sh\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(buildDir, "usr", "bin", "foo"), filepath.Join(buildDir, "usr", "bin", "bar")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("usr/bin", filepath.Join(buildDir, "bin")); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+
+	if err := syncBuildDir(buildDir, target, !testing.Verbose()); err != nil {
+		t.Fatal(err)
+	}
+	if err := unMountBuildDir(); err != nil {
+		t.Fatal(err)
+	}
+	unMountBuildDir = nil
+	if _, err := os.Stat(buildDir); err == nil {
+		t.Fatalf("the build dir %v was not removed", buildDir)
+	}
+
+	fooInfo, err := os.Stat(filepath.Join(target, "bin", "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	barInfo, err := os.Stat(filepath.Join(target, "usr", "bin", "bar"))
+	if err != nil {
+		t.Fatal(err)
+	} else if !os.SameFile(fooInfo, barInfo) {
+		t.Fatal("the hard link was not kept when synced")
+	}
+}
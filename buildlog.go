@@ -0,0 +1,82 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const logsDir = "logs"
+
+// The build log of the comprt being created, nil outside of a create. The log is
+// kept in debcomprt's data dir, that way it outlives a create that failed (and
+// was rolled back).
+var buildLog *os.File
+
+// Get the path of the target's build log.
+func buildLogPath(target string) (string, error) {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(progDataDir, logsDir, url.PathEscape(absTarget)+".log"), nil
+}
+
+// Open the target's build log, replacing the log of a previous create of the
+// target. A resumed create is appended to the log of the create it resumes.
+func openBuildLog(target string, resume bool) (*os.File, error) {
+	logPath, err := buildLogPath(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return nil, err
+	}
+
+	var flags int = syscall.O_CREAT | syscall.O_WRONLY | syscall.O_APPEND
+	if !resume {
+		flags |= syscall.O_TRUNC
+	}
+	logFile, err := os.OpenFile(logPath, flags, OS_USER_R|OS_USER_W|OS_GROUP_R)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(logFile, "%s %v: creating %v at %v\n", progname, progVersion, target, time.Now().UTC().Format(time.RFC3339))
+
+	return logFile, nil
+}
+
+// Get the writers the stdout and stderr of a command ran by a create are to be
+// written to. The output always goes to the build log (if any), and to stdout and
+// stderr unless quiet.
+func buildLogOutput(quiet bool) (io.Writer, io.Writer) {
+	switch {
+	case buildLog == nil && quiet:
+		return io.Discard, io.Discard
+	case buildLog == nil:
+		return os.Stdout, os.Stderr
+	case quiet:
+		return buildLog, buildLog
+	}
+
+	return io.MultiWriter(os.Stdout, buildLog), io.MultiWriter(os.Stderr, buildLog)
+}
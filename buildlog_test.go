@@ -0,0 +1,92 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenBuildLog(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var testTarget string = filepath.Join(progDataDir, "testChroot")
+	writeLog := func(resume bool, text string) {
+		logFile, err := openBuildLog(testTarget, resume)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer logFile.Close()
+		if _, err := logFile.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readLog := func() string {
+		logPath, err := buildLogPath(testTarget)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(contents)
+	}
+
+	writeLog(false, "I: Retrieving InRelease\n")
+	writeLog(true, "I: Extracting base-files...\n")
+	if contents := readLog(); !strings.Contains(contents, "I: Retrieving InRelease\n") || !strings.Contains(contents, "I: Extracting base-files...\n") {
+		t.Fatalf("expected the resumed create to be appended to the log, got:\n%v", contents)
+	}
+
+	writeLog(false, "I: Validating Packages\n")
+	if contents := readLog(); strings.Contains(contents, "I: Retrieving InRelease\n") {
+		t.Fatalf("expected the log of the previous create to be replaced, got:\n%v", contents)
+	} else if !strings.HasPrefix(contents, progname+" ") {
+		t.Fatalf("expected the log to start with what is being created, got:\n%v", contents)
+	}
+}
+
+func TestBuildLogOutput(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+	defer func() { buildLog = nil }()
+
+	if stdout, stderr := buildLogOutput(false); stdout != os.Stdout || stderr != os.Stderr {
+		t.Fatal("expected the output to go to stdout and stderr as is outside of a create")
+	}
+
+	logFile, err := openBuildLog(filepath.Join(progDataDir, "testChroot"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	buildLog = logFile
+
+	stdout, stderr := buildLogOutput(true)
+	for _, w := range []io.Writer{stdout, stderr} {
+		if _, err := io.WriteString(w, "foo\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	contents, err := os.ReadFile(logFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.HasSuffix(string(contents), "foo\nfoo\n") {
+		t.Fatalf("expected the quiet output to still be logged, got:\n%s", contents)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	cachesDir = "caches"
+	// Paths starting with this are in the home of the user logged in as.
+	homeCachePrefix = "~/"
+)
+
+// Where the caches of well-known tools are kept in a comprt, so only the cache's
+// name has to be given.
+var wellKnownCachePaths = map[string]string{
+	"apt":      "/var/cache/apt/archives",
+	"ccache":   homeCachePrefix + ".cache/ccache",
+	"go-build": homeCachePrefix + ".cache/go-build",
+	"go-mod":   homeCachePrefix + "go/pkg/mod",
+	"npm":      homeCachePrefix + ".npm",
+	"pip":      homeCachePrefix + ".cache/pip",
+}
+
+// Matches the names of caches, which are used as dir names on the host.
+var reCacheName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// A type used to describe a host cache dir mounted into a comprt. A cache is
+// kept in debcomprt's data dir by name, so it outlives the comprt and is shared
+// with any other comprt that mounts a cache of the same name.
+type cacheMount struct {
+	Name string `json:"name"`
+	// Where the cache is mounted in the comprt, a path starting with '~/' is
+	// in the home of the user logged in as. Defaults to the well-known path of
+	// the cache's name.
+	Path string `json:"path,omitempty"`
+}
+
+// Check that the cache can be mounted into a comprt.
+func (cache cacheMount) validate() error {
+	if reCacheName.FindStringIndex(cache.Name) == nil {
+		return fmt.Errorf("%v is not a valid cache name", cache.Name)
+	}
+
+	path := cache.comprtPath("/")
+	if path == "" {
+		return fmt.Errorf("the cache %v needs a path, it is not a well-known cache (one of: %v)", cache.Name, strings.Join(wellKnownCacheNames(), ", "))
+	} else if !filepath.IsAbs(path) || filepath.Clean(path) == "/" {
+		return fmt.Errorf("the path of the cache %v must be an absolute path (or start with %v) other than /", cache.Name, homeCachePrefix)
+	}
+
+	return nil
+}
+
+// Get the names of the well-known caches, sorted.
+func wellKnownCacheNames() []string {
+	var names []string
+	for name := range wellKnownCachePaths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Check whether the cache is in the home of the user logged in as.
+func (cache cacheMount) inHome() bool {
+	path := cache.Path
+	if path == "" {
+		path = wellKnownCachePaths[cache.Name]
+	}
+
+	return strings.HasPrefix(path, homeCachePrefix)
+}
+
+// Get where the cache is mounted in the comprt, with home being the home of the
+// user logged in as.
+func (cache cacheMount) comprtPath(home string) string {
+	path := cache.Path
+	if path == "" {
+		path = wellKnownCachePaths[cache.Name]
+	}
+	if strings.HasPrefix(path, homeCachePrefix) {
+		return filepath.Join(home, strings.TrimPrefix(path, homeCachePrefix))
+	}
+
+	return path
+}
+
+// Get where the cache is kept on the host.
+func (cache cacheMount) hostPath() string {
+	return filepath.Join(progDataDir, cachesDir, cache.Name)
+}
+
+// Get the bind mounts of the caches into the comprt, creating the caches on the
+// host as needed. A cache in the home of the user logged in as is owned by that
+// user, so the user can write to it.
+func cacheBindMounts(caches []cacheMount, target, loginName string) ([]bindMount, error) {
+	var binds []bindMount
+	for _, cache := range caches {
+		if err := os.MkdirAll(cache.hostPath(), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+			return nil, err
+		}
+
+		var home string = "/"
+		if cache.inHome() {
+			entry, err := comprtPasswdEntry(target, loginName)
+			if err != nil {
+				return nil, err
+			}
+			home = entry[5]
+
+			uid, err := strconv.Atoi(entry[2])
+			if err != nil {
+				return nil, err
+			}
+			gid, err := strconv.Atoi(entry[3])
+			if err != nil {
+				return nil, err
+			}
+			if err := os.Chown(cache.hostPath(), uid, gid); err != nil {
+				return nil, err
+			}
+		}
+
+		binds = append(binds, bindMount{hostPath: cache.hostPath(), comprtPath: cache.comprtPath(home)})
+	}
+
+	return binds, nil
+}
+
+// Get the fields of the user's entry in the comprt's /etc/passwd.
+func comprtPasswdEntry(target, userName string) ([]string, error) {
+	passwd, err := os.ReadFile(filepath.Join(target, "/etc/passwd"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(passwd), "\n") {
+		if fields := strings.Split(line, ":"); len(fields) == 7 && fields[0] == userName {
+			return fields, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%v was not found in the comprt's /etc/passwd", userName)
+}
+
+// Count the caches that are warm (already have something in them on the host)
+// and cold, e.g. for the cache hit rate of creating comprts.
+func cacheUsage(caches []cacheMount) (int, int) {
+	var hits, misses int
+	for _, cache := range caches {
+		if entries, err := os.ReadDir(cache.hostPath()); err == nil && len(entries) > 0 {
+			hits++
+		} else {
+			misses++
+		}
+	}
+
+	return hits, misses
+}
+
+// Get the bind mounts of the caches recorded for the comprt in the registry.
+func comprtCacheBindMounts(target string) ([]bindMount, error) {
+	entry, err := lookupComprt(target)
+	if err != nil || entry == nil || len(entry.Caches) == 0 {
+		return nil, err
+	}
+
+	loginName, err := comprtLoginName(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return cacheBindMounts(entry.Caches, target, loginName)
+}
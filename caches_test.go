@@ -0,0 +1,119 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCacheMountValidate(t *testing.T) {
+	for _, cache := range []cacheMount{
+		{Name: "apt"},
+		{Name: "ccache"},
+		{Name: "cargo", Path: "~/.cargo/registry"},
+		{Name: "sccache", Path: "/var/cache/sccache"},
+	} {
+		if err := cache.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, cache := range []cacheMount{
+		{Name: "cargo"},
+		{Name: "../cargo", Path: "/var/cache/cargo"},
+		{Name: "cargo", Path: "var/cache/cargo"},
+		{Name: "cargo", Path: "/"},
+	} {
+		if err := cache.validate(); err == nil {
+			t.Fatalf("an invalid cache was accepted: %+v", cache)
+		}
+	}
+}
+
+func TestComprtCacheBindMounts(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var testTarget string = filepath.Join(progDataDir, "testChroot")
+	if err := os.MkdirAll(filepath.Join(testTarget, "etc"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(
+		filepath.Join(testTarget, "/etc/passwd"),
+		"root:x:0:0:root:/root:/bin/bash\nbuilder:x:2000:2001::/home/builder:/bin/bash\n",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// a comprt that is not registered has no caches
+	if binds, err := comprtCacheBindMounts(testTarget); err != nil {
+		t.Fatal(err)
+	} else if len(binds) != 0 {
+		t.Fatalf("an unregistered comprt was given caches: %v", binds)
+	}
+
+	now := time.Now().UTC()
+	if err := registerComprt(registryEntry{
+		Target:   testTarget,
+		CodeName: testCodeCame,
+		User:     "builder",
+		Created:  now,
+		Updated:  now,
+		Caches:   []cacheMount{{Name: "apt"}, {Name: "ccache"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	binds, err := comprtCacheBindMounts(testTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []bindMount = []bindMount{
+		{hostPath: filepath.Join(progDataDir, cachesDir, "apt"), comprtPath: "/var/cache/apt/archives"},
+		{hostPath: filepath.Join(progDataDir, cachesDir, "ccache"), comprtPath: "/home/builder/.cache/ccache"},
+	}
+	if !reflect.DeepEqual(binds, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, binds)
+	}
+
+	var ccacheStat *syscall.Stat_t = &syscall.Stat_t{}
+	if err := stat(filepath.Join(progDataDir, cachesDir, "ccache"), ccacheStat); err != nil {
+		t.Fatal(err)
+	} else if ccacheStat.Uid != 2000 || ccacheStat.Gid != 2001 {
+		t.Fatalf("the cache was not owned by the user logged in as: %v:%v", ccacheStat.Uid, ccacheStat.Gid)
+	}
+}
+
+func TestCacheUsage(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var caches []cacheMount = []cacheMount{{Name: "apt"}, {Name: "ccache"}, {Name: "pip"}}
+	// apt is warm, ccache was created but is empty and pip does not exist yet
+	if err := os.MkdirAll(caches[0].hostPath(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	} else if err := createTestFile(filepath.Join(caches[0].hostPath(), "foo.deb"), "foo\n"); err != nil {
+		t.Fatal(err)
+	} else if err := os.MkdirAll(caches[1].hostPath(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if hits, misses := cacheUsage(caches); hits != 1 || misses != 2 {
+		t.Fatalf("expected 1 hit and 2 misses, got %v and %v", hits, misses)
+	}
+}
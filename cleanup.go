@@ -0,0 +1,188 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Unmount what was left mounted under the targets by runs that crashed, returns
+// the mount points that were unmounted.
+func unMountStaleMounts(targets []string, mounts []mountInfo) ([]string, error) {
+	var unMounted []string
+	for _, target := range targets {
+		for _, mount := range mountsUnder(target, mounts) {
+			if err := progExecutor.Unmount(mount.mountPoint, 0); err != nil {
+				return unMounted, fmt.Errorf("%v: %w", mount.mountPoint, err)
+			}
+			unMounted = append(unMounted, mount.mountPoint)
+		}
+	}
+
+	return unMounted, nil
+}
+
+// Check that the target is a comprt, by its metadata or its registry entry. A
+// directory that is neither (e.g. a mistyped target) is refused.
+func checkIsComprt(target string) error {
+	if metadata, err := readComprtMetadata(target); err != nil {
+		return err
+	} else if metadata != nil {
+		return nil
+	}
+
+	if entry, err := lookupComprt(target); err != nil {
+		return err
+	} else if entry == nil {
+		return fmt.Errorf("%v has no %v and is not in the registry, refusing to remove what does not look like a comprt", target, comprtMetadataPath)
+	}
+
+	return nil
+}
+
+// Remove a comprt along with its registry entry. Nothing can be left mounted
+// under the target, otherwise the host's files could be removed too.
+func removeComprt(target string, mounts []mountInfo) error {
+	if err := checkIsComprt(target); err != nil {
+		return err
+	}
+
+	return removeTarget(target, mounts)
+}
+
+// Remove the target along with its registry entry, whether or not it looks like
+// a comprt. Only meant for a target made by debcomprt (e.g. by a failed create).
+func removeTarget(target string, mounts []mountInfo) error {
+	if stale := mountsUnder(target, mounts); len(stale) > 0 {
+		return fmt.Errorf("%v still has %v mounted under it, refusing to remove it", target, stale[0].mountPoint)
+	}
+
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+
+	return unregisterComprt(target)
+}
+
+// Roll back a create that failed, unmounting what is left mounted under the
+// target and removing what was written to it. The target itself is only removed
+// if the create made it, a target that was already there is emptied instead.
+func rollbackComprt(target string, madeTarget bool, mounts []mountInfo) error {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	if _, err := unMountStaleMounts([]string{absTarget}, mounts); err != nil {
+		return err
+	}
+	if mounts, err = readMountInfo(procSelfMountInfo); err != nil {
+		return err
+	}
+
+	if madeTarget {
+		return removeTarget(absTarget, mounts)
+	}
+	return emptyComprt(absTarget, mounts)
+}
+
+// Remove what is in a comprt along with its registry entry, the target itself is
+// kept. Nothing can be left mounted under the target, as with removeComprt.
+func emptyComprt(target string, mounts []mountInfo) error {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	if stale := mountsUnder(absTarget, mounts); len(stale) > 0 {
+		return fmt.Errorf("%v still has %v mounted under it, refusing to remove it", absTarget, stale[0].mountPoint)
+	}
+
+	entries, err := os.ReadDir(absTarget)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(absTarget, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return unregisterComprt(absTarget)
+}
+
+// Clean up after runs that crashed, for the target or every comprt in the
+// registry if target is empty. Stale mounts are unmounted, and comprts left
+// incomplete by an interrupted create are removed if removeIncomplete is set.
+func cleanupComprts(target string, removeIncomplete, quiet bool) error {
+	entries, err := loadRegistry()
+	if err != nil {
+		return err
+	}
+
+	var targets []string
+	var incomplete []string
+	if target != "" {
+		absTarget, err := filepath.Abs(target)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, absTarget)
+	}
+	for _, entry := range entries {
+		if target != "" && entry.Target != targets[0] {
+			continue
+		} else if target == "" {
+			targets = append(targets, entry.Target)
+		}
+		if entry.Incomplete {
+			incomplete = append(incomplete, entry.Target)
+		}
+	}
+
+	mounts, err := readMountInfo(procSelfMountInfo)
+	if err != nil {
+		return err
+	}
+	unMounted, err := unMountStaleMounts(targets, mounts)
+	if !quiet {
+		for _, mountPoint := range unMounted {
+			fmt.Printf("unmounted %v\n", mountPoint)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if removeIncomplete {
+		if mounts, err = readMountInfo(procSelfMountInfo); err != nil {
+			return err
+		}
+		for _, incompleteTarget := range incomplete {
+			if err := removeComprt(incompleteTarget, mounts); err != nil {
+				return err
+			}
+			if !quiet {
+				fmt.Printf("removed incomplete comprt %v\n", incompleteTarget)
+			}
+		}
+	} else if !quiet {
+		for _, incompleteTarget := range incomplete {
+			fmt.Printf("%v is incomplete (see --remove-incomplete)\n", incompleteTarget)
+		}
+	}
+
+	return nil
+}
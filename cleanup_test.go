@@ -0,0 +1,196 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestRemoveComprt(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var testTarget string = filepath.Join(progDataDir, "testChroot")
+	if err := os.Mkdir(testTarget, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(testTarget, "foo"), "foo\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerComprt(registryEntry{Target: testTarget, CodeName: testCodeCame, Incomplete: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeComprt(testTarget, []mountInfo{{mountPoint: filepath.Join(testTarget, "proc")}}); err == nil {
+		t.Fatal("a comprt with a filesystem mounted under it was removed")
+	}
+
+	if err := removeComprt(testTarget, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(testTarget); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("%v was not removed", testTarget)
+	}
+	if entry, err := lookupComprt(testTarget); err != nil {
+		t.Fatal(err)
+	} else if entry != nil {
+		t.Fatalf("%v was still found in the registry", testTarget)
+	}
+}
+
+func TestRemoveComprtNotAComprt(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var testTarget string = filepath.Join(progDataDir, "data")
+	if err := os.Mkdir(testTarget, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(testTarget, "foo"), "foo\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeComprt(testTarget, nil); err == nil {
+		t.Fatal("a directory that is not a comprt was removed")
+	}
+	if _, err := os.Stat(filepath.Join(testTarget, "foo")); err != nil {
+		t.Fatalf("%v was removed from the directory that is not a comprt", "foo")
+	}
+
+	// the metadata alone is enough to tell it is a comprt
+	if err := writeComprtMetadata(testTarget, comprtMetadata{CodeName: testCodeCame}); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeComprt(testTarget, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(testTarget); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("%v was not removed", testTarget)
+	}
+}
+
+func TestRollbackComprt(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var madeTarget, existingTarget string = filepath.Join(progDataDir, "made"), filepath.Join(progDataDir, "existing")
+	for _, target := range []string{madeTarget, existingTarget} {
+		if err := os.Mkdir(target, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(filepath.Join(target, "foo"), "foo\n"); err != nil {
+			t.Fatal(err)
+		}
+		if err := registerComprt(registryEntry{Target: target, CodeName: testCodeCame, Incomplete: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := rollbackComprt(madeTarget, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(madeTarget); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("%v was not removed", madeTarget)
+	}
+
+	if err := rollbackComprt(existingTarget, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := os.ReadDir(existingTarget); err != nil {
+		t.Fatalf("%v was removed, it was there before the create", existingTarget)
+	} else if len(entries) != 0 {
+		t.Fatalf("%v was not emptied", existingTarget)
+	}
+	if entry, err := lookupComprt(existingTarget); err != nil {
+		t.Fatal(err)
+	} else if entry != nil {
+		t.Fatalf("%v was still found in the registry", existingTarget)
+	}
+}
+
+func TestEmptyComprt(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var testTarget string = filepath.Join(progDataDir, "testChroot")
+	if err := os.Mkdir(testTarget, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeComprtMetadata(testTarget, comprtMetadata{CodeName: testCodeCame}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := emptyComprt(testTarget, []mountInfo{{mountPoint: filepath.Join(testTarget, "proc")}}); err == nil {
+		t.Fatal("a comprt with a filesystem mounted under it was emptied")
+	}
+
+	if err := emptyComprt(testTarget, nil); err != nil {
+		t.Fatal(err)
+	}
+	if metadata, err := readComprtMetadata(testTarget); err != nil {
+		t.Fatal(err)
+	} else if metadata != nil {
+		t.Fatalf("%v is still a comprt", testTarget)
+	}
+}
+
+func TestCleanupComprts(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var completeTarget, incompleteTarget string = filepath.Join(progDataDir, "complete"), filepath.Join(progDataDir, "incomplete")
+	var mountPoint string = filepath.Join(completeTarget, "proc")
+	if err := os.MkdirAll(mountPoint, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(incompleteTarget, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []registryEntry{
+		{Target: completeTarget, CodeName: testCodeCame},
+		{Target: incompleteTarget, CodeName: testCodeCame, Incomplete: true},
+	} {
+		if err := registerComprt(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := syscall.Mount("tmpfs", mountPoint, "tmpfs", 0, ""); err != nil {
+		t.Skipf("unable to mount a tmpfs on this host: %v", err)
+	}
+	defer syscall.Unmount(mountPoint, syscall.MNT_DETACH)
+
+	if err := cleanupComprts("", false, true); err != nil {
+		t.Fatal(err)
+	}
+	mounts, err := readMountInfo(procSelfMountInfo)
+	if err != nil {
+		t.Fatal(err)
+	} else if isMountPoint(mountPoint, mounts) {
+		t.Fatalf("%v was not unmounted", mountPoint)
+	}
+	if _, err := os.Stat(incompleteTarget); err != nil {
+		t.Fatalf("an incomplete comprt was removed without asking: %v", err)
+	}
+
+	if err := cleanupComprts("", true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(incompleteTarget); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("%v was not removed", incompleteTarget)
+	} else if _, err := os.Stat(completeTarget); err != nil {
+		t.Fatalf("a complete comprt was removed: %v", err)
+	}
+}
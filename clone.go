@@ -0,0 +1,135 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// A type that can natively duplicate a comprt, implemented by the snapshotters
+// of filesystems that support it.
+type cloner interface {
+	Clone(src, dest string) error
+}
+
+// Duplicate the src comprt into dest. Native filesystem clones are used where
+// possible, then reflink copies and finally a tar pipe. The clone gets its own
+// machine-id and registry entry.
+func cloneComprt(src, dest string) error {
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("%v already exists", dest)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	s, err := getSnapshotter(src, defaultCodecName)
+	if err != nil {
+		return err
+	}
+
+	var cloned bool
+	if c, ok := s.(cloner); ok {
+		if err := c.Clone(src, dest); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: unable to clone with %v, falling back to copying: %v\n", progname, s.Name(), err)
+		} else {
+			cloned = true
+		}
+	}
+	if !cloned {
+		if err := copyComprt(src, dest); err != nil {
+			os.RemoveAll(dest)
+			return err
+		}
+	}
+
+	if err := regenerateMachineId(dest); err != nil {
+		return err
+	}
+
+	entry, err := lookupComprt(src)
+	if err != nil {
+		return err
+	} else if entry == nil {
+		entry = &registryEntry{}
+	}
+	entry.Target = dest
+	entry.Created = time.Now().UTC()
+	entry.Updated = entry.Created
+
+	return registerComprt(*entry)
+}
+
+// Copy the src comprt into dest, sharing the file data through reflinks if the
+// filesystem supports it. Otherwise the comprt is copied with a tar pipe.
+func copyComprt(src, dest string) error {
+	cpCmd := exec.Command("cp", "--archive", "--reflink=always", "--one-file-system", "--", src, dest)
+	if err := progExecutor.Run(cpCmd); err == nil {
+		return nil
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+
+	if err := os.Mkdir(dest, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X)); err != nil {
+		return err
+	}
+
+	tarCreateCmd := exec.Command("tar", "--create", "--file", "-", "--directory", src, "--numeric-owner", "--xattrs", "--acls", "--one-file-system", ".")
+	tarExtractCmd := exec.Command("tar", "--extract", "--file", "-", "--directory", dest, "--numeric-owner", "--same-permissions", "--xattrs", "--xattrs-include=*", "--acls")
+	tarCreateCmd.Stderr = os.Stderr
+	tarExtractCmd.Stderr = os.Stderr
+
+	return runPipe(tarCreateCmd, tarExtractCmd)
+}
+
+// Give the comprt a new machine-id, as no two systems should share one. For
+// reference:
+// https://www.freedesktop.org/software/systemd/man/machine-id.html
+func regenerateMachineId(target string) error {
+	machineIdPath := filepath.Join(target, "/etc/machine-id")
+	machineId, err := os.ReadFile(machineIdPath)
+	if errors.Is(err, fs.ErrNotExist) || len(machineId) == 0 {
+		// an empty machine-id is generated on the comprt's first boot
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	newMachineId := make([]byte, 16)
+	if _, err := rand.Read(newMachineId); err != nil {
+		return err
+	}
+	machineId = []byte(hex.EncodeToString(newMachineId) + "\n")
+
+	if err := os.WriteFile(machineIdPath, machineId, ModeFile|(OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R)); err != nil {
+		return err
+	}
+
+	// older comprts may have dbus's own copy rather than a symlink to /etc/machine-id
+	dbusMachineIdPath := filepath.Join(target, "/var/lib/dbus/machine-id")
+	if fileInfo, err := os.Lstat(dbusMachineIdPath); err == nil && fileInfo.Mode().IsRegular() {
+		return os.WriteFile(dbusMachineIdPath, machineId, ModeFile|(OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R))
+	}
+
+	return nil
+}
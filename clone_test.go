@@ -0,0 +1,73 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCloneComprt(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	src, dest := filepath.Join(tempDirPath, "foo"), filepath.Join(tempDirPath, "bar")
+	if err := os.MkdirAll(filepath.Join(src, "/etc"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	var machineId string = "0123456789abcdef0123456789abcdef\n"
+	if err := os.WriteFile(filepath.Join(src, "/etc/machine-id"), []byte(machineId), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "/etc/hostname"), []byte("foo\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerComprt(registryEntry{Target: src, CodeName: testCodeCame}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cloneComprt(src, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	if hostname, err := os.ReadFile(filepath.Join(dest, "/etc/hostname")); err != nil {
+		t.Fatal(err)
+	} else if string(hostname) != "foo\n" {
+		t.Fatalf("the clone's contents differ from the comprt's: %q", hostname)
+	}
+
+	if newMachineId, err := os.ReadFile(filepath.Join(dest, "/etc/machine-id")); err != nil {
+		t.Fatal(err)
+	} else if string(newMachineId) == machineId || len(newMachineId) != len(machineId) {
+		t.Fatalf("the clone's machine-id was not regenerated: %q", newMachineId)
+	}
+
+	entry, err := lookupComprt(dest)
+	if err != nil {
+		t.Fatal(err)
+	} else if entry == nil || entry.CodeName != testCodeCame {
+		t.Fatalf("the clone's registry entry was not created from the comprt's: %v", entry)
+	}
+
+	if err := cloneComprt(src, dest); err == nil {
+		t.Fatal("a comprt was cloned over an existing dir")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	cloudInitPkg = "cloud-init"
+
+	// Where cloud-init's NoCloud datasource looks for seed data on the root
+	// filesystem, for reference:
+	// https://cloudinit.readthedocs.io/en/latest/topics/datasources/nocloud.html
+	cloudInitSeedDir      = "/var/lib/cloud/seed/nocloud"
+	cloudInitUserDataName = "user-data"
+	cloudInitMetaDataName = "meta-data"
+)
+
+// A type used to store the seed data cloud-init is given in a comprt.
+type cloudInitSeed struct {
+	userDataPath string
+	// Empty if the meta-data is to be generated.
+	metaDataPath string
+}
+
+// Parse the seed data passed in as 'USER_DATA[,META_DATA]'.
+func parseCloudInitSeed(value string) (*cloudInitSeed, error) {
+	fields := strings.Split(value, ",")
+	if len(fields) > 2 || fields[0] == "" {
+		return nil, fmt.Errorf("%v is not properly formatted cloud-init seed data (e.g. USER_DATA[,META_DATA])", value)
+	}
+
+	var seed cloudInitSeed = cloudInitSeed{userDataPath: fields[0]}
+	if len(fields) == 2 {
+		seed.metaDataPath = fields[1]
+	}
+	for _, path := range []string{seed.userDataPath, seed.metaDataPath} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return &seed, nil
+}
+
+// Generate the meta-data of a comprt, for when none is passed in. NoCloud
+// requires an instance-id, the comprt's name is used for it (and the hostname).
+func cloudInitMetaData(target string) string {
+	var name string = filepath.Base(filepath.Clean(target))
+	return fmt.Sprintf("instance-id: iid-%v\nlocal-hostname: %v\n", name, name)
+}
+
+// Get the copies that place the seed data into the comprt. Generated meta-data
+// is written into the dir, which is to outlive the copies being made. The
+// user-data is only readable by root, as it may hold secrets.
+func (seed cloudInitSeed) copies(target, dir string) ([]comprtCopy, error) {
+	var metaDataPath string = seed.metaDataPath
+	if metaDataPath == "" {
+		metaDataPath = filepath.Join(dir, cloudInitMetaDataName)
+		if err := os.WriteFile(metaDataPath, []byte(cloudInitMetaData(target)), OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R); err != nil {
+			return nil, err
+		}
+	}
+
+	return []comprtCopy{
+		{
+			Src:  seed.userDataPath,
+			Dest: filepath.Join(cloudInitSeedDir, cloudInitUserDataName),
+			Mode: "0600",
+		},
+		{
+			Src:  metaDataPath,
+			Dest: filepath.Join(cloudInitSeedDir, cloudInitMetaDataName),
+			Mode: "0644",
+		},
+	}, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCloudInitSeed(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	userDataPath, metaDataPath := filepath.Join(tempDirPath, "user-data.yaml"), filepath.Join(tempDirPath, "meta-data.yaml")
+	for _, path := range []string{userDataPath, metaDataPath} {
+		if err := os.WriteFile(path, []byte("#cloud-config\n"), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seed, err := parseCloudInitSeed(userDataPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if seed.userDataPath != userDataPath || seed.metaDataPath != "" {
+		t.Fatalf("unexpected seed: %+v", *seed)
+	}
+
+	seed, err = parseCloudInitSeed(userDataPath + "," + metaDataPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if seed.userDataPath != userDataPath || seed.metaDataPath != metaDataPath {
+		t.Fatalf("unexpected seed: %+v", *seed)
+	}
+
+	for _, value := range []string{
+		"",
+		"," + metaDataPath,
+		userDataPath + "," + metaDataPath + "," + metaDataPath,
+		filepath.Join(tempDirPath, "foo"),
+	} {
+		if _, err := parseCloudInitSeed(value); err == nil {
+			t.Fatalf("%q was accepted", value)
+		}
+	}
+}
+
+func TestCloudInitSeedCopies(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	userDataPath := filepath.Join(tempDirPath, "user-data.yaml")
+	if err := os.WriteFile(userDataPath, []byte("#cloud-config\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	copies, err := cloudInitSeed{userDataPath: userDataPath}.copies("/srv/foo", tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copies) != 2 {
+		t.Fatalf("expected 2 copies, actual: %v", copies)
+	}
+	for _, comprtCp := range copies {
+		if err := comprtCp.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if expected := filepath.Join(cloudInitSeedDir, cloudInitUserDataName); copies[0].Dest != expected {
+		t.Fatalf("expected: %v, actual: %v", expected, copies[0].Dest)
+	}
+	metaData, err := os.ReadFile(copies[1].Src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "instance-id: iid-foo\nlocal-hostname: foo\n"; string(metaData) != expected {
+		t.Fatalf("expected: %q, actual: %q", expected, metaData)
+	}
+}
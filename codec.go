@@ -0,0 +1,248 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	defaultCodecName = "gzip"
+	noCodecName      = "none"
+)
+
+// A type that can compress and decompress the archives used by debcomprt
+// (e.g. exports, snapshots, cached tarballs).
+type codec interface {
+	// The name used to select the codec (e.g. --compression gzip).
+	Name() string
+	// The file extension appended to an archive compressed by the codec.
+	Ext() string
+	// The magic bytes found at the start of a stream compressed by the codec.
+	Magic() []byte
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Mappings of codec names to their respective codec. New codecs only need to be
+// added here to be available to every archive feature.
+var codecs = map[string]codec{}
+
+func init() {
+	registerCodec(noneCodec{})
+	registerCodec(gzipCodec{})
+	registerCodec(&cmdCodec{name: "zstd", ext: ".zst", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}})
+	registerCodec(&cmdCodec{name: "xz", ext: ".xz", magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}})
+}
+
+// Add the codec to the registry of codecs.
+func registerCodec(c codec) {
+	codecs[c.Name()] = c
+}
+
+// Get the codec by its name.
+func getCodec(name string) (codec, error) {
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%v is not a supported compression, use one of: %v", name, strings.Join(codecNames(), ", "))
+	}
+
+	return c, nil
+}
+
+// Get the names of all the codecs registered.
+func codecNames() []string {
+	var names []string
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Determine the codec used to compress the stream by looking at the stream's
+// magic bytes. The returned reader must be used in place of r, as some of r
+// will have been read in. Streams without known magic bytes are assumed to be
+// uncompressed.
+func detectCodec(r io.Reader) (codec, io.Reader, error) {
+	bufR := bufio.NewReader(r)
+	for _, c := range codecs {
+		if len(c.Magic()) == 0 {
+			continue
+		}
+
+		header, err := bufR.Peek(len(c.Magic()))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, bufR, err
+		}
+		if bytes.Equal(header, c.Magic()) {
+			return c, bufR, nil
+		}
+	}
+
+	return codecs[noCodecName], bufR, nil
+}
+
+// Create the --compression flag shared by the commands that work with archives.
+func compressionFlag(destination *string) cli.Flag {
+	return &cli.StringFlag{
+		Name:        "compression",
+		Value:       defaultCodecName,
+		Usage:       fmt.Sprintf("compress archives with `CODEC` (one of: %v)", strings.Join(codecNames(), ", ")),
+		Destination: destination,
+	}
+}
+
+// A codec that leaves a stream as is.
+type noneCodec struct{}
+
+func (noneCodec) Name() string  { return noCodecName }
+func (noneCodec) Ext() string   { return "" }
+func (noneCodec) Magic() []byte { return nil }
+
+func (noneCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (noneCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+// A codec using golang's gzip implementation.
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string  { return "gzip" }
+func (gzipCodec) Ext() string   { return ".gz" }
+func (gzipCodec) Magic() []byte { return []byte{0x1f, 0x8b} }
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// A codec that has the host's executable of the same name do the work
+// (e.g. zstd, xz). This avoids vendoring a library per codec.
+type cmdCodec struct {
+	name  string
+	ext   string
+	magic []byte
+}
+
+func (c *cmdCodec) Name() string  { return c.name }
+func (c *cmdCodec) Ext() string   { return c.ext }
+func (c *cmdCodec) Magic() []byte { return c.magic }
+
+func (c *cmdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	cmdPath, err := exec.LookPath(c.name)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(cmdPath, "--compress", "--stdout")
+	cmd.Stdout = w
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &cmdWriteCloser{WriteCloser: stdin, cmd: cmd}, nil
+}
+
+func (c *cmdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	cmdPath, err := exec.LookPath(c.name)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(cmdPath, "--decompress", "--stdout")
+	cmd.Stdin = r
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &cmdReadCloser{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// A io.WriteCloser that also waits on the command consuming what is written.
+type cmdWriteCloser struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (wc *cmdWriteCloser) Close() error {
+	if err := wc.WriteCloser.Close(); err != nil {
+		return err
+	}
+
+	return wc.cmd.Wait()
+}
+
+// A io.ReadCloser that also waits on the command producing what is read.
+type cmdReadCloser struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+	eof bool
+}
+
+func (rc *cmdReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(p)
+	if errors.Is(err, io.EOF) {
+		rc.eof = true
+	}
+
+	return n, err
+}
+
+func (rc *cmdReadCloser) Close() error {
+	// the command has exited by the time its stdout has been read in full
+	if rc.eof {
+		return rc.cmd.Wait()
+	}
+
+	// otherwise the command could be blocked writing to a stdout no one is
+	// reading anymore, how it then exits is of no interest to the caller
+	rc.ReadCloser.Close()
+	rc.cmd.Process.Kill()
+	rc.cmd.Wait()
+	return nil
+}
+
+// A io.Writer with a no-op Close method.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,130 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestCodecsRoundTripAndDetect(t *testing.T) {
+	var contents []byte = []byte("hello\nthere!\n")
+	for _, name := range codecNames() {
+		c, err := getCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := c.(*cmdCodec); ok {
+			if _, err := exec.LookPath(name); err != nil {
+				t.Logf("skipping %v codec, %v", name, err)
+				continue
+			}
+		}
+
+		var compressed bytes.Buffer
+		w, err := c.NewWriter(&compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(contents); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		detectedCodec, r, err := detectCodec(&compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if detectedCodec.Name() != name {
+			t.Fatalf("detected %v codec for a stream compressed by %v", detectedCodec.Name(), name)
+		}
+
+		rc, err := detectedCodec.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(decompressed, contents) {
+			t.Fatalf("%v codec did not round trip the contents: %q", name, decompressed)
+		}
+	}
+}
+
+func TestGetCodecUnsupported(t *testing.T) {
+	if _, err := getCodec("foo"); err == nil {
+		t.Fatal("an unsupported codec was returned without error")
+	}
+}
+
+func TestCodecsCloseAfterPartialRead(t *testing.T) {
+	// more than a pipe's buffer, so a command is left blocked writing it
+	var contents []byte = make([]byte, 4*1024*1024)
+	rand.Read(contents)
+	for _, name := range codecNames() {
+		c, err := getCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := c.(*cmdCodec); ok {
+			if _, err := exec.LookPath(name); err != nil {
+				t.Logf("skipping %v codec, %v", name, err)
+				continue
+			}
+		}
+
+		var compressed bytes.Buffer
+		w, err := c.NewWriter(&compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(contents); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		rc, err := c.NewReader(&compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(rc, make([]byte, 16)); err != nil {
+			t.Fatal(err)
+		}
+		closed := make(chan error, 1)
+		go func() { closed <- rc.Close() }()
+		select {
+		case err := <-closed:
+			if err != nil {
+				t.Fatalf("%v codec failed to close after a partial read: %v", name, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%v codec did not close after a partial read", name)
+		}
+	}
+}
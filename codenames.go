@@ -0,0 +1,267 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+const (
+	// Where debootstrap keeps its scripts, one script (or symlink to one) per suite
+	// that the installed debootstrap is able to build.
+	debootstrapScriptsDir = "/usr/share/debootstrap/scripts"
+
+	// The file in debcomprt's data dir with the user's codename to mirror mappings.
+	mirrorMappingsFile = "mirrors.json"
+
+	ubuntuPortsMirror = "http://ports.ubuntu.com/ubuntu-ports/"
+
+	mirrorSourceUser        = "user"
+	mirrorSourceDistroInfo  = "distro-info"
+	mirrorSourceDebootstrap = "debootstrap"
+)
+
+// The suite names debian's releases are also known by, these change codename
+// with each release.
+var debianSuiteNames = []string{"oldoldstable", "oldstable", "stable", "testing", "unstable"}
+
+// The architectures carried by ubuntu's main archive, the others are carried by
+// ports.ubuntu.com.
+var ubuntuArchiveArchs = []string{"amd64", "i386"}
+
+// A type used to describe a user's mapping of a codename to a mirror, these add
+// to or override the mappings from distro-info.
+type mirrorMapping struct {
+	Codename string `json:"codename"`
+	Mirror   string `json:"mirror"`
+	// The debian architecture the mapping is used for, every architecture if empty.
+	Arch string `json:"arch,omitempty"`
+}
+
+// A type used to describe the mirror a codename is created from by default, and
+// where that mapping came from.
+type codenameMirror struct {
+	codeName string
+	// Empty if debcomprt does not know of a mirror for the codename.
+	mirror string
+	source string
+}
+
+// Read in the user's mirror mappings. Mappings that do not exist yet are
+// treated as empty.
+func loadUserMirrorMappings() ([]mirrorMapping, error) {
+	var mappings []mirrorMapping
+	mappingsBytes, err := os.ReadFile(filepath.Join(progDataDir, mirrorMappingsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return mappings, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(mappingsBytes, &mappings); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %w", mirrorMappingsFile, err)
+	}
+
+	var seen map[mirrorMapping]bool = make(map[mirrorMapping]bool)
+	for _, mapping := range mappings {
+		if mapping.Codename == "" || mapping.Mirror == "" {
+			return nil, fmt.Errorf("mirror mappings require a codename and a mirror, got %+v", mapping)
+		} else if key := (mirrorMapping{Codename: mapping.Codename, Arch: mapping.Arch}); seen[key] {
+			return nil, fmt.Errorf("the mirror of %v (%v) is mapped more than once", mapping.Codename, mapping.Arch)
+		} else {
+			seen[key] = true
+		}
+	}
+
+	return mappings, nil
+}
+
+// Get the mirror a comprt of the codename and architecture is created from by
+// default. A user's mapping for the architecture comes first, then a user's
+// mapping for every architecture and last the mapping from distro-info.
+func lookupCodenameMirror(codeName, arch string, userMappings []mirrorMapping) (codenameMirror, bool) {
+	for _, anyArch := range []bool{false, true} {
+		for _, mapping := range userMappings {
+			if mapping.Codename == codeName && (mapping.Arch == arch && !anyArch || mapping.Arch == "" && anyArch) {
+				return codenameMirror{codeName, mapping.Mirror, mirrorSourceUser}, true
+			}
+		}
+	}
+
+	mirror, ok := defaultMirrorMappings[codeName]
+	if !ok {
+		return codenameMirror{codeName: codeName}, false
+	}
+	if mirror == defaultUbuntuMirror && !stringInArr(arch, &ubuntuArchiveArchs) {
+		mirror = ubuntuPortsMirror
+	}
+
+	return codenameMirror{codeName, mirror, mirrorSourceDistroInfo}, true
+}
+
+// Get the codenames that can be used to create a comprt of the architecture,
+// along with their default mirror. Codenames come from the debootstrap scripts
+// dir and the codenames debcomprt knows a mirror for.
+func listCodenameMirrors(scriptsDir, arch string) ([]codenameMirror, error) {
+	userMappings, err := loadUserMirrorMappings()
+	if err != nil {
+		return nil, err
+	}
+
+	var codenames []string
+	var seen map[string]bool = make(map[string]bool)
+	for codename := range defaultMirrorMappings {
+		seen[codename] = true
+		codenames = append(codenames, codename)
+	}
+	for _, mapping := range userMappings {
+		if !seen[mapping.Codename] {
+			seen[mapping.Codename] = true
+			codenames = append(codenames, mapping.Codename)
+		}
+	}
+
+	entries, err := os.ReadDir(scriptsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		// debootstrap's scripts dir can also contain non-suite files (e.g. 'debian-common')
+		if entry.IsDir() || !entry.Type().IsRegular() && entry.Type()&fs.ModeSymlink == 0 {
+			continue
+		} else if stringInArr(entry.Name(), &[]string{"debian-common", "ubuntu-common"}) {
+			continue
+		} else if seen[entry.Name()] {
+			continue
+		}
+		seen[entry.Name()] = true
+		codenames = append(codenames, entry.Name())
+	}
+	sort.Strings(codenames)
+
+	var codenameMirrors []codenameMirror
+	for _, codename := range codenames {
+		mirror, ok := lookupCodenameMirror(codename, arch, userMappings)
+		if !ok {
+			mirror.source = mirrorSourceDebootstrap
+		}
+		codenameMirrors = append(codenameMirrors, mirror)
+	}
+
+	return codenameMirrors, nil
+}
+
+// Get the codenames that can be used to create a comprt.
+func listCodenames(scriptsDir string) ([]string, error) {
+	codenameMirrors, err := listCodenameMirrors(scriptsDir, hostDebianArch())
+	if err != nil {
+		return nil, err
+	}
+
+	var codenames []string
+	for _, mirror := range codenameMirrors {
+		codenames = append(codenames, mirror.codeName)
+	}
+
+	return codenames, nil
+}
+
+// Write out the table of codenames and their default mirrors.
+func writeCodenameMirrors(w io.Writer, codenameMirrors []codenameMirror) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CODENAME\tMIRROR\tSOURCE")
+	for _, mirror := range codenameMirrors {
+		var mirrorUrl string = mirror.mirror
+		if mirrorUrl == "" {
+			mirrorUrl = "-"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", mirror.codeName, mirrorUrl, mirror.source)
+	}
+
+	return tw.Flush()
+}
+
+// Get the edit (Levenshtein) distance between two strings.
+func editDistance(a, b string) int {
+	var prev, cur []int = make([]int, len(b)+1), make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			var cost int = 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+// Get the known codename closest to the codename, ok is false if none of the
+// known codenames are close enough to be a typo of it.
+func suggestCodename(codeName string, codenames []string) (suggestion string, ok bool) {
+	// e.g. two typos in 'bookworm', though only one in 'sid'
+	var maxDistance int = len(codeName) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	} else if maxDistance > 2 {
+		maxDistance = 2
+	}
+
+	var bestDistance int = maxDistance + 1
+	for _, codename := range codenames {
+		if distance := editDistance(codeName, codename); distance < bestDistance {
+			suggestion, bestDistance = codename, distance
+		}
+	}
+
+	return suggestion, bestDistance <= maxDistance
+}
+
+// Check the codename is one of the known codenames, that way a typo is not found
+// out about after debootstrap fails to find it on the mirror. An unknown codename
+// that is not close to a known one is allowed when the mirror is passed in
+// (e.g. the suite of a derivative).
+func checkCodename(codeName string, codenames []string, mirrorPassedIn bool) error {
+	if stringInArr(codeName, &codenames) || stringInArr(codeName, &debianSuiteNames) {
+		return nil
+	}
+
+	if suggestion, ok := suggestCodename(codeName, codenames); ok {
+		return fmt.Errorf("%v is not a known codename, did you mean '%v'? (see debcomprt codenames)", codeName, suggestion)
+	} else if !mirrorPassedIn {
+		return fmt.Errorf("%v is not a known codename (see debcomprt codenames)", codeName)
+	}
+
+	return nil
+}
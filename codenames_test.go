@@ -0,0 +1,145 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestListCodenames(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	for _, script := range []string{"sid", "debian-common"} {
+		if err := createTestFile(filepath.Join(tempDirPath, script), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("sid", filepath.Join(tempDirPath, "bookworm")); err != nil {
+		t.Fatal(err)
+	}
+
+	codenames, err := listCodenames(tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sort.StringsAreSorted(codenames) {
+		t.Fatalf("codenames are not sorted: %v", codenames)
+	}
+	for _, codename := range []string{"sid", "bookworm", "buster", "focal"} {
+		if !stringInArr(codename, &codenames) {
+			t.Fatalf("%v was not listed as a codename: %v", codename, codenames)
+		}
+	}
+	if stringInArr("debian-common", &codenames) {
+		t.Fatalf("debian-common was listed as a codename: %v", codenames)
+	}
+}
+
+func TestLookupCodenameMirror(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	if err := createTestFile(filepath.Join(progDataDir, mirrorMappingsFile), `[
+	{"codename": "bookworm", "mirror": "http://deb.debian.org/debian/"},
+	{"codename": "bookworm", "mirror": "http://mirror.example/debian-arm64/", "arch": "arm64"},
+	{"codename": "foo", "mirror": "http://mirror.example/foo/"}
+]`); err != nil {
+		t.Fatal(err)
+	}
+	userMappings, err := loadUserMirrorMappings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		codeName, arch, expected string
+	}{
+		{"bookworm", "amd64", "http://deb.debian.org/debian/"},
+		{"bookworm", "arm64", "http://mirror.example/debian-arm64/"},
+		{"focal", "amd64", defaultUbuntuMirror},
+		{"focal", "arm64", ubuntuPortsMirror},
+	} {
+		if mirror, ok := lookupCodenameMirror(test.codeName, test.arch, userMappings); !ok || mirror.mirror != test.expected {
+			t.Fatalf("expected %v (%v) to be mapped to %v, got %+v", test.codeName, test.arch, test.expected, mirror)
+		}
+	}
+	if _, ok := lookupCodenameMirror("bar", "amd64", userMappings); ok {
+		t.Fatal("a mirror was found for an unknown codename")
+	}
+
+	codenames, err := listCodenames(filepath.Join(progDataDir, "scripts"))
+	if err != nil {
+		t.Fatal(err)
+	} else if !stringInArr("foo", &codenames) {
+		t.Fatalf("the user's codename was not listed: %v", codenames)
+	}
+
+	if err := createTestFile(filepath.Join(progDataDir, mirrorMappingsFile), `[{"codename": "foo"}]`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadUserMirrorMappings(); err == nil {
+		t.Fatal("a mirror mapping without a mirror was accepted")
+	}
+}
+
+func TestWriteCodenameMirrors(t *testing.T) {
+	var table bytes.Buffer
+	if err := writeCodenameMirrors(&table, []codenameMirror{
+		{"buster", defaultDebianMirror, mirrorSourceDistroInfo},
+		{"foo", "", mirrorSourceDebootstrap},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 3 || strings.Fields(lines[2])[1] != "-" {
+		t.Fatalf("unexpected codenames table: %q", table.String())
+	}
+}
+
+func TestCheckCodename(t *testing.T) {
+	var codenames []string = []string{"bookworm", "bullseye", "jammy", "sid"}
+	if distance := editDistance("bookwrom", "bookworm"); distance != 2 {
+		t.Fatalf("expected an edit distance of 2, got %v", distance)
+	}
+
+	for _, codeName := range []string{"bookworm", "stable"} {
+		if err := checkCodename(codeName, codenames, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := checkCodename("bookwrom", codenames, true); err == nil || !strings.Contains(err.Error(), "did you mean 'bookworm'?") {
+		t.Fatalf("a typo of a codename was not caught: %v", err)
+	} else if err := checkCodename("jamy", codenames, false); err == nil || !strings.Contains(err.Error(), "'jammy'") {
+		t.Fatalf("a typo of a codename was not caught: %v", err)
+	}
+
+	// e.g. the suite of a derivative
+	if err := checkCodename("kali-rolling", codenames, true); err != nil {
+		t.Fatal(err)
+	} else if err := checkCodename("kali-rolling", codenames, false); err == nil {
+		t.Fatal("an unknown codename was accepted without a mirror")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The SGR parameters of what debcomprt colors, for reference:
+// https://en.wikipedia.org/wiki/ANSI_escape_code#SGR_(Select_Graphic_Rendition)_parameters
+const (
+	phaseHeaderColor = "1;36"
+	warningColor     = "1;33"
+	errorColor       = "1;31"
+	passColor        = "32"
+	failColor        = "31"
+
+	noColorEnvVar = "NO_COLOR"
+)
+
+// Whether color is turned off (see --no-color).
+var noColor bool
+
+// Check whether the output written to w is to be colored. Only a terminal is
+// colored, and only if neither --no-color or NO_COLOR turn color off, for
+// reference:
+// https://no-color.org/
+func colorEnabled(w io.Writer) bool {
+	if noColor {
+		return false
+	} else if value, ok := os.LookupEnv(noColorEnvVar); ok && value != "" {
+		return false
+	}
+
+	file, ok := w.(*os.File)
+	return ok && isTerminal(file.Fd())
+}
+
+// Color the text, if the output written to w is to be colored.
+func colorize(w io.Writer, color, text string) string {
+	if !colorEnabled(w) {
+		return text
+	}
+
+	return "\x1b[" + color + "m" + text + "\x1b[0m"
+}
+
+// Output a warning to stderr.
+func warnf(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, "%s: %s "+format+"\n", append([]interface{}{progname, colorize(os.Stderr, warningColor, "warning:")}, a...)...)
+}
+
+// A type used to color each line written to w (e.g. the errors logged).
+type colorWriter struct {
+	w     io.Writer
+	color string
+}
+
+func (writer colorWriter) Write(p []byte) (int, error) {
+	if !colorEnabled(writer.w) {
+		return writer.w.Write(p)
+	}
+
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var text []byte = bytes.TrimSuffix(line, []byte("\n"))
+		buf.WriteString(colorize(writer.w, writer.color, string(text)))
+		buf.Write(line[len(text):])
+	}
+	if _, err := writer.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
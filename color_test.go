@@ -0,0 +1,58 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestColorize(t *testing.T) {
+	master, slave, err := openTestPty()
+	if err != nil {
+		t.Skipf("unable to open a pty: %v", err)
+	}
+	defer master.Close()
+	defer slave.Close()
+	// an empty NO_COLOR leaves color on
+	t.Setenv(noColorEnvVar, "")
+
+	if text := colorize(slave, warningColor, "warning:"); text != "\x1b[1;33mwarning:\x1b[0m" {
+		t.Fatalf("expected the text to be colored on a terminal, got %q", text)
+	}
+	if text := colorize(&bytes.Buffer{}, warningColor, "warning:"); text != "warning:" {
+		t.Fatalf("expected the text not to be colored off a terminal, got %q", text)
+	}
+
+	noColor = true
+	if text := colorize(slave, warningColor, "warning:"); text != "warning:" {
+		t.Fatalf("expected --no-color to turn color off, got %q", text)
+	}
+	noColor = false
+
+	t.Setenv(noColorEnvVar, "1")
+	if text := colorize(slave, warningColor, "warning:"); text != "warning:" {
+		t.Fatalf("expected %v to turn color off, got %q", noColorEnvVar, text)
+	}
+}
+
+func TestColorWriter(t *testing.T) {
+	var buf bytes.Buffer
+	if n, err := (colorWriter{w: &buf, color: errorColor}).Write([]byte("foo\n")); err != nil {
+		t.Fatal(err)
+	} else if n != 4 || buf.String() != "foo\n" {
+		t.Fatalf("expected the output to be passed on as is, got %q", buf.String())
+	}
+}
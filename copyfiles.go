@@ -0,0 +1,290 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A type used to describe a host file or dir copied into the comprt.
+type comprtCopy struct {
+	Src  string `json:"src"`
+	Dest string `json:"dest"`
+	// A name or id found in the comprt, what is copied is owned by root otherwise.
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+	// An octal mode (e.g. 0600) for the files copied, otherwise the files (and
+	// every dir) keep the mode they have on the host.
+	Mode string `json:"mode,omitempty"`
+}
+
+// Parse a copy passed in as 'SRC:DEST[:OWNER[:GROUP[:MODE]]]', where an empty
+// field is left unset (e.g. './id_rsa:/root/.ssh/id_rsa:::0600').
+func parseComprtCopy(value string) (comprtCopy, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) < 2 || len(fields) > 5 {
+		return comprtCopy{}, fmt.Errorf("%v is not a properly formatted copy (e.g. SRC:DEST[:OWNER[:GROUP[:MODE]]])", value)
+	}
+	for len(fields) < 5 {
+		fields = append(fields, "")
+	}
+
+	return comprtCopy{Src: fields[0], Dest: fields[1], Owner: fields[2], Group: fields[3], Mode: fields[4]}, nil
+}
+
+// Parse the copies passed in.
+func parseComprtCopies(values []string) ([]comprtCopy, error) {
+	var copies []comprtCopy
+	for _, value := range values {
+		comprtCp, err := parseComprtCopy(value)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, comprtCp)
+	}
+
+	return copies, nil
+}
+
+// Check that the copy can be made into the comprt.
+func (comprtCp comprtCopy) validate() error {
+	if _, err := os.Lstat(comprtCp.Src); err != nil {
+		return err
+	} else if !filepath.IsAbs(comprtCp.Dest) || filepath.Clean(comprtCp.Dest) == "/" {
+		return fmt.Errorf("the dest of the copy of %v must be an absolute path other than /", comprtCp.Src)
+	} else if _, _, err := comprtCp.mode(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Get the mode for the files copied, ok is false if the files keep their own.
+func (comprtCp comprtCopy) mode() (mode fs.FileMode, ok bool, err error) {
+	if comprtCp.Mode == "" {
+		return 0, false, nil
+	}
+
+	parsedMode, err := strconv.ParseUint(comprtCp.Mode, 8, 32)
+	if err != nil || parsedMode > 0o7777 {
+		return 0, false, fmt.Errorf("%v is not an octal mode (e.g. 0644)", comprtCp.Mode)
+	}
+
+	return fs.FileMode(parsedMode&0o777) | unixModeBits(parsedMode), true, nil
+}
+
+// Convert the setuid, setgid and sticky bits of a unix mode to their go mode bits.
+func unixModeBits(mode uint64) fs.FileMode {
+	var goMode fs.FileMode
+	if mode&0o4000 != 0 {
+		goMode |= fs.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		goMode |= fs.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		goMode |= fs.ModeSticky
+	}
+
+	return goMode
+}
+
+// Check that a path in the comprt does not go through a symlink, as the symlink
+// would be followed on the host instead of in the comprt.
+func checkComprtPath(target, comprtPath string) error {
+	var path string = target
+	for _, name := range strings.Split(strings.TrimPrefix(filepath.Clean(comprtPath), "/"), "/") {
+		path = filepath.Join(path, name)
+		if fileInfo, err := os.Lstat(path); err == nil && fileInfo.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%v goes through a symlink in the comprt", comprtPath)
+		} else if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Look up the id of the user or group in the comprt's passwd or group file, an
+// id is used as is. An empty name is -1, which os.Lchown leaves unchanged.
+func lookupComprtId(target, dbPath, name string) (int, error) {
+	if name == "" {
+		return -1, nil
+	} else if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	var nameIndex, idIndex int = 0, 2
+	id, err := locateField(
+		filepath.Join(target, dbPath),
+		regexp.MustCompile(":"),
+		nameIndex,
+		idIndex,
+		regexp.MustCompile("^"+regexp.QuoteMeta(name)+"$"),
+	)
+	if err != nil {
+		return -1, err
+	} else if id == "" {
+		return -1, fmt.Errorf("%v was not found in the comprt's %v", name, dbPath)
+	}
+
+	return strconv.Atoi(id)
+}
+
+// Copy the src into the comprt at dest, recursively if src is a dir. Files
+// already at dest are replaced, dirs are merged.
+func (comprtCp comprtCopy) copyInto(target string) error {
+	if err := checkComprtPath(target, comprtCp.Dest); err != nil {
+		return err
+	}
+	uid, err := lookupComprtId(target, "/etc/passwd", comprtCp.Owner)
+	if err != nil {
+		return err
+	}
+	gid, err := lookupComprtId(target, "/etc/group", comprtCp.Group)
+	if err != nil {
+		return err
+	}
+	mode, setMode, err := comprtCp.mode()
+	if err != nil {
+		return err
+	}
+
+	var dest string = filepath.Join(target, comprtCp.Dest)
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(comprtCp.Src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(comprtCp.Src, path)
+		if err != nil {
+			return err
+		}
+		var entryDest string = filepath.Join(dest, rel)
+
+		entryInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			if fileInfo, err := os.Lstat(entryDest); err == nil && !fileInfo.IsDir() {
+				return fmt.Errorf("unable to copy the dir %v over %v in the comprt", path, filepath.Join(comprtCp.Dest, rel))
+			}
+			if err := os.MkdirAll(entryDest, os.ModeDir|entryInfo.Mode().Perm()); err != nil {
+				return err
+			}
+			if err := os.Chmod(entryDest, entryInfo.Mode().Perm()); err != nil {
+				return err
+			}
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(entryDest); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if err := os.Symlink(link, entryDest); err != nil {
+				return err
+			}
+		case entry.Type().IsRegular():
+			if err := replaceFile(path, entryDest); err != nil {
+				return err
+			}
+			var entryMode fs.FileMode = entryInfo.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+			if setMode {
+				entryMode = mode
+			}
+			// chown clears the setuid and setgid bits, so the mode is set afterwards
+			if err := os.Lchown(entryDest, uid, gid); err != nil {
+				return err
+			}
+			return os.Chmod(entryDest, entryMode)
+		default:
+			return fmt.Errorf("unable to copy %v into the comprt, it is not a file, dir or symlink", path)
+		}
+
+		return os.Lchown(entryDest, uid, gid)
+	})
+}
+
+// Copy the src file to dest, replacing whatever is at dest.
+func replaceFile(src, dest string) error {
+	if err := os.Remove(dest); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	srcFd, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFd.Close()
+
+	destFd, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, OS_USER_R|OS_USER_W)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(destFd, srcFd); err != nil {
+		destFd.Close()
+		return err
+	}
+
+	return destFd.Close()
+}
+
+// Get the mmdebstrap customize hooks that copy the src into the comprt, the
+// same as copyInto does. The owner and mode are set from inside the comprt.
+func (comprtCp comprtCopy) mmdebstrapArgs() []string {
+	var args []string = []string{
+		`--customize-hook=mkdir -p "$1"` + shellQuote(filepath.Dir(comprtCp.Dest)),
+	}
+	if fileInfo, err := os.Stat(comprtCp.Src); err == nil && fileInfo.IsDir() {
+		args = append(args,
+			`--customize-hook=mkdir -p "$1"`+shellQuote(comprtCp.Dest),
+			"--customize-hook=sync-in "+shellQuote(comprtCp.Src)+" "+shellQuote(comprtCp.Dest),
+		)
+	} else {
+		args = append(args, "--customize-hook=upload "+shellQuote(comprtCp.Src)+" "+shellQuote(comprtCp.Dest))
+	}
+
+	var chrootCmd string = `--customize-hook=chroot "$1" `
+	if comprtCp.Owner != "" || comprtCp.Group != "" {
+		// chown would otherwise change the group to the owner's login group
+		var owner string = comprtCp.Owner
+		if comprtCp.Group != "" {
+			owner += ":" + comprtCp.Group
+		}
+		args = append(args, chrootCmd+"chown -R -h "+shellQuote(owner)+" "+shellQuote(comprtCp.Dest))
+	}
+	if comprtCp.Mode != "" {
+		args = append(args, chrootCmd+"find "+shellQuote(comprtCp.Dest)+" -type f -exec chmod "+shellQuote(comprtCp.Mode)+" {} +")
+	}
+
+	return args
+}
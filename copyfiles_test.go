@@ -0,0 +1,146 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestParseComprtCopy(t *testing.T) {
+	copies, err := parseComprtCopies([]string{"./motd:/etc/motd", "./id_ed25519:/root/.ssh/id_ed25519:::0600", "./src:/home/builder/src:builder:builder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []comprtCopy = []comprtCopy{
+		{Src: "./motd", Dest: "/etc/motd"},
+		{Src: "./id_ed25519", Dest: "/root/.ssh/id_ed25519", Mode: "0600"},
+		{Src: "./src", Dest: "/home/builder/src", Owner: "builder", Group: "builder"},
+	}
+	if !reflect.DeepEqual(copies, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, copies)
+	}
+
+	for _, value := range []string{"./motd", "./motd:/etc/motd:root:root:0644:foo"} {
+		if _, err := parseComprtCopy(value); err == nil {
+			t.Fatalf("an improperly formatted copy was accepted: %v", value)
+		}
+	}
+
+	for _, invalidCp := range []comprtCopy{
+		{Src: "/etc/hostname", Dest: "etc/hostname"},
+		{Src: "/etc/hostname", Dest: "/"},
+		{Src: "/etc/hostname", Dest: "/etc/hostname", Mode: "rw-r--r--"},
+		{Src: "/etc/hostname", Dest: "/etc/hostname", Mode: "17777"},
+	} {
+		if err := invalidCp.validate(); err == nil {
+			t.Fatalf("an invalid copy was accepted: %+v", invalidCp)
+		}
+	}
+}
+
+func TestComprtCopyInto(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var srcPath, targetPath string = filepath.Join(tempDirPath, "src"), filepath.Join(tempDirPath, "target")
+	for _, dir := range []string{filepath.Join(srcPath, "scripts"), filepath.Join(targetPath, "etc")} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createTestFile(filepath.Join(srcPath, "scripts", "build.sh"), "#!/bin/sh\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("scripts/build.sh", filepath.Join(srcPath, "build")); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(targetPath, "/etc/passwd"), "root:x:0:0:root:/root:/bin/bash\nbuilder:x:2000:2000::/home/builder:/bin/bash\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(targetPath, "/etc/group"), "root:x:0:\nbuilder:x:2000:\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (comprtCopy{Src: srcPath, Dest: "/home/builder/src", Owner: "builder", Group: "2000", Mode: "0750"}).copyInto(targetPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var buildScriptPath string = filepath.Join(targetPath, "/home/builder/src/scripts/build.sh")
+	var buildScriptStat *syscall.Stat_t = &syscall.Stat_t{}
+	if err := stat(buildScriptPath, buildScriptStat); err != nil {
+		t.Fatal(err)
+	} else if buildScriptStat.Uid != 2000 || buildScriptStat.Gid != 2000 {
+		t.Fatalf("the copy was not owned by builder: %v:%v", buildScriptStat.Uid, buildScriptStat.Gid)
+	} else if buildScriptStat.Mode&0o7777 != 0o750 {
+		t.Fatalf("the copy was not given the mode: %o", buildScriptStat.Mode&0o7777)
+	}
+	if link, err := os.Readlink(filepath.Join(targetPath, "/home/builder/src/build")); err != nil {
+		t.Fatal(err)
+	} else if link != "scripts/build.sh" {
+		t.Fatalf("the symlink was not copied as is: %v", link)
+	}
+
+	// copying again replaces the files
+	if err := createTestFile(filepath.Join(srcPath, "scripts", "build.sh"), "#!/bin/sh\nmake\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := (comprtCopy{Src: srcPath, Dest: "/home/builder/src"}).copyInto(targetPath); err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := os.ReadFile(buildScriptPath); err != nil {
+		t.Fatal(err)
+	} else if string(contents) != "#!/bin/sh\nmake\n" {
+		t.Fatalf("the file in the comprt was not replaced: %q", contents)
+	}
+
+	if err := (comprtCopy{Src: srcPath, Dest: "/home/builder/src", Owner: "tester"}).copyInto(targetPath); err == nil {
+		t.Fatal("an owner that is not in the comprt was accepted")
+	}
+	if err := os.Symlink("/etc", filepath.Join(targetPath, "mnt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := (comprtCopy{Src: srcPath, Dest: "/mnt/src"}).copyInto(targetPath); err == nil {
+		t.Fatal("a copy through a symlink in the comprt was accepted")
+	}
+}
+
+func TestComprtCopyMmdebstrapArgs(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var args string = strings.Join(comprtCopy{Src: tempDirPath, Dest: "/home/builder/src", Owner: "builder", Mode: "0640"}.mmdebstrapArgs(), "\n")
+	for _, expected := range []string{
+		`--customize-hook=mkdir -p "$1"'/home/builder/src'`,
+		"--customize-hook=sync-in '" + tempDirPath + "' '/home/builder/src'",
+		`--customize-hook=chroot "$1" chown -R -h 'builder' '/home/builder/src'`,
+		`--customize-hook=chroot "$1" find '/home/builder/src' -type f -exec chmod '0640' {} +`,
+	} {
+		if !strings.Contains(args, expected) {
+			t.Fatalf("%v was not found in the mmdebstrap args: %v", expected, args)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+const (
+	cryptMethodSha256   = "sha256"
+	cryptMethodSha512   = "sha512"
+	cryptMethodYescrypt = "yescrypt"
+
+	// The alphabet used by crypt(3) for salts and hashes.
+	cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// The default rounds of SHA-crypt, which are not recorded in the hash.
+	shaCryptRounds  = 5000
+	shaCryptSaltLen = 16
+)
+
+var cryptMethods = []string{cryptMethodSha512, cryptMethodSha256, cryptMethodYescrypt}
+
+// Matches what useradd would take as an already hashed (or locked) password
+// (e.g. '$6$salt$hash', a legacy 13 char DES hash, '!' or '*').
+var reCryptString = regexp.MustCompile(`^(\$[0-9a-z]+\$[^$]+\$|[./0-9A-Za-z]{13}$|!|\*)`)
+
+// A type used to describe the SHA-crypt variant of a hash function.
+type shaCryptVariant struct {
+	id      string
+	newHash func() hash.Hash
+	// The order the final digest's bytes are encoded in, three bytes at a time.
+	// The last group is encoded into tailLen chars, a -1 is a zero byte.
+	order   [][3]int
+	tailLen int
+}
+
+var shaCryptVariants = map[string]shaCryptVariant{
+	cryptMethodSha256: {
+		id:      "5",
+		newHash: sha256.New,
+		order: [][3]int{
+			{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+			{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+			{-1, 31, 30},
+		},
+		tailLen: 3,
+	},
+	cryptMethodSha512: {
+		id:      "6",
+		newHash: sha512.New,
+		order: [][3]int{
+			{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+			{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+			{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+			{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+			{62, 20, 41}, {-1, -1, 63},
+		},
+		tailLen: 2,
+	},
+}
+
+// Hash the plaintext password into a crypt(3) string with the crypt method
+// passed in. The SHA-crypt methods are done by debcomprt, yescrypt requires
+// mkpasswd (from the whois package).
+func hashPassword(password, method string) (string, error) {
+	if variant, ok := shaCryptVariants[method]; ok {
+		salt, err := cryptSalt(shaCryptSaltLen)
+		if err != nil {
+			return "", err
+		}
+		return shaCrypt(variant, password, salt), nil
+	} else if method != cryptMethodYescrypt {
+		return "", fmt.Errorf("%v is not a crypt method (one of: %v)", method, strings.Join(cryptMethods, ", "))
+	}
+
+	mkpasswdPath, err := progExecutor.LookPath("mkpasswd")
+	if err != nil {
+		return "", fmt.Errorf("mkpasswd is needed to hash passwords with %v: %w", method, err)
+	}
+
+	var stdout bytes.Buffer
+	mkpasswdCmd := exec.Command(mkpasswdPath, "--method="+method, "--stdin")
+	mkpasswdCmd.Stdin = strings.NewReader(password)
+	mkpasswdCmd.Stdout = &stdout
+	if err := progExecutor.Run(mkpasswdCmd); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Generate a random salt of the length passed in.
+func cryptSalt(length int) (string, error) {
+	var salt []byte
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(cryptAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		salt = append(salt, cryptAlphabet[n.Int64()])
+	}
+
+	return string(salt), nil
+}
+
+// Hash the password as SHA-crypt does with the default rounds.
+//
+// inspired by:
+// https://www.akkadia.org/drepper/SHA-crypt.txt
+func shaCrypt(variant shaCryptVariant, password, salt string) string {
+	if len(salt) > shaCryptSaltLen {
+		salt = salt[:shaCryptSaltLen]
+	}
+	var key, saltBytes []byte = []byte(password), []byte(salt)
+
+	digestB := variant.newHash()
+	digestB.Write(key)
+	digestB.Write(saltBytes)
+	digestB.Write(key)
+	sumB := digestB.Sum(nil)
+
+	digestA := variant.newHash()
+	digestA.Write(key)
+	digestA.Write(saltBytes)
+	digestA.Write(repeatBytes(sumB, len(key)))
+	for i := len(key); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			digestA.Write(sumB)
+		} else {
+			digestA.Write(key)
+		}
+	}
+	sumA := digestA.Sum(nil)
+
+	digestP := variant.newHash()
+	for i := 0; i < len(key); i++ {
+		digestP.Write(key)
+	}
+	seqP := repeatBytes(digestP.Sum(nil), len(key))
+
+	digestS := variant.newHash()
+	for i := 0; i < 16+int(sumA[0]); i++ {
+		digestS.Write(saltBytes)
+	}
+	seqS := repeatBytes(digestS.Sum(nil), len(saltBytes))
+
+	var sumC []byte = sumA
+	for i := 0; i < shaCryptRounds; i++ {
+		digestC := variant.newHash()
+		if i&1 != 0 {
+			digestC.Write(seqP)
+		} else {
+			digestC.Write(sumC)
+		}
+		if i%3 != 0 {
+			digestC.Write(seqS)
+		}
+		if i%7 != 0 {
+			digestC.Write(seqP)
+		}
+		if i&1 != 0 {
+			digestC.Write(sumC)
+		} else {
+			digestC.Write(seqP)
+		}
+		sumC = digestC.Sum(nil)
+	}
+
+	var encoded strings.Builder
+	for i, group := range variant.order {
+		var word uint
+		for _, index := range group {
+			word <<= 8
+			if index >= 0 {
+				word |= uint(sumC[index])
+			}
+		}
+
+		var chars int = 4
+		if i == len(variant.order)-1 {
+			chars = variant.tailLen
+		}
+		for ; chars > 0; chars-- {
+			encoded.WriteByte(cryptAlphabet[word&0x3f])
+			word >>= 6
+		}
+	}
+
+	return fmt.Sprintf("$%v$%v$%v", variant.id, salt, encoded.String())
+}
+
+// Repeat the bytes passed in until the length passed in is reached.
+func repeatBytes(b []byte, length int) []byte {
+	var repeated []byte
+	for len(repeated) < length {
+		repeated = append(repeated, b...)
+	}
+
+	return repeated[:length]
+}
+
+// Check that the password passed to useradd looks already hashed, useradd would
+// otherwise store the password as is. The error is only meant to be warned
+// about, a hash debcomprt does not know of may still be one.
+func checkCryptPassword(cryptPassword string) error {
+	if cryptPassword != "" && reCryptString.FindStringIndex(cryptPassword) == nil {
+		return errors.New("the password does not look like it was hashed by crypt(3), use --password for a plaintext password")
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShaCrypt(t *testing.T) {
+	for _, test := range []struct {
+		method, password, salt, expected string
+	}{
+		{cryptMethodSha512, "Hello world!", "saltstring", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+		{cryptMethodSha256, "Hello world!", "saltstring", "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5"},
+		{cryptMethodSha512, "we have a short salt string but not a short password", "short", "$6$short$qmfj2meTBr5G2EAGIJ4vjX7RpefsD4JzpEyTAeEUJdzdxlBS6pe8gdMHm5zFftaFSj/2p2bjBwyVS9ZhWpLZt."},
+		{cryptMethodSha256, "we have a short salt string but not a short password", "short", "$5$short$k38kpRP0CfxHLIcmymaSTFLK.iFfF4tKryDuEGKp6SC"},
+		{cryptMethodSha512, "a", "toolongsaltstringxx", "$6$toolongsaltstrin$W0TyyDfdc.ZBRsHnHME2Ugypd.smPN.uHqrgdyfui3u7bPN0H9xGtDW230eR8VbWiFACsbCXoTT/lgwwKktDv1"},
+	} {
+		if hash := shaCrypt(shaCryptVariants[test.method], test.password, test.salt); hash != test.expected {
+			t.Fatalf("expected %v, got %v", test.expected, hash)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("foo", cryptMethodSha512)
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(hash, "$6$") {
+		t.Fatalf("expected a SHA-512 crypt string, got %v", hash)
+	} else if err := checkCryptPassword(hash); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hashPassword("foo", "md5"); err == nil {
+		t.Fatal("a password was hashed with an unknown crypt method")
+	}
+	if err := checkCryptPassword("foo"); err == nil {
+		t.Fatal("a plaintext password was taken as hashed")
+	}
+	if err := checkCryptPassword("abJnggxhB/yWI"); err != nil {
+		t.Fatalf("a DES crypt string was not taken as hashed: %v", err)
+	}
+}
@@ -0,0 +1,651 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultSocketPath = "/run/debcomprt.sock"
+
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+
+	apiPrefix = "/v1"
+
+	// How often a followed job's output is checked for more output.
+	jobOutputPollInterval = 250 * time.Millisecond
+)
+
+var (
+	// The most finished jobs kept by the daemon, the jobs that finished first
+	// are forgotten first.
+	maxFinishedJobs = 100
+	// How long a finished job is kept by the daemon.
+	finishedJobRetention = 24 * time.Hour
+	// The most of a job's output kept, the start of the output is dropped first.
+	maxJobOutputSize = 1024 * 1024
+)
+
+// A type used to describe a debcomprt command the daemon runs in the
+// background, e.g. creating a comprt.
+type daemonJob struct {
+	mu        sync.Mutex
+	ID        string    `json:"id"`
+	Operation string    `json:"operation"`
+	Target    string    `json:"target"`
+	Args      []string  `json:"args"`
+	Status    string    `json:"status"`
+	ExitCode  int       `json:"exit_code"`
+	Error     string    `json:"error,omitempty"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished,omitempty"`
+	output    bytes.Buffer
+	// How much of the start of the output was dropped, see maxJobOutputSize.
+	dropped int
+	// Closed once the job's command has finished.
+	done chan struct{}
+}
+
+// Write output from the job's command, the job is locked as the command's stdout
+// and stderr are written to at the same time.
+func (job *daemonJob) Write(p []byte) (int, error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	n, err := job.output.Write(p)
+	if over := job.output.Len() - maxJobOutputSize; over > 0 {
+		job.output.Next(over)
+		job.dropped += over
+	}
+	return n, err
+}
+
+// Get the output written since offset, along with the offset following it and
+// whether the job has finished (that being all of its output). Output dropped
+// since offset is skipped.
+func (job *daemonJob) outputFrom(offset int) ([]byte, int, bool) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if offset < job.dropped {
+		offset = job.dropped
+	}
+	var output []byte = append([]byte{}, job.output.Bytes()[offset-job.dropped:]...)
+	return output, offset + len(output), job.Status != jobRunning
+}
+
+// Get a copy of the job that can be encoded without racing the job's command.
+func (job *daemonJob) snapshot() *daemonJob {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	return &daemonJob{
+		ID:        job.ID,
+		Operation: job.Operation,
+		Target:    job.Target,
+		Args:      job.Args,
+		Status:    job.Status,
+		ExitCode:  job.ExitCode,
+		Error:     job.Error,
+		Started:   job.Started,
+		Finished:  job.Finished,
+	}
+}
+
+// A type used to serve debcomprt's API, the operations that change comprts are
+// ran as debcomprt commands in jobs.
+type daemon struct {
+	mu     sync.Mutex
+	jobs   map[string]*daemonJob
+	nextID int
+	wg     sync.WaitGroup
+	// The debcomprt ran for a job (e.g. /proc/self/exe).
+	exe string
+	// The metrics taken from the audit log by past scrapes.
+	auditMetrics auditLogMetrics
+}
+
+// A type used to describe the comprt to create.
+type createRequest struct {
+	CodeName string   `json:"codename"`
+	Target   string   `json:"target"`
+	Mirrors  []string `json:"mirrors"`
+	// The create command's flags (e.g. '--alias=python3').
+	Flags []string `json:"flags"`
+	// The args passed to debootstrap as is (e.g. '--variant=minbase').
+	Debootstrap []string `json:"debootstrap,omitempty"`
+}
+
+// A type used to describe the command to run in a comprt.
+type execRequest struct {
+	Target  string   `json:"target"`
+	Command []string `json:"command"`
+}
+
+func newDaemon(exe string) *daemon {
+	return &daemon{jobs: make(map[string]*daemonJob), exe: exe}
+}
+
+// Start a job running debcomprt with the args, the script (if any) is removed
+// once the job is done.
+func (d *daemon) startJob(operation, target string, args []string, script string) *daemonJob {
+	d.mu.Lock()
+	d.nextID++
+	var job *daemonJob = &daemonJob{
+		ID:        strconv.Itoa(d.nextID),
+		Operation: operation,
+		Target:    target,
+		Args:      redactArgs(args),
+		Status:    jobRunning,
+		Started:   time.Now().UTC(),
+		done:      make(chan struct{}),
+	}
+	d.pruneJobs(job.Started)
+	d.jobs[job.ID] = job
+	d.mu.Unlock()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer close(job.done)
+		if script != "" {
+			defer os.Remove(script)
+		}
+
+		cmd := exec.Command(d.exe, args...)
+		cmd.Stdout = job
+		cmd.Stderr = job
+		err := cmd.Run()
+
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		job.Finished = time.Now().UTC()
+		job.Status = jobSucceeded
+		if err != nil {
+			job.Status, job.Error, job.ExitCode = jobFailed, err.Error(), -1
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				job.ExitCode = exitErr.ExitCode()
+			}
+		}
+	}()
+
+	return job
+}
+
+// Forget the finished jobs past finishedJobRetention, along with the jobs that
+// finished first when there are more than maxFinishedJobs. The daemon is
+// expected to be locked.
+func (d *daemon) pruneJobs(now time.Time) {
+	type finishedJob struct {
+		id       string
+		finished time.Time
+	}
+	var finishedJobs []finishedJob
+	for id, job := range d.jobs {
+		job.mu.Lock()
+		running, finished := job.Status == jobRunning, job.Finished
+		job.mu.Unlock()
+		if running {
+			continue
+		} else if now.Sub(finished) > finishedJobRetention {
+			delete(d.jobs, id)
+			continue
+		}
+		finishedJobs = append(finishedJobs, finishedJob{id: id, finished: finished})
+	}
+
+	if over := len(finishedJobs) - maxFinishedJobs; over > 0 {
+		sort.Slice(finishedJobs, func(i, j int) bool {
+			return finishedJobs[i].finished.Before(finishedJobs[j].finished)
+		})
+		for _, job := range finishedJobs[:over] {
+			delete(d.jobs, job.id)
+		}
+	}
+}
+
+// Get the job, nil if there is no such job.
+func (d *daemon) job(id string) *daemonJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.jobs[id]
+}
+
+// Get every job, oldest first.
+func (d *daemon) listJobs() []*daemonJob {
+	d.mu.Lock()
+	var jobs []*daemonJob = []*daemonJob{}
+	for _, job := range d.jobs {
+		jobs = append(jobs, job.snapshot())
+	}
+	d.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		iID, _ := strconv.Atoi(jobs[i].ID)
+		jID, _ := strconv.Atoi(jobs[j].ID)
+		return iID < jID
+	})
+	return jobs
+}
+
+// Write v as the json response.
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Write the error as the json response.
+func writeJsonError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
+
+// Check the target is an existing dir, the same as the commands check it.
+func checkApiTarget(target string) error {
+	if target == "" {
+		return errors.New("a target is required")
+	} else if !filepath.IsAbs(target) {
+		return fmt.Errorf("the target %v is not an absolute path", target)
+	} else if _, err := os.Stat(target); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Get the debcomprt args that create the comprt, the target is made if it does
+// not exist.
+func (req createRequest) args() ([]string, error) {
+	if req.CodeName == "" {
+		return nil, errors.New("a codename is required")
+	} else if req.Target == "" {
+		return nil, errors.New("a target is required")
+	} else if !filepath.IsAbs(req.Target) {
+		return nil, fmt.Errorf("the target %v is not an absolute path", req.Target)
+	}
+	for _, flag := range req.Flags {
+		if flag == "--" {
+			return nil, errors.New("debootstrap's args are passed separately from the flags")
+		} else if !strings.HasPrefix(flag, "-") {
+			return nil, fmt.Errorf("%v is not a flag, flags must be passed as --flag=value", flag)
+		}
+	}
+
+	var args []string = append([]string{"create", "--parents"}, req.Flags...)
+	args = append(args, req.CodeName, req.Target)
+	args = append(args, req.Mirrors...)
+	if len(req.Debootstrap) > 0 {
+		args = append(append(args, "--"), req.Debootstrap...)
+	}
+	return args, nil
+}
+
+// Write a script that runs the command, that way the command is ran in the comprt
+// the same as a comprt config file is (see the provision command).
+func writeExecScript(command []string) (string, error) {
+	if len(command) < 1 {
+		return "", errors.New("a command is required")
+	}
+
+	script, err := os.CreateTemp("", progname+"-exec")
+	if err != nil {
+		return "", err
+	}
+	var quoted []string
+	for _, arg := range command {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	if _, err := fmt.Fprintf(script, "#!/bin/sh\nexec %v\n", strings.Join(quoted, " ")); err != nil {
+		script.Close()
+		os.Remove(script.Name())
+		return "", err
+	}
+
+	return script.Name(), script.Close()
+}
+
+func (d *daemon) handleComprts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		inventory, err := getInventory()
+		if err != nil {
+			writeJsonError(w, http.StatusInternalServerError, err)
+			return
+		} else if inventory == nil {
+			inventory = []inventoryEntry{}
+		}
+		writeJson(w, http.StatusOK, inventory)
+	case http.MethodPost:
+		var req createRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJsonError(w, http.StatusBadRequest, err)
+			return
+		}
+		args, err := req.args()
+		if err != nil {
+			writeJsonError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJson(w, http.StatusAccepted, d.startJob("create", req.Target, args, "").snapshot())
+	case http.MethodDelete:
+		var target string = r.URL.Query().Get("target")
+		if err := checkApiTarget(target); err != nil {
+			writeJsonError(w, http.StatusBadRequest, err)
+			return
+		} else if err := checkIsComprt(target); err != nil {
+			writeJsonError(w, http.StatusConflict, err)
+			return
+		}
+		writeJson(w, http.StatusAccepted, d.startJob("delete", target, []string{"delete", target}, "").snapshot())
+	default:
+		writeJsonError(w, http.StatusMethodNotAllowed, fmt.Errorf("%v is not allowed", r.Method))
+	}
+}
+
+func (d *daemon) handleExec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJsonError(w, http.StatusMethodNotAllowed, fmt.Errorf("%v is not allowed", r.Method))
+		return
+	}
+
+	var req execRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJsonError(w, http.StatusBadRequest, err)
+		return
+	} else if err := checkApiTarget(req.Target); err != nil {
+		writeJsonError(w, http.StatusBadRequest, err)
+		return
+	}
+	script, err := writeExecScript(req.Command)
+	if err != nil {
+		writeJsonError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var args []string = []string{"provision", "--config-path=" + script, req.Target}
+	writeJson(w, http.StatusAccepted, d.startJob("exec", req.Target, args, script).snapshot())
+}
+
+// Stream the comprt as a tarball, compressed with the codec named by the
+// compression query parameter (none by default).
+func (d *daemon) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJsonError(w, http.StatusMethodNotAllowed, fmt.Errorf("%v is not allowed", r.Method))
+		return
+	}
+
+	var target string = r.URL.Query().Get("target")
+	if err := checkApiTarget(target); err != nil {
+		writeJsonError(w, http.StatusBadRequest, err)
+		return
+	}
+	var compression string = r.URL.Query().Get("compression")
+	if compression == "" {
+		compression = noCodecName
+	}
+	c, err := getCodec(compression)
+	if err != nil {
+		writeJsonError(w, http.StatusBadRequest, err)
+		return
+	}
+	mounts, err := readMountInfo(procSelfMountInfo)
+	if err != nil {
+		writeJsonError(w, http.StatusInternalServerError, err)
+		return
+	} else if err := checkTargetUnmounted(target, mounts); err != nil {
+		writeJsonError(w, http.StatusConflict, err)
+		return
+	} else if err := checkNoSecrets(target); err != nil {
+		writeJsonError(w, http.StatusConflict, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(target)+tarSnapshotExt+c.Ext()))
+	cw, err := c.NewWriter(w)
+	if err != nil {
+		writeJsonError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// the status has already been sent, a failed export is only seen as a
+	// truncated tarball
+	if err := writeExportTar(target, cw); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: exporting %v failed: %v\n", progname, target, err)
+	}
+	cw.Close()
+}
+
+func (d *daemon) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJsonError(w, http.StatusMethodNotAllowed, fmt.Errorf("%v is not allowed", r.Method))
+		return
+	}
+
+	// e.g. /v1/jobs, /v1/jobs/1 or /v1/jobs/1/output
+	var parts []string = strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix+"/jobs"), "/"), "/")
+	if parts[0] == "" {
+		writeJson(w, http.StatusOK, d.listJobs())
+		return
+	}
+
+	job := d.job(parts[0])
+	if job == nil {
+		writeJsonError(w, http.StatusNotFound, fmt.Errorf("there is no job %v", parts[0]))
+		return
+	}
+	switch {
+	case len(parts) == 1:
+		writeJson(w, http.StatusOK, job.snapshot())
+	case len(parts) == 2 && parts[1] == "output":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if r.URL.Query().Get("follow") != "true" {
+			output, _, _ := job.outputFrom(0)
+			w.Write(output)
+			return
+		}
+		streamJobOutput(w, r, job)
+	default:
+		writeJsonError(w, http.StatusNotFound, fmt.Errorf("%v was not found", r.URL.Path))
+	}
+}
+
+// Stream the job's output from the start until the job finishes (or the client
+// goes away).
+func streamJobOutput(w http.ResponseWriter, r *http.Request, job *daemonJob) {
+	flusher, _ := w.(http.Flusher)
+	followJobOutput(r.Context(), job, func(output []byte) error {
+		if _, err := w.Write(output); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+}
+
+// Pass the job's output to send as it is written, from the start until the job
+// finishes. Following stops early if ctx is done or send fails.
+func followJobOutput(ctx context.Context, job *daemonJob, send func([]byte) error) error {
+	var offset int
+	for {
+		output, next, finished := job.outputFrom(offset)
+		if len(output) > 0 {
+			if err := send(output); err != nil {
+				return err
+			}
+		}
+		offset = next
+		if finished {
+			return nil
+		}
+
+		select {
+		case <-job.done:
+		case <-time.After(jobOutputPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Get the handler of the daemon's API.
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiPrefix+"/comprts", d.handleComprts)
+	mux.HandleFunc(apiPrefix+"/comprts/exec", d.handleExec)
+	mux.HandleFunc(apiPrefix+"/comprts/export", d.handleExport)
+	mux.HandleFunc(apiPrefix+"/jobs", d.handleJobs)
+	mux.HandleFunc(apiPrefix+"/jobs/", d.handleJobs)
+	mux.HandleFunc(metricsPath, d.handleMetrics)
+	return mux
+}
+
+// Listen on the unix socket, only root can connect to it as the API can do
+// anything root can. A socket left behind by a previous daemon is replaced,
+// anything else at the socket's path is left be.
+func listenUnixSocket(socketPath string) (net.Listener, error) {
+	if fileInfo, err := os.Lstat(socketPath); err == nil {
+		fileStat, ok := fileInfo.Sys().(*syscall.Stat_t)
+		if fileInfo.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("%v already exists and is not a socket, refusing to replace it", socketPath)
+		} else if !ok || int(fileStat.Uid) != os.Geteuid() {
+			return nil, fmt.Errorf("%v already exists and is owned by another user, refusing to replace it", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// the socket is made usable by its owner only from the start, a chmod
+	// afterwards would leave a window where anyone could connect
+	oldUmask := syscall.Umask(0o177)
+	listener, err := net.Listen("unix", socketPath)
+	syscall.Umask(oldUmask)
+	if err != nil {
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// Serve the API on the unix socket until debcomprt is signaled to stop, the jobs
+// still running are waited on before returning. The API is also served as a gRPC
+// service on the unix socket at grpcSocketPath (if any). The metrics are also
+// served on the tcp metricsAddress (if any) for prometheus to scrape, only the
+// metrics are served on it.
+func runDaemon(socketPath, grpcSocketPath, metricsAddress string) error {
+	listener, err := listenUnixSocket(socketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socketPath)
+
+	d := newDaemon("/proc/self/exe")
+	server := &http.Server{Handler: d.handler()}
+
+	var grpcServer *grpc.Server
+	if grpcSocketPath != "" {
+		grpcListener, err := listenUnixSocket(grpcSocketPath)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		defer os.Remove(grpcSocketPath)
+		grpcServer = newGrpcServer(d)
+		go func() {
+			if err := grpcServer.Serve(grpcListener); err != nil {
+				warnf("serving the gRPC api failed: %v", err)
+			}
+		}()
+	}
+
+	var metricsServer *http.Server
+	if metricsAddress != "" {
+		metricsListener, err := net.Listen("tcp", metricsAddress)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc(metricsPath, d.handleMetrics)
+		metricsServer = &http.Server{Handler: mux}
+		go func() {
+			if err := metricsServer.Serve(metricsListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				warnf("serving the metrics failed: %v", err)
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		if metricsServer != nil {
+			metricsServer.Shutdown(context.Background())
+		}
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+		server.Shutdown(context.Background())
+	}()
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	d.wg.Wait()
+
+	return nil
+}
+
+// Get an http client that talks to the daemon over its unix socket, e.g. for
+// tests or tools written in go.
+func newDaemonClient(socketPath string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Wait for the job to finish, failing the test if it takes too long.
+func waitForJob(t *testing.T, server *httptest.Server, id string) *daemonJob {
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		resp, err := http.Get(server.URL + apiPrefix + "/jobs/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var job *daemonJob
+		err = json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		} else if job.Status != jobRunning {
+			return job
+		}
+	}
+
+	t.Fatalf("job %v did not finish", id)
+	return nil
+}
+
+func TestDaemonCreateJob(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// echo stands in for debcomprt, that way the args the job ran with are output
+	server := httptest.NewServer(newDaemon("/bin/echo").handler())
+	defer server.Close()
+
+	body := strings.NewReader(`{"codename": "` + testCodeCame + `", "target": "` + tempDirPath + `", "flags": ["--password=hunter2"]}`)
+	resp, err := http.Post(server.URL+apiPrefix+"/comprts", "application/json", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job *daemonJob
+	err = json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected %v, got %v", http.StatusAccepted, resp.StatusCode)
+	}
+
+	if job = waitForJob(t, server, job.ID); job.Status != jobSucceeded || job.ExitCode != 0 {
+		t.Fatalf("expected the job to succeed, got %+v", job)
+	} else if strings.Contains(strings.Join(job.Args, " "), "hunter2") {
+		t.Fatalf("expected the job's password to be redacted, got %v", job.Args)
+	}
+
+	resp, err = http.Get(server.URL + apiPrefix + "/jobs/" + job.ID + "/output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected string = "create --parents --password=hunter2 " + testCodeCame + " " + tempDirPath + "\n"
+	if string(output) != expected {
+		t.Fatalf("expected %q, got %q", expected, output)
+	}
+}
+
+func TestDaemonFollowJobOutput(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var exePath string = filepath.Join(tempDirPath, "debcomprt")
+	if err := createTestFile(exePath, "#!/bin/sh\necho first\nsleep 0.5\necho second\n"); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(newDaemon(exePath).handler())
+	defer server.Close()
+
+	body := strings.NewReader(`{"codename": "` + testCodeCame + `", "target": "` + tempDirPath + `"}`)
+	resp, err := http.Post(server.URL+apiPrefix+"/comprts", "application/json", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job *daemonJob
+	err = json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the output is streamed until the job finishes
+	resp, err = http.Get(server.URL + apiPrefix + "/jobs/" + job.ID + "/output?follow=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	} else if string(output) != "first\nsecond\n" {
+		t.Fatalf("expected all of the job's output, got %q", output)
+	}
+}
+
+func TestDaemonJobOutputCapped(t *testing.T) {
+	previousMaxJobOutputSize := maxJobOutputSize
+	maxJobOutputSize = 8
+	defer func() { maxJobOutputSize = previousMaxJobOutputSize }()
+
+	var job *daemonJob = &daemonJob{Status: jobRunning}
+	job.Write([]byte("first\n"))
+	output, offset, _ := job.outputFrom(0)
+	if string(output) != "first\n" {
+		t.Fatalf("expected %q, got %q", "first\n", output)
+	}
+
+	// the start of the output is dropped, a follower skips what it missed
+	job.Write([]byte("second\n"))
+	if output, _, _ = job.outputFrom(offset); string(output) != "second\n" {
+		t.Fatalf("expected %q, got %q", "second\n", output)
+	}
+	job.Write([]byte("third\n"))
+	if output, _, _ = job.outputFrom(0); string(output) != "d\nthird\n" {
+		t.Fatalf("expected %q, got %q", "d\nthird\n", output)
+	}
+}
+
+func TestDaemonPruneJobs(t *testing.T) {
+	previousMaxFinishedJobs := maxFinishedJobs
+	maxFinishedJobs = 2
+	defer func() { maxFinishedJobs = previousMaxFinishedJobs }()
+
+	var now time.Time = time.Now()
+	d := newDaemon("/bin/true")
+	for id, job := range map[string]*daemonJob{
+		"1": {Status: jobSucceeded, Finished: now.Add(-2 * finishedJobRetention)},
+		"2": {Status: jobSucceeded, Finished: now.Add(-3 * time.Hour)},
+		"3": {Status: jobFailed, Finished: now.Add(-2 * time.Hour)},
+		"4": {Status: jobSucceeded, Finished: now.Add(-1 * time.Hour)},
+		"5": {Status: jobRunning},
+	} {
+		job.ID = id
+		d.jobs[id] = job
+	}
+
+	d.pruneJobs(now)
+	var ids []string
+	for _, job := range d.listJobs() {
+		ids = append(ids, job.ID)
+	}
+	if expected := "3 4 5"; strings.Join(ids, " ") != expected {
+		t.Fatalf("expected: %v, actual: %v", expected, ids)
+	}
+}
+
+func TestDaemonFailedJob(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+	if err := writeComprtMetadata(tempDirPath, comprtMetadata{CodeName: testCodeCame}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(newDaemon("/bin/false").handler())
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodDelete, server.URL+apiPrefix+"/comprts?target="+tempDirPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job *daemonJob
+	err = json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job = waitForJob(t, server, job.ID); job.Status != jobFailed || job.ExitCode != 1 {
+		t.Fatalf("expected the job to fail with exit code 1, got %+v", job)
+	}
+}
+
+func TestDaemonErrors(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	server := httptest.NewServer(newDaemon("/bin/true").handler())
+	defer server.Close()
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/comprts", `{"codename": "` + testCodeCame + `", "target": "foo"}`, http.StatusBadRequest},
+		{http.MethodPost, "/comprts", `{"target": "/"}`, http.StatusBadRequest},
+		{http.MethodPost, "/comprts", `{"codename": "` + testCodeCame + `", "target": "/srv/foo", "flags": ["--", "--variant=minbase"]}`, http.StatusBadRequest},
+		{http.MethodPost, "/comprts/exec", `{"target": "/"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/comprts", "", http.StatusBadRequest},
+		{http.MethodDelete, "/comprts?target=" + progDataDir, "", http.StatusConflict},
+		{http.MethodPut, "/comprts", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/jobs/1", "", http.StatusNotFound},
+	} {
+		req, err := http.NewRequest(tc.method, server.URL+apiPrefix+tc.path, strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var apiErr map[string]string
+		err = json.NewDecoder(resp.Body).Decode(&apiErr)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != tc.status || apiErr["error"] == "" {
+			t.Fatalf("%v %v: expected %v with an error, got %v %v", tc.method, tc.path, tc.status, resp.StatusCode, apiErr)
+		}
+	}
+}
+
+func TestWriteExecScript(t *testing.T) {
+	script, err := writeExecScript([]string{"sh", "-c", "echo 'hello world'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(script)
+
+	contents, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected string = "#!/bin/sh\nexec 'sh' '-c' 'echo '\\''hello world'\\'''\n"
+	if string(contents) != expected {
+		t.Fatalf("expected %q, got %q", expected, contents)
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var socketPath string = filepath.Join(tempDirPath, "debcomprt.sock")
+	listener, err := listenUnixSocket(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: newDaemon("/bin/true").handler()}
+	go server.Serve(listener)
+	defer server.Close()
+
+	if fileInfo, err := os.Stat(socketPath); err != nil {
+		t.Fatal(err)
+	} else if fileInfo.Mode().Perm() != OS_USER_R|OS_USER_W {
+		t.Fatalf("expected the socket to only be usable by its owner, got %v", fileInfo.Mode().Perm())
+	}
+
+	resp, err := newDaemonClient(socketPath).Get("http://localhost" + apiPrefix + "/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobs []*daemonJob
+	err = json.NewDecoder(resp.Body).Decode(&jobs)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	} else if jobs == nil || len(jobs) != 0 {
+		t.Fatalf("expected no jobs, got %v", jobs)
+	}
+}
+
+func TestListenUnixSocketRefusesOtherFiles(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var socketPath string = filepath.Join(tempDirPath, "debcomprt.sock")
+	if err := createTestFile(socketPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenUnixSocket(socketPath); err == nil {
+		t.Fatal("a file that is not a socket was replaced")
+	}
+	if err := os.Remove(socketPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// a socket left behind by a previous daemon is replaced
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	if listener, err = listenUnixSocket(socketPath); err != nil {
+		t.Fatal(err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	if os.Geteuid() != rootUid {
+		t.Skip("changing the socket's owner requires root")
+	}
+	if err := os.Lchown(socketPath, rootUid+1, rootUid+1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenUnixSocket(socketPath); err == nil {
+		t.Fatal("a socket owned by another user was replaced")
+	}
+}
@@ -17,6 +17,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -33,12 +34,12 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/go-git/go-git/v5"
 	"github.com/urfave/cli/v2"
 )
 
 const (
 	comprtConfigFile      = "comprtconfig"
+	comprtConfigDir       = "comprtconfig.d"
 	comprtConfigsRepoName = "comprtconfigs"
 	comprtConfigsRepoUrl  = "https://github.com/cavcrosby/comprtconfigs"
 	comprtIncludeFile     = "comprtinc"
@@ -51,10 +52,14 @@ const (
 	defaultComprtUid      = 1224
 	defaultComprtUserName = "debcomprt"
 
+	// The gid of the tty group, based on debian's base-passwd package.
+	ttyGid = 5
+
 	defaultDebianMirror = "http://ftp.us.debian.org/debian/"
 	defaultUbuntuMirror = "http://archive.ubuntu.com/ubuntu/"
 	rootUid             = 0
 	noAlias             = "none"
+	localAliasPrefix    = "path:"
 	progname            = "debcomprt"
 )
 
@@ -87,14 +92,14 @@ const (
 
 var (
 	reFindEnvVar = regexp.MustCompile(`(?P<name>^[a-zA-Z_]\w*)=(?P<value>.+)`)
+	// Set when debcomprt is built (see the Makefile).
+	progVersion = "dev"
+	// Whether a filesystem that stays busy is detached instead (see --lazy-unmount).
+	lazyUnmount bool
 )
 
-// Mappings of codenames to respective a package repository.
-var defaultMirrorMappings = map[string]string{
-	"buster":  defaultDebianMirror,
-	"focal":   defaultUbuntuMirror,
-	"hirsute": defaultUbuntuMirror,
-}
+// Mappings of codenames to respective a package repository (see distroinfo.go).
+var defaultMirrorMappings = defaultMirrorMappingsFromDistroInfo()
 
 // A custom callback handler in the event improper cli flag/flag
 // arguments/arguments are passed in.
@@ -106,19 +111,114 @@ var CustomOnUsageErrorFunc cli.OnUsageErrorFunc = func(context *cli.Context, err
 
 // A type used to store command flag argument values and argument values.
 type progConfigs struct {
-	alias              string
-	codeName           string
-	command            string
-	comprtConfigPath   string
-	comprtIncludesPath string
-	cryptPassword      string
-	helpFlagPassedIn   bool
-	mirror             string
-	passthrough        bool
-	passThroughFlags   []string
-	preprocessAliases  bool
-	quiet              bool
-	target             string
+	alias                string
+	aliasCommit          string
+	aliasCopyDir         string
+	aliasEnvVars         []string
+	aliasKeyringPath     string
+	aliasRef             string
+	aliasValuesPath      string
+	aliasEnvFiles        []string
+	apply                *applyFile
+	aptRepoKeysDir       string
+	arch                 string
+	bashCompletion       bool
+	binds                []bindMount
+	bootable             bool
+	bootablePkgs         []string
+	bootloader           string
+	bootBackend          string
+	cacheHits            int
+	cacheMisses          int
+	caches               []cacheMount
+	checksumsPath        string
+	buildInTmpfs         bool
+	cloudInit            *cloudInitSeed
+	cloudInitSeedDir     string
+	codeName             string
+	command              string
+	containerEngine      string
+	copies               []comprtCopy
+	comprtConfigPath     string
+	comprtIncludesPath   string
+	compression          string
+	cryptMethod          string
+	cryptPassword        string
+	duDepth              int
+	envFile              string
+	envVars              []string
+	exportDir            string
+	exportFormat         string
+	exportTags           []string
+	ephemeral            bool
+	foreignArchs         []string
+	grpcSocketPath       string
+	helpFlagPassedIn     bool
+	hooks                []string
+	labels               map[string]string
+	listCodenames        bool
+	lock                 *comprtLock
+	lockFilePath         string
+	lockFileKeyringPath  string
+	lxdAlias             string
+	lxdImport            bool
+	minTargetDepth       int
+	manifest             *comprtManifest
+	manifestPath         string
+	metricsAddress       string
+	mirror               string
+	netFiles             networkFiles
+	networkNamespace     string
+	offline              bool
+	outputFormat         string
+	parallel             int
+	parents              bool
+	passThroughFlags     []string
+	password             string
+	passwordFile         string
+	passwordStdin        bool
+	passwordPrompt       bool
+	pidNamespace         string
+	playbooks            []ansiblePlaybook
+	preprocessAliases    bool
+	preprocessedAliasDir string
+	quiet                bool
+	verbosity            verbosityFlagValues
+	removeIncomplete     bool
+	dryRun               bool
+	maxCacheAge          time.Duration
+	minimize             bool
+	minimizePolicy       minimizePolicy
+	manDir               string
+	cliApp               *cli.App
+	resume               bool
+	rmOnFailure          bool
+	force                bool
+	skipExisting         bool
+	rootless             bool
+	rootlessMetadataDir  string
+	createBackend        string
+	schrootGroups        []string
+	schrootName          string
+	schrootProfile       string
+	schrootUsers         []string
+	secrets              comprtSecrets
+	signKeyID            string
+	snapshotName         string
+	socketPath           string
+	sortKey              string
+	skipPreflight        bool
+	sources              aptSources
+	sudo                 string
+	syslog               bool
+	sysroot              bool
+	srcTarget            string
+	target               string
+	tmpfsSize            string
+	unsafeTarget         bool
+	user                 comprtUser
+	users                []comprtUser
+	workDir              string
 }
 
 // Interpret the command arguments passed in. Saving particular flag/flag
@@ -126,6 +226,8 @@ type progConfigs struct {
 func (pconfs *progConfigs) parseCmdArgs() {
 	var localOsArgs []string = os.Args
 
+	localOsArgs, pconfs.passThroughFlags = splitPassThroughArgs(localOsArgs)
+
 	for i, val := range localOsArgs {
 		if i < 1 {
 			continue
@@ -134,24 +236,24 @@ func (pconfs *progConfigs) parseCmdArgs() {
 		} else if stringsInArr([]string{"-a", "-alias", "--alias"}, &localOsArgs) &&
 			stringsInArr([]string{"-p", "-crypt-password", "--crypt-password"}, &localOsArgs) {
 			log.Panic(errors.New("--crypt-password cannot be used with --alias"))
+		} else if stringsInArr([]string{"-a", "-alias", "--alias"}, &localOsArgs) &&
+			stringsInArr([]string{"-password", "--password", "-password-file", "--password-file", "-password-stdin", "--password-stdin", "-password-prompt", "--password-prompt"}, &localOsArgs) {
+			log.Panic(errors.New("--password (or --password-file, --password-stdin, --password-prompt) cannot be used with --alias"))
 		} else if stringsInArr([]string{"-a", "-alias", "--alias"}, &localOsArgs) &&
 			stringsInArr([]string{"-c", "-config-path", "--config-path"}, &localOsArgs) {
 			log.Panic(errors.New("--config-path cannot be used with --alias"))
 		} else if stringInArr(val, &[]string{"-h", "-help", "--help"}) {
 			pconfs.helpFlagPassedIn = true
-		} else if stringInArr(val, &[]string{"-passthrough", "--passthrough"}) {
-			// i + 1 to ignoring iterating over passthrough flag
-			for passthroughIndex, passthroughValue := range localOsArgs[i+1:] {
-				if strings.HasPrefix(passthroughValue, "-") {
-					pconfs.passThroughFlags = append(pconfs.passThroughFlags, passthroughValue)
-				} else {
-					// i + 1 to keep passthrough flag
-					// i + passthroughIndex + 1 to truncate final flag argument
-					localOsArgs = append(localOsArgs[:i+1], localOsArgs[i+passthroughIndex+1:]...)
-					break
-				}
+		} else if val == "--generate-bash-completion" {
+			pconfs.bashCompletion = true
+		} else if stringInArr(val, &[]string{"-sudo", "--sudo"}) {
+			// --sudo can be passed without a value, a value passed after it (e.g.
+			// --sudo nopasswd) is left for the cli to parse
+			if i+1 >= len(localOsArgs) || !stringInArr(localOsArgs[i+1], &sudoModes) {
+				localOsArgs[i] = "--sudo=" + sudoPassword
 			}
-			break
+		} else if stringInArr(val, &[]string{"-passthrough", "--passthrough"}) {
+			log.Panic(errors.New("--passthrough was replaced by --, pass debootstrap's args after it (ex. debcomprt create buster foo -- --variant=minbase)"))
 		} else if stringInArr(val, &[]string{"-e", "-alias-envvar", "--alias-envvar"}) {
 			var envVar string = localOsArgs[i+1]
 
@@ -160,27 +262,140 @@ func (pconfs *progConfigs) parseCmdArgs() {
 			}
 			envVarArr := reFindEnvVar.FindStringSubmatch(envVar)
 			envVarName, envVarValue := envVarArr[1], envVarArr[2]
-			os.Setenv(envVarName, envVarValue)
+			setComprtEnvVar(envVarName, envVarValue)
+			pconfs.aliasEnvVars = append(pconfs.aliasEnvVars, envVar)
 
 			// i + 1 to keep alias-envvar flag
 			// i + 2 only to truncate the flag's argument
 			localOsArgs = append(localOsArgs[:i+1], localOsArgs[i+2:]...)
 		}
 	}
-	os.Setenv("DEBCOMPRT_DEFAULT_LOGIN_UID", strconv.Itoa(defaultComprtUid))
+	// create may change this to the uid passed in
+	setComprtEnvVar("DEBCOMPRT_DEFAULT_LOGIN_UID", strconv.Itoa(defaultComprtUid))
+	// also made available to aliases preprocessed by debcomprt
+	pconfs.aliasEnvVars = append([]string{"DEBCOMPRT_DEFAULT_LOGIN_UID=" + strconv.Itoa(defaultComprtUid)}, pconfs.aliasEnvVars...)
 
 	app := &cli.App{
-		Name:            progname,
-		Usage:           "manages debian compartments (comprt), an underlying 'target' generated from debootstrap",
-		UsageText:       "debcomprt [global options] [command] CODENAME TARGET [MIRROR]",
-		Description:     "[WARNING] this tool's cli is not fully POSIX compliant, so POSIX utility cli behavior may not always occur",
-		HideHelpCommand: true,
-		OnUsageError:    CustomOnUsageErrorFunc,
+		Name:                 progname,
+		Usage:                "manages debian compartments (comprt), an underlying 'target' generated from debootstrap",
+		UsageText:            "debcomprt [global options] [command] CODENAME TARGET [MIRROR]",
+		Description:          "[WARNING] this tool's cli is not fully POSIX compliant, so POSIX utility cli behavior may not always occur",
+		Version:              progVersion,
+		HideHelpCommand:      true,
+		EnableBashCompletion: true,
+		OnUsageError:         CustomOnUsageErrorFunc,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:        "list-codenames",
+				Value:       false,
+				Usage:       "list the codenames that can be used to create a comprt",
+				Destination: &pconfs.listCodenames,
+			},
+			&cli.IntFlag{
+				Name:        "retries",
+				Value:       defaultRetryPolicy.attempts,
+				Usage:       "the number of attempts made for operations that may fail transiently (e.g. unmounting, cloning, debootstrap)",
+				Destination: &progRetryPolicy.attempts,
+			},
+			&cli.DurationFlag{
+				Name:        "retry-delay",
+				Value:       defaultRetryPolicy.delay,
+				Usage:       "the delay before retrying an operation, doubling for each attempt after",
+				Destination: &progRetryPolicy.delay,
+			},
+			&cli.DurationFlag{
+				Name:        "retry-max-delay",
+				Value:       defaultRetryPolicy.maxDelay,
+				Usage:       "the cap on the delay before retrying an operation",
+				Destination: &progRetryPolicy.maxDelay,
+			},
+			&cli.DurationFlag{
+				Name:        "retry-timeout",
+				Value:       defaultRetryPolicy.timeout,
+				Usage:       "the time an attempt of a network operation (e.g. debootstrap, cloning) is given before it is cancelled, 0 for no limit",
+				Destination: &progRetryPolicy.timeout,
+			},
+			&cli.BoolFlag{
+				Name:        "lazy-unmount",
+				Value:       false,
+				Usage:       "detach the filesystems in a comprt that are still busy after retrying to unmount them, they are unmounted once no longer busy",
+				Destination: &lazyUnmount,
+			},
+			&cli.BoolFlag{
+				Name:        "preserve-env",
+				Value:       false,
+				Usage:       "run the commands in a comprt (e.g. the comprt config file) with debcomprt's env, instead of only PATH, HOME, LANG, TERM, the proxies and the alias env vars",
+				Destination: &preserveEnv,
+			},
+			&cli.BoolFlag{
+				Name:        "no-color",
+				Value:       false,
+				Usage:       fmt.Sprintf("do not color the output, even on a terminal (the same as setting %v)", noColorEnvVar),
+				Destination: &noColor,
+			},
+			&cli.IntFlag{
+				Name:        "min-target-depth",
+				Value:       defaultMinTargetDepth,
+				Usage:       "refuse to use a TARGET with less path components than this (e.g. /srv/foo has 2)",
+				Destination: &pconfs.minTargetDepth,
+			},
+			&cli.BoolFlag{
+				Name:        unsafeTargetFlagName,
+				Value:       false,
+				Usage:       "allow using a system path, mount point or shallow path as a TARGET",
+				Destination: &pconfs.unsafeTarget,
+			},
+			&cli.BoolFlag{
+				Name:        "syslog",
+				Value:       false,
+				Usage:       fmt.Sprintf("also send the operations audited in %v to syslog", auditLogFile),
+				Destination: &pconfs.syslog,
+			},
+		},
 		Commands: []*cli.Command{
 			{
 				Name:      "chroot",
 				Usage:     "chroots into a debian compartment",
 				UsageText: "debcomprt [options] create TARGET",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "bind",
+						Usage: "bind mount HOST_PATH[:COMPRT_PATH[:ro]] into the chroot session (ex. <flag> ./src:/home/debcomprt/src <flag> /var/cache/ccache:/ccache:ro)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "env",
+						Usage: "set an env var in the chroot session (ex. <flag> FOO=bar <flag> BAR=baz)",
+					},
+					&cli.PathFlag{
+						Name:        "env-file",
+						Usage:       "read in env vars for the chroot session from `PATH` (one KEY=VALUE per line)",
+						Destination: &pconfs.envFile,
+					},
+					&cli.StringFlag{
+						Name:        "workdir",
+						Aliases:     []string{"w"},
+						Value:       "",
+						Usage:       "start the chroot session in `PATH` inside the comprt, instead of the user's home",
+						Destination: &pconfs.workDir,
+					},
+					&cli.BoolFlag{
+						Name:        "ephemeral",
+						Usage:       "discard any changes made in the chroot session once it exits",
+						Destination: &pconfs.ephemeral,
+					},
+					&cli.StringFlag{
+						Name:        "pid",
+						Value:       privateNamespace,
+						Usage:       fmt.Sprintf("run the chroot session in a %v PID namespace or share the %v's", privateNamespace, hostNamespace),
+						Destination: &pconfs.pidNamespace,
+					},
+					&cli.StringFlag{
+						Name:        "network",
+						Value:       hostNamespace,
+						Usage:       fmt.Sprintf("share the %v's network, have %v or have a %v loopback only network in the chroot session", hostNamespace, noNamespace, privateNamespace),
+						Destination: &pconfs.networkNamespace,
+					},
+				},
 				Action: func(context *cli.Context) error {
 					if context.NArg() < 1 { // TARGET
 						cli.ShowAppHelp(context)
@@ -189,21 +404,71 @@ func (pconfs *progConfigs) parseCmdArgs() {
 						log.Panic(err)
 					}
 
+					if pconfs.envFile != "" {
+						envVars, err := parseEnvFile(pconfs.envFile)
+						if err != nil {
+							log.Panic(err)
+						}
+						pconfs.envVars = append(pconfs.envVars, envVars...)
+					}
+					// env vars passed in from the cli take precedence over the env file's
+					if err := validateEnvVars(context.StringSlice("env")); err != nil {
+						log.Panic(err)
+					}
+					pconfs.envVars = append(pconfs.envVars, context.StringSlice("env")...)
+
+					binds, err := parseBindMounts(context.StringSlice("bind"))
+					if err != nil {
+						log.Panic(err)
+					}
+					pconfs.binds = binds
+
+					if pconfs.workDir != "" {
+						if !filepath.IsAbs(pconfs.workDir) {
+							log.Panic(fmt.Errorf("--workdir %v must be an absolute path", pconfs.workDir))
+						} else if _, err := os.Stat(filepath.Join(context.Args().Get(0), pconfs.workDir)); err != nil &&
+							// a workdir in a bind mount is only there once the bind mount is mounted
+							!inBindMount(filepath.Clean(pconfs.workDir), pconfs.binds) {
+							log.Panic(err)
+						}
+					}
+
+					if !stringInArr(pconfs.pidNamespace, &[]string{privateNamespace, hostNamespace}) {
+						log.Panic(fmt.Errorf("--pid must be either %v or %v", privateNamespace, hostNamespace))
+					}
+					if !stringInArr(pconfs.networkNamespace, &[]string{hostNamespace, noNamespace, privateNamespace}) {
+						log.Panic(fmt.Errorf("--network must be one of %v, %v or %v", hostNamespace, noNamespace, privateNamespace))
+					}
+
 					pconfs.command = context.Command.Name
 					pconfs.target = context.Args().Get(0)
 					return nil
 				},
 			},
 			{
-				Name:      "create",
-				Usage:     "creates a debian compartment",
-				UsageText: "debcomprt [options] create CODENAME TARGET [MIRROR]",
+				Name:        "create",
+				Usage:       "creates a debian compartment",
+				UsageText:   "debcomprt [options] create CODENAME TARGET [MIRROR...] [-- DEBOOTSTRAP_ARG...]",
+				Description: "the args after -- are passed to debootstrap (or mmdebstrap with --rootless) as is, ex. -- --variant=minbase --arch=arm64",
+				BashComplete: func(context *cli.Context) {
+					if context.NArg() > 0 { // CODENAME
+						return
+					}
+
+					codenames, err := listCodenames(debootstrapScriptsDir)
+					if err != nil {
+						return
+					}
+					for _, codename := range codenames {
+						fmt.Fprintln(context.App.Writer, codename)
+					}
+				},
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:        "alias",
 						Aliases:     []string{"a"},
 						Value:       noAlias,
-						Usage:       fmt.Sprintf("use a particular comprt configuration from %v", comprtConfigsRepoUrl),
+						Usage:       fmt.Sprintf("use a particular comprt configuration from %v (or a local dir of one, ex. <flag> %v./myalias)", comprtConfigsRepoUrl, localAliasPrefix),
 						Destination: &pconfs.alias,
 					},
 					&cli.BoolFlag{
@@ -213,18 +478,30 @@ func (pconfs *progConfigs) parseCmdArgs() {
 						Usage:       "preprocess all the aliases files by evaluating these env vars (ex. <flag> foo=bar <flag> bar=baz)",
 						Destination: &pconfs.preprocessAliases,
 					},
-					&cli.BoolFlag{
-						Name:        "passthrough",
-						Value:       false,
-						Usage:       "pass the rest of the flag/flag arguments to debootstrap (e.g. use --foo=bar flag format)",
-						Destination: &pconfs.passthrough,
+					&cli.PathFlag{
+						Name:        "alias-keyring",
+						Usage:       "require the alias's commit (or a tag of it) to be signed by a key in the armored keyring at `PATH`",
+						Destination: &pconfs.aliasKeyringPath,
+					},
+					&cli.StringFlag{
+						Name:        "alias-ref",
+						Usage:       "use the alias from a particular `REF` (a branch, tag or commit) of the comprtconfigs repo",
+						Destination: &pconfs.aliasRef,
+					},
+					&cli.PathFlag{
+						Name:        "alias-values",
+						Usage:       "preprocess all the aliases files with the values in `PATH` (one KEY=VALUE per line)",
+						Destination: &pconfs.aliasValuesPath,
+					},
+					&cli.StringSliceFlag{
+						Name:  "env-file",
+						Usage: "preprocess all the aliases files with the env vars in the dotenv file at `PATH`, the files passed after override the ones before (ex. <flag> base.env <flag> ci.env)",
 					},
 					&cli.BoolFlag{
-						Name:        "quiet",
-						Aliases:     []string{"q"},
+						Name:        "offline",
 						Value:       false,
-						Usage:       "quiet (no output)",
-						Destination: &pconfs.quiet,
+						Usage:       "use the alias as it was last fetched, without accessing the network",
+						Destination: &pconfs.offline,
 					},
 					&cli.PathFlag{
 						Name:        "includes-path",
@@ -244,652 +521,3152 @@ func (pconfs *progConfigs) parseCmdArgs() {
 						Name:        "crypt-password",
 						Aliases:     []string{"p"},
 						Value:       "",
-						Usage:       fmt.Sprintf("set a password for the default comprt user: %v", defaultComprtUserName),
+						Usage:       fmt.Sprintf("set a password (hashed by crypt(3)) for the default comprt user: %v", defaultComprtUserName),
 						Destination: &pconfs.cryptPassword,
 					},
+					&cli.StringFlag{
+						Name:        "crypt-method",
+						Value:       cryptMethodSha512,
+						Usage:       fmt.Sprintf("the method used to hash the --password (one of: %v)", strings.Join(cryptMethods, ", ")),
+						Destination: &pconfs.cryptMethod,
+					},
+					&cli.StringFlag{
+						Name:        "password",
+						Usage:       fmt.Sprintf("set a plaintext password (hashed by debcomprt) for the default comprt user: %v", defaultComprtUserName),
+						Destination: &pconfs.password,
+					},
+					&cli.PathFlag{
+						Name:        "password-file",
+						Usage:       "read the plaintext password from the first line of `PATH`",
+						Destination: &pconfs.passwordFile,
+					},
+					&cli.BoolFlag{
+						Name:        "password-stdin",
+						Value:       false,
+						Usage:       "read the plaintext password from the first line of stdin",
+						Destination: &pconfs.passwordStdin,
+					},
+					&cli.BoolFlag{
+						Name:        "password-prompt",
+						Value:       false,
+						Usage:       "prompt for the plaintext password on the terminal",
+						Destination: &pconfs.passwordPrompt,
+					},
+					&cli.BoolFlag{
+						Name:        "rootless",
+						Value:       false,
+						Usage:       "create the comprt without root by using mmdebstrap in a user namespace",
+						Destination: &pconfs.rootless,
+					},
+					&cli.StringFlag{
+						Name:        "backend",
+						Value:       debootstrapBackend,
+						Usage:       fmt.Sprintf("bootstrap the comprt with %v or lay down a skeleton rootfs without packages (%v), for testing debcomprt", debootstrapBackend, fakeBootstrapBackend),
+						Hidden:      true,
+						Destination: &pconfs.createBackend,
+					},
+					&cli.StringSliceFlag{
+						Name:  "hook",
+						Usage: fmt.Sprintf("run the script on the host at a lifecycle stage (one of: %v) (ex. <flag> post-bootstrap=./cache.sh)", strings.Join(hookStages, ", ")),
+					},
+					&cli.StringSliceFlag{
+						Name:  "ansible-playbook",
+						Usage: fmt.Sprintf("run the ansible `PLAYBOOK` against the comprt (with the %v connection) after the comprt config file", ansibleChrootConnection),
+					},
+					&cli.StringFlag{
+						Name:        "user-name",
+						Value:       defaultComprtUserName,
+						Usage:       "the `NAME` of the default comprt user",
+						Destination: &pconfs.user.name,
+					},
+					&cli.IntFlag{
+						Name:        "uid",
+						Value:       defaultComprtUid,
+						Usage:       "the uid of the default comprt user",
+						Destination: &pconfs.user.uid,
+					},
+					&cli.IntFlag{
+						Name:        "gid",
+						Usage:       "the gid of the default comprt user's primary group (default: the uid)",
+						Destination: &pconfs.user.gid,
+					},
+					&cli.StringFlag{
+						Name:        "user-shell",
+						Value:       defaultComprtUserShell,
+						Usage:       "the login shell of the default comprt user",
+						Destination: &pconfs.user.shell,
+					},
+					&cli.StringFlag{
+						Name:  "user-groups",
+						Usage: "the supplementary groups of the default comprt user (ex. <flag> adm,audio,video)",
+					},
+					&cli.StringFlag{
+						Name:        "sudo",
+						Usage:       fmt.Sprintf("install sudo and allow %v to use it, with or without a password (ex. <flag> or <flag>=%v)", defaultComprtUserName, sudoNoPasswd),
+						Destination: &pconfs.sudo,
+					},
+					&cli.PathFlag{
+						Name:        "manifest",
+						Usage:       "create what the manifest at `PATH` declares (e.g. more users) along with the comprt",
+						Destination: &pconfs.manifestPath,
+					},
+					&cli.PathFlag{
+						Name:        "lockfile",
+						Value:       lockFile,
+						Usage:       "write what the comprt was created from to the lockfile at `PATH` (an empty PATH writes none)",
+						Destination: &pconfs.lockFilePath,
+					},
+					&cli.StringFlag{
+						Name:  "snapshot",
+						Usage: "create the comprt from the snapshot mirror (snapshot.debian.org or snapshot.ubuntu.com) of each MIRROR as of `TIME` (ex. <flag> 2024-01-15T00:00:00Z)",
+					},
+					&cli.PathFlag{
+						Name:  "locked",
+						Usage: "create the comprt again from the lockfile at `PATH`, by using snapshot mirrors and installing the locked package versions (the CODENAME is taken from the lockfile)",
+					},
+					&cli.PathFlag{
+						Name:        "lockfile-keyring",
+						Usage:       "require the lockfile passed to --locked to be signed (PATH.asc) by a key in the armored keyring at `PATH`",
+						Destination: &pconfs.lockFileKeyringPath,
+					},
+					&cli.StringFlag{
+						Name:        "sign",
+						Usage:       "sign the lockfile with the gpg key `KEYID`, the detached signature is written next to it (ex. debcomprt.lock.json.asc)",
+						Destination: &pconfs.signKeyID,
+					},
+					&cli.StringSliceFlag{
+						Name:  "ssh-key",
+						Usage: fmt.Sprintf("authorize the public key (or a file of them) to log in as %v over SSH (ex. <flag> ~/.ssh/id_ed25519.pub)", defaultComprtUserName),
+					},
+					&cli.StringSliceFlag{
+						Name:  "mirror",
+						Usage: "a MIRROR to fall back on if debootstrap is unable to download from the ones before it, used after the MIRROR arguments (ex. <flag> http://deb.debian.org/debian/)",
+					},
+					&cli.StringFlag{
+						Name:  "components",
+						Value: "main",
+						Usage: "the archive components to use in the comprt's apt sources (ex. <flag> main,contrib,non-free)",
+					},
+					&cli.BoolFlag{
+						Name:  "no-security",
+						Value: false,
+						Usage: "leave the security suite out of the comprt's apt sources",
+					},
+					&cli.BoolFlag{
+						Name:  "no-updates",
+						Value: false,
+						Usage: "leave the updates suite out of the comprt's apt sources",
+					},
+					&cli.BoolFlag{
+						Name:        "backports",
+						Value:       false,
+						Usage:       "add the backports suite to the comprt's apt sources",
+						Destination: &pconfs.sources.backports,
+					},
+					&cli.BoolFlag{
+						Name:        "deb822-sources",
+						Value:       false,
+						Usage:       "write the comprt's apt sources in the deb822 format",
+						Destination: &pconfs.sources.deb822,
+					},
+					&cli.StringSliceFlag{
+						Name:  "apt-repo",
+						Usage: "install a third-party apt repo into the comprt (ex. <flag> 'docker=https://download.docker.com/linux/debian buster stable')",
+					},
+					&cli.StringSliceFlag{
+						Name:  "apt-repo-key",
+						Usage: "install the keyring (a URL or PATH) that signs the named apt repo (ex. <flag> docker=https://download.docker.com/linux/debian/gpg)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "bind",
+						Usage: "bind mount HOST_PATH[:COMPRT_PATH[:ro]] into the comprt while it is configured (ex. <flag> ./src:/home/debcomprt/src <flag> /var/cache/ccache:/ccache:ro)",
+					},
+					&cli.StringFlag{
+						Name:  "build-in",
+						Usage: fmt.Sprintf("build the comprt in a %v (ex. <flag> %v:8G) and then sync it to TARGET", tmpfsBuildIn, tmpfsBuildIn),
+					},
+					&cli.BoolFlag{
+						Name:        "eatmydata",
+						Value:       false,
+						Usage:       "skip fsync while the comprt is bootstrapped and its packages are installed, by using eatmydata",
+						Destination: &useEatmydata,
+					},
+					&cli.BoolFlag{
+						Name:        "noninteractive",
+						Value:       noninteractiveConfig,
+						Usage:       fmt.Sprintf("run the comprt config file with %v, that way apt and debconf never prompt", strings.Join(aptNonInteractiveEnv, " ")),
+						Destination: &noninteractiveConfig,
+					},
+					&cli.BoolFlag{
+						Name:        "skip-preflight",
+						Value:       false,
+						Usage:       "skip checking the free space, programs, kernel filesystems and keyrings needed before creating the comprt",
+						Destination: &pconfs.skipPreflight,
+					},
+					&cli.StringSliceFlag{
+						Name:  "copy",
+						Usage: "copy the host file or dir into the comprt as SRC:DEST[:OWNER[:GROUP[:MODE]]] (ex. <flag> ./etc/motd:/etc/motd <flag> ./id_ed25519:/root/.ssh/id_ed25519:::0600)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "dns",
+						Usage: "use the nameserver at `IP` while the comprt is configured, instead of the host's",
+					},
+					&cli.BoolFlag{
+						Name:  "copy-hosts",
+						Value: false,
+						Usage: "use the host's /etc/hosts while the comprt is configured",
+					},
+					&cli.StringSliceFlag{
+						Name:  "secret",
+						Usage: fmt.Sprintf("put the secret into %v while the comprt config file runs, as NAME=VALUE or NAME=@PATH to read it from a host file (ex. <flag> GITHUB_TOKEN=@./token)", secretsDir),
+					},
+					&cli.StringSliceFlag{
+						Name:  "label",
+						Usage: "label the comprt in the registry (ex. <flag> team=infra <flag> purpose=ci)",
+					},
+					&cli.BoolFlag{
+						Name:        "resume",
+						Value:       false,
+						Usage:       "resume the interrupted create of TARGET, skipping the stages it finished (e.g. the bootstrap)",
+						Destination: &pconfs.resume,
+					},
+					&cli.BoolFlag{
+						Name:        "parents",
+						Aliases:     []string{"mkdir"},
+						Value:       false,
+						Usage:       "make TARGET (and its parent dirs) if it does not exist",
+						Destination: &pconfs.parents,
+					},
+					&cli.BoolFlag{
+						Name:        "rm-on-failure",
+						Value:       true,
+						Usage:       "remove what a failed create wrote to TARGET, pass <flag>=false to keep it (e.g. to --resume the create)",
+						Destination: &pconfs.rmOnFailure,
+					},
+					&cli.BoolFlag{
+						Name:        "force",
+						Value:       false,
+						Usage:       "remove the comprt already at TARGET and create it again",
+						Destination: &pconfs.force,
+					},
+					&cli.BoolFlag{
+						Name:        "skip-existing",
+						Value:       false,
+						Usage:       "do nothing (and exit successfully) if TARGET is already a comprt",
+						Destination: &pconfs.skipExisting,
+					},
+					&cli.BoolFlag{
+						Name:        "bootable",
+						Value:       false,
+						Usage:       "install a kernel, generate its initramfs and install the bootloader (see --bootloader), so the comprt can be booted from a disk",
+						Destination: &pconfs.bootable,
+					},
+					&cli.StringFlag{
+						Name:        "bootloader",
+						Value:       grubBootloader,
+						Usage:       fmt.Sprintf("the `BOOTLOADER` installed by --bootable, either %v or %v", grubBootloader, systemdBootBootloader),
+						Destination: &pconfs.bootloader,
+					},
+					&cli.StringFlag{
+						Name:  "cloud-init",
+						Usage: "install cloud-init and seed it with `USER_DATA[,META_DATA]` (NoCloud), meta-data is generated if none is passed in",
+					},
+					&cli.BoolFlag{
+						Name:        "sysroot",
+						Value:       false,
+						Usage:       "make the comprt a sysroot to cross compile against for --arch, the -dev packages in the comprt includes are installed for --arch",
+						Destination: &pconfs.sysroot,
+					},
+					&cli.StringFlag{
+						Name:        "arch",
+						Usage:       "the debian `ARCH` the comprt is a sysroot for (needs --sysroot)",
+						Destination: &pconfs.arch,
+					},
+					&cli.BoolFlag{
+						Name:        "minimize",
+						Value:       false,
+						Usage:       "once the comprt is configured, remove its docs, man pages and locales (and keep dpkg from installing them) and clear apt's package lists and caches",
+						Destination: &pconfs.minimize,
+					},
+					&cli.StringSliceFlag{
+						Name:  "minimize-keep",
+						Usage: "keep the docs, man or locales, or the files matching the path glob, when the comprt is minimized (ex. <flag> man <flag> '/usr/share/locale/en*')",
+					},
+					&cli.StringSliceFlag{
+						Name:  "add-architecture",
+						Usage: "enable the foreign `ARCH` in the comprt before the packages of the comprt includes are installed, so packages like libc6:ARCH can be included (ex. <flag> armhf <flag> i386)",
+					},
 				},
 				Action: func(context *cli.Context) error {
-					if context.NArg() < 1 { // CODENAME
+					var args []string = context.Args().Slice()
+					if context.String("locked") != "" {
+						if pconfs.lockFileKeyringPath != "" {
+							if err := verifyFileSignature(context.String("locked"), pconfs.lockFileKeyringPath); err != nil {
+								log.Panic(err)
+							}
+						}
+						lock, err := loadComprtLock(context.String("locked"))
+						if err != nil {
+							log.Panic(err)
+						}
+						pconfs.lock = lock
+						args = append([]string{lock.CodeName}, args...)
+					}
+
+					if len(args) < 1 { // CODENAME
 						cli.ShowAppHelp(context)
 						log.Panic(errors.New("CODENAME argument is required"))
 					}
 
-					if context.NArg() < 2 { // TARGET
+					if len(args) < 2 { // TARGET
 						cli.ShowAppHelp(context)
 						log.Panic(errors.New("TARGET argument is required"))
-					} else if _, err := os.Stat(context.Args().Get(1)); errors.Is(err, fs.ErrNotExist) {
-						log.Panic(err)
+					} else if _, err := os.Stat(args[1]); errors.Is(err, fs.ErrNotExist) && !pconfs.parents {
+						log.Panic(fmt.Errorf("%w (see --parents)", err))
 					}
 
-					if context.NArg() < 3 { // MIRROR
-						if _, ok := defaultMirrorMappings[context.Args().Get(0)]; !ok {
-							log.Panic(errors.New("no default MIRROR could be determined"))
+					if pconfs.lock != nil {
+						if err := applyComprtLock(pconfs, context.IsSet("alias")); err != nil {
+							log.Panic(err)
 						}
-						pconfs.mirror = defaultMirrorMappings[context.Args().Get(0)]
-					} else {
-						pconfs.mirror = context.Args().Get(2)
 					}
 
-					pconfs.command = context.Command.Name
-					pconfs.codeName = context.Args().Get(0)
-					pconfs.target = context.Args().Get(1)
-					return nil
-				},
-			},
-		},
-		Action: func(context *cli.Context) error {
-			if context.NArg() < 1 || context.Command.Name == "" {
-				cli.ShowAppHelp(context)
-				os.Exit(1)
-			}
+					// the mirrors after the first are fallen back on
+					var mirrors []string = append(args[2:], context.StringSlice("mirror")...)
+					codenames, err := listCodenames(debootstrapScriptsDir)
+					if err != nil {
+						log.Panic(err)
+					}
+					if err := checkCodename(args[0], codenames, len(mirrors) > 0); err != nil {
+						log.Panic(err)
+					}
+					var snapshotAt time.Time
+					if context.String("snapshot") != "" {
+						if snapshotAt, err = parseSnapshotTime(context.String("snapshot"), time.Now()); err != nil {
+							log.Panic(err)
+						}
+					} else if pconfs.lock != nil {
+						snapshotAt = pconfs.lock.Created
+						// a comprt created from a snapshot mirror is locked to it
+						if at, ok := snapshotTime(pconfs.lock.Mirror); ok {
+							snapshotAt = at
+						}
+					}
+					if len(mirrors) < 1 && pconfs.lock != nil { // MIRROR
+						mirrors = append(mirrors, pconfs.lock.Mirror)
+					} else if len(mirrors) < 1 {
+						userMappings, err := loadUserMirrorMappings()
+						if err != nil {
+							log.Panic(err)
+						}
+						mirror, ok := lookupCodenameMirror(args[0], comprtArch(pconfs.passThroughFlags), userMappings)
+						if !ok {
+							log.Panic(fmt.Errorf("no default MIRROR could be determined (see %v in %v)", mirrorMappingsFile, progDataDir))
+						}
+						mirrors = append(mirrors, mirror.mirror)
+					}
+					// the mirrors passed in along with --locked are used as they are
+					if context.String("snapshot") != "" || (pconfs.lock != nil && len(args) < 3 && !context.IsSet("mirror")) {
+						for i, mirror := range mirrors {
+							if mirrors[i], err = snapshotMirror(mirror, snapshotAt); err != nil {
+								log.Panic(err)
+							}
+						}
+					}
+					pconfs.mirror = mirrors[0]
+					pconfs.sources.codeName = args[0]
+					pconfs.sources.mirror = pconfs.mirror
+					pconfs.sources.fallbackMirrors = mirrors[1:]
+					pconfs.sources.components = strings.Split(context.String("components"), ",")
+					pconfs.sources.security = !context.Bool("no-security")
+					pconfs.sources.updates = !context.Bool("no-updates")
+
+					pconfs.aliasEnvFiles = context.StringSlice("env-file")
+					if pconfs.aliasValuesPath != "" || len(pconfs.aliasEnvFiles) > 0 {
+						pconfs.preprocessAliases = true
+					}
 
-			// this shouldn't get here as long as a subcommand is required!
-			return nil
-		},
-	}
+					if localPath, ok := localAliasPath(pconfs.alias); ok {
+						if pconfs.aliasRef != "" {
+							log.Panic(errors.New("--alias-ref cannot be used with a local alias"))
+						} else if pconfs.aliasKeyringPath != "" {
+							log.Panic(errors.New("--alias-keyring cannot be used with a local alias"))
+						}
 
-	sort.Sort(cli.FlagsByName(app.Flags))
-	app.Run(localOsArgs)
-	// Because for some reason github.com/urfave/cli/v2@v2.3.0 does not have a way to
-	// eject if a variant of 'help' is passed in!
-	if pconfs.helpFlagPassedIn {
-		os.Exit(0)
-	}
-}
+						absLocalPath, err := checkLocalAlias(localPath)
+						if err != nil {
+							log.Panic(err)
+						}
+						pconfs.alias = localAliasPrefix + absLocalPath
+					}
 
-// Copy the src file to dest. Any existing file will not be overwritten and will not
-// copy file attributes.
-func copy(src, dest string) error {
-	// inspired from:
-	// https://stackoverflow.com/questions/21060945/simple-way-to-copy-a-file#answer-21061062
-	srcFd, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer srcFd.Close()
+					pconfs.hooks = context.StringSlice("hook")
+					// the comprt config file is optional, unless it was asked for
+					if _, err := os.Stat(pconfs.comprtConfigPath); context.IsSet("config-path") && errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
 
-	destFd, err := os.OpenFile(
-		dest,
-		syscall.O_CREAT|syscall.O_EXCL|syscall.O_WRONLY,
-		ModeFile|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X),
-	)
-	if err != nil {
-		return err
-	}
-	defer destFd.Close()
+					labels, err := parseLabels(context.StringSlice("label"))
+					if err != nil {
+						log.Panic(err)
+					}
+					pconfs.labels = labels
 
-	if _, err := io.Copy(destFd, srcFd); err != nil {
-		return err
-	}
+					if !context.IsSet("gid") {
+						pconfs.user.gid = pconfs.user.uid
+					}
+					if context.String("user-groups") != "" {
+						pconfs.user.groups = strings.Split(context.String("user-groups"), ",")
+					}
+					if err := pconfs.user.validate(); err != nil {
+						log.Panic(err)
+					}
+					// an alias creates the user it logs in as with this uid
+					setComprtEnvVar("DEBCOMPRT_DEFAULT_LOGIN_UID", strconv.Itoa(pconfs.user.uid))
+					pconfs.aliasEnvVars = append(pconfs.aliasEnvVars, "DEBCOMPRT_DEFAULT_LOGIN_UID="+strconv.Itoa(pconfs.user.uid))
 
-	return nil
-}
+					if pconfs.user.sshKeys, err = readSshKeys(context.StringSlice("ssh-key")); err != nil {
+						log.Panic(err)
+					}
 
-// Reverse the string array. Inspired by:
-// https://stackoverflow.com/questions/28058278/how-do-i-reverse-a-slice-in-go
-func reverse(arr *[]string) {
-	for i, j := 0, len(*arr)-1; i < j; i, j = i+1, j-1 {
-		(*arr)[i], (*arr)[j] = (*arr)[j], (*arr)[i]
-	}
-}
+					if pconfs.sudo != "" && !stringInArr(pconfs.sudo, &sudoModes) {
+						log.Panic(fmt.Errorf("%v is not a sudo mode (one of: %v)", pconfs.sudo, strings.Join(sudoModes, ", ")))
+					}
+					pconfs.user.sudo = pconfs.sudo
+
+					var passwordFlags int
+					for _, passed := range []bool{
+						pconfs.cryptPassword != "",
+						pconfs.password != "",
+						pconfs.passwordFile != "",
+						pconfs.passwordStdin,
+						pconfs.passwordPrompt,
+					} {
+						if passed {
+							passwordFlags++
+						}
+					}
+					if passwordFlags > 1 {
+						log.Panic(errors.New("only one of --crypt-password, --password, --password-file, --password-stdin or --password-prompt can be used"))
+					}
 
-// Look to see if the string is in the string array.
-func stringInArr(strArg string, arr *[]string) bool {
+					// re-executed in a mount namespace, the password was already read in
+					if cryptPassword, inherited, err := readInheritedCryptPassword(); err != nil {
+						log.Panic(err)
+					} else if inherited {
+						pconfs.cryptPassword, pconfs.password = cryptPassword, ""
+						pconfs.passwordFile, pconfs.passwordStdin, pconfs.passwordPrompt = "", false, false
+					}
+
+					if pconfs.passwordFile != "" {
+						if pconfs.password, err = readPasswordFile(pconfs.passwordFile); err != nil {
+							log.Panic(err)
+						}
+					} else if pconfs.passwordStdin {
+						if pconfs.password, err = readPassword(os.Stdin); err != nil {
+							log.Panic(err)
+						}
+					} else if pconfs.passwordPrompt {
+						if !isTerminal(os.Stdin.Fd()) {
+							log.Panic(errors.New("--password-prompt needs stdin to be a terminal"))
+						}
+						if pconfs.password, err = promptPassword(os.Stdin, os.Stderr, pconfs.user.name); err != nil {
+							log.Panic(err)
+						}
+					}
+
+					if pconfs.password != "" {
+						if pconfs.cryptPassword, err = hashPassword(pconfs.password, pconfs.cryptMethod); err != nil {
+							log.Panic(err)
+						}
+					} else if err := checkCryptPassword(pconfs.cryptPassword); err != nil {
+						warnf("%v", err)
+					}
+					pconfs.user.cryptPassword = pconfs.cryptPassword
+
+					pconfs.users = []comprtUser{pconfs.user}
+					if pconfs.manifestPath != "" {
+						if pconfs.manifest, err = loadManifest(pconfs.manifestPath); err != nil {
+							log.Panic(err)
+						}
+						manifestUsers, err := pconfs.manifest.comprtUsers(pconfs.users)
+						if err != nil {
+							log.Panic(err)
+						}
+						pconfs.users = append(pconfs.users, manifestUsers...)
+						pconfs.sources.repos = append(pconfs.sources.repos, pconfs.manifest.aptRepos()...)
+						pconfs.copies = append(pconfs.copies, pconfs.manifest.comprtCopies()...)
+						pconfs.caches = pconfs.manifest.Caches
+						pconfs.playbooks = pconfs.manifest.ansiblePlaybooks()
+					}
+					playbooks, err := parseAnsiblePlaybooks(context.StringSlice("ansible-playbook"))
+					if err != nil {
+						log.Panic(err)
+					}
+					pconfs.playbooks = append(pconfs.playbooks, playbooks...)
+					if len(pconfs.playbooks) > 0 && pconfs.rootless {
+						log.Panic(errors.New("--ansible-playbook (or a manifest's ansible playbooks) cannot be used with --rootless"))
+					}
+					for _, playbook := range pconfs.playbooks {
+						if err := playbook.validate(); err != nil {
+							log.Panic(err)
+						}
+					}
+					var cacheNames map[string]bool = make(map[string]bool)
+					for _, cache := range pconfs.caches {
+						if err := cache.validate(); err != nil {
+							log.Panic(err)
+						} else if cacheNames[cache.Name] {
+							log.Panic(fmt.Errorf("more than one cache is named %v", cache.Name))
+						}
+						cacheNames[cache.Name] = true
+					}
+
+					for _, value := range context.StringSlice("apt-repo") {
+						repo, err := parseAptRepo(value)
+						if err != nil {
+							log.Panic(err)
+						}
+						pconfs.sources.repos = append(pconfs.sources.repos, repo)
+					}
+					if err := setAptRepoKeys(pconfs.sources.repos, context.StringSlice("apt-repo-key")); err != nil {
+						log.Panic(err)
+					}
+					if value, ok := os.LookupEnv(fakeBootstrapEnvVar); ok && value != "" && !context.IsSet("backend") {
+						pconfs.createBackend = fakeBootstrapBackend
+					}
+					switch pconfs.createBackend {
+					case debootstrapBackend:
+					case fakeBootstrapBackend:
+						if pconfs.rootless {
+							log.Panic(fmt.Errorf("--backend %v cannot be used with --rootless", fakeBootstrapBackend))
+						}
+						fakeBootstrap = true
+					default:
+						log.Panic(fmt.Errorf("--backend must be either %v or %v", debootstrapBackend, fakeBootstrapBackend))
+					}
+					if useEatmydata {
+						if err := checkEatmydata(pconfs.rootless); err != nil {
+							warnf("%v", err)
+							useEatmydata = false
+						}
+					}
+
+					if pconfs.force && pconfs.skipExisting {
+						log.Panic(errors.New("--force cannot be used with --skip-existing"))
+					} else if pconfs.resume && (pconfs.force || pconfs.skipExisting) {
+						log.Panic(errors.New("--resume cannot be used with --force or --skip-existing"))
+					}
+					if pconfs.resume && (pconfs.rootless || context.String("build-in") != "") {
+						log.Panic(errors.New("--resume cannot be used with --rootless or --build-in, neither leave an interrupted create behind"))
+					}
+					if pconfs.bootable {
+						if pconfs.rootless {
+							log.Panic(errors.New("--bootable cannot be used with --rootless"))
+						}
+						if pconfs.bootablePkgs, err = bootablePkgs(args[0], comprtArch(pconfs.passThroughFlags), pconfs.bootloader); err != nil {
+							log.Panic(err)
+						}
+					}
+					if context.String("cloud-init") != "" {
+						if pconfs.cloudInit, err = parseCloudInitSeed(context.String("cloud-init")); err != nil {
+							log.Panic(err)
+						}
+					}
+					if pconfs.foreignArchs, err = parseForeignArchs(context.StringSlice("add-architecture"), comprtArch(pconfs.passThroughFlags)); err != nil {
+						log.Panic(err)
+					}
+					if pconfs.sysroot {
+						if pconfs.arch == "" {
+							log.Panic(errors.New("--sysroot needs --arch"))
+						} else if pconfs.rootless {
+							log.Panic(errors.New("--sysroot cannot be used with --rootless"))
+						}
+						if _, err := getSysrootArch(pconfs.arch); err != nil {
+							log.Panic(err)
+						}
+						// the comprt itself stays of the host's arch, so it can be chrooted into
+						if pconfs.arch != comprtArch(pconfs.passThroughFlags) && !stringInArr(pconfs.arch, &pconfs.foreignArchs) {
+							pconfs.foreignArchs = append(pconfs.foreignArchs, pconfs.arch)
+						}
+					} else if pconfs.arch != "" {
+						log.Panic(errors.New("--arch needs --sysroot"))
+					}
+					if pconfs.minimize {
+						if pconfs.rootless {
+							log.Panic(errors.New("--minimize cannot be used with --rootless"))
+						}
+						if pconfs.minimizePolicy, err = newMinimizePolicy(context.StringSlice("minimize-keep")); err != nil {
+							log.Panic(err)
+						}
+					} else if context.IsSet("minimize-keep") {
+						log.Panic(errors.New("--minimize-keep needs --minimize"))
+					}
+					if pconfs.lockFileKeyringPath != "" && context.String("locked") == "" {
+						log.Panic(errors.New("--lockfile-keyring needs --locked"))
+					}
+					if pconfs.signKeyID != "" {
+						if pconfs.lockFilePath == "" {
+							log.Panic(errors.New("--sign needs a lockfile to sign (see --lockfile)"))
+						}
+						if err := checkSigningKey(pconfs.signKeyID); err != nil {
+							log.Panic(err)
+						}
+					}
+					if context.String("build-in") != "" {
+						if pconfs.rootless {
+							log.Panic(errors.New("--build-in cannot be used with --rootless"))
+						}
+						if pconfs.tmpfsSize, err = parseBuildIn(context.String("build-in")); err != nil {
+							log.Panic(err)
+						}
+						pconfs.buildInTmpfs = true
+					}
+
+					if pconfs.binds, err = parseBindMounts(context.StringSlice("bind")); err != nil {
+						log.Panic(err)
+					}
+
+					mirrors, mirrorBinds, err := resolveLocalMirrors(append([]string{pconfs.mirror}, pconfs.sources.fallbackMirrors...), pconfs.sources.codeName)
+					if err != nil {
+						log.Panic(err)
+					}
+					pconfs.mirror, pconfs.sources.mirror, pconfs.sources.fallbackMirrors = mirrors[0], mirrors[0], mirrors[1:]
+					pconfs.binds = append(mirrorBinds, pconfs.binds...)
+
+					if pconfs.netFiles, err = newNetworkFiles(context.StringSlice("dns"), context.Bool("copy-hosts")); err != nil {
+						log.Panic(err)
+					}
+					if pconfs.secrets, err = parseComprtSecrets(context.StringSlice("secret")); err != nil {
+						log.Panic(err)
+					}
+
+					copies, err := parseComprtCopies(context.StringSlice("copy"))
+					if err != nil {
+						log.Panic(err)
+					}
+					pconfs.copies = append(pconfs.copies, copies...)
+					for _, comprtCp := range pconfs.copies {
+						if err := comprtCp.validate(); err != nil {
+							log.Panic(err)
+						}
+					}
+
+					var repoNames map[string]bool = make(map[string]bool)
+					for _, repo := range pconfs.sources.repos {
+						if err := repo.validate(); err != nil {
+							log.Panic(err)
+						} else if repoNames[repo.Name] {
+							log.Panic(fmt.Errorf("more than one repo is named %v", repo.Name))
+						}
+						repoNames[repo.Name] = true
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.codeName = args[0]
+					pconfs.target = args[1]
+					return nil
+				},
+			},
+			{
+				Name:      "boot",
+				Usage:     "boots a debian compartment's init system, as if the comprt were a container",
+				UsageText: "debcomprt [options] boot TARGET",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "backend",
+						Value:       autoBootBackend,
+						Usage:       fmt.Sprintf("boot with systemd-nspawn (%v), debcomprt itself (%v) or whichever is available (%v)", nspawnBootBackend, internalBootBackend, autoBootBackend),
+						Destination: &pconfs.bootBackend,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET argument is required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					backend, err := resolveBootBackend(pconfs.bootBackend)
+					if err != nil {
+						log.Panic(err)
+					}
+					pconfs.bootBackend = backend
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					return nil
+				},
+			},
+			{
+				Name:      "snapshot",
+				Usage:     "captures the state of a debian compartment, to later restore it",
+				UsageText: "debcomprt [options] snapshot TARGET NAME",
+				Flags: []cli.Flag{
+					compressionFlag(&pconfs.compression),
+				},
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 2 { // TARGET NAME
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET and NAME arguments are required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					if _, err := getCodec(pconfs.compression); err != nil {
+						log.Panic(err)
+					}
+					if err := validateSnapshotName(context.Args().Get(1)); err != nil {
+						log.Panic(err)
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					pconfs.snapshotName = context.Args().Get(1)
+					return nil
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "rolls a debian compartment back to a snapshot",
+				UsageText: "debcomprt [options] restore TARGET NAME",
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 2 { // TARGET NAME
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET and NAME arguments are required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					if err := validateSnapshotName(context.Args().Get(1)); err != nil {
+						log.Panic(err)
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					pconfs.snapshotName = context.Args().Get(1)
+					pconfs.compression = defaultCodecName
+					return nil
+				},
+			},
+			{
+				Name:      "export",
+				Usage:     "exports a debian compartment into archives other tools can import (e.g. a LXD image)",
+				UsageText: "debcomprt [options] export TARGET [DEST]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "format",
+						Value:       defaultExportFormat,
+						Usage:       fmt.Sprintf("export the comprt in `FORMAT` (one of: %v)", strings.Join(exportFormats(), ", ")),
+						Destination: &pconfs.exportFormat,
+					},
+					compressionFlag(&pconfs.compression),
+					&cli.BoolFlag{
+						Name:        "lxd-import",
+						Value:       false,
+						Usage:       "import the exported image into LXD (needs --format lxd)",
+						Destination: &pconfs.lxdImport,
+					},
+					&cli.StringFlag{
+						Name:        "lxd-alias",
+						Usage:       "import the exported image into LXD under `ALIAS` (implies --lxd-import)",
+						Destination: &pconfs.lxdAlias,
+					},
+					&cli.StringSliceFlag{
+						Name:  "tag",
+						Usage: "tag the image imported into the container engine, the first tag is imported as (needs --format docker)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "label",
+						Usage: "label the image imported into the container engine (ex. <flag> team=infra <flag> purpose=ci)",
+					},
+					&cli.StringFlag{
+						Name:        "engine",
+						Usage:       fmt.Sprintf("import the image into `ENGINE` (one of: %v), the first installed is used by default", strings.Join(containerEngines, ", ")),
+						Destination: &pconfs.containerEngine,
+					},
+					&cli.StringFlag{
+						Name:        "sign",
+						Usage:       "sign the exported files with the gpg key `KEYID`, each detached signature is written next to its file (ex. rootfs.tar.gz.asc)",
+						Destination: &pconfs.signKeyID,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET argument is required"))
+					} else if context.NArg() < 2 && pconfs.exportFormat != dockerExportFormat { // TARGET DEST
+						cli.ShowAppHelp(context)
+						log.Panic(fmt.Errorf("DEST argument is required for --format %v", pconfs.exportFormat))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					if _, err := getExporter(pconfs.exportFormat); err != nil {
+						log.Panic(err)
+					}
+					if _, err := getCodec(pconfs.compression); err != nil {
+						log.Panic(err)
+					}
+					if pconfs.lxdAlias != "" {
+						pconfs.lxdImport = true
+					}
+					if pconfs.lxdImport && pconfs.exportFormat != lxdExportFormat {
+						log.Panic(fmt.Errorf("--lxd-import (or --lxd-alias) needs --format %v", lxdExportFormat))
+					}
+
+					pconfs.exportTags = context.StringSlice("tag")
+					labels, err := parseLabels(context.StringSlice("label"))
+					if err != nil {
+						log.Panic(err)
+					}
+					pconfs.labels = labels
+					if pconfs.exportFormat == dockerExportFormat && len(pconfs.exportTags) == 0 {
+						log.Panic(fmt.Errorf("--tag is required with --format %v", dockerExportFormat))
+					} else if pconfs.exportFormat != dockerExportFormat && (len(pconfs.exportTags) > 0 || len(pconfs.labels) > 0) {
+						log.Panic(fmt.Errorf("--tag (or --label) needs --format %v", dockerExportFormat))
+					} else if pconfs.containerEngine != "" && !stringInArr(pconfs.containerEngine, &containerEngines) {
+						log.Panic(fmt.Errorf("%v is not a supported container engine, use one of: %v", pconfs.containerEngine, strings.Join(containerEngines, ", ")))
+					}
+					if pconfs.signKeyID != "" {
+						if pconfs.exportFormat == dockerExportFormat {
+							log.Panic(fmt.Errorf("--sign cannot be used with --format %v, the image is not exported to files", dockerExportFormat))
+						}
+						if err := checkSigningKey(pconfs.signKeyID); err != nil {
+							log.Panic(err)
+						}
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					pconfs.exportDir = context.Args().Get(1)
+					return nil
+				},
+			},
+			{
+				Name:      "clone",
+				Usage:     "duplicates a debian compartment",
+				UsageText: "debcomprt [options] clone SRC_TARGET DEST_TARGET",
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 2 { // SRC_TARGET DEST_TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("SRC_TARGET and DEST_TARGET arguments are required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.srcTarget = context.Args().Get(0)
+					pconfs.target = context.Args().Get(1)
+					return nil
+				},
+			},
+			{
+				Name:      "upgrade",
+				Usage:     "upgrades the packages installed in a debian compartment",
+				UsageText: "debcomprt [options] upgrade TARGET",
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET argument is required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					return nil
+				},
+			},
+			{
+				Name:      "provision",
+				Usage:     "re-runs a comprt config file on an existing debian compartment",
+				UsageText: "debcomprt [options] provision TARGET",
+				Flags: []cli.Flag{
+					&cli.PathFlag{
+						Name:        "config-path",
+						Aliases:     []string{"c"},
+						Value:       pconfs.comprtConfigPath,
+						Usage:       "alternative `PATH` to comprt config file",
+						Destination: &pconfs.comprtConfigPath,
+					},
+					&cli.StringSliceFlag{
+						Name:  "hook",
+						Usage: fmt.Sprintf("run the script on the host at a lifecycle stage (%v or %v) (ex. <flag> post-config=./notify.sh)", preConfigHook, postConfigHook),
+					},
+					&cli.StringSliceFlag{
+						Name:  "ansible-playbook",
+						Usage: fmt.Sprintf("run the ansible `PLAYBOOK` against the comprt (with the %v connection) after the comprt config file", ansibleChrootConnection),
+					},
+					&cli.StringSliceFlag{
+						Name:  "secret",
+						Usage: fmt.Sprintf("put the secret into %v while the comprt config file runs, as NAME=VALUE or NAME=@PATH to read it from a host file (ex. <flag> GITHUB_TOKEN=@./token)", secretsDir),
+					},
+					&cli.BoolFlag{
+						Name:        "noninteractive",
+						Value:       noninteractiveConfig,
+						Usage:       fmt.Sprintf("run the comprt config file with %v, that way apt and debconf never prompt", strings.Join(aptNonInteractiveEnv, " ")),
+						Destination: &noninteractiveConfig,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET argument is required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					} else if _, err := os.Stat(pconfs.comprtConfigPath); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					pconfs.hooks = context.StringSlice("hook")
+					playbooks, err := parseAnsiblePlaybooks(context.StringSlice("ansible-playbook"))
+					if err != nil {
+						log.Panic(err)
+					}
+					for _, playbook := range playbooks {
+						if err := playbook.validate(); err != nil {
+							log.Panic(err)
+						}
+					}
+					pconfs.playbooks = playbooks
+					if pconfs.secrets, err = parseComprtSecrets(context.StringSlice("secret")); err != nil {
+						log.Panic(err)
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					return nil
+				},
+			},
+			{
+				Name:      "info",
+				Usage:     "prints how a debian compartment was created",
+				UsageText: "debcomprt [options] info TARGET",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "output",
+						Aliases:     []string{"o"},
+						Value:       textOutput,
+						Usage:       fmt.Sprintf("the `FORMAT` to output the comprt's metadata in (%v or %v)", textOutput, jsonOutput),
+						Destination: &pconfs.outputFormat,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET argument is required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					if !stringInArr(pconfs.outputFormat, &[]string{textOutput, jsonOutput}) {
+						log.Panic(fmt.Errorf("--output must be either %v or %v", textOutput, jsonOutput))
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					return nil
+				},
+			},
+			{
+				Name:      "digest",
+				Usage:     "records a manifest of a debian compartment's files for the verify command",
+				UsageText: "debcomprt [options] digest TARGET",
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET argument is required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					return nil
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "checks a debian compartment has not drifted from how it was created",
+				UsageText: "debcomprt [options] verify TARGET",
+				Flags: []cli.Flag{
+					&cli.PathFlag{
+						Name:        "lockfile",
+						Value:       lockFile,
+						Usage:       "check the comprt's packages against the lockfile at `PATH`",
+						Destination: &pconfs.lockFilePath,
+					},
+					&cli.PathFlag{
+						Name:        "lockfile-keyring",
+						Usage:       "require the lockfile to be signed (PATH.asc) by a key in the armored keyring at `PATH`",
+						Destination: &pconfs.lockFileKeyringPath,
+					},
+					&cli.PathFlag{
+						Name:        "checksums",
+						Usage:       "check the comprt's files against the checksums (as sha256sum writes them) at `PATH`",
+						Destination: &pconfs.checksumsPath,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET argument is required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					// the default lockfile is only checked against if there is one
+					if _, err := os.Stat(pconfs.lockFilePath); context.IsSet("lockfile") || err == nil {
+						if pconfs.lockFileKeyringPath != "" {
+							if err := verifyFileSignature(pconfs.lockFilePath, pconfs.lockFileKeyringPath); err != nil {
+								log.Panic(err)
+							}
+						}
+						if pconfs.lock, err = loadComprtLock(pconfs.lockFilePath); err != nil {
+							log.Panic(err)
+						}
+					} else if pconfs.lockFileKeyringPath != "" {
+						log.Panic(errors.New("--lockfile-keyring needs a lockfile to verify (see --lockfile)"))
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					return nil
+				},
+			},
+			{
+				Name:      "du",
+				Usage:     "breaks down the space a debian compartment takes up by package and by dir",
+				UsageText: "debcomprt [options] du TARGET",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "sort",
+						Value:       sizeSortKey,
+						Usage:       fmt.Sprintf("sort the packages and dirs by `KEY` (%v or %v)", sizeSortKey, nameSortKey),
+						Destination: &pconfs.sortKey,
+					},
+					&cli.IntFlag{
+						Name:        "depth",
+						Value:       defaultDuDepth,
+						Usage:       "break down the space by dir `N` path components deep (e.g. /usr/share is 2)",
+						Destination: &pconfs.duDepth,
+					},
+					&cli.StringFlag{
+						Name:        "output",
+						Aliases:     []string{"o"},
+						Value:       textOutput,
+						Usage:       fmt.Sprintf("the `FORMAT` to output the breakdown in (%v or %v)", textOutput, jsonOutput),
+						Destination: &pconfs.outputFormat,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET argument is required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					if !stringInArr(pconfs.sortKey, &[]string{sizeSortKey, nameSortKey}) {
+						log.Panic(fmt.Errorf("--sort must be either %v or %v", sizeSortKey, nameSortKey))
+					} else if pconfs.duDepth < 1 {
+						log.Panic(errors.New("--depth must be at least 1"))
+					} else if !stringInArr(pconfs.outputFormat, &[]string{textOutput, jsonOutput}) {
+						log.Panic(fmt.Errorf("--output must be either %v or %v", textOutput, jsonOutput))
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					return nil
+				},
+			},
+			{
+				Name:      "inventory",
+				Usage:     "lists the comprts created on this host along with their metadata",
+				UsageText: "debcomprt [options] inventory",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "output",
+						Aliases:     []string{"o"},
+						Value:       jsonOutput,
+						Usage:       fmt.Sprintf("the `FORMAT` to output the inventory in (%v or %v)", jsonOutput, csvOutput),
+						Destination: &pconfs.outputFormat,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					if !stringInArr(pconfs.outputFormat, &[]string{jsonOutput, csvOutput}) {
+						log.Panic(fmt.Errorf("--output must be either %v or %v", jsonOutput, csvOutput))
+					}
+
+					pconfs.command = context.Command.Name
+					return nil
+				},
+			},
+			{
+				Name:      "cleanup",
+				Usage:     "unmounts what crashed runs left mounted in debian compartments",
+				UsageText: "debcomprt [options] cleanup [TARGET]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:        "remove-incomplete",
+						Value:       false,
+						Usage:       "remove the comprts left incomplete by an interrupted create",
+						Destination: &pconfs.removeIncomplete,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					return nil
+				},
+			},
+			{
+				Name:      genManCmdName,
+				Usage:     "generates the man pages of debcomprt and its commands",
+				UsageText: "debcomprt gen-man DIR",
+				Hidden:    true,
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // DIR
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("DIR argument is required"))
+					}
+					pconfs.command = context.Command.Name
+					pconfs.manDir = context.Args().Get(0)
+					pconfs.cliApp = context.App
+					return nil
+				},
+			},
+			{
+				Name:      "gc",
+				Usage:     "removes what debcomprt no longer needs from its data dir",
+				UsageText: "debcomprt [options] gc [--dry-run]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:        "dry-run",
+						Aliases:     []string{"n"},
+						Value:       false,
+						Usage:       "report what would be removed without removing it",
+						Destination: &pconfs.dryRun,
+					},
+					&cli.DurationFlag{
+						Name:        "max-cache-age",
+						Value:       defaultGcCacheAge,
+						Usage:       "remove the caches not written to within `DURATION`, 0 keeps every cache",
+						Destination: &pconfs.maxCacheAge,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					pconfs.command = context.Command.Name
+					return nil
+				},
+			},
+			{
+				Name:      "apply",
+				Usage:     "creates the debian compartments declared in a file",
+				UsageText: "debcomprt [options] apply [--parallel N] FILE",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:        "parallel",
+						Value:       1,
+						Usage:       "create up to `N` comprts at once",
+						Destination: &pconfs.parallel,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // FILE
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("FILE argument is required"))
+					} else if pconfs.parallel < 1 {
+						log.Panic(errors.New("--parallel must be at least 1"))
+					}
+
+					var err error
+					if pconfs.apply, err = loadApplyFile(context.Args().Get(0)); err != nil {
+						log.Panic(err)
+					}
+
+					pconfs.command = context.Command.Name
+					return nil
+				},
+			},
+			{
+				Name:      "delete",
+				Usage:     "removes a debian compartment along with its registry entry",
+				UsageText: "debcomprt [options] delete TARGET",
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET argument is required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					return nil
+				},
+			},
+			{
+				Name:      "register-schroot",
+				Usage:     "writes a schroot chroot definition for a debian compartment",
+				UsageText: "debcomprt [options] register-schroot TARGET",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "name",
+						Usage:       "name the schroot `NAME` (defaults to the name of TARGET's dir)",
+						Destination: &pconfs.schrootName,
+					},
+					&cli.StringSliceFlag{
+						Name:  "users",
+						Usage: "allow the user to use the schroot (defaults to the user that ran sudo, or the current user)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "groups",
+						Usage: "allow the members of the group to use the schroot",
+					},
+					&cli.StringFlag{
+						Name:        "profile",
+						Value:       defaultSchrootProfile,
+						Usage:       "set up the schroot with the schroot `PROFILE` (ex. <flag> buildd)",
+						Destination: &pconfs.schrootProfile,
+					},
+					&cli.BoolFlag{
+						Name:        "force",
+						Value:       false,
+						Usage:       "replace an existing schroot of the same name",
+						Destination: &pconfs.force,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET argument is required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					pconfs.schrootUsers = context.StringSlice("users")
+					pconfs.schrootGroups = context.StringSlice("groups")
+					if len(pconfs.schrootUsers) == 0 && len(pconfs.schrootGroups) == 0 {
+						if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+							pconfs.schrootUsers = []string{sudoUser}
+						} else if current, err := user.Current(); err == nil {
+							pconfs.schrootUsers = []string{current.Username}
+						}
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					return nil
+				},
+			},
+			{
+				Name:      "register-sbuild",
+				Usage:     "prepares a debian compartment for sbuild and registers it as an sbuild chroot",
+				UsageText: "debcomprt [options] register-sbuild TARGET",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:        "force",
+						Value:       false,
+						Usage:       "replace an existing schroot of the same name",
+						Destination: &pconfs.force,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					if context.NArg() < 1 { // TARGET
+						cli.ShowAppHelp(context)
+						log.Panic(errors.New("TARGET argument is required"))
+					} else if _, err := os.Stat(context.Args().Get(0)); errors.Is(err, fs.ErrNotExist) {
+						log.Panic(err)
+					}
+
+					pconfs.command = context.Command.Name
+					pconfs.target = context.Args().Get(0)
+					return nil
+				},
+			},
+			{
+				Name:      "serve",
+				Usage:     "serves an http api for managing debian compartments over a unix socket",
+				UsageText: "debcomprt [options] serve",
+				Flags: []cli.Flag{
+					&cli.PathFlag{
+						Name:        "socket",
+						Value:       defaultSocketPath,
+						Usage:       "listen on the unix socket at `PATH`",
+						Destination: &pconfs.socketPath,
+					},
+					&cli.PathFlag{
+						Name:        "grpc-socket",
+						Usage:       "also serve the api as a gRPC service (see api/debcomprt.proto) on the unix socket at `PATH`",
+						Destination: &pconfs.grpcSocketPath,
+					},
+					&cli.StringFlag{
+						Name:        "metrics-address",
+						Usage:       "also serve the prometheus metrics (only) over tcp at `ADDRESS` (ex. <flag> :9464)",
+						Destination: &pconfs.metricsAddress,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					pconfs.command = context.Command.Name
+					return nil
+				},
+			},
+			{
+				Name:      "codenames",
+				Usage:     "lists the codenames along with the mirror a comprt of each is created from by default",
+				UsageText: "debcomprt [options] codenames",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "arch",
+						Value:       hostDebianArch(),
+						Usage:       "list the mirrors for comprts of the debian `ARCH`",
+						Destination: &pconfs.arch,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					pconfs.command = context.Command.Name
+					return nil
+				},
+			},
+			{
+				Name:      "doctor",
+				Usage:     "audits the host for what is needed to create and use debian compartments",
+				UsageText: "debcomprt [options] doctor",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "arch",
+						Value:       hostDebianArch(),
+						Usage:       "check that comprts of the debian `ARCH` can be chrooted into",
+						Destination: &pconfs.arch,
+					},
+					&cli.BoolFlag{
+						Name:        "offline",
+						Value:       false,
+						Usage:       "skip checking the default mirrors can be reached",
+						Destination: &pconfs.offline,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					pconfs.command = context.Command.Name
+					return nil
+				},
+			},
+		},
+		Action: func(context *cli.Context) error {
+			if pconfs.listCodenames {
+				codenames, err := listCodenames(debootstrapScriptsDir)
+				if err != nil {
+					log.Panic(err)
+				}
+				fmt.Println(strings.Join(codenames, "\n"))
+				os.Exit(0)
+			}
+
+			if context.NArg() < 1 || context.Command.Name == "" {
+				cli.ShowAppHelp(context)
+				os.Exit(1)
+			}
+
+			// this shouldn't get here as long as a subcommand is required!
+			return nil
+		},
+	}
+
+	for _, command := range app.Commands {
+		if stringInArr(command.Name, &verbosityCommands) {
+			command.Flags = append(command.Flags, verbosityFlags(&pconfs.verbosity)...)
+		}
+	}
+
+	sort.Sort(cli.FlagsByName(app.Flags))
+	setSecretFlags(app)
+	app.Run(localOsArgs)
+	// Because for some reason github.com/urfave/cli/v2@v2.3.0 does not have a way to
+	// eject if a variant of 'help' is passed in!
+	if pconfs.helpFlagPassedIn || pconfs.bashCompletion {
+		os.Exit(0)
+	}
+
+	level, err := pconfs.verbosity.level()
+	if err != nil {
+		log.Panic(err)
+	}
+	progVerbosity = level
+	pconfs.quiet = progVerbosity < normalVerbosity
+}
+
+// Copy the src file to dest. Any existing file will not be overwritten and will not
+// copy file attributes.
+func copy(src, dest string) error {
+	// inspired from:
+	// https://stackoverflow.com/questions/21060945/simple-way-to-copy-a-file#answer-21061062
+	srcFd, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFd.Close()
+
+	destFd, err := os.OpenFile(
+		dest,
+		syscall.O_CREAT|syscall.O_EXCL|syscall.O_WRONLY,
+		ModeFile|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X),
+	)
+	if err != nil {
+		return err
+	}
+	defer destFd.Close()
+
+	if _, err := io.Copy(destFd, srcFd); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Reverse the string array. Inspired by:
+// https://stackoverflow.com/questions/28058278/how-do-i-reverse-a-slice-in-go
+func reverse(arr *[]string) {
+	for i, j := 0, len(*arr)-1; i < j; i, j = i+1, j-1 {
+		(*arr)[i], (*arr)[j] = (*arr)[j], (*arr)[i]
+	}
+}
+
+// Look to see if the string is in the string array.
+func stringInArr(strArg string, arr *[]string) bool {
 	for _, val := range *arr {
 		if val == strArg {
 			return true
 		}
-	}
+	}
+
+	return false
+}
+
+// Split the args passed to create's debootstrap (those after --) from the args,
+// the cli never sees them. The args of other commands are left as is.
+func splitPassThroughArgs(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg != "--" {
+			continue
+		}
+		var beforeTerminator []string = args[:i]
+		if stringInArr("create", &beforeTerminator) {
+			return args[:i], append([]string{}, args[i+1:]...)
+		}
+		break
+	}
+
+	return args, nil
+}
+
+// Look to see if a string from the strArgs is in the string array.
+func stringsInArr(strArgs []string, arr *[]string) bool {
+	for _, val := range strArgs {
+		if stringInArr(val, arr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Quote the string so a POSIX shell will interpret it as a single word.
+func shellQuote(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
+
+// Look in a file that has some form of standardized file format
+// (e.g. /etc/passwd, /etc/os-release) and locate a 'field' among
+// the rows based on a regex for another field. Fields are a sequence
+// of characters separated by a field separator (or a character). Field
+// indexes start at 0.
+func locateField(fPath string, fieldSepRegex *regexp.Regexp, matchIndex, returnIndex int, matchRegex *regexp.Regexp) (string, error) {
+	file, err := os.Open(fPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var allFields int = -1
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := fieldSepRegex.Split(scanner.Text(), allFields)
+		if len(fields) <= matchIndex {
+			continue
+		} else if matchRegex.FindStringIndex(fields[matchIndex]) != nil {
+			return fields[returnIndex], nil
+		}
+	}
+
+	return "", nil
+}
+
+// Get required extra data to be used by the program.
+func getProgData(alias string, preprocessAliases bool, pconfs *progConfigs) error {
+	if alias != noAlias {
+		var aliasPath string
+		if localPath, ok := localAliasPath(alias); ok {
+			aliasPath = localPath
+
+			var err error
+			if pconfs.aliasCommit, err = aliasCommit(aliasPath); err != nil {
+				return err
+			}
+		} else {
+			if _, err := os.Stat(progDataDir); errors.Is(err, fs.ErrNotExist) {
+				os.MkdirAll(progDataDir, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X))
+			} else if err != nil {
+				return err
+			}
+
+			var err error
+			if aliasPath, err = fetchAlias(alias, pconfs); err != nil {
+				return err
+			}
+		}
+
+		if preprocessAliases {
+			var valuesPaths []string = pconfs.aliasEnvFiles
+			if pconfs.aliasValuesPath != "" {
+				valuesPaths = append([]string{pconfs.aliasValuesPath}, valuesPaths...)
+			}
+			values, err := aliasTemplateValues(valuesPaths, pconfs.aliasEnvVars)
+			if err != nil {
+				return err
+			}
+
+			if aliasPath, err = preprocessAlias(aliasPath, values); err != nil {
+				return err
+			}
+			pconfs.preprocessedAliasDir = aliasPath
+		}
+
+		pconfs.comprtConfigPath = filepath.Join(aliasPath, comprtConfigFile)
+		pconfs.comprtIncludesPath = filepath.Join(aliasPath, comprtIncludeFile)
+	}
+
+	return nil
+}
+
+// Read in the comprt includes file and adds the discovered packages into
+// includePkgs. Packages with a condition (e.g. '[buster] libssl1.1' or
+// '[arm64] gcc-aarch64-linux-gnu') are only added if the condition is met for
+// the codename and architecture passed in.
+func getComprtIncludes(includePkgs *[]string, comprtIncludesPath, codeName, arch string) error {
+	// inspired by:
+	// https://stackoverflow.com/questions/8757389/reading-a-file-line-by-line-in-go/16615559#16615559
+	file, err := os.Open(comprtIncludesPath)
+	if err != nil {
+		// the comprt includes is optional
+		return nil
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// a comment can take up a whole line or trail after a package
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i > -1 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			i := strings.Index(line, "]")
+			if i < 0 {
+				return fmt.Errorf("%v: %v has an unterminated condition", comprtIncludesPath, line)
+			}
+			if !comprtIncludeConditionMet(line[1:i], codeName, arch) {
+				continue
+			}
+			line = strings.TrimSpace(line[i+1:])
+		}
+		*includePkgs = append(*includePkgs, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Mount filesystems found on devices to their respective location(s) on the
+// target. As if the process had chooted to the target.
+func mountChrootFileSystems(devicesToMount []string, target string) ([]string, error) {
+	var fileSystemsMounted []string
+	// a rerun after a crash may find the filesystems still mounted
+	mounts, err := progExecutor.Mounts()
+	if err != nil {
+		return fileSystemsMounted, err
+	}
+	for _, filesys := range devicesToMount {
+		if mounted, err := isMountPointIn(target, filesys, mounts); err != nil {
+			return fileSystemsMounted, err
+		} else if mounted {
+			infof("%v is already mounted, leaving it be", filesys)
+			continue
+		}
+
+		mountPoint := filepath.Join(target, filesys)
+		if _, err := os.Stat(mountPoint); errors.Is(err, fs.ErrNotExist) {
+			var fileMode fs.FileMode
+			// filemode for /sys based on current workstation (same for /proc except url) and
+			// https://askubuntu.com/questions/341939/why-cant-i-create-a-directory-in-sys
+			switch filesys {
+			case "/sys":
+				fileMode = os.ModeDir | (OS_USER_R | OS_USER_X | OS_GROUP_R | OS_GROUP_X | OS_OTH_R | OS_OTH_X)
+			case "/proc":
+				fileMode = os.ModeDir | (OS_USER_R | OS_USER_X | OS_GROUP_R | OS_GROUP_X | OS_OTH_R | OS_OTH_X)
+			case "/dev":
+				fileMode = os.ModeDir | (OS_USER_R | OS_USER_W | OS_USER_X | OS_GROUP_R | OS_GROUP_X | OS_OTH_R | OS_OTH_X)
+			case "/dev/pts":
+				fileMode = os.ModeDir | (OS_USER_R | OS_USER_W | OS_USER_X | OS_GROUP_R | OS_GROUP_X | OS_OTH_R | OS_OTH_X)
+			default:
+				fileMode = os.ModeDir | (OS_USER_R | OS_USER_W | OS_USER_X | OS_GROUP_R | OS_GROUP_X | OS_OTH_R | OS_OTH_X)
+			}
+			if err := os.Mkdir(
+				mountPoint,
+				fileMode,
+			); err != nil {
+				return fileSystemsMounted, err
+			}
+		}
+		if filesys == "/dev/pts" {
+			ptsMounted, err := mountDevPts(target)
+			fileSystemsMounted = append(fileSystemsMounted, ptsMounted...)
+			if err != nil {
+				return fileSystemsMounted, err
+			}
+			verbosef("mounted %v", mountPoint)
+			continue
+		}
+		if err := progExecutor.Mount(filesys, filepath.Join(target, filesys), "", syscall.MS_BIND, ""); err != nil {
+			return fileSystemsMounted, err
+		}
+		fileSystemsMounted = append(fileSystemsMounted, filesys)
+		verbosef("mounted %v", mountPoint)
+
+		// Otherwise mounts made on top of this mount (e.g. /dev/pts on /dev) could
+		// propagate back to the host if the host's mount is shared.
+		if err := progExecutor.Mount("", filepath.Join(target, filesys), "", syscall.MS_PRIVATE, ""); err != nil {
+			return fileSystemsMounted, err
+		}
+	}
+	return fileSystemsMounted, nil
+}
+
+// Mount a new devpts instance on the target's /dev/pts, instead of using the
+// host's. That way ptys allocated inside the comprt are owned by the comprt's tty
+// group and the non-root comprt user can use them. The target's /dev/ptmx is
+// pointed at the new instance. The filesystems mounted are returned.
+func mountDevPts(target string) ([]string, error) {
+	var fileSystemsMounted []string
+	// for reference:
+	// https://www.kernel.org/doc/html/latest/filesystems/devpts.html
+	if err := progExecutor.Mount(
+		"devpts",
+		filepath.Join(target, "/dev/pts"),
+		"devpts",
+		syscall.MS_NOSUID|syscall.MS_NOEXEC,
+		"newinstance,ptmxmode=0666,mode=0620,gid="+strconv.Itoa(ttyGid),
+	); err != nil {
+		return fileSystemsMounted, err
+	}
+	fileSystemsMounted = append(fileSystemsMounted, "/dev/pts")
+
+	ptmxPath := filepath.Join(target, "/dev/ptmx")
+	if fileInfo, err := os.Lstat(ptmxPath); errors.Is(err, fs.ErrNotExist) {
+		// /dev/ptmx may be the host's (e.g. /dev is bind mounted), so leave it be
+		return fileSystemsMounted, nil
+	} else if err != nil {
+		return fileSystemsMounted, err
+	} else if fileInfo.Mode()&fs.ModeSymlink != 0 {
+		// assume the symlink already points to pts/ptmx
+		return fileSystemsMounted, nil
+	}
+
+	if err := progExecutor.Mount(filepath.Join(target, "/dev/pts/ptmx"), ptmxPath, "", syscall.MS_BIND, ""); err != nil {
+		return fileSystemsMounted, err
+	}
+	fileSystemsMounted = append(fileSystemsMounted, "/dev/ptmx")
+
+	return fileSystemsMounted, nil
+}
+
+// Unmount filesystems found on devices starting in the tree hierarchy of the target.
+func unMountChrootFileSystems(devicesToMount []string, target string) error {
+	// Unfortunately unmounting filesystems is not as simple when working in code.
+	// It seems retrying to unmount the same filesystem previously attempted works
+	// after a short sleep. Ordering of the filesystems matter, for reference:
+	// https://unix.stackexchange.com/questions/61885/how-to-unmount-a-formerly-chrootd-filesystem#answer-234901
+	//
+	// MONITOR(cavcrosby): the syscall package is deprecated. At the time of writing, the replacement
+	// package for Unix systems is still not at a stable version. So this will need to
+	// be revisited at some point. Also for reference: golang.org/x/sys
+	reverse(&devicesToMount)
+	var fileSystemsUnmountBacklog []string = []string{}
+	for _, filesys := range devicesToMount {
+		// DISCUSS(cavcrosby): would using golang's logging package be beneficial? Its
+		// either that, or just using the schmorgesborg of io utilities.
+		//
+		// Even with --quiet, in some cases like the below, output should still go to
+		// where an operator will see it. Only --very-quiet silences it.
+		err := unMountChrootFileSystem(filesys, target, " is busy, trying again")
+		if errors.Is(err, syscall.EBUSY) {
+			// inspired by:
+			// https://stackoverflow.com/questions/35615839/how-to-merge-multiple-strings-and-int-into-a-single-string#answer-35624701
+			infof("%v does not want to unmount, will try again later", filesys)
+			fileSystemsUnmountBacklog = append(fileSystemsUnmountBacklog, filesys)
+		} else if err != nil {
+			fmt.Printf("%s: non-expected error thrown %v\n", progname, err)
+			return err
+		}
+	}
+
+	// in the rare event that a filesystem is being stubborn to unmount
+	for _, filesys := range fileSystemsUnmountBacklog {
+		err := unMountChrootFileSystem(filesys, target, " is busy...AGAIN, trying again")
+		if errors.Is(err, syscall.EBUSY) {
+			infof("%v does not want to unmount...AGAIN", filesys)
+			var mountPoint string = filepath.Join(target, filesys)
+			if holders, err := mountHolders(procDir, mountPoint); err == nil && len(holders) > 0 {
+				var pids []string
+				for _, holder := range holders {
+					pids = append(pids, holder.String())
+				}
+				infof("%v is held by the processes: %v", mountPoint, strings.Join(pids, ", "))
+			}
+			if !lazyUnmount {
+				return fmt.Errorf("%s: unable to unmount %v (see --lazy-unmount)", progname, filesys)
+			}
+
+			// the filesystem is unmounted by the kernel once it is no longer busy
+			if err := progExecutor.Unmount(mountPoint, syscall.MNT_DETACH); err != nil {
+				return fmt.Errorf("%s: unable to lazily unmount %v: %w", progname, filesys, err)
+			}
+			infof("detached %v, it is unmounted once no longer busy", filesys)
+		} else if err != nil {
+			fmt.Printf("%s: non-expected error thrown %v\n", progname, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Unmount a filesystem found on a device from the target, retrying while the
+// filesystem is busy. busyMsg is printed before each retry.
+func unMountChrootFileSystem(filesys, target, busyMsg string) error {
+	mounts, err := progExecutor.Mounts()
+	if err != nil {
+		return err
+	}
+	if mounted, err := isMountPointIn(target, filesys, mounts); err != nil {
+		return err
+	} else if !mounted {
+		infof("%v is no longer mounted...this may be an issue", filesys)
+		return nil
+	}
+
+	return retry(context.Background(), progRetryPolicy, func(attempt int, err error) {
+		infof("%v%v", filesys, busyMsg)
+	}, func() error {
+		err := progExecutor.Unmount(filepath.Join(target, filesys), 0x0)
+		if err == nil {
+			verbosef("unmounted %v", filepath.Join(target, filesys))
+			return nil
+		} else if errors.Is(err, syscall.EBUSY) {
+			return err
+		}
+
+		return permanent(err)
+	})
+}
+
+// Set the current process's root dir to target. A function to exit out
+// of the chroot will be returned. The bind mounts passed in are mounted into
+// the target along with /sys, /proc and /dev. While chrooted, the process's env
+// is the one made by chrootEnv, for the commands ran in the comprt to inherit.
+func Chroot(target string, binds ...bindMount) (f func() error, errs []error) {
+	// Returning back to the residing directory before entering the chroot.
+	returnDir, err := os.Getwd()
+	if err != nil {
+		return nil, append(errs, err)
+	}
+
+	var devicesToMount []string = []string{"/sys", "/proc", "/dev", "/dev/pts"}
+	fileSystemsMounted, err := mountChrootFileSystems(devicesToMount, target)
+	defer func() {
+		if errs != nil {
+			if err := unMountChrootFileSystems(fileSystemsMounted, target); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}()
+	if err != nil {
+		return nil, append(errs, err)
+	}
+
+	bindsMounted, err := mountBindMounts(binds, target)
+	fileSystemsMounted = append(fileSystemsMounted, bindsMounted...)
+	if err != nil {
+		return nil, append(errs, err)
+	}
+
+	exitRoot, err := progExecutor.Chroot(target)
+	if err != nil {
+		return nil, append(errs, err)
+	}
+	exitChrootEnv := enterChrootEnv()
+
+	return func() error {
+		exitChrootEnv()
+		if err := exitRoot(); err != nil {
+			return err
+		}
+
+		if err := os.Chdir(returnDir); err != nil {
+			return err
+		}
+
+		return unMountChrootFileSystems(fileSystemsMounted, target)
+	}, nil
+}
+
+// Determine if a comprt includes condition is met. A condition is a comma
+// separated list of codenames and/or architectures, any of which must match.
+// Entries prefixed with '!' must not match (e.g. '!arm64').
+func comprtIncludeConditionMet(condition, codeName, arch string) bool {
+	var met, hasPositive bool
+	for _, entry := range strings.Split(condition, ",") {
+		entry = strings.TrimSpace(entry)
+		if strings.HasPrefix(entry, "!") {
+			if stringInArr(strings.TrimPrefix(entry, "!"), &[]string{codeName, arch}) {
+				return false
+			}
+			continue
+		}
+
+		hasPositive = true
+		if stringInArr(entry, &[]string{codeName, arch}) {
+			met = true
+		}
+	}
+
+	return met || !hasPositive
+}
+
+// Create the debootstrap arg list to be used elsewhere. Packages pinned to a
+// version in the comprt includes (e.g. git=1:2.30.2-1) or qualified with an
+// architecture (e.g. libc6:armhf) are left out, these are added to pinnedPkgs to
+// be installed with apt-get.
+func createDebootstrapArgList(args *[]string, pinnedPkgs *[]string, passThroughFlags *[]string, comprtIncludesPath, codeName, target, mirror string) error {
+	var flags []string
+	if passThroughFlags != nil {
+		flags = *passThroughFlags
+	}
+	var comprtIncludes []string
+	if err := getComprtIncludes(&comprtIncludes, comprtIncludesPath, codeName, comprtArch(flags)); err != nil {
+		return err
+	}
+
+	// debootstrap has no way to install a particular version of a package, nor a
+	// package of a foreign architecture
+	var includePkgs []string
+	for _, pkg := range comprtIncludes {
+		if strings.Contains(pkg, "=") || isArchQualifiedPkg(pkg) {
+			if pinnedPkgs != nil {
+				*pinnedPkgs = append(*pinnedPkgs, pkg)
+			}
+			continue
+		}
+		includePkgs = append(includePkgs, pkg)
+	}
+
+	if includePkgs != nil {
+		*args = append(*args, "--include="+strings.Join(includePkgs, ","))
+	}
+	if passThroughFlags != nil {
+		*args = append(*args, *passThroughFlags...)
+	}
+	*args = append(*args, codeName, target, mirror)
+
+	return nil
+}
+
+// Provide an interactive shell into the comprt. Env vars passed in will be set
+// for the shell, in addition to what su(1) normally sets for a login shell. If a
+// working directory is passed in, the shell will start there instead of the
+// user's home. With a private PID namespace, only the processes started in the
+// session are visible to the shell. Without the host's network namespace, the
+// shell has no network access (aside from loopback for a private network). The
+// bind mounts passed in are mounted into the comprt for the session.
+func runInteractiveChroot(target, loginName string, envVars []string, workDir, pidNamespace, networkNamespace string, binds []bindMount) (errs []error) {
+	exitChroot, errs := Chroot(target, binds...)
+	if errs != nil {
+		errs = append(errs, errs...)
+		return
+	}
+	defer func() {
+		if err := exitChroot(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+
+	bashPath, err := progExecutor.LookPath("bash")
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	suPath, err := progExecutor.LookPath("su")
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	var suArgs []string = []string{"--shell", bashPath, "--login"}
+	if envVars != nil {
+		// su(1) resets the env for a login shell, except for what is whitelisted
+		suArgs = append(suArgs, "--whitelist-environment", strings.Join(envVarNames(envVars), ","))
+	}
+	if workDir != "" {
+		// a login shell always starts in the user's home, so change dirs afterwards
+		suArgs = append(suArgs, "--command", strings.Join([]string{"cd -- ", shellQuote(workDir), " && exec ", bashPath, " --login"}, ""))
+	}
+	suArgs = append(suArgs, loginName)
+
+	bashCmd := exec.Command(suPath, suArgs...)
+	traceCommand(bashCmd)
+	bashCmd.Env = append(os.Environ(), envVars...)
+	bashCmd.Stdin = os.Stdin
+	bashCmd.Stdout = os.Stdout
+	bashCmd.Stderr = os.Stderr
+	if cloneFlags := sessionCloneFlags(pidNamespace, networkNamespace); cloneFlags != 0 {
+		bashCmd.Env = append(bashCmd.Env, networkNsEnvVar+"="+networkNamespace)
+		bashCmd = nsCommand(bashCmd, cloneFlags)
+	}
+	if err := progExecutor.Run(bashCmd); err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	return nil
+}
+
+// A type used to store what createComprt creates a comprt with.
+type createOptions struct {
+	comprtConfigPath string
+	target           string
+	alias            string
+	users            []comprtUser
+	quiet            bool
+	// Left with the mirror the comprt was created from, which can be one of the
+	// sources' fallback mirrors.
+	debootstrapCmdArr *[]string
+	// The foreign architectures are enabled before the pinned packages are
+	// installed.
+	foreignArchs []string
+	pinnedPkgs   []string
+	sources      aptSources
+	netFiles     networkFiles
+	// Only in the comprt while the comprt config file runs.
+	secrets comprtSecrets
+	binds   []bindMount
+	copies  []comprtCopy
+	hooks   *comprtHooks
+	// Skip the stages done by the create being resumed.
+	resume bool
+}
+
+// Create a debian comprt as the options describe. No services are started in the
+// comprt while it is configured.
+func createComprt(opts createOptions) (errs []error) {
+	var debootstrapPath string
+	if !fakeBootstrap {
+		path, err := progExecutor.LookPath("debootstrap")
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		debootstrapPath = path
+	}
+
+	// the stages done by the create being resumed are skipped
+	if !opts.resume {
+		if err := clearStages(opts.target); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	}
+
+	var bootstrapped bool = stageDone(opts.target, bootstrapDoneStage)
+	if !bootstrapped {
+		if err := opts.hooks.run(preBootstrapHook); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	}
+
+	// the comprt config file is copied in again when resuming, it may have been
+	// changed since
+	chrootComprtConfigPath, err := copyComprtConfig(opts.comprtConfigPath, opts.target)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	defer createPhases.stop()
+	if !bootstrapped {
+		if fakeBootstrap {
+			if err := layDownSkeletonRootfs(opts.target); err != nil {
+				errs = append(errs, err)
+				return
+			}
+		} else {
+			fullDebootstrapCmdArr := eatmydataCmdArr(append(append([]string{debootstrapPath}, bootstrapVerbosityArgs()...), *opts.debootstrapCmdArr...))
+			if err := runDebootstrap(fullDebootstrapCmdArr, opts.sources.fallbackMirrors, opts.quiet); err != nil {
+				errs = append(errs, err)
+				return
+			}
+			// the mirror may have been fallen back on
+			opts.sources.mirror = fullDebootstrapCmdArr[len(fullDebootstrapCmdArr)-1]
+			(*opts.debootstrapCmdArr)[len(*opts.debootstrapCmdArr)-1] = opts.sources.mirror
+		}
+		createPhases.stop()
+
+		if err := opts.sources.write(opts.target); err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		for _, comprtCp := range opts.copies {
+			if err := comprtCp.copyInto(opts.target); err != nil {
+				errs = append(errs, err)
+				return
+			}
+		}
+
+		if err := opts.hooks.run(postBootstrapHook); err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if err := markStageDone(opts.target, bootstrapDoneStage); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	} else if !opts.quiet {
+		infof("resuming %v, the bootstrap is done", opts.target)
+	}
+
+	if err := opts.hooks.run(preConfigHook); err != nil {
+		errs = append(errs, err)
+		return
+	}
+	// deferred before exiting the chroot is, so the hooks run on the host
+	defer func() {
+		if errs == nil {
+			if err := opts.hooks.run(postConfigHook); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}()
+
+	removeNetFiles, err := opts.netFiles.install(opts.target)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+	// deferred before exiting the chroot is, so the files are removed from the host
+	defer func() {
+		if err := removeNetFiles(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+
+	exitChroot, errs := Chroot(opts.target, opts.binds...)
+	if errs != nil {
+		errs = append(errs, errs...)
+		return
+	}
+	defer func() {
+		if err := exitChroot(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+
+	restoreServiceStarts, err := suppressServiceStarts(opts.quiet)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+	defer func() {
+		if err := restoreServiceStarts(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+
+	// chrooted, the comprt's stages are marked from its root
+	if !stageDone(progExecutor.Root(), configDoneStage) {
+		if err := addForeignArchs(opts.foreignArchs, opts.quiet); err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		createPhases.start(aptUpdatePhase)
+		if err := updateAptLists(opts.quiet); err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		if len(opts.pinnedPkgs) > 0 {
+			createPhases.start(pinnedPkgsPhase)
+		}
+		if err := installPinnedPkgs(opts.pinnedPkgs, opts.quiet); err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		createPhases.start(comprtConfigPhase)
+		if err := opts.secrets.exposeWhile(progExecutor.Root(), func() error {
+			return runComprtConfig(chrootComprtConfigPath, opts.quiet)
+		}); err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if err := markStageDone(progExecutor.Root(), configDoneStage); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	}
+
+	if !stageDone(progExecutor.Root(), userDoneStage) {
+		createPhases.start(userCreationPhase)
+		for _, setupCmdArr := range usersSetupCmdArrs(opts.users, opts.alias) {
+			setupCmd := exec.Command(setupCmdArr[0], setupCmdArr[1:]...)
+			traceCommand(setupCmd)
+			setupCmd.Stdout, setupCmd.Stderr = buildLogOutput(opts.quiet)
+			if err := progExecutor.Run(setupCmd); err != nil {
+				errs = append(errs, err)
+				return
+			}
+		}
+		if err := markStageDone(progExecutor.Root(), userDoneStage); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	}
+
+	return nil
+}
+
+// Install the packages at their pinned versions (e.g. git=1:2.30.2-1). Expected
+// to be called while chrooted into the comprt.
+func installPinnedPkgs(pinnedPkgs []string, quiet bool) error {
+	if len(pinnedPkgs) == 0 {
+		return nil
+	}
+
+	aptGetPath, err := progExecutor.LookPath("apt-get")
+	if err != nil {
+		return err
+	}
+
+	aptGetCmdArr := eatmydataCmdArr(append(append([]string{aptGetPath}, pinnedPkgsAptGetArgs()...), pinnedPkgs...))
+	aptGetCmd := exec.Command(aptGetCmdArr[0], aptGetCmdArr[1:]...)
+	traceCommand(aptGetCmd)
+	aptGetCmd.Env = append(os.Environ(), aptNonInteractiveEnv...)
+	aptGetCmd.Stdout, aptGetCmd.Stderr = buildLogOutput(quiet)
+
+	return progExecutor.Run(aptGetCmd)
+}
+
+// Get the apt-get args used to install pinned packages, the pinned packages are
+// to be appended. A pinned version may be older than what debootstrap installed
+// as a dependency.
+func pinnedPkgsAptGetArgs() []string {
+	return []string{"install", "--yes", "--allow-downgrades", "--no-install-recommends"}
+}
+
+// Copy the comprt config file (or dir of config scripts) into the comprt,
+// replacing any comprt config previously copied in. Returns the path of the
+// comprt config inside of the comprt, which is empty if there is no comprt
+// config to copy (e.g. an alias with only host-side scripts).
+func copyComprtConfig(comprtConfigPath, target string) (string, error) {
+	for _, previousConfig := range []string{comprtConfigFile, comprtConfigDir} {
+		if err := os.RemoveAll(filepath.Join(target, previousConfig)); err != nil {
+			return "", err
+		}
+	}
+	if _, err := os.Stat(comprtConfigPath); errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+
+	var comprtCp comprtCopy = comprtCopy{Src: comprtConfigPath, Dest: comprtConfigDest(comprtConfigPath)}
+	if err := comprtCp.copyInto(target); err != nil {
+		return "", err
+	}
+
+	return comprtCp.Dest, nil
+}
+
+// Get the path the comprt config file (or dir of config scripts) is copied to
+// in the comprt.
+func comprtConfigDest(comprtConfigPath string) string {
+	if fileInfo, err := os.Stat(comprtConfigPath); err == nil && fileInfo.IsDir() {
+		return filepath.Join("/", comprtConfigDir)
+	}
+
+	return filepath.Join("/", comprtConfigFile)
+}
+
+// Run the comprt config copied into the comprt. A comprt config dir has every
+// executable in it ran in lexical order (e.g. 01-base.sh, 20-users.sh). There is
+// nothing to run without a comprt config path. Expected to be called while
+// chrooted into the comprt.
+func runComprtConfig(comprtConfigPath string, quiet bool) error {
+	if comprtConfigPath == "" {
+		return nil
+	}
+
+	fileInfo, err := os.Stat(filepath.Join(progExecutor.Root(), comprtConfigPath))
+	if err != nil {
+		return err
+	}
+
+	var comprtConfigCmds []*exec.Cmd
+	if fileInfo.IsDir() {
+		entries, err := os.ReadDir(filepath.Join(progExecutor.Root(), comprtConfigPath))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			entryInfo, err := entry.Info()
+			if err != nil {
+				return err
+			} else if !entryInfo.Mode().IsRegular() || entryInfo.Mode().Perm()&(OS_USER_X|OS_GROUP_X|OS_OTH_X) == 0 {
+				continue
+			}
+			comprtConfigCmds = append(comprtConfigCmds, exec.Command(filepath.Join(comprtConfigPath, entry.Name())))
+		}
+	} else {
+		shPath, err := progExecutor.LookPath("sh")
+		if err != nil {
+			return err
+		}
+		comprtConfigCmds = append(comprtConfigCmds, exec.Command(shPath, comprtConfigPath))
+	}
+
+	for _, comprtConfigCmd := range comprtConfigCmds {
+		comprtConfigCmd.Env = append(os.Environ(), comprtConfigEnv()...)
+		traceCommand(comprtConfigCmd)
+		comprtConfigCmd.Stdout, comprtConfigCmd.Stderr = buildLogOutput(quiet)
+		if err := progExecutor.Run(comprtConfigCmd); err != nil {
+			return fmt.Errorf("%v failed: %w", comprtConfigCmd.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// Re-run a (possibly updated) comprt config file on an existing comprt, without
+// bootstrapping the comprt again. Only the config lifecycle hooks are ran. The
+// bind mounts passed in (e.g. the comprt's caches) are mounted while the comprt
+// config file runs, as are the secrets. No services are started in the comprt
+// while the comprt config file runs.
+func provisionComprt(comprtConfigPath, target string, quiet bool, binds []bindMount, secrets comprtSecrets, hooks *comprtHooks) (errs []error) {
+	chrootComprtConfigPath, err := copyComprtConfig(comprtConfigPath, target)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	if err := hooks.run(preConfigHook); err != nil {
+		errs = append(errs, err)
+		return
+	}
+	// deferred before exiting the chroot is, so the hooks run on the host
+	defer func() {
+		if errs == nil {
+			if err := hooks.run(postConfigHook); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}()
+
+	exitChroot, errs := Chroot(target, binds...)
+	if errs != nil {
+		return
+	}
+	defer func() {
+		if err := exitChroot(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+
+	restoreServiceStarts, err := suppressServiceStarts(quiet)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+	defer func() {
+		if err := restoreServiceStarts(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+
+	if err := secrets.exposeWhile(progExecutor.Root(), func() error {
+		return runComprtConfig(chrootComprtConfigPath, quiet)
+	}); err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	return nil
+}
+
+// Start the main program execution.
+func main() {
+	// the errors logged (e.g. by log.Panic) stand out from the output around them
+	log.SetOutput(colorWriter{w: os.Stderr, color: errorColor})
+	if len(os.Args) > 1 && os.Args[1] == reaperCmdName {
+		os.Exit(runReaper(os.Args[2:]))
+	}
+	if len(os.Args) > 2 && os.Args[1] == bootInitCmdName {
+		log.Panic(runBootInit(os.Args[2]))
+	}
+
+	pconfs := &progConfigs{ // sets defaults
+		comprtConfigPath:   filepath.Join(".", comprtConfigFile),
+		comprtIncludesPath: filepath.Join(".", comprtIncludeFile),
+	}
+
+	// the data dir is needed while the args are parsed (e.g. for the user's mirror mappings)
+	user, err := user.Current()
+	if err != nil {
+		log.Panic(err)
+	}
+	if user.Uid != strconv.Itoa(rootUid) {
+		if progDataDir, err = userProgDataDir(); err != nil {
+			log.Panic(err)
+		}
+	}
+	// parsing the args changes them (e.g. --alias-envvar's values are taken out)
+	var args []string = append([]string{}, os.Args[1:]...)
+	pconfs.parseCmdArgs()
+
+	// the doctor reports on the lack of privileges itself, as does each create ran by
+	// apply, gc only needs access to the data dir of the user
+	if user.Uid != strconv.Itoa(rootUid) && !pconfs.rootless && !stringInArr(pconfs.command, &[]string{"apply", "codenames", "doctor", "gc", genManCmdName, "info"}) {
+		log.Panic(strings.Join([]string{progname, ": must be ran as root (or use --rootless)!"}, ""))
+	}
+
+	if pconfs.target != "" && !pconfs.unsafeTarget {
+		mounts, err := readMountInfo(procSelfMountInfo)
+		if err != nil {
+			log.Panic(err)
+		}
+		if err := checkTargetSafety(pconfs.target, pconfs.minTargetDepth, mounts, stringInArr(pconfs.command, &zfsDatasetCommands)); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	// a target is a comprt once its metadata is written, which is the last thing a
+	// create does (an interrupted create is not a comprt yet, see --resume)
+	if pconfs.command == "create" && !pconfs.resume && os.Getenv(mountNsEnvVar) != privateNamespace {
+		metadata, err := readComprtMetadata(pconfs.target)
+		if err != nil {
+			log.Panic(err)
+		}
+		if metadata != nil {
+			switch {
+			case pconfs.skipExisting:
+				if !pconfs.quiet {
+					fmt.Printf("%s: %v is already a comprt, skipping it\n", progname, pconfs.target)
+				}
+				os.Exit(0)
+			case pconfs.force:
+				mounts, err := readMountInfo(procSelfMountInfo)
+				if err != nil {
+					log.Panic(err)
+				}
+				if err := emptyComprt(pconfs.target, mounts); err != nil {
+					log.Panic(err)
+				}
+			default:
+				log.Panic(fmt.Errorf("%v is already a comprt (see --force or --skip-existing)", pconfs.target))
+			}
+		}
+	}
+
+	// a re-executed debcomprt is audited by the debcomprt that re-executed it
+	var audited bool = stringInArr(pconfs.command, &auditedCommands) && os.Getenv(mountNsEnvVar) != privateNamespace
+	if audited {
+		defer func() {
+			if r := recover(); r != nil {
+				auditOperation(pconfs, user, args, fmt.Errorf("%v", r))
+				panic(r)
+			}
+		}()
+	}
+
+	// a failed create is rolled back by the debcomprt that re-executed it, a
+	// resumed create is kept as it likely has stages worth resuming again
+	var rollback bool = pconfs.command == "create" && pconfs.rmOnFailure && !pconfs.resume && os.Getenv(mountNsEnvVar) != privateNamespace
+	var madeTarget, emptyTarget bool
+	if rollback {
+		entries, err := os.ReadDir(pconfs.target)
+		madeTarget, emptyTarget = errors.Is(err, fs.ErrNotExist), err == nil && len(entries) == 0
+	}
+	rollbackCreate := func() {
+		if !madeTarget && !emptyTarget {
+			warnf("not removing the failed create of %v, it was not empty before the create", pconfs.target)
+			return
+		}
+		mounts, err := readMountInfo(procSelfMountInfo)
+		if err == nil {
+			err = rollbackComprt(pconfs.target, madeTarget, mounts)
+		}
+		if err != nil {
+			warnf("unable to remove the failed create of %v: %v", pconfs.target, err)
+		} else if !pconfs.quiet {
+			fmt.Fprintf(os.Stderr, "%s: removed the failed create of %v (see --rm-on-failure)\n", progname, pconfs.target)
+		}
+	}
+	if rollback {
+		defer func() {
+			if r := recover(); r != nil {
+				rollbackCreate()
+				panic(r)
+			}
+		}()
+	}
+
+	// the target is only made once it is known to be safe to use
+	if pconfs.command == "create" && pconfs.parents {
+		if err := os.MkdirAll(pconfs.target, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	// whether the mounted caches were warm is audited before they are used
+	if audited && stringInArr(pconfs.command, &[]string{"chroot", "create", "provision"}) {
+		var caches []cacheMount = pconfs.caches
+		if pconfs.command != "create" {
+			if entry, err := lookupComprt(pconfs.target); err == nil && entry != nil {
+				caches = entry.Caches
+			}
+		}
+		pconfs.cacheHits, pconfs.cacheMisses = cacheUsage(caches)
+	}
+
+	// mmdebstrap takes care of the namespaces for a rootless comprt
+	if stringInArr(pconfs.command, &[]string{"chroot", "create", "provision", "register-sbuild", "upgrade"}) && !pconfs.rootless &&
+		os.Getenv(mountNsEnvVar) != privateNamespace {
+		// the password is handed down, otherwise it would be read in again
+		var cryptPassword *string
+		if pconfs.command == "create" {
+			cryptPassword = &pconfs.cryptPassword
+		}
+		exitCode := reexecInMountNamespace(cryptPassword)
+		if exitCode != 0 && rollback {
+			rollbackCreate()
+		}
+		if exitCode != 0 {
+			auditOperation(pconfs, user, args, fmt.Errorf("exited with status %v", exitCode))
+		} else {
+			auditOperation(pconfs, user, args, nil)
+		}
+		os.Exit(exitCode)
+	}
+
+	switch pconfs.command {
+	case "chroot":
+		// DISCUSS(cavcrosby): chrooting allows for the filesystem to be virtualized in that, the running
+		// process will believe it is running in its own private filesystem. The process tree is
+		// virtualized as well by running the session in a new PID namespace (see runReaper).
+		//
+		// To add, systemd processes cannot be controlled in a chroot, the boot command
+		// (see bootComprt) should be used instead if this feat is desired. For reference:
+		// https://superuser.com/questions/688733/start-a-systemd-service-inside-chroot-from-a-non-systemd-based-rootfs
+
+		loginName, err := comprtLoginName(pconfs.target)
+		if err != nil {
+			log.Panic(err)
+		}
+		cacheBinds, err := comprtCacheBindMounts(pconfs.target)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		var chrootTarget string = pconfs.target
+		var unMountOverlay func() error
+		if pconfs.ephemeral {
+			overlayPath, f, err := mountEphemeralOverlay(pconfs.target)
+			if err != nil {
+				log.Panic(err)
+			}
+			chrootTarget, unMountOverlay = overlayPath, f
+		}
+
+		errs := runInteractiveChroot(
+			chrootTarget,
+			loginName,
+			pconfs.envVars,
+			pconfs.workDir,
+			pconfs.pidNamespace,
+			pconfs.networkNamespace,
+			append(cacheBinds, pconfs.binds...),
+		)
+		if unMountOverlay != nil {
+			if err := unMountOverlay(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if errs != nil {
+			log.Panic(errs)
+		}
+	case "create":
+		logFile, err := openBuildLog(pconfs.target, pconfs.resume)
+		if err != nil {
+			log.Panic(err)
+		}
+		buildLog = logFile
+		defer func() {
+			// the error goes into the log too, for whoever looks into the failure
+			if r := recover(); r != nil {
+				fmt.Fprintf(buildLog, "%s: %v\n", progname, r)
+				buildLog.Close()
+				fmt.Fprintf(os.Stderr, "%s: the output of the create is logged to %v\n", progname, buildLog.Name())
+				panic(r)
+			}
+			buildLog.Close()
+		}()
+		if !pconfs.quiet {
+			createPhases.headers = append(createPhases.headers, os.Stdout)
+		}
+		createPhases.headers = append(createPhases.headers, buildLog)
+		if !pconfs.skipPreflight {
+			if errs := preflightCreate(pconfs); errs != nil {
+				for _, err := range errs {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", progname, colorize(os.Stderr, errorColor, err.Error()))
+					fmt.Fprintf(buildLog, "%s: %v\n", progname, err)
+				}
+				if rollback {
+					rollbackCreate()
+				}
+				os.Exit(1)
+			}
+		}
 
-	return false
-}
+		// a deferred removal would be skipped by the os.Exit once the create is
+		// done, so the temp dirs are removed explicitly there and here on a failure
+		defer func() {
+			if r := recover(); r != nil {
+				for _, dir := range []string{pconfs.preprocessedAliasDir, pconfs.aliasCopyDir, pconfs.aptRepoKeysDir, pconfs.cloudInitSeedDir, pconfs.rootlessMetadataDir} {
+					if dir != "" {
+						os.RemoveAll(dir)
+					}
+				}
+				panic(r)
+			}
+		}()
 
-// Look to see if a string from the strArgs is in the string array.
-func stringsInArr(strArgs []string, arr *[]string) bool {
-	for _, val := range strArgs {
-		if stringInArr(val, arr) {
-			return true
+		if err := getProgData(pconfs.alias, pconfs.preprocessAliases, pconfs); err != nil {
+			log.Panic(err)
 		}
-	}
-
-	return false
-}
-
-// Look in a file that has some form of standardized file format
-// (e.g. /etc/passwd, /etc/os-release) and locate a 'field' among
-// the rows based on a regex for another field. Fields are a sequence
-// of characters separated by a field separator (or a character). Field
-// indexes start at 0.
-func locateField(fPath string, fieldSepRegex *regexp.Regexp, matchIndex, returnIndex int, matchRegex *regexp.Regexp) (string, error) {
-	file, err := os.Open(fPath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
 
-	var allFields int = -1
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		fields := fieldSepRegex.Split(scanner.Text(), allFields)
-		if len(fields) <= matchIndex {
-			continue
-		} else if matchRegex.FindStringIndex(fields[matchIndex]) != nil {
-			return fields[returnIndex], nil
+		if len(pconfs.sources.repos) > 0 {
+			aptRepoKeysDir, err := makeTempDir("", progname)
+			if err != nil {
+				log.Panic(err)
+			}
+			pconfs.aptRepoKeysDir = aptRepoKeysDir
+			if pconfs.sources.repos, err = fetchAptRepoKeys(pconfs.sources.repos, aptRepoKeysDir); err != nil {
+				log.Panic(err)
+			}
 		}
-	}
-
-	return "", nil
-}
 
-// Get required extra data to be used by the program.
-func getProgData(alias string, preprocessAliases bool, pconfs *progConfigs) error {
-	comprtConfigsRepoPath := filepath.Join(progDataDir, comprtConfigsRepoName)
+		var metadata comprtMetadata = comprtMetadata{
+			CodeName: pconfs.codeName,
+			Arch:     comprtArch(pconfs.passThroughFlags),
+			Alias:    pconfs.alias,
+			Mirror:   pconfs.mirror,
+			Created:  time.Now().UTC(),
+			Version:  progVersion,
+		}
+		if pconfs.alias == noAlias {
+			metadata.User = pconfs.user.name
+		}
 
-	if alias != noAlias {
-		if _, err := os.Stat(progDataDir); errors.Is(err, fs.ErrNotExist) {
-			os.MkdirAll(progDataDir, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X))
-		} else if err != nil {
-			return err
+		// the entry is replaced once the comprt is created, see the cleanup command
+		if err := registerComprt(registryEntry{
+			Target:     pconfs.target,
+			CodeName:   pconfs.codeName,
+			Arch:       metadata.Arch,
+			Mirror:     pconfs.mirror,
+			Alias:      pconfs.alias,
+			Created:    metadata.Created,
+			Labels:     pconfs.labels,
+			Incomplete: true,
+			Version:    progVersion,
+		}); err != nil {
+			log.Panic(err)
 		}
 
-		if _, err := os.Stat(comprtConfigsRepoPath); errors.Is(err, fs.ErrNotExist) {
-			if _, err := git.PlainClone(comprtConfigsRepoPath, false, &git.CloneOptions{
-				URL: comprtConfigsRepoUrl,
-			}); err != nil {
-				return err
-			}
-		} else {
-			var pullOpts git.PullOptions = git.PullOptions{RemoteName: "origin"}
-			comprtRepo, err := git.PlainOpen(comprtConfigsRepoPath)
+		// the comprt is built in buildTarget, which is only different with --build-in
+		var buildTarget string = pconfs.target
+		var unMountBuildDir func() error
+		if pconfs.buildInTmpfs {
+			buildDir, f, err := mountTmpfsBuildDir(pconfs.tmpfsSize)
 			if err != nil {
-				return err
+				log.Panic(err)
 			}
+			buildTarget, unMountBuildDir = buildDir, f
+		}
 
-			gitWorkingDir, err := comprtRepo.Worktree()
+		var debootstrapCmdArr, pinnedPkgs []string
+		createDebootstrapArgList(
+			&debootstrapCmdArr,
+			&pinnedPkgs,
+			&pconfs.passThroughFlags,
+			pconfs.comprtIncludesPath,
+			pconfs.codeName,
+			buildTarget,
+			pconfs.mirror,
+		)
+		if pconfs.sysroot {
+			pinnedPkgs = append(pinnedPkgs, takeSysrootDevPkgs(&debootstrapCmdArr, &pinnedPkgs, pconfs.arch)...)
+		}
+		if pconfs.lock != nil {
+			pinnedPkgs = append(pinnedPkgs, pconfs.lock.pinnedPkgs()...)
+		}
+		pinnedPkgs = append(pinnedPkgs, pconfs.bootablePkgs...)
+		if len(pconfs.playbooks) > 0 {
+			pinnedPkgs = append(pinnedPkgs, ansiblePythonPkg)
+		}
+		if pconfs.cloudInit != nil {
+			// the seed can hold credentials (e.g. in its user-data), it is removed
+			// along with the other temp dirs once the create is done or has failed
+			seedDir, err := makeTempDir("", progname)
 			if err != nil {
-				return err
+				log.Panic(err)
 			}
-			gitWorkingDir.Pull(&pullOpts)
+			pconfs.cloudInitSeedDir = seedDir
+			seedCopies, err := pconfs.cloudInit.copies(pconfs.target, seedDir)
+			if err != nil {
+				log.Panic(err)
+			}
+			pconfs.copies = append(pconfs.copies, seedCopies...)
+			pinnedPkgs = append(pinnedPkgs, cloudInitPkg)
+		}
+		hooks, err := newComprtHooks(pconfs.comprtConfigPath, pconfs.hooks, buildTarget, pconfs.codeName, pconfs.quiet)
+		if err != nil {
+			log.Panic(err)
 		}
+		hooks.playbooks = pconfs.playbooks
 
-		if preprocessAliases {
-			makePath, err := exec.LookPath("make")
+		if pconfs.rootless {
+			// the comprt is not writable afterwards, so the metadata is copied in
+			metadataDir, err := makeTempDir("", progname)
 			if err != nil {
 				log.Panic(err)
 			}
-
-			makeCmd := exec.Command(makePath, "PREPROCESS_ALIASES=1", alias)
-			makeCmd.Dir = comprtConfigsRepoPath
-			if _, err := makeCmd.Output(); err != nil {
+			pconfs.rootlessMetadataDir = metadataDir
+			if err := writeComprtMetadata(metadataDir, metadata); err != nil {
 				log.Panic(err)
 			}
+			pconfs.copies = append(pconfs.copies, comprtCopy{
+				Src:  filepath.Join(metadataDir, comprtMetadataPath),
+				Dest: comprtMetadataPath,
+			})
+
+			if errs := createRootlessComprt(
+				pconfs.comprtConfigPath,
+				pconfs.alias,
+				pconfs.users,
+				pconfs.quiet,
+				&debootstrapCmdArr,
+				pconfs.foreignArchs,
+				pinnedPkgs,
+				pconfs.sources,
+				pconfs.netFiles,
+				pconfs.secrets,
+				pconfs.binds,
+				pconfs.copies,
+				hooks,
+			); errs != nil {
+				log.Panic(errs)
+			}
+		} else if errs := createComprt(createOptions{
+			comprtConfigPath:  pconfs.comprtConfigPath,
+			target:            buildTarget,
+			alias:             pconfs.alias,
+			users:             pconfs.users,
+			quiet:             pconfs.quiet,
+			debootstrapCmdArr: &debootstrapCmdArr,
+			foreignArchs:      pconfs.foreignArchs,
+			pinnedPkgs:        pinnedPkgs,
+			sources:           pconfs.sources,
+			netFiles:          pconfs.netFiles,
+			secrets:           pconfs.secrets,
+			binds:             pconfs.binds,
+			copies:            pconfs.copies,
+			hooks:             hooks,
+			resume:            pconfs.resume,
+		}); errs != nil {
+			if unMountBuildDir != nil {
+				if err := unMountBuildDir(); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			log.Panic(errs)
 		}
 
-		pconfs.comprtConfigPath = filepath.Join(comprtConfigsRepoPath, alias, comprtConfigFile)
-		pconfs.comprtIncludesPath = filepath.Join(comprtConfigsRepoPath, alias, comprtIncludeFile)
-	}
-
-	return nil
-}
-
-// Read in the comprt includes file and adds the discovered packages into
-// includePkgs.
-func getComprtIncludes(includePkgs *[]string, comprtIncludesPath string) error {
-	// inspired by:
-	// https://stackoverflow.com/questions/8757389/reading-a-file-line-by-line-in-go/16615559#16615559
-	file, err := os.Open(comprtIncludesPath)
-	if err != nil {
-		// the comprt includes is optional
-		return nil
-	}
-	defer file.Close()
+		if pconfs.bootable {
+			createPhases.start(initramfsPhase)
+			if errs := generateInitramfs(buildTarget, pconfs.quiet); errs != nil {
+				if unMountBuildDir != nil {
+					if err := unMountBuildDir(); err != nil {
+						errs = append(errs, err)
+					}
+				}
+				log.Panic(errs)
+			}
+			createPhases.stop()
+		}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		*includePkgs = append(*includePkgs, scanner.Text())
-	}
+		if pconfs.minimize {
+			createPhases.start(minimizePhase)
+			freed, err := minimizeComprt(buildTarget, pconfs.minimizePolicy)
+			if err != nil {
+				if unMountBuildDir != nil {
+					unMountBuildDir()
+				}
+				log.Panic(err)
+			}
+			createPhases.stop()
+			if !pconfs.quiet {
+				fmt.Printf("%s: minimized %v, %v freed\n", progname, pconfs.target, formatMiB(freed))
+			}
+		}
 
-	if err := scanner.Err(); err != nil {
-		return err
-	}
+		if unMountBuildDir != nil {
+			createPhases.start(syncBuildDirPhase)
+			if err := syncBuildDir(buildTarget, pconfs.target, pconfs.quiet); err != nil {
+				unMountBuildDir()
+				log.Panic(err)
+			}
+			createPhases.stop()
+			if err := unMountBuildDir(); err != nil {
+				log.Panic(err)
+			}
+		}
 
-	return nil
-}
+		var sysrootFiles []string
+		if pconfs.sysroot {
+			createPhases.start(sysrootPhase)
+			if _, err := relativizeSymlinks(pconfs.target); err != nil {
+				log.Panic(err)
+			}
+			sa, err := getSysrootArch(pconfs.arch)
+			if err != nil {
+				log.Panic(err)
+			}
+			if sysrootFiles, err = writeSysrootFiles(pconfs.target, sa); err != nil {
+				log.Panic(err)
+			}
+			createPhases.stop()
+		}
 
-// Mount filesystems found on devices to their respective location(s) on the
-// target. As if the process had chooted to the target.
-func mountChrootFileSystems(devicesToMount []string, target string) ([]string, error) {
-	var fileSystemsMounted []string
-	for _, filesys := range devicesToMount {
-		mountPoint := filepath.Join(target, filesys)
-		if _, err := os.Stat(mountPoint); errors.Is(err, fs.ErrNotExist) {
-			var fileMode fs.FileMode
-			// filemode for /sys based on current workstation (same for /proc except url) and
-			// https://askubuntu.com/questions/341939/why-cant-i-create-a-directory-in-sys
-			switch filesys {
-			case "/sys":
-				fileMode = os.ModeDir | (OS_USER_R | OS_USER_X | OS_GROUP_R | OS_GROUP_X | OS_OTH_R | OS_OTH_X)
-			case "/proc":
-				fileMode = os.ModeDir | (OS_USER_R | OS_USER_X | OS_GROUP_R | OS_GROUP_X | OS_OTH_R | OS_OTH_X)
-			case "/dev":
-				fileMode = os.ModeDir | (OS_USER_R | OS_USER_W | OS_USER_X | OS_GROUP_R | OS_GROUP_X | OS_OTH_R | OS_OTH_X)
-			case "/dev/pts":
-				fileMode = os.ModeDir | (OS_USER_R | OS_USER_W | OS_USER_X | OS_GROUP_R | OS_GROUP_X | OS_OTH_R | OS_OTH_X)
-			default:
-				fileMode = os.ModeDir | (OS_USER_R | OS_USER_W | OS_USER_X | OS_GROUP_R | OS_GROUP_X | OS_OTH_R | OS_OTH_X)
+		for _, aliasDir := range []string{pconfs.preprocessedAliasDir, pconfs.aliasCopyDir} {
+			if aliasDir == "" {
+				continue
 			}
-			if err := os.Mkdir(
-				mountPoint,
-				fileMode,
-			); err != nil {
-				return fileSystemsMounted, err
+			if err := os.RemoveAll(aliasDir); err != nil {
+				log.Panic(err)
 			}
 		}
-		if err := syscall.Mount(filesys, filepath.Join(target, filesys), "", syscall.MS_BIND, ""); err != nil {
-			return fileSystemsMounted, err
+		for _, dir := range []string{pconfs.aptRepoKeysDir, pconfs.cloudInitSeedDir, pconfs.rootlessMetadataDir} {
+			if dir == "" {
+				continue
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				log.Panic(err)
+			}
 		}
-		fileSystemsMounted = append(fileSystemsMounted, filesys)
-	}
-	return fileSystemsMounted, nil
-}
 
-// Unmount filesystems found on devices starting in the tree hierarchy of the target.
-func unMountChrootFileSystems(devicesToMount []string, target string) error {
-	// Unfortunately unmounting filesystems is not as simple when working in code.
-	// It seems retrying to unmount the same filesystem previously attempted works
-	// after a short sleep. Ordering of the filesystems matter, for reference:
-	// https://unix.stackexchange.com/questions/61885/how-to-unmount-a-formerly-chrootd-filesystem#answer-234901
-	//
-	// MONITOR(cavcrosby): the syscall package is deprecated. At the time of writing, the replacement
-	// package for Unix systems is still not at a stable version. So this will need to
-	// be revisited at some point. Also for reference: golang.org/x/sys
-	reverse(&devicesToMount)
-	var fileSystemsUnmountBacklog []string = []string{}
-	for _, filesys := range devicesToMount {
-		var retries int
-		for {
-			// DISCUSS(cavcrosby): would using golang's logging package be beneficial? Its
-			// either that, or just using the schmorgesborg of io utilities.
-			//
-			// Even with --quiet implemented, in some cases like the below, output should
-			// still go to where an operator will see it.
-			err := syscall.Unmount(filepath.Join(target, filesys), 0x0)
-			if err == nil {
-				break
-			} else if retries == 1 {
-				// inspired by:
-				// https://stackoverflow.com/questions/35615839/how-to-merge-multiple-strings-and-int-into-a-single-string#answer-35624701
-				fmt.Println(strings.Join([]string{progname, ": ", filesys, " does not want to unmount, will try again later"}, ""))
-				fileSystemsUnmountBacklog = append(fileSystemsUnmountBacklog, filesys)
-			} else if errors.Is(err, syscall.EBUSY) {
-				fmt.Println(strings.Join([]string{progname, ": ", filesys, " is busy, trying again"}, ""))
-				retries += 1
-				time.Sleep(1 * time.Second)
-			} else if errors.Is(err, syscall.EINVAL) {
-				fmt.Println(strings.Join([]string{progname, ": ", filesys, " is not a mount point...this may be an issue"}, ""))
-				break
-			} else {
-				fmt.Printf("%s: non-expected error thrown %d", progname, err)
-				return err
+		metadata.Mirror = debootstrapCmdArr[len(debootstrapCmdArr)-1]
+		metadata.Phases = createPhases.phases()
+		if !pconfs.quiet {
+			fmt.Printf("%s: created %v in:\n", progname, pconfs.target)
+			if err := writePhaseSummary(os.Stdout, metadata.Phases); err != nil {
+				log.Panic(err)
 			}
-
 		}
-	}
-
-	// in the rare event that a filesystem is being stubborn to unmount
-	for _, filesys := range fileSystemsUnmountBacklog {
-		var retries int
-		for {
-			err := syscall.Unmount(filepath.Join(target, filesys), 0x0)
-			if err == nil {
-				break
-			} else if retries == 1 {
-				fmt.Println(strings.Join([]string{progname, ": ", filesys, " does not want to unmount...AGAIN"}, ""))
-				return fmt.Errorf("%s: unable to unmount %v", progname, filesys)
-			} else if errors.Is(err, syscall.EBUSY) {
-				fmt.Println(strings.Join([]string{progname, ": ", filesys, " is busy...AGAIN, trying again"}, ""))
-				retries += 1
-				time.Sleep(2 * time.Second)
-			} else if errors.Is(err, syscall.EINVAL) {
-				fmt.Println(strings.Join([]string{progname, ": ", filesys, " is not a mount point...this may be an issue"}, ""))
-				break
-			} else {
-				fmt.Printf("%s: non-expected error thrown %d", progname, err)
-				return err
+		if len(sysrootFiles) > 0 && !pconfs.quiet {
+			fmt.Printf("%s: cross compile against %v with:\n", progname, pconfs.target)
+			for _, path := range sysrootFiles {
+				fmt.Printf("  %v\n", path)
+			}
+		}
+		if !pconfs.rootless {
+			if err := clearStages(pconfs.target); err != nil {
+				log.Panic(err)
+			}
+			if pconfs.alias != noAlias {
+				// the alias creates the user it logs in as with the uid passed in
+				if metadata.User, err = comprtUserName(pconfs.target, pconfs.user.uid); err != nil {
+					log.Panic(err)
+				}
+			}
+			if err := writeComprtMetadata(pconfs.target, metadata); err != nil {
+				log.Panic(err)
 			}
 		}
-	}
 
-	return nil
-}
+		var loginName string
+		if pconfs.alias == noAlias {
+			loginName = pconfs.user.name
+		}
+		now := time.Now().UTC()
+		if err := registerComprt(registryEntry{
+			Target:   pconfs.target,
+			CodeName: pconfs.codeName,
+			Arch:     metadata.Arch,
+			Mirror:   metadata.Mirror,
+			Alias:    pconfs.alias,
+			User:     loginName,
+			Created:  metadata.Created,
+			Updated:  now,
+			Labels:   pconfs.labels,
+			Caches:   pconfs.caches,
+			Version:  progVersion,
+		}); err != nil {
+			log.Panic(err)
+		}
 
-// Set the current process's root dir to target. A function to exit out
-// of the chroot will be returned.
-func Chroot(target string) (f func() error, errs []error) {
-	// Returning back to the residing directory before entering the chroot.
-	// For reference:
-	// https://devsidestory.com/exit-from-a-chroot-with-golang/
-	returnDir, err := os.Getwd()
-	if err != nil {
-		return nil, append(errs, err)
-	}
+		if pconfs.lockFilePath != "" {
+			lock, err := newComprtLock(pconfs, debootstrapCmdArr[len(debootstrapCmdArr)-1], now)
+			if err != nil {
+				log.Panic(err)
+			}
+			if err := lock.write(pconfs.lockFilePath); err != nil {
+				log.Panic(err)
+			}
+			if pconfs.signKeyID != "" {
+				if _, err := signFile(pconfs.lockFilePath, pconfs.signKeyID); err != nil {
+					log.Panic(err)
+				}
+			}
+		}
+	case "boot":
+		if err := bootComprt(pconfs.target, pconfs.bootBackend); err != nil {
+			log.Panic(err)
+		}
+	case "snapshot", "restore":
+		mounts, err := readMountInfo(procSelfMountInfo)
+		if err != nil {
+			log.Panic(err)
+		}
+		if err := checkTargetUnmounted(pconfs.target, mounts); err != nil {
+			log.Panic(err)
+		}
 
-	root, err := os.Open("/")
-	if err != nil {
-		return nil, append(errs, err)
-	}
+		comprtSnapshotter, err := getSnapshotter(pconfs.target, pconfs.compression)
+		if err != nil {
+			log.Panic(err)
+		}
 
-	var devicesToMount []string = []string{"/sys", "/proc", "/dev", "/dev/pts"}
-	fileSystemsMounted, err := mountChrootFileSystems(devicesToMount, target)
-	defer func() {
-		if errs != nil {
-			root.Close()
-			if err := unMountChrootFileSystems(fileSystemsMounted, target); err != nil {
-				errs = append(errs, err)
+		if pconfs.command == "snapshot" {
+			if err := comprtSnapshotter.Snapshot(pconfs.target, pconfs.snapshotName); err != nil {
+				log.Panic(err)
 			}
+			break
 		}
-	}()
-	if err != nil {
-		return nil, append(errs, err)
-	}
-
-	if err := syscall.Chroot(target); err != nil {
-		return nil, append(errs, err)
-	}
 
-	if err := syscall.Chdir("/"); err != nil { // makes sh happy, otherwise getcwd() for sh fails
-		return nil, append(errs, err)
-	}
+		if err := comprtSnapshotter.Restore(pconfs.target, pconfs.snapshotName); err != nil {
+			names, _ := comprtSnapshotter.List(pconfs.target)
+			if len(names) > 0 {
+				fmt.Fprintf(os.Stderr, "%s: snapshots available: %v\n", progname, strings.Join(names, ", "))
+			}
+			log.Panic(err)
+		}
 
-	return func() error {
-		if err := root.Chdir(); err != nil {
-			return err
+		if err := touchComprt(pconfs.target); err != nil {
+			log.Panic(err)
+		}
+	case "export":
+		mounts, err := readMountInfo(procSelfMountInfo)
+		if err != nil {
+			log.Panic(err)
+		}
+		if err := checkTargetUnmounted(pconfs.target, mounts); err != nil {
+			log.Panic(err)
 		}
-
-		if err := syscall.Chroot("."); err != nil {
-			return err
+		if err := checkNoSecrets(pconfs.target); err != nil {
+			log.Panic(err)
 		}
 
-		if err := os.Chdir(returnDir); err != nil {
-			return err
+		comprtExporter, err := getExporter(pconfs.exportFormat)
+		if err != nil {
+			log.Panic(err)
 		}
-
-		if err := unMountChrootFileSystems(devicesToMount, target); err != nil {
-			root.Close()
-			return err
+		c, err := getCodec(pconfs.compression)
+		if err != nil {
+			log.Panic(err)
+		}
+		if pconfs.exportDir != "" {
+			if err := os.MkdirAll(pconfs.exportDir, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+				log.Panic(err)
+			}
 		}
 
-		return nil
-	}, nil
-}
-
-// Create the debootstrap arg list to be used elsewhere.
-func createDebootstrapArgList(args *[]string, passThroughFlags *[]string, comprtIncludesPath, codeName, target, mirror string) error {
-	var includePkgs []string
-	if err := getComprtIncludes(&includePkgs, comprtIncludesPath); err != nil {
-		return err
-	}
-
-	if includePkgs != nil {
-		*args = append(*args, "--include="+strings.Join(includePkgs, ","))
-	}
-	if passThroughFlags != nil {
-		*args = append(*args, *passThroughFlags...)
-	}
-	*args = append(*args, codeName, target, mirror)
-
-	return nil
-}
+		exported, err := comprtExporter.Export(pconfs.target, exportOptions{
+			dir:    pconfs.exportDir,
+			codec:  c,
+			engine: pconfs.containerEngine,
+			tags:   pconfs.exportTags,
+			labels: pconfs.labels,
+		})
+		if err != nil {
+			log.Panic(err)
+		}
+		for _, item := range exported {
+			fmt.Println(item)
+			if pconfs.signKeyID != "" {
+				signaturePath, err := signFile(item, pconfs.signKeyID)
+				if err != nil {
+					log.Panic(err)
+				}
+				fmt.Println(signaturePath)
+			}
+		}
 
-// Provide an interactive shell into the comprt.
-func runInteractiveChroot(target string) (errs []error) {
-	var uidRegex *regexp.Regexp = regexp.MustCompile(strconv.Itoa(defaultComprtUid))
-	var loginNameIndex, uidIndex int = 0, 2
-	defaultComprtUsername, err := locateField(
-		filepath.Join(target, "/etc/passwd"),
-		regexp.MustCompile(":"),
-		uidIndex,
-		loginNameIndex,
-		uidRegex,
-	)
-	if err != nil {
-		errs = append(errs, err)
-		return
-	}
+		if pconfs.lxdImport {
+			if err := lxdImportImage(exported, pconfs.lxdAlias); err != nil {
+				log.Panic(err)
+			}
+		}
+	case "clone":
+		if err := cloneComprt(pconfs.srcTarget, pconfs.target); err != nil {
+			log.Panic(err)
+		}
+	case "provision":
+		hooks, err := newComprtHooks(pconfs.comprtConfigPath, pconfs.hooks, pconfs.target, "", pconfs.quiet)
+		if err != nil {
+			log.Panic(err)
+		}
+		hooks.playbooks = pconfs.playbooks
+		if entry, err := lookupComprt(pconfs.target); err != nil {
+			log.Panic(err)
+		} else if entry != nil {
+			hooks.codeName = entry.CodeName
+		}
 
-	exitChroot, errs := Chroot(target)
-	if errs != nil {
-		errs = append(errs, errs...)
-		return
-	}
-	defer func() {
-		if err := exitChroot(); err != nil {
-			errs = append(errs, err)
+		cacheBinds, err := comprtCacheBindMounts(pconfs.target)
+		if err != nil {
+			log.Panic(err)
 		}
-	}()
 
-	bashPath, err := exec.LookPath("bash")
-	if err != nil {
-		errs = append(errs, err)
-		return
-	}
+		if errs := provisionComprt(pconfs.comprtConfigPath, pconfs.target, pconfs.quiet, cacheBinds, pconfs.secrets, hooks); errs != nil {
+			log.Panic(errs)
+		}
 
-	suPath, err := exec.LookPath("su")
-	if err != nil {
-		errs = append(errs, err)
-		return
-	}
+		if err := touchComprt(pconfs.target); err != nil {
+			log.Panic(err)
+		}
+	case "upgrade":
+		oldPkgs, newPkgs, errs := upgradeComprt(pconfs.target, pconfs.quiet)
+		if errs != nil {
+			log.Panic(errs)
+		}
 
-	bashCmd := exec.Command(suPath, "--shell", bashPath, "--login", defaultComprtUsername)
-	bashCmd.Stdin = os.Stdin
-	bashCmd.Stdout = os.Stdout
-	bashCmd.Stderr = os.Stderr
-	if err := bashCmd.Start(); err != nil {
-		errs = append(errs, err)
-		return
-	}
-	if err := bashCmd.Wait(); err != nil {
-		errs = append(errs, err)
-		return
-	}
+		if err := savePackageState(pconfs.target, newPkgs); err != nil {
+			log.Panic(err)
+		}
+		if !pconfs.quiet {
+			for _, change := range diffPackages(oldPkgs, newPkgs) {
+				fmt.Println(change)
+			}
+		}
 
-	return nil
-}
+		if err := touchComprt(pconfs.target); err != nil {
+			log.Panic(err)
+		}
+	case "info":
+		metadata, err := getComprtMetadata(pconfs.target)
+		if err != nil {
+			log.Panic(err)
+		}
 
-// Create a debian comprt.
-func createComprt(comprtConfigPath, target, alias, cryptPassword string, quiet bool, debootstrapCmdArr *[]string) (errs []error) {
-	debootstrapPath, err := exec.LookPath("debootstrap")
-	if err != nil {
-		errs = append(errs, err)
-		return
-	}
+		if err := writeComprtInfo(os.Stdout, pconfs.outputFormat, *metadata); err != nil {
+			log.Panic(err)
+		}
+	case "digest":
+		digest, err := recordComprtDigest(pconfs.target)
+		if err != nil {
+			log.Panic(err)
+		}
 
-	if err := copy(comprtConfigPath, filepath.Join(target, comprtConfigFile)); err != nil {
-		errs = append(errs, err)
-		return
-	}
+		fmt.Printf("%v  %v\n", digest.Root, pconfs.target)
+	case "verify":
+		var checksums []fileChecksum
+		if pconfs.checksumsPath != "" {
+			checksumsFile, err := os.Open(pconfs.checksumsPath)
+			if err != nil {
+				log.Panic(err)
+			}
+			checksums, err = readChecksums(checksumsFile)
+			checksumsFile.Close()
+			if err != nil {
+				log.Panic(fmt.Errorf("%v: %w", pconfs.checksumsPath, err))
+			}
+		}
 
-	// inspired by:
-	// https://stackoverflow.com/questions/39173430/how-to-print-the-realtime-output-of-running-child-process-in-go
-	debootstrapCmd := exec.Command(debootstrapPath, *debootstrapCmdArr...)
-	if !quiet {
-		debootstrapCmd.Stdout = os.Stdout
-		debootstrapCmd.Stderr = os.Stderr
-	}
-	if err := debootstrapCmd.Start(); err != nil {
-		errs = append(errs, err)
-		return
-	}
-	if err := debootstrapCmd.Wait(); err != nil {
-		errs = append(errs, err)
-		return
-	}
+		results, err := verifyComprt(pconfs.target, pconfs.lock, checksums)
+		if err != nil {
+			log.Panic(err)
+		}
 
-	exitChroot, errs := Chroot(target)
-	if errs != nil {
-		errs = append(errs, errs...)
-		return
-	}
-	defer func() {
-		if err := exitChroot(); err != nil {
-			errs = append(errs, err)
+		passed, err := writeDoctorReport(os.Stdout, results)
+		if err != nil {
+			log.Panic(err)
+		} else if !passed {
+			os.Exit(1)
+		}
+	case "du":
+		report, err := comprtSizeReport(pconfs.target, pconfs.duDepth)
+		if err != nil {
+			log.Panic(err)
+		}
+		if err := report.sort(pconfs.sortKey); err != nil {
+			log.Panic(err)
 		}
-	}()
 
-	shPath, err := exec.LookPath("sh")
-	if err != nil {
-		errs = append(errs, err)
-		return
-	}
+		if err := writeSizeReport(os.Stdout, pconfs.outputFormat, report); err != nil {
+			log.Panic(err)
+		}
+	case "inventory":
+		inventory, err := getInventory()
+		if err != nil {
+			log.Panic(err)
+		}
 
-	comprtConfigFileCmd := exec.Command(shPath, filepath.Join("/", comprtConfigFile))
-	if !quiet {
-		comprtConfigFileCmd.Stdout = os.Stdout
-		comprtConfigFileCmd.Stderr = os.Stderr
-	}
-	if err := comprtConfigFileCmd.Start(); err != nil {
-		errs = append(errs, err)
-		return
-	}
-	if err := comprtConfigFileCmd.Wait(); err != nil {
-		errs = append(errs, err)
-		return
-	}
+		if err := writeInventory(os.Stdout, pconfs.outputFormat, inventory); err != nil {
+			log.Panic(err)
+		}
+	case "apply":
+		// the global flags (e.g. --retries) are passed on to each create
+		var globalArgs []string = args
+		for i, arg := range args {
+			if arg == "apply" {
+				globalArgs = args[:i]
+				break
+			}
+		}
 
-	if alias == noAlias {
-		groupAddPath, err := exec.LookPath("groupadd")
+		if err := pconfs.apply.apply("/proc/self/exe", globalArgs, pconfs.parallel, os.Stdout); err != nil {
+			log.Panic(err)
+		}
+	case "delete":
+		mounts, err := readMountInfo(procSelfMountInfo)
 		if err != nil {
-			errs = append(errs, err)
-			return
+			log.Panic(err)
+		}
+		absTarget, err := filepath.Abs(pconfs.target)
+		if err != nil {
+			log.Panic(err)
 		}
 
-		groupAddCmd := exec.Command(
-			groupAddPath,
-			"--gid",
-			strconv.Itoa(defaultComprtUid),
-			defaultComprtUserName,
-		)
-		if !quiet {
-			groupAddCmd.Stdout = os.Stdout
-			groupAddCmd.Stderr = os.Stderr
+		if err := removeComprt(absTarget, mounts); err != nil {
+			log.Panic(err)
 		}
-		if err := groupAddCmd.Start(); err != nil {
-			errs = append(errs, err)
-			return
+		if !pconfs.quiet {
+			fmt.Printf("deleted %v\n", absTarget)
 		}
-		if err := groupAddCmd.Wait(); err != nil {
-			errs = append(errs, err)
-			return
+	case "register-schroot":
+		entry, err := newSchrootEntry(pconfs.target, pconfs.schrootName, pconfs.schrootUsers, pconfs.schrootGroups, pconfs.schrootProfile)
+		if err != nil {
+			log.Panic(err)
 		}
-
-		userAddPath, err := exec.LookPath("useradd")
+		entryPath, err := writeSchrootEntry(schrootChrootDir, *entry, pconfs.force)
 		if err != nil {
-			errs = append(errs, err)
-			return
+			log.Panic(err)
 		}
-
-		// DISCUSS(cavcrosby): it might be fun to reimplement the creation of the default
-		// user and group using the more primitive system calls for Unix/Linux. I would
-		// like to circle around at some point and look into this.
-		userAddCmd := exec.Command(
-			userAddPath,
-			"--create-home",
-			"--home-dir",
-			"/home/debcomprt",
-			"--uid",
-			strconv.Itoa(defaultComprtUid),
-			"--gid",
-			strconv.Itoa(defaultComprtUid),
-			"--shell",
-			"/bin/bash",
-			defaultComprtUserName,
-			"--password",
-			cryptPassword,
-		)
-		if !quiet {
-			userAddCmd.Stdout = os.Stdout
-			userAddCmd.Stderr = os.Stderr
+		fmt.Printf("registered %v as the schroot %v (%v)\n", pconfs.target, entry.name, entryPath)
+	case "register-sbuild":
+		entry, err := newSbuildSchrootEntry(pconfs.target)
+		if err != nil {
+			log.Panic(err)
 		}
-		if err := userAddCmd.Start(); err != nil {
-			errs = append(errs, err)
-			return
+		if errs := prepareSbuildComprt(pconfs.target, pconfs.quiet); errs != nil {
+			log.Panic(errs)
 		}
-		if err := userAddCmd.Wait(); err != nil {
-			errs = append(errs, err)
-			return
+		entryPath, err := writeSchrootEntry(schrootChrootDir, *entry, pconfs.force)
+		if err != nil {
+			log.Panic(err)
+		}
+		if !sbuildGroupExists() {
+			warnf("the %v group does not exist on the host, install sbuild to use the schroot", sbuildGroup)
+		}
+		fmt.Printf("registered %v as the schroot %v (%v)\n", pconfs.target, entry.name, entryPath)
+	case "serve":
+		if err := runDaemon(pconfs.socketPath, pconfs.grpcSocketPath, pconfs.metricsAddress); err != nil {
+			log.Panic(err)
+		}
+	case "codenames":
+		codenameMirrors, err := listCodenameMirrors(debootstrapScriptsDir, pconfs.arch)
+		if err != nil {
+			log.Panic(err)
 		}
-	}
-
-	return nil
-}
-
-// Start the main program execution.
-func main() {
-	pconfs := &progConfigs{ // sets defaults
-		comprtConfigPath:   filepath.Join(".", comprtConfigFile),
-		comprtIncludesPath: filepath.Join(".", comprtIncludeFile),
-	}
-	pconfs.parseCmdArgs()
-
-	user, err := user.Current()
-	if err != nil {
-		log.Panic(err)
-	}
-	if user.Uid != strconv.Itoa(rootUid) {
-		log.Panic(strings.Join([]string{progname, ": must be ran as root!"}, ""))
-	}
-
-	switch pconfs.command {
-	case "chroot":
-		// DISCUSS(cavcrosby): chrooting allows for the filesystem to be virtualized in that, the running
-		// process will believe it is running in its own private filesystem. I would like
-		// to extend this in the future to the process tree as well. That said, some
-		// investigation has already been done to look into this.
-		//
-		// Virtualizing the process tree will require creating processes inside a new
-		// PID namespace and mounting a new instance of /proc from a process inside the
-		// new PID namespace.
-		//
-		// While the above would not be technically to hard to implement, it does come
-		// with caveats. Looking mainly at the PID namespace man page (link below), any new
-		// process created in this PID namespace will be labeled as the 'init' process
-		// for the new namespace. Thus, some form of 'init' software would probably need
-		// to be run vs just using a shell instance. Otherwise, if the shell instance
-		// exited, then all processes in the PID namespace will be killed by the kernel.
-		// https://man7.org/linux/man-pages/man7/pid_namespaces.7.html,
-		//
-		// To add, systemd processes cannot be controlled in a chroot. Thus, more research
-		// would need to be done if this feat would be desired to attempt. For reference:
-		// https://superuser.com/questions/688733/start-a-systemd-service-inside-chroot-from-a-non-systemd-based-rootfs
 
-		if errs := runInteractiveChroot(pconfs.target); errs != nil {
-			log.Panic(errs)
+		if err := writeCodenameMirrors(os.Stdout, codenameMirrors); err != nil {
+			log.Panic(err)
 		}
-	case "create":
-		if err := getProgData(pconfs.alias, pconfs.preprocessAliases, pconfs); err != nil {
+	case "cleanup":
+		if err := cleanupComprts(pconfs.target, pconfs.removeIncomplete, pconfs.quiet); err != nil {
+			log.Panic(err)
+		}
+	case genManCmdName:
+		pagePaths, err := writeManPages(pconfs.cliApp, pconfs.manDir)
+		if err != nil {
+			log.Panic(err)
+		}
+		for _, pagePath := range pagePaths {
+			fmt.Println(pagePath)
+		}
+	case "gc":
+		items, err := findGarbage(pconfs.maxCacheAge, time.Now())
+		if err != nil {
+			log.Panic(err)
+		}
+		if err := collectGarbage(items, pconfs.dryRun, os.Stdout); err != nil {
+			log.Panic(err)
+		}
+	case "doctor":
+		results, err := runDoctor(pconfs.arch, pconfs.offline)
+		if err != nil {
 			log.Panic(err)
 		}
 
-		var debootstrapCmdArr []string
-		createDebootstrapArgList(
-			&debootstrapCmdArr,
-			&pconfs.passThroughFlags,
-			pconfs.comprtIncludesPath,
-			pconfs.codeName,
-			pconfs.target,
-			pconfs.mirror,
-		)
-		if errs := createComprt(
-			pconfs.comprtConfigPath,
-			pconfs.target,
-			pconfs.alias,
-			pconfs.cryptPassword,
-			pconfs.quiet,
-			&debootstrapCmdArr,
-		); errs != nil {
-			log.Panic(errs)
+		passed, err := writeDoctorReport(os.Stdout, results)
+		if err != nil {
+			log.Panic(err)
+		} else if !passed {
+			os.Exit(1)
 		}
 	}
 
+	if audited {
+		auditOperation(pconfs, user, args, nil)
+	}
 	os.Exit(0)
 }
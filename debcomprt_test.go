@@ -253,13 +253,239 @@ func TestGetComprtIncludes(t *testing.T) {
 
 	var includePkgs []string
 	pkgsByteString := []byte(strings.Join(testPkgs, "\n"))
-	getComprtIncludes(&includePkgs, pconfs.comprtIncludesPath)
+	getComprtIncludes(&includePkgs, pconfs.comprtIncludesPath, testCodeCame, hostDebianArch())
 
 	if !bytes.Equal([]byte(strings.Join(includePkgs, "\n")), pkgsByteString) {
 		t.Fatalf("found the following packages \n%s", strings.Join(includePkgs, "\n"))
 	}
 }
 
+func TestGetComprtIncludesSkipsComments(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var comprtIncludesPath string = filepath.Join(tempDirPath, comprtIncludeFile)
+	if err := createTestFile(comprtIncludesPath, "# build tools\nautoconf\n\n  git  # for cloning\n\t\n#wget\nwget\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	var includePkgs []string
+	if err := getComprtIncludes(&includePkgs, comprtIncludesPath, testCodeCame, hostDebianArch()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(includePkgs, testPkgs) {
+		t.Fatalf("found the following packages %v", includePkgs)
+	}
+}
+
+func TestCopyAndRunComprtConfigDir(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var comprtConfigPath string = filepath.Join(tempDirPath, "configs")
+	var target string = filepath.Join(tempDirPath, "target")
+	var outPath string = filepath.Join(tempDirPath, "out")
+	for _, dir := range []string{comprtConfigPath, target} {
+		if err := os.Mkdir(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a previously copied in comprt config file should be replaced
+	if err := createTestFile(filepath.Join(target, comprtConfigFile), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, script := range []string{"90-cleanup.sh", "01-base.sh", "20-users.sh"} {
+		if err := createTestFile(
+			filepath.Join(comprtConfigPath, script),
+			"#!/bin/sh\necho "+script+" >> "+shellQuote(outPath)+"\n",
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(comprtConfigPath, "README"), []byte("exit 1\n"), ModeFile|(OS_USER_R|OS_USER_W)); err != nil {
+		t.Fatal(err)
+	}
+
+	chrootComprtConfigPath, err := copyComprtConfig(comprtConfigPath, target)
+	if err != nil {
+		t.Fatal(err)
+	} else if chrootComprtConfigPath != filepath.Join("/", comprtConfigDir) {
+		t.Fatalf("the comprt config dir was copied to %v", chrootComprtConfigPath)
+	}
+	if _, err := os.Stat(filepath.Join(target, comprtConfigFile)); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("the previous comprt config file was not removed")
+	}
+
+	// not chrooted, so the comprt config dir is ran from the host
+	if err := runComprtConfig(filepath.Join(target, comprtConfigDir), true); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "01-base.sh\n20-users.sh\n90-cleanup.sh\n"; string(out) != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestRunComprtConfigNoninteractive(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+	defer func(previous bool) { noninteractiveConfig = previous }(noninteractiveConfig)
+
+	var comprtConfigPath string = filepath.Join(tempDirPath, comprtConfigFile)
+	var outPath string = filepath.Join(tempDirPath, "out")
+	if err := createTestFile(comprtConfigPath, "echo \"$DEBIAN_FRONTEND\" >> "+shellQuote(outPath)+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, noninteractive := range []bool{true, false} {
+		noninteractiveConfig = noninteractive
+		if err := runComprtConfig(comprtConfigPath, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "noninteractive\n" + os.Getenv("DEBIAN_FRONTEND") + "\n"; string(out) != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestGetComprtIncludesConditions(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var comprtIncludesPath string = filepath.Join(tempDirPath, comprtIncludeFile)
+	if err := createTestFile(comprtIncludesPath, strings.Join([]string{
+		"git",
+		"[buster] libssl1.1",
+		"[bullseye, bookworm] libssl3",
+		"[arm64] gcc-aarch64-linux-gnu # only for cross compiling",
+		"[buster,!amd64] qemu-user-static",
+		"[!buster] wget",
+	}, "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		codeName string
+		arch     string
+		expected []string
+	}{
+		{"buster", "amd64", []string{"git", "libssl1.1"}},
+		{"buster", "arm64", []string{"git", "libssl1.1", "gcc-aarch64-linux-gnu", "qemu-user-static"}},
+		{"bookworm", "amd64", []string{"git", "libssl3", "wget"}},
+	} {
+		var includePkgs []string
+		if err := getComprtIncludes(&includePkgs, comprtIncludesPath, tc.codeName, tc.arch); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(includePkgs, tc.expected) {
+			t.Fatalf("expected %v for %v/%v, got %v", tc.expected, tc.codeName, tc.arch, includePkgs)
+		}
+	}
+
+	if err := createTestFile(comprtIncludesPath, "[buster libssl1.1\n"); err != nil {
+		t.Fatal(err)
+	}
+	var includePkgs []string
+	if err := getComprtIncludes(&includePkgs, comprtIncludesPath, testCodeCame, hostDebianArch()); err == nil {
+		t.Fatal("an unterminated condition was accepted")
+	}
+}
+
+func TestCreateDebootstrapArgListPinnedPkgs(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var comprtIncludesPath string = filepath.Join(tempDirPath, comprtIncludeFile)
+	if err := createTestFile(comprtIncludesPath, "autoconf\ngit=1:2.20.1-2+deb10u3\nlibc6:armhf\nwget\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	var debootstrapCmdArr, pinnedPkgs []string
+	if err := createDebootstrapArgList(
+		&debootstrapCmdArr,
+		&pinnedPkgs,
+		nil,
+		comprtIncludesPath,
+		testCodeCame,
+		"foo",
+		defaultMirrorMappings[testCodeCame],
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if debootstrapCmdArr[0] != "--include=autoconf,wget" {
+		t.Fatalf("a pinned package was passed to debootstrap: %v", debootstrapCmdArr)
+	}
+	if !reflect.DeepEqual(pinnedPkgs, []string{"git=1:2.20.1-2+deb10u3", "libc6:armhf"}) {
+		t.Fatalf("found the following pinned packages %v", pinnedPkgs)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	var quoted string = shellQuote("/home/it's here")
+	out, err := exec.Command("sh", "-c", "printf '%s' "+quoted).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != "/home/it's here" {
+		t.Fatalf("%v was not interpreted as a single word by sh, got %v", quoted, string(out))
+	}
+}
+
+func TestSplitPassThroughArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args        []string
+		cliArgs     []string
+		passThrough []string
+	}{
+		{
+			[]string{progname, "create", testCodeCame, "foo", "--", "--variant=minbase", "--include", "git,vim", "extra arg"},
+			[]string{progname, "create", testCodeCame, "foo"},
+			[]string{"--variant=minbase", "--include", "git,vim", "extra arg"},
+		},
+		{
+			[]string{progname, "--retries=1", "create", testCodeCame, "foo", "--"},
+			[]string{progname, "--retries=1", "create", testCodeCame, "foo"},
+			[]string{},
+		},
+		{
+			[]string{progname, "chroot", "foo", "--", "--variant=minbase"},
+			[]string{progname, "chroot", "foo", "--", "--variant=minbase"},
+			nil,
+		},
+	} {
+		cliArgs, passThrough := splitPassThroughArgs(tc.args)
+		if !reflect.DeepEqual(cliArgs, tc.cliArgs) || !reflect.DeepEqual(passThrough, tc.passThrough) {
+			t.Fatalf("expected %v and %v, got %v and %v", tc.cliArgs, tc.passThrough, cliArgs, passThrough)
+		}
+	}
+}
+
 func TestLocateField(t *testing.T) {
 	var mountPointIndex int = 1
 	mountPoint, err := locateField(
@@ -357,9 +583,18 @@ func TestChroot(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	bindDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bindDirPath)
+	if err := createTestFile(filepath.Join(bindDirPath, "foo"), ""); err != nil {
+		t.Fatal(err)
+	}
+
 	// For reference on determining if the process is in a chroot:
 	// https://unix.stackexchange.com/questions/14345/how-do-i-tell-im-running-in-a-chroot
-	exitChroot, errs := Chroot(tempDirPath)
+	exitChroot, errs := Chroot(tempDirPath, bindMount{hostPath: bindDirPath, comprtPath: "/src", readOnly: true})
 	if errs != nil {
 		t.Fatal(errs)
 	}
@@ -386,6 +621,12 @@ func TestChroot(t *testing.T) {
 	if rootStat.Ino == parentRootStat.Ino {
 		t.Fatal("was unable to chroot into target")
 	}
+
+	if _, err := os.Stat("/src/foo"); err != nil {
+		t.Fatalf("the bind mount was not mounted in the chroot: %v", err)
+	} else if err := createTestFile("/src/bar", ""); err == nil {
+		t.Fatal("the read-only bind mount was written to")
+	}
 }
 
 func TestMountAndUnMountChrootFileSystemsRecoveryIntegration(t *testing.T) {
@@ -547,12 +788,20 @@ func TestChrootCommandIntegration(t *testing.T) {
 	createDebootstrapArgList(
 		&debootstrapCmdArr,
 		nil,
+		nil,
 		"",
 		testCodeCame,
 		pconfs.target,
 		defaultMirrorMappings[testCodeCame],
 	)
-	if errs := createComprt(pconfs.comprtConfigPath, pconfs.target, noAlias, "", false, &debootstrapCmdArr); errs != nil {
+	if errs := createComprt(createOptions{
+		comprtConfigPath:  pconfs.comprtConfigPath,
+		target:            pconfs.target,
+		alias:             noAlias,
+		users:             []comprtUser{defaultComprtUser()},
+		debootstrapCmdArr: &debootstrapCmdArr,
+		sources:           testAptSources,
+	}); errs != nil {
 		t.Fatal(errs)
 	}
 
@@ -599,3 +848,117 @@ func TestChrootCommandIntegration(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestProvisionComprtIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	if err := setupProgDataDir(); err != nil {
+		t.Fatal(err)
+	}
+
+	tempDirPath, err := os.MkdirTemp(progDataDir, "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var testTarget string = filepath.Join(tempDirPath, "testChroot")
+	var comprtConfigPath string = filepath.Join(tempDirPath, comprtConfigFile)
+	if err := os.Mkdir(
+		testTarget,
+		os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_W|OS_GROUP_X|OS_OTH_R|OS_OTH_W|OS_OTH_X),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createTestFile(comprtConfigPath, testComprtConfigFileContents); err != nil {
+		t.Fatal(err)
+	}
+
+	var debootstrapCmdArr []string
+	createDebootstrapArgList(
+		&debootstrapCmdArr,
+		nil,
+		nil,
+		"",
+		testCodeCame,
+		testTarget,
+		defaultMirrorMappings[testCodeCame],
+	)
+	if errs := createComprt(createOptions{
+		comprtConfigPath:  comprtConfigPath,
+		target:            testTarget,
+		alias:             noAlias,
+		users:             []comprtUser{defaultComprtUser()},
+		quiet:             !testing.Verbose(),
+		debootstrapCmdArr: &debootstrapCmdArr,
+		sources:           testAptSources,
+	}); errs != nil {
+		t.Fatal(errs)
+	}
+
+	// the updated comprt config file should be ran without bootstrapping again
+	if err := createTestFile(comprtConfigPath, "#!/bin/sh\n\ntouch bar\n"); err != nil {
+		t.Fatal(err)
+	}
+	if errs := provisionComprt(comprtConfigPath, testTarget, !testing.Verbose(), nil, comprtSecrets{}, nil); errs != nil {
+		t.Fatal(errs)
+	}
+
+	if _, err := os.Stat(filepath.Join(testTarget, "bar")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMountChrootFileSystemsDevPtsNewInstance(t *testing.T) {
+	if err := setupProgDataDir(); err != nil {
+		t.Fatal(err)
+	}
+
+	tempDirPath, err := os.MkdirTemp(progDataDir, "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var testTarget string = filepath.Join(tempDirPath, "testChroot")
+	if err := os.Mkdir(
+		testTarget,
+		os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_W|OS_GROUP_X|OS_OTH_R|OS_OTH_W|OS_OTH_X),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	var hostPtsStat *syscall.Stat_t = &syscall.Stat_t{}
+	if err := stat("/dev/pts", hostPtsStat); err != nil {
+		t.Fatal(err)
+	}
+
+	fileSystemsMounted, err := mountChrootFileSystems([]string{"/dev", "/dev/pts"}, testTarget)
+	defer func() {
+		if err := unMountChrootFileSystems(fileSystemsMounted, testTarget); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testPtsStat *syscall.Stat_t = &syscall.Stat_t{}
+	if err := stat(filepath.Join(testTarget, "/dev/pts"), testPtsStat); err != nil {
+		t.Fatal(err)
+	}
+	if hostPtsStat.Dev == testPtsStat.Dev {
+		t.Fatal("the host's /dev/pts was mounted in test directory instead of a new instance")
+	}
+
+	var newPtsStat *syscall.Stat_t = &syscall.Stat_t{}
+	if err := stat("/dev/pts", newPtsStat); err != nil {
+		t.Fatal(err)
+	}
+	if hostPtsStat.Dev != newPtsStat.Dev {
+		t.Fatal("the new /dev/pts instance was propagated to the host")
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+)
+
+// Where the comprt's digest manifest is kept in the comprt, next to its
+// metadata.
+const comprtDigestPath = "/etc/debcomprt/digest.json"
+
+// The paths in the comprt that are expected to change as the comprt is used,
+// they are left out of the digest along with everything under them.
+var volatileDigestPaths = []string{
+	"/dev",
+	"/proc",
+	"/run",
+	"/sys",
+	"/tmp",
+	"/var/cache",
+	"/var/lib/apt/lists",
+	"/var/lib/systemd/random-seed",
+	"/var/log",
+	"/var/tmp",
+	comprtMetadataPath,
+	comprtDigestPath,
+	comprtStagesPath,
+}
+
+// A type used to describe a file in the comprt's digest.
+type digestEntry struct {
+	// The file's path in the comprt.
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Uid  uint32 `json:"uid"`
+	Gid  uint32 `json:"gid"`
+	// The sha256 checksum of a regular file's contents.
+	Sum string `json:"sha256,omitempty"`
+	// What a symlink points to.
+	Link string `json:"link,omitempty"`
+}
+
+// A type used to describe the digest of a comprt, a manifest of its files and a
+// root hash over them. Each dir is hashed along with the hashes of what is in
+// it (a merkle tree), that way the root hash changes when any file does.
+type comprtDigest struct {
+	Root  string        `json:"root"`
+	Files []digestEntry `json:"files"`
+}
+
+// Check whether the path in the comprt is left out of the digest.
+func isVolatileDigestPath(path string) bool {
+	return stringInArr(path, &volatileDigestPaths)
+}
+
+// Get the digest of the comprt. Filesystems mounted under the target (e.g. /proc
+// from a chroot session) are left out, the same as the volatile paths.
+func digestComprt(target string) (comprtDigest, error) {
+	var targetStat *syscall.Stat_t = &syscall.Stat_t{}
+	if err := syscall.Lstat(target, targetStat); err != nil {
+		return comprtDigest{}, err
+	}
+
+	var digest comprtDigest
+	err := filepath.WalkDir(target, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(target, path)
+		if err != nil {
+			return err
+		}
+		var comprtPath string = filepath.Join("/", relPath)
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fileStat, ok := fileInfo.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("%v could not be stat'd", comprtPath)
+		}
+		if isVolatileDigestPath(comprtPath) || fileStat.Dev != targetStat.Dev {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		var file digestEntry = digestEntry{
+			Path: comprtPath,
+			Mode: fileInfo.Mode().String(),
+			Uid:  fileStat.Uid,
+			Gid:  fileStat.Gid,
+		}
+		switch {
+		case fileInfo.Mode().IsRegular():
+			if file.Sum, err = sha256File(path); err != nil {
+				return err
+			}
+		case fileInfo.Mode()&fs.ModeSymlink != 0:
+			if file.Link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		digest.Files = append(digest.Files, file)
+
+		return nil
+	})
+	if err != nil {
+		return comprtDigest{}, err
+	}
+	digest.Root = digest.rootHash()
+
+	return digest, nil
+}
+
+// Get the root hash of the digest's files. A file is hashed by its mode,
+// owners and contents (or what it points to), a dir by its mode and owners and
+// the hashes and names of what is in it.
+func (digest comprtDigest) rootHash() string {
+	var files map[string]digestEntry = make(map[string]digestEntry)
+	var children map[string][]string = make(map[string][]string)
+	for _, file := range digest.Files {
+		files[file.Path] = file
+		if file.Path != "/" {
+			children[filepath.Dir(file.Path)] = append(children[filepath.Dir(file.Path)], file.Path)
+		}
+	}
+
+	var hashPath func(path string) string
+	hashPath = func(path string) string {
+		var file digestEntry = files[path]
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%v %v %v %v %v\n", file.Mode, file.Uid, file.Gid, file.Sum, file.Link)
+		sort.Strings(children[path])
+		for _, child := range children[path] {
+			fmt.Fprintf(hash, "%v %v\n", hashPath(child), filepath.Base(child))
+		}
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+
+	return hashPath("/")
+}
+
+// Get the files that differ between the recorded digest and the current one,
+// e.g. '/etc/passwd was changed'.
+func digestDrift(recorded, current comprtDigest) []string {
+	var recordedFiles map[string]digestEntry = make(map[string]digestEntry)
+	for _, file := range recorded.Files {
+		recordedFiles[file.Path] = file
+	}
+
+	var drift []string
+	for _, file := range current.Files {
+		if recordedFile, ok := recordedFiles[file.Path]; !ok {
+			drift = append(drift, file.Path+" was added")
+		} else if recordedFile != file {
+			drift = append(drift, file.Path+" was changed")
+		}
+		delete(recordedFiles, file.Path)
+	}
+	for path := range recordedFiles {
+		drift = append(drift, path+" was removed")
+	}
+	sort.Strings(drift)
+
+	return drift
+}
+
+// Write the digest into the comprt.
+func writeComprtDigest(target string, digest comprtDigest) error {
+	contents, err := json.MarshalIndent(digest, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := checkComprtPath(target, comprtDigestPath); err != nil {
+		return err
+	}
+	var digestPath string = filepath.Join(target, comprtDigestPath)
+	if err := os.MkdirAll(filepath.Dir(digestPath), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return err
+	}
+
+	return os.WriteFile(digestPath, append(contents, '\n'), OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R)
+}
+
+// Read in the digest of the comprt, nil is returned if no digest was recorded.
+func readComprtDigest(target string) (*comprtDigest, error) {
+	contents, err := os.ReadFile(filepath.Join(target, comprtDigestPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var digest comprtDigest
+	if err := json.Unmarshal(contents, &digest); err != nil {
+		return nil, fmt.Errorf("%v: %w", comprtDigestPath, err)
+	}
+
+	return &digest, nil
+}
+
+// Record the digest of the comprt: the manifest is written into the comprt and
+// the root hash is kept in the comprt's metadata and registry entry (if there
+// are any). The registry is outside of the comprt, that way rewriting the
+// manifest along with the files can still be caught.
+func recordComprtDigest(target string) (comprtDigest, error) {
+	// the dir the digest is written into is made first, otherwise it would be
+	// missing from the digest
+	if err := checkComprtPath(target, comprtDigestPath); err != nil {
+		return comprtDigest{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(target, comprtDigestPath)), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return comprtDigest{}, err
+	}
+
+	digest, err := digestComprt(target)
+	if err != nil {
+		return comprtDigest{}, err
+	}
+	if err := writeComprtDigest(target, digest); err != nil {
+		return comprtDigest{}, err
+	}
+
+	metadata, err := readComprtMetadata(target)
+	if err != nil {
+		return comprtDigest{}, err
+	} else if metadata != nil {
+		metadata.Digest = digest.Root
+		if err := writeComprtMetadata(target, *metadata); err != nil {
+			return comprtDigest{}, err
+		}
+	}
+
+	entry, err := lookupComprt(target)
+	if err != nil {
+		return comprtDigest{}, err
+	} else if entry != nil {
+		entry.Digest = digest.Root
+		if err := registerComprt(*entry); err != nil {
+			return comprtDigest{}, err
+		}
+	}
+
+	return digest, nil
+}
+
+// Check the comprt's files match its recorded digest.
+func verifyDigest(target string) doctorResult {
+	var result doctorResult = doctorResult{name: "digest"}
+	recorded, err := readComprtDigest(target)
+	if err != nil {
+		result.status, result.detail = doctorFail, err.Error()
+		return result
+	} else if recorded == nil {
+		result.status, result.detail = doctorWarn, "no digest was recorded, the files were not checked (see the digest command)"
+		return result
+	}
+
+	if recorded.rootHash() != recorded.Root {
+		result.status, result.detail = doctorFail, fmt.Sprintf("%v does not match its root hash, it was changed", comprtDigestPath)
+		return result
+	}
+	metadata, err := readComprtMetadata(target)
+	if err != nil {
+		result.status, result.detail = doctorFail, err.Error()
+		return result
+	} else if metadata != nil && metadata.Digest != "" && metadata.Digest != recorded.Root {
+		result.status, result.detail = doctorFail, fmt.Sprintf("the digest in %v does not match %v", comprtMetadataPath, comprtDigestPath)
+		return result
+	}
+	entry, err := lookupComprt(target)
+	if err != nil {
+		result.status, result.detail = doctorFail, err.Error()
+		return result
+	} else if entry != nil && entry.Digest != "" && entry.Digest != recorded.Root {
+		result.status, result.detail = doctorFail, fmt.Sprintf("the registry's digest %v does not match the comprt's %v, the comprt's digest was rewritten", entry.Digest, recorded.Root)
+		return result
+	}
+
+	current, err := digestComprt(target)
+	if err != nil {
+		result.status, result.detail = doctorFail, err.Error()
+		return result
+	}
+	if current.Root != recorded.Root {
+		result.status, result.detail = doctorFail, driftDetail("files", digestDrift(*recorded, current))
+	} else {
+		result.status, result.detail = doctorPass, fmt.Sprintf("%v files match the digest %v", len(current.Files), current.Root)
+	}
+	return result
+}
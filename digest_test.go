@@ -0,0 +1,153 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestComprt(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	for _, dir := range []string{"etc", "var/log"} {
+		if err := os.MkdirAll(filepath.Join(tempDirPath, dir), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createTestFile(filepath.Join(tempDirPath, "etc/motd"), "foo\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("motd", filepath.Join(tempDirPath, "etc/issue")); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(tempDirPath, "var/log/dpkg.log"), "foo\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, err := digestComprt(tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, file := range recorded.Files {
+		paths = append(paths, file.Path)
+	}
+	// the volatile /var/log is left out
+	if expected := "/ /etc /etc/issue /etc/motd /var"; strings.Join(paths, " ") != expected {
+		t.Fatalf("expected: %v, actual: %v", expected, paths)
+	}
+
+	// changing a volatile path leaves the root hash as is
+	if err := createTestFile(filepath.Join(tempDirPath, "var/log/dpkg.log"), "bar\n"); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := digestComprt(tempDirPath); err != nil {
+		t.Fatal(err)
+	} else if current.Root != recorded.Root {
+		t.Fatalf("expected: %v, actual: %v", recorded.Root, current.Root)
+	}
+
+	if err := os.Chmod(filepath.Join(tempDirPath, "etc/motd"), os.ModeSetuid|os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(tempDirPath, "etc/issue")); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(tempDirPath, "etc/hosts"), "foo\n"); err != nil {
+		t.Fatal(err)
+	}
+	current, err := digestComprt(tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if current.Root == recorded.Root {
+		t.Fatal("the root hash did not change along with the files")
+	}
+	if expected := "/etc/hosts was added, /etc/issue was removed, /etc/motd was changed"; strings.Join(digestDrift(recorded, current), ", ") != expected {
+		t.Fatalf("expected: %v, actual: %v", expected, digestDrift(recorded, current))
+	}
+}
+
+func TestVerifyDigest(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var testTarget string = filepath.Join(progDataDir, "testChroot")
+	if err := os.MkdirAll(filepath.Join(testTarget, "etc"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(testTarget, "etc/motd"), "foo\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeComprtMetadata(testTarget, comprtMetadata{CodeName: testCodeCame}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerComprt(registryEntry{Target: testTarget, CodeName: testCodeCame, Created: time.Now().UTC()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := verifyDigest(testTarget); result.status != doctorWarn {
+		t.Fatalf("expected %v without a digest, got %v (%v)", doctorWarn, result.status, result.detail)
+	}
+
+	digest, err := recordComprtDigest(testTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata, err := readComprtMetadata(testTarget); err != nil {
+		t.Fatal(err)
+	} else if metadata.Digest != digest.Root {
+		t.Fatalf("expected: %v, actual: %v", digest.Root, metadata.Digest)
+	}
+	if entry, err := lookupComprt(testTarget); err != nil {
+		t.Fatal(err)
+	} else if entry.Digest != digest.Root {
+		t.Fatalf("expected: %v, actual: %v", digest.Root, entry.Digest)
+	}
+	if result := verifyDigest(testTarget); result.status != doctorPass {
+		t.Fatalf("expected %v, got %v (%v)", doctorPass, result.status, result.detail)
+	}
+
+	if err := createTestFile(filepath.Join(testTarget, "etc/motd"), "bar\n"); err != nil {
+		t.Fatal(err)
+	}
+	result := verifyDigest(testTarget)
+	if result.status != doctorFail {
+		t.Fatalf("expected %v for a changed file, got %v (%v)", doctorFail, result.status, result.detail)
+	} else if !strings.Contains(result.detail, "/etc/motd was changed") {
+		t.Fatalf("expected %q in %q", "/etc/motd was changed", result.detail)
+	}
+
+	// rewriting the digest in the comprt is caught by the registry's root hash
+	rewritten, err := digestComprt(testTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeComprtDigest(testTarget, rewritten); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeComprtMetadata(testTarget, comprtMetadata{CodeName: testCodeCame, Digest: rewritten.Root}); err != nil {
+		t.Fatal(err)
+	}
+	if result := verifyDigest(testTarget); result.status != doctorFail {
+		t.Fatalf("expected %v for a rewritten digest, got %v (%v)", doctorFail, result.status, result.detail)
+	}
+}
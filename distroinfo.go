@@ -0,0 +1,164 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Where the distro-info-data package keeps a csv of each distro's releases.
+	distroInfoDir = "/usr/share/distro-info"
+
+	debianArchiveMirror = "http://archive.debian.org/debian/"
+	ubuntuArchiveMirror = "http://old-releases.ubuntu.com/ubuntu/"
+
+	distroInfoDateLayout = "2006-01-02"
+)
+
+// A copy of distro-info-data's csvs, used when the package is not installed.
+//
+//go:embed distro-info/*.csv
+var bundledDistroInfo embed.FS
+
+// A type used to describe where a distro's releases are mirrored, releases are
+// moved to the archive mirror once they are no longer supported.
+type distroMirrors struct {
+	name    string
+	mirror  string
+	archive string
+	// The columns of the distro's csv that hold when a release stops being
+	// supported, the last one that is set is used (e.g. debian's LTS, ubuntu's
+	// ESM).
+	eolColumns []string
+}
+
+var distros = []distroMirrors{
+	{"debian", defaultDebianMirror, debianArchiveMirror, []string{"eol", "eol-lts"}},
+	{"ubuntu", defaultUbuntuMirror, ubuntuArchiveMirror, []string{"eol", "eol-server", "eol-esm"}},
+}
+
+// Read in the codenames (series) of a distro's releases from its distro-info
+// csv, mapped to the mirror each release can be found on as of now. Releases
+// that are not created yet are left out.
+func readDistroInfo(r io.Reader, distro distroMirrors, now time.Time) (map[string]string, error) {
+	// distro-info leaves off the trailing fields of a release that are not set
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	} else if len(records) < 1 {
+		return nil, fmt.Errorf("the %v distro-info is empty", distro.name)
+	}
+
+	var columns map[string]int = make(map[string]int)
+	for i, column := range records[0] {
+		columns[column] = i
+	}
+	for _, column := range []string{"series", "created"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("the %v distro-info has no %v column", distro.name, column)
+		}
+	}
+
+	var field func(record []string, column string) string = func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var mappings map[string]string = make(map[string]string)
+	for _, record := range records[1:] {
+		created, err := time.Parse(distroInfoDateLayout, field(record, "created"))
+		if err != nil {
+			return nil, err
+		} else if created.After(now) {
+			continue
+		}
+
+		var eol string
+		for _, column := range distro.eolColumns {
+			if value := field(record, column); value != "" {
+				eol = value
+			}
+		}
+		mappings[field(record, "series")] = distro.mirror
+		if eol == "" {
+			continue
+		}
+
+		eolDate, err := time.Parse(distroInfoDateLayout, eol)
+		if err != nil {
+			return nil, err
+		} else if eolDate.Before(now) {
+			mappings[field(record, "series")] = distro.archive
+		}
+	}
+
+	return mappings, nil
+}
+
+// Get the mirror of each codename from the distro-info csvs in the dir, the
+// bundled csvs are used for a distro whose csv is not in the dir (or if dir is
+// empty).
+func loadMirrorMappings(dir string, now time.Time) (map[string]string, error) {
+	var mappings map[string]string = make(map[string]string)
+	for _, distro := range distros {
+		var csvName string = distro.name + ".csv"
+		var file fs.File
+		var err error = fs.ErrNotExist
+		if dir != "" {
+			file, err = os.Open(filepath.Join(dir, csvName))
+		}
+		if err != nil {
+			if file, err = bundledDistroInfo.Open("distro-info/" + csvName); err != nil {
+				return nil, err
+			}
+		}
+
+		distroMappings, err := readDistroInfo(file, distro, now)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", csvName, err)
+		}
+		for codename, mirror := range distroMappings {
+			mappings[codename] = mirror
+		}
+	}
+
+	return mappings, nil
+}
+
+// Get the mirror of each codename, a malformed distro-info csv on the host
+// falls back to the bundled csvs.
+func defaultMirrorMappingsFromDistroInfo() map[string]string {
+	mappings, err := loadMirrorMappings(distroInfoDir, time.Now())
+	if err != nil {
+		if mappings, err = loadMirrorMappings("", time.Now()); err != nil {
+			panic(err)
+		}
+	}
+
+	return mappings
+}
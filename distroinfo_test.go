@@ -0,0 +1,91 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadDistroInfo(t *testing.T) {
+	const debianCsv = `version,codename,series,created,release,eol,eol-lts,eol-elts
+9,Stretch,stretch,2015-04-26,2017-06-17,2020-07-18,2022-06-30,2027-06-30
+10,Buster,buster,2017-06-17,2019-07-06,2022-09-10,2024-06-30,2029-06-30
+12,Bookworm,bookworm,2021-08-14,2023-06-10,2026-06-10,2028-06-30,2033-06-30
+14,Forky,forky,2025-08-09
+,Sid,sid,1993-08-16
+`
+	now := time.Date(2023, time.July, 1, 0, 0, 0, 0, time.UTC)
+	mappings, err := readDistroInfo(strings.NewReader(debianCsv), distros[0], now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for codename, expected := range map[string]string{
+		"stretch":  debianArchiveMirror,
+		"buster":   defaultDebianMirror, // still under LTS
+		"bookworm": defaultDebianMirror,
+		"sid":      defaultDebianMirror,
+	} {
+		if mappings[codename] != expected {
+			t.Fatalf("expected %v to be mapped to %v, got %v", codename, expected, mappings[codename])
+		}
+	}
+	if _, ok := mappings["forky"]; ok {
+		t.Fatal("a release that was not created yet was mapped to a mirror")
+	}
+
+	if _, err := readDistroInfo(strings.NewReader("version,codename\n"), distros[0], now); err == nil {
+		t.Fatal("a distro-info csv without series was accepted")
+	}
+}
+
+func TestLoadMirrorMappings(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// the bundled csvs are used for both distros
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	mappings, err := loadMirrorMappings(tempDirPath, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for codename, expected := range map[string]string{
+		"bookworm": defaultDebianMirror,
+		"trixie":   defaultDebianMirror,
+		"jammy":    defaultUbuntuMirror,
+		"noble":    defaultUbuntuMirror,
+		"hirsute":  ubuntuArchiveMirror,
+	} {
+		if mappings[codename] != expected {
+			t.Fatalf("expected %v to be mapped to %v, got %v", codename, expected, mappings[codename])
+		}
+	}
+
+	if err := createTestFile(filepath.Join(tempDirPath, "debian.csv"), "version,codename,series,created\n,Foo,foo,1993-08-16\n"); err != nil {
+		t.Fatal(err)
+	}
+	if mappings, err = loadMirrorMappings(tempDirPath, now); err != nil {
+		t.Fatal(err)
+	} else if mappings["foo"] != defaultDebianMirror || mappings["bookworm"] != "" {
+		t.Fatalf("the host's distro-info was not used over the bundled one: %v", mappings)
+	}
+}
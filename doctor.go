@@ -0,0 +1,233 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	doctorPass = "PASS"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+
+	procSelfStatus = "/proc/self/status"
+
+	// The bit of CAP_SYS_ADMIN in a capability set. For reference:
+	// https://man7.org/linux/man-pages/man7/capabilities.7.html
+	capSysAdmin = 21
+
+	mirrorTimeout = 10 * time.Second
+)
+
+// The colors each status of a check is reported in, on a terminal.
+var doctorStatusColors = map[string]string{
+	doctorPass: passColor,
+	doctorWarn: warningColor,
+	doctorFail: failColor,
+}
+
+// A type used to store the outcome of one of the doctor's checks.
+type doctorResult struct {
+	name   string
+	status string
+	detail string
+}
+
+// Check the process is able to create and chroot into comprts, either by being
+// root or by having CAP_SYS_ADMIN.
+func checkPrivileges(statusPath string, uid int) doctorResult {
+	var result doctorResult = doctorResult{name: "privileges"}
+	if uid == rootUid {
+		result.status, result.detail = doctorPass, "running as root"
+		return result
+	}
+
+	capEff, err := locateField(statusPath, regexp.MustCompile(`:\s*`), 0, 1, regexp.MustCompile(`^CapEff$`))
+	if err != nil {
+		result.status, result.detail = doctorFail, err.Error()
+		return result
+	}
+	caps, err := strconv.ParseUint(capEff, 16, 64)
+	if err != nil {
+		result.status, result.detail = doctorFail, fmt.Sprintf("%v is not a capability set", capEff)
+		return result
+	}
+
+	if caps&(1<<capSysAdmin) != 0 {
+		result.status, result.detail = doctorPass, "running with CAP_SYS_ADMIN"
+	} else {
+		result.status, result.detail = doctorWarn, "not running as root, only --rootless comprts can be created (run with sudo)"
+	}
+
+	return result
+}
+
+// Check the programs used to create comprts are installed. mmdebstrap is only
+// needed for rootless comprts.
+func checkPrograms() []doctorResult {
+	var results []doctorResult
+	for _, program := range []struct {
+		name     string
+		required bool
+	}{
+		{"debootstrap", true},
+		{"mmdebstrap", false},
+	} {
+		var result doctorResult = doctorResult{name: program.name, status: doctorPass, detail: "installed"}
+		if err := checkProgram(program.name, program.name); err != nil {
+			result.status, result.detail = doctorFail, err.Error()
+			if !program.required {
+				result.status = doctorWarn
+				result.detail += ", it is needed for --rootless"
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Check a comprt for the architecture can be chrooted into. A foreign
+// architecture needs binfmt_misc and a qemu-user-static handler for it.
+func checkBinfmt(binfmtDir, arch string) doctorResult {
+	var result doctorResult = doctorResult{name: "binfmt " + arch}
+	if arch == hostDebianArch() {
+		result.status, result.detail = doctorPass, "native architecture, emulation is not needed"
+		return result
+	}
+
+	if err := checkBinfmtHandler(binfmtDir, arch); err != nil {
+		result.status, result.detail = doctorFail, err.Error()
+		return result
+	}
+
+	result.status, result.detail = doctorPass, fmt.Sprintf("qemu-%v handler is enabled", qemuArchMappings[arch])
+	return result
+}
+
+// Check the archive keyrings used to verify debian and ubuntu releases are
+// installed. The ubuntu keyring is only needed for ubuntu comprts.
+func checkKeyrings() []doctorResult {
+	var results []doctorResult
+	for _, keyring := range []string{debianArchiveKeyring, ubuntuArchiveKeyring} {
+		var result doctorResult = doctorResult{name: filepath.Base(keyring), status: doctorPass, detail: "installed"}
+		if err := checkKeyring(keyring); err != nil {
+			result.status, result.detail = doctorFail, err.Error()
+			if keyring == ubuntuArchiveKeyring {
+				result.status = doctorWarn
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Check the mirror can be reached over the network.
+func checkMirror(client *http.Client, mirror string) doctorResult {
+	var result doctorResult = doctorResult{name: mirror}
+	resp, err := client.Head(mirror)
+	if err != nil {
+		result.status, result.detail = doctorFail, fmt.Sprintf("unreachable: %v", err)
+		return result
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		result.status, result.detail = doctorFail, fmt.Sprintf("returned %v", resp.Status)
+	} else {
+		result.status, result.detail = doctorPass, "reachable"
+	}
+
+	return result
+}
+
+// Check nothing is still mounted in the comprts on this host. A chroot session
+// mounts into its own mount namespace, so mounts seen here were left behind by
+// a run that crashed.
+func checkStaleMounts(targets []string, mounts []mountInfo) doctorResult {
+	var result doctorResult = doctorResult{name: "stale mounts"}
+	var stale []string
+	for _, target := range targets {
+		for _, mount := range mountsUnder(target, mounts) {
+			stale = append(stale, mount.mountPoint)
+		}
+	}
+
+	if len(stale) > 0 {
+		result.status, result.detail = doctorFail, fmt.Sprintf("%v (run debcomprt cleanup)", strings.Join(stale, ", "))
+	} else {
+		result.status, result.detail = doctorPass, "none found"
+	}
+
+	return result
+}
+
+// Audit the host for what is needed to create and use comprts for the
+// architecture. The mirrors are not checked when offline.
+func runDoctor(arch string, offline bool) ([]doctorResult, error) {
+	var results []doctorResult = []doctorResult{checkPrivileges(procSelfStatus, os.Getuid())}
+	results = append(results, checkPrograms()...)
+	results = append(results, checkBinfmt(binfmtMiscDir, arch))
+	results = append(results, checkKeyrings()...)
+
+	if !offline {
+		client := &http.Client{Timeout: mirrorTimeout}
+		for _, mirror := range []string{defaultDebianMirror, defaultUbuntuMirror} {
+			results = append(results, checkMirror(client, mirror))
+		}
+	}
+
+	entries, err := loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := readMountInfo(procSelfMountInfo)
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	for _, entry := range entries {
+		targets = append(targets, entry.Target)
+	}
+	results = append(results, checkStaleMounts(targets, mounts))
+
+	return results, nil
+}
+
+// Write out the doctor's report, returns if all of the checks passed (warnings
+// do not count as failing).
+func writeDoctorReport(w io.Writer, results []doctorResult) (bool, error) {
+	var passed bool = true
+	for _, result := range results {
+		if result.status == doctorFail {
+			passed = false
+		}
+		if _, err := fmt.Fprintf(w, "[%v] %v: %v\n", colorize(w, doctorStatusColors[result.status], result.status), result.name, result.detail); err != nil {
+			return false, err
+		}
+	}
+
+	return passed, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPrivileges(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if result := checkPrivileges(procSelfStatus, rootUid); result.status != doctorPass {
+		t.Fatalf("root was not accepted: %+v", result)
+	}
+
+	var statusPath string = filepath.Join(tempDirPath, "status")
+	if err := createTestFile(statusPath, "Name:\tdebcomprt\nCapEff:\t0000000000200000\n"); err != nil {
+		t.Fatal(err)
+	}
+	if result := checkPrivileges(statusPath, 1000); result.status != doctorPass {
+		t.Fatalf("CAP_SYS_ADMIN was not accepted: %+v", result)
+	}
+
+	if err := createTestFile(statusPath, "Name:\tdebcomprt\nCapEff:\t0000000000000000\n"); err != nil {
+		t.Fatal(err)
+	}
+	if result := checkPrivileges(statusPath, 1000); result.status != doctorWarn {
+		t.Fatalf("an unprivileged user was not warned: %+v", result)
+	}
+}
+
+func TestCheckBinfmt(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var foreignArch string = "s390x"
+	if hostDebianArch() == foreignArch {
+		foreignArch = "arm64"
+	}
+	if result := checkBinfmt(tempDirPath, hostDebianArch()); result.status != doctorPass {
+		t.Fatalf("the native architecture needed emulation: %+v", result)
+	} else if result := checkBinfmt(tempDirPath, foreignArch); result.status != doctorFail {
+		t.Fatalf("a foreign architecture passed without binfmt_misc: %+v", result)
+	}
+
+	if err := createTestFile(filepath.Join(tempDirPath, "status"), "enabled\n"); err != nil {
+		t.Fatal(err)
+	}
+	if result := checkBinfmt(tempDirPath, foreignArch); result.status != doctorFail {
+		t.Fatalf("a foreign architecture passed without a qemu handler: %+v", result)
+	}
+
+	if err := createTestFile(
+		filepath.Join(tempDirPath, "qemu-"+qemuArchMappings[foreignArch]),
+		"enabled\ninterpreter /usr/bin/qemu-"+qemuArchMappings[foreignArch]+"-static\nflags: F\n",
+	); err != nil {
+		t.Fatal(err)
+	}
+	if result := checkBinfmt(tempDirPath, foreignArch); result.status != doctorPass {
+		t.Fatalf("a foreign architecture with a qemu handler did not pass: %+v", result)
+	}
+}
+
+func TestCheckMirror(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/debian/" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	if result := checkMirror(server.Client(), server.URL+"/debian/"); result.status != doctorPass {
+		t.Fatalf("a reachable mirror did not pass: %+v", result)
+	} else if result := checkMirror(server.Client(), server.URL+"/ubuntu/"); result.status != doctorFail {
+		t.Fatalf("a missing mirror passed: %+v", result)
+	}
+}
+
+func TestCheckStaleMounts(t *testing.T) {
+	mounts := []mountInfo{{mountPoint: "/srv/foo"}, {mountPoint: "/srv/bar/proc"}}
+	if result := checkStaleMounts([]string{"/srv/foo"}, mounts); result.status != doctorPass {
+		t.Fatalf("a comprt that is a mount point was taken as a stale mount: %+v", result)
+	}
+	if result := checkStaleMounts([]string{"/srv/foo", "/srv/bar"}, mounts); result.status != doctorFail {
+		t.Fatalf("a stale mount was not found: %+v", result)
+	} else if !strings.Contains(result.detail, "/srv/bar/proc") {
+		t.Fatalf("the stale mount was not reported: %+v", result)
+	}
+}
+
+func TestWriteDoctorReport(t *testing.T) {
+	var report bytes.Buffer
+	passed, err := writeDoctorReport(&report, []doctorResult{
+		{"privileges", doctorPass, "running as root"},
+		{"mmdebstrap", doctorWarn, "not installed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if !passed {
+		t.Fatal("a warning failed the report")
+	} else if !strings.Contains(report.String(), "[WARN] mmdebstrap: not installed\n") {
+		t.Fatalf("unexpected report: %q", report.String())
+	}
+
+	if passed, err := writeDoctorReport(&report, []doctorResult{{"debootstrap", doctorFail, "not installed"}}); err != nil {
+		t.Fatal(err)
+	} else if passed {
+		t.Fatal("a failed check passed the report")
+	}
+}
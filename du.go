@@ -0,0 +1,274 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+const (
+	// Where dpkg keeps the lists of the files each package installed (e.g.
+	// /var/lib/dpkg/info/git.list).
+	dpkgInfoDir = "/var/lib/dpkg/info"
+
+	sizeSortKey    = "size"
+	nameSortKey    = "name"
+	defaultDuDepth = 2
+)
+
+// A type used to describe the space a package takes up in a comprt.
+type packageSize struct {
+	// The package's name, qualified with its architecture if dpkg does (e.g.
+	// libc6:amd64).
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	Files int    `json:"files"`
+}
+
+// A type used to describe the space the files under a dir take up in a comprt.
+type dirSize struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// A type used to describe where the space in a comprt goes.
+type sizeReport struct {
+	Total int64 `json:"total"`
+	// The size of the files no package installed (e.g. those written by the
+	// comprt config file).
+	Unowned  int64         `json:"unowned"`
+	Packages []packageSize `json:"packages"`
+	Dirs     []dirSize     `json:"dirs"`
+}
+
+// A type used to tell files apart, hard links to a file are the same file.
+type fileId struct {
+	dev uint64
+	ino uint64
+}
+
+// Read in the lists of the files each package in the comprt installed, keyed by
+// the package's name.
+func readDpkgFileLists(target string) (map[string][]string, error) {
+	entries, err := os.ReadDir(filepath.Join(target, dpkgInfoDir))
+	if err != nil {
+		return nil, err
+	}
+
+	var fileLists map[string][]string = make(map[string][]string)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".list") {
+			continue
+		}
+
+		listFile, err := os.Open(filepath.Join(target, dpkgInfoDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var pkg string = strings.TrimSuffix(entry.Name(), ".list")
+		scanner := bufio.NewScanner(listFile)
+		for scanner.Scan() {
+			if path := strings.TrimSpace(scanner.Text()); path != "" {
+				fileLists[pkg] = append(fileLists[pkg], path)
+			}
+		}
+		listFile.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return fileLists, nil
+}
+
+// Get the dir the file's size is counted towards, the file's dir cut down to
+// depth (e.g. /usr/share/doc/git/copyright is counted towards /usr/share with a
+// depth of 2).
+func duDir(path string, depth int) string {
+	var dir string = filepath.Dir(path)
+	if dir == "/" {
+		return dir
+	}
+
+	var names []string = strings.Split(strings.TrimPrefix(dir, "/"), "/")
+	if len(names) > depth {
+		names = names[:depth]
+	}
+	return "/" + strings.Join(names, "/")
+}
+
+// Get where the space in the comprt goes, by package (from dpkg's file lists)
+// and by dir (down to depth). Only the apparent size of regular files is
+// counted, hard links are counted once. Filesystems mounted under the target
+// (e.g. /proc from a chroot session) are not counted.
+func comprtSizeReport(target string, depth int) (sizeReport, error) {
+	var targetStat *syscall.Stat_t = &syscall.Stat_t{}
+	if err := syscall.Lstat(target, targetStat); err != nil {
+		return sizeReport{}, err
+	}
+
+	fileLists, err := readDpkgFileLists(target)
+	if err != nil {
+		return sizeReport{}, err
+	}
+
+	var report sizeReport
+	var owned map[fileId]bool = make(map[fileId]bool)
+	for pkg, paths := range fileLists {
+		var size packageSize = packageSize{Name: pkg}
+		var counted map[fileId]bool = make(map[fileId]bool)
+		for _, path := range paths {
+			var fileStat *syscall.Stat_t = &syscall.Stat_t{}
+			// the files left out by dpkg (e.g. by --minimize) are still listed
+			if err := syscall.Lstat(filepath.Join(target, path), fileStat); errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+				continue
+			} else if err != nil {
+				return sizeReport{}, err
+			}
+			if fileStat.Mode&syscall.S_IFMT != syscall.S_IFREG || fileStat.Dev != targetStat.Dev {
+				continue
+			}
+
+			var id fileId = fileId{dev: uint64(fileStat.Dev), ino: fileStat.Ino}
+			if counted[id] {
+				continue
+			}
+			counted[id] = true
+			owned[id] = true
+			size.Size += fileStat.Size
+			size.Files++
+		}
+		report.Packages = append(report.Packages, size)
+	}
+
+	var dirs map[string]int64 = make(map[string]int64)
+	var counted map[fileId]bool = make(map[fileId]bool)
+	err = filepath.WalkDir(target, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fileStat, ok := fileInfo.Sys().(*syscall.Stat_t)
+		if ok && fileStat.Dev != targetStat.Dev {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fileInfo.Mode().IsRegular() {
+			return nil
+		}
+
+		var id fileId
+		if ok {
+			id = fileId{dev: uint64(fileStat.Dev), ino: fileStat.Ino}
+			if counted[id] {
+				return nil
+			}
+			counted[id] = true
+		}
+		relPath, err := filepath.Rel(target, path)
+		if err != nil {
+			return err
+		}
+
+		report.Total += fileInfo.Size()
+		dirs[duDir(filepath.Join("/", relPath), depth)] += fileInfo.Size()
+		if !owned[id] {
+			report.Unowned += fileInfo.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return sizeReport{}, err
+	}
+	for path, size := range dirs {
+		report.Dirs = append(report.Dirs, dirSize{Path: path, Size: size})
+	}
+
+	return report, nil
+}
+
+// Sort the report's packages and dirs by the key, size sorts the largest first.
+func (report *sizeReport) sort(key string) error {
+	switch key {
+	case sizeSortKey:
+		sort.Slice(report.Packages, func(i, j int) bool {
+			if report.Packages[i].Size != report.Packages[j].Size {
+				return report.Packages[i].Size > report.Packages[j].Size
+			}
+			return report.Packages[i].Name < report.Packages[j].Name
+		})
+		sort.Slice(report.Dirs, func(i, j int) bool {
+			if report.Dirs[i].Size != report.Dirs[j].Size {
+				return report.Dirs[i].Size > report.Dirs[j].Size
+			}
+			return report.Dirs[i].Path < report.Dirs[j].Path
+		})
+	case nameSortKey:
+		sort.Slice(report.Packages, func(i, j int) bool { return report.Packages[i].Name < report.Packages[j].Name })
+		sort.Slice(report.Dirs, func(i, j int) bool { return report.Dirs[i].Path < report.Dirs[j].Path })
+	default:
+		return fmt.Errorf("%v is not a supported sort key, use either %v or %v", key, sizeSortKey, nameSortKey)
+	}
+
+	return nil
+}
+
+// Write the report in the format (text or json).
+func writeSizeReport(w io.Writer, format string, report sizeReport) error {
+	switch format {
+	case jsonOutput:
+		if report.Packages == nil {
+			report.Packages = []packageSize{}
+		}
+		if report.Dirs == nil {
+			report.Dirs = []dirSize{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(report)
+	case textOutput:
+		tabWriter := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tabWriter, "total:\t%v\n", formatMiB(report.Total))
+		fmt.Fprintf(tabWriter, "not from a package:\t%v\n", formatMiB(report.Unowned))
+		fmt.Fprintf(tabWriter, "\npackage\tsize\tfiles\n")
+		for _, pkg := range report.Packages {
+			fmt.Fprintf(tabWriter, "%v\t%v\t%v\n", pkg.Name, formatMiB(pkg.Size), pkg.Files)
+		}
+		fmt.Fprintf(tabWriter, "\ndir\tsize\n")
+		for _, dir := range report.Dirs {
+			fmt.Fprintf(tabWriter, "%v\t%v\n", dir.Path, formatMiB(dir.Size))
+		}
+		return tabWriter.Flush()
+	default:
+		return fmt.Errorf("%v is not a supported output format", format)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDuDir(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/usr/share/doc/git/copyright": "/usr/share",
+		"/usr/bin/git":                 "/usr/bin",
+		"/etc/motd":                    "/etc",
+		"/vmlinuz":                     "/",
+	} {
+		if actual := duDir(path, 2); actual != expected {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+	}
+}
+
+func TestComprtSizeReport(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	for _, dir := range []string{dpkgInfoDir, "usr/bin", "usr/share/doc/git", "etc"} {
+		if err := os.MkdirAll(filepath.Join(tempDirPath, dir), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, contents := range map[string]string{
+		"/usr/bin/git":                 strings.Repeat("a", 100),
+		"/usr/share/doc/git/copyright": strings.Repeat("a", 10),
+		"/usr/bin/curl":                strings.Repeat("a", 50),
+		"/etc/motd":                    strings.Repeat("a", 5),
+		// the lists themselves are owned by no package
+		dpkgInfoDir + "/git.list":        "/.\n/usr\n/usr/bin\n/usr/bin/git\n/usr/share/doc/git/copyright\n/usr/share/man/man1/git.1.gz\n",
+		dpkgInfoDir + "/curl:amd64.list": "/usr/bin/curl\n",
+	} {
+		if err := createTestFile(filepath.Join(tempDirPath, path), contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// hard links are only counted once
+	if err := os.Link(filepath.Join(tempDirPath, "/usr/bin/git"), filepath.Join(tempDirPath, "/usr/bin/git-receive-pack")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := comprtSizeReport(tempDirPath, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.sort(sizeSortKey); err != nil {
+		t.Fatal(err)
+	}
+
+	var listsSize int64 = int64(len("/.\n/usr\n/usr/bin\n/usr/bin/git\n/usr/share/doc/git/copyright\n/usr/share/man/man1/git.1.gz\n") + len("/usr/bin/curl\n"))
+	if expected := []packageSize{{Name: "git", Size: 110, Files: 2}, {Name: "curl:amd64", Size: 50, Files: 1}}; !reflect.DeepEqual(report.Packages, expected) {
+		t.Fatalf("expected: %+v, actual: %+v", expected, report.Packages)
+	}
+	if expected := []dirSize{{Path: "/usr/bin", Size: 150}, {Path: "/var/lib", Size: listsSize}, {Path: "/usr/share", Size: 10}, {Path: "/etc", Size: 5}}; !reflect.DeepEqual(report.Dirs, expected) {
+		t.Fatalf("expected: %+v, actual: %+v", expected, report.Dirs)
+	}
+	if report.Total != 165+listsSize {
+		t.Fatalf("expected: %v, actual: %v", 165+listsSize, report.Total)
+	} else if report.Unowned != 5+listsSize {
+		t.Fatalf("expected: %v, actual: %v", 5+listsSize, report.Unowned)
+	}
+
+	if err := report.sort(nameSortKey); err != nil {
+		t.Fatal(err)
+	} else if report.Packages[0].Name != "curl:amd64" || report.Dirs[0].Path != "/etc" {
+		t.Fatalf("expected the packages and dirs sorted by name, actual: %+v %+v", report.Packages, report.Dirs)
+	}
+	if err := report.sort("foo"); err == nil {
+		t.Fatal("an unknown sort key was accepted")
+	}
+}
+
+func TestWriteSizeReport(t *testing.T) {
+	var report sizeReport = sizeReport{
+		Total:    3 * 1024 * 1024,
+		Unowned:  1024 * 1024,
+		Packages: []packageSize{{Name: "git", Size: 2 * 1024 * 1024, Files: 2}},
+		Dirs:     []dirSize{{Path: "/usr/bin", Size: 3 * 1024 * 1024}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeSizeReport(&buf, textOutput, report); err != nil {
+		t.Fatal(err)
+	}
+	var expected string = "total:               3.0 MiB\n" +
+		"not from a package:  1.0 MiB\n" +
+		"\n" +
+		"package  size     files\n" +
+		"git      2.0 MiB  2\n" +
+		"\n" +
+		"dir       size\n" +
+		"/usr/bin  3.0 MiB\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := writeSizeReport(&buf, jsonOutput, report); err != nil {
+		t.Fatal(err)
+	}
+	var decoded sizeReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(decoded, report) {
+		t.Fatalf("expected %+v, got %+v", report, decoded)
+	}
+
+	if err := writeSizeReport(&buf, csvOutput, report); err == nil {
+		t.Fatal("an unsupported output format was accepted")
+	}
+}
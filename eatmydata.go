@@ -0,0 +1,67 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// The hooks mmdebstrap ships to run dpkg under eatmydata, for reference:
+// https://gitlab.mister-muffin.de/josch/mmdebstrap/src/branch/main/hooks/eatmydata
+const mmdebstrapEatmydataHookDir = "/usr/share/mmdebstrap/hooks/eatmydata"
+
+// Whether fsync is skipped (by eatmydata) while a comprt is created, set by
+// create's --eatmydata flag.
+var useEatmydata bool
+
+// Check that eatmydata can be used on the host, mmdebstrap uses its own hooks
+// instead.
+func checkEatmydata(rootless bool) error {
+	if rootless {
+		if _, err := os.Stat(mmdebstrapEatmydataHookDir); err != nil {
+			return errors.New("mmdebstrap's eatmydata hooks were not found, is mmdebstrap installed?")
+		}
+	} else if _, err := progExecutor.LookPath("eatmydata"); err != nil {
+		return errors.New("eatmydata was not found, install the eatmydata package")
+	}
+
+	return nil
+}
+
+// Wrap the command so it is ran under eatmydata, if eatmydata is used and is
+// installed. Chrooted into a comprt, eatmydata has to be installed in the comprt
+// (e.g. by listing it in the comprtinc file).
+func eatmydataCmdArr(cmdArr []string) []string {
+	if !useEatmydata {
+		return cmdArr
+	}
+
+	eatmydataPath, err := progExecutor.LookPath("eatmydata")
+	if err != nil {
+		return cmdArr
+	}
+
+	return append([]string{eatmydataPath}, cmdArr...)
+}
+
+// Get the mmdebstrap args that have mmdebstrap run dpkg under eatmydata.
+func eatmydataMmdebstrapArgs() []string {
+	if !useEatmydata {
+		return nil
+	}
+
+	return []string{"--hook-dir=" + mmdebstrapEatmydataHookDir}
+}
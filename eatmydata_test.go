@@ -0,0 +1,60 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEatmydataCmdArr(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	defer func(previous bool) { useEatmydata = previous }(useEatmydata)
+	var cmdArr []string = []string{"/usr/sbin/debootstrap", testCodeCame, "foo"}
+
+	useEatmydata = false
+	if wrapped := eatmydataCmdArr(cmdArr); !reflect.DeepEqual(wrapped, cmdArr) {
+		t.Fatalf("the command was wrapped without --eatmydata: %v", wrapped)
+	} else if args := eatmydataMmdebstrapArgs(); len(args) != 0 {
+		t.Fatalf("mmdebstrap was given the eatmydata hooks without --eatmydata: %v", args)
+	}
+
+	useEatmydata = true
+	t.Setenv("PATH", tempDirPath)
+	if wrapped := eatmydataCmdArr(cmdArr); !reflect.DeepEqual(wrapped, cmdArr) {
+		t.Fatalf("the command was wrapped without eatmydata being installed: %v", wrapped)
+	}
+
+	var eatmydataPath string = filepath.Join(tempDirPath, "eatmydata")
+	if err := createTestFile(eatmydataPath, "#!/bin/sh\nexec \"$@\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if wrapped := eatmydataCmdArr(cmdArr); !reflect.DeepEqual(wrapped, append([]string{eatmydataPath}, cmdArr...)) {
+		t.Fatalf("the command was not wrapped by eatmydata: %v", wrapped)
+	} else if err := checkEatmydata(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if args := eatmydataMmdebstrapArgs(); !reflect.DeepEqual(args, []string{"--hook-dir=" + mmdebstrapEatmydataHookDir}) {
+		t.Fatalf("mmdebstrap was not given the eatmydata hooks: %v", args)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The PATH commands ran in a comprt get, the same as su(1) gives root.
+const chrootPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Matches a line of an env file, the value may be empty.
+var reEnvFileLine = regexp.MustCompile(`^([a-zA-Z_]\w*)=(.*)$`)
+
+// Whether commands ran in a comprt inherit debcomprt's env as is (see
+// --preserve-env), instead of the env made by chrootEnv.
+var preserveEnv bool
+
+// The env vars of the host kept for commands ran in a comprt, if set. apt needs
+// the proxies to reach the mirrors.
+var chrootHostEnvVarNames = []string{
+	"TERM",
+	"http_proxy",
+	"https_proxy",
+	"ftp_proxy",
+	"no_proxy",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"FTP_PROXY",
+	"NO_PROXY",
+}
+
+// The names of the env vars set by setComprtEnvVar, in the order they were set.
+var comprtEnvVarNames []string
+
+// Set an env var that is also passed on to the commands ran in a comprt (e.g.
+// the alias env vars).
+func setComprtEnvVar(name, value string) {
+	os.Setenv(name, value)
+	if !stringInArr(name, &comprtEnvVarNames) {
+		comprtEnvVarNames = append(comprtEnvVarNames, name)
+	}
+}
+
+// Get the env commands ran in a comprt (e.g. the comprt config file) are ran
+// with, instead of the host's. The env is made up of PATH, HOME, LANG, the
+// host's TERM and proxies and the env vars set by setComprtEnvVar. With
+// --preserve-env, it is debcomprt's env as is.
+func chrootEnv() []string {
+	if preserveEnv {
+		return os.Environ()
+	}
+
+	var env []string = []string{"PATH=" + chrootPath, "HOME=/root", "LANG=C.UTF-8"}
+	for _, name := range append(append([]string{}, chrootHostEnvVarNames...), comprtEnvVarNames...) {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	return env
+}
+
+// Replace debcomprt's env with the env made by chrootEnv, for the commands ran
+// in a comprt to inherit. A func is returned to put back debcomprt's env.
+func enterChrootEnv() func() {
+	var hostEnv []string = os.Environ()
+	var env []string = chrootEnv()
+	os.Clearenv()
+	for _, envVar := range env {
+		parts := strings.SplitN(envVar, "=", 2)
+		os.Setenv(parts[0], parts[1])
+	}
+
+	return func() {
+		os.Clearenv()
+		for _, envVar := range hostEnv {
+			if parts := strings.SplitN(envVar, "=", 2); len(parts) == 2 {
+				os.Setenv(parts[0], parts[1])
+			}
+		}
+	}
+}
+
+// Read in an env file (in the dotenv format) and return the discovered env vars
+// in the KEY=VALUE form. Blank lines and lines starting with '#' are skipped. A
+// value may be wrapped in single or double quotes, which will be removed.
+func parseEnvFile(fPath string) ([]string, error) {
+	file, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var envVars []string
+	var lineNum int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNum += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		envVarArr := reEnvFileLine.FindStringSubmatch(line)
+		if envVarArr == nil {
+			return nil, fmt.Errorf("%v:%d: %v is not a properly formatted env var (KEY=VALUE)", fPath, lineNum, line)
+		}
+		envVarName, envVarValue := envVarArr[1], envVarArr[2]
+		if len(envVarValue) > 0 && (envVarValue[0] == '"' || envVarValue[0] == '\'') {
+			if len(envVarValue) < 2 || envVarValue[len(envVarValue)-1] != envVarValue[0] {
+				return nil, fmt.Errorf("%v:%d: the value of %v is missing its closing quote", fPath, lineNum, envVarName)
+			}
+			envVarValue = envVarValue[1 : len(envVarValue)-1]
+		}
+		envVars = append(envVars, envVarName+"="+envVarValue)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return envVars, nil
+}
+
+// Validate each env var is in the KEY=VALUE form.
+func validateEnvVars(envVars []string) error {
+	for _, envVar := range envVars {
+		if reFindEnvVar.FindStringIndex(envVar) == nil {
+			return fmt.Errorf("%v is not a properly formatted env var", envVar)
+		}
+	}
+
+	return nil
+}
+
+// Get the names of the env vars passed in (e.g. FOO=bar => FOO).
+func envVarNames(envVars []string) []string {
+	var names []string
+	for _, envVar := range envVars {
+		if i := strings.Index(envVar, "="); i > 0 {
+			names = append(names, envVar[:i])
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var envFilePath string = filepath.Join(tempDirPath, "env")
+	if err := createTestFile(envFilePath, `# a comment
+FOO=bar
+
+export BAR="baz qux"
+LANG='C.UTF-8'
+EMPTY=
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	envVars, err := parseEnvFile(envFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expectedEnvVars []string = []string{"FOO=bar", "BAR=baz qux", "LANG=C.UTF-8", "EMPTY="}
+	if !reflect.DeepEqual(envVars, expectedEnvVars) {
+		t.Fatalf("found the following env vars %v", envVars)
+	}
+
+	if names := envVarNames(envVars); !reflect.DeepEqual(names, []string{"FOO", "BAR", "LANG", "EMPTY"}) {
+		t.Fatalf("found the following env var names %v", names)
+	}
+}
+
+func TestParseEnvFileBadLine(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var envFilePath string = filepath.Join(tempDirPath, "env")
+	for _, contents := range []string{"FOO=bar\n1BAR=baz\n", "FOO=bar\nBAR=\"baz\n"} {
+		if err := createTestFile(envFilePath, contents); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := parseEnvFile(envFilePath); err == nil {
+			t.Fatal("a malformed env file was parsed without error")
+		} else if !strings.Contains(err.Error(), envFilePath+":2:") {
+			t.Fatalf("expected the error to name line 2, got %v", err)
+		}
+	}
+}
+
+func TestChrootEnv(t *testing.T) {
+	defer func(previous []string) { comprtEnvVarNames = previous }(comprtEnvVarNames)
+	defer os.Unsetenv("DEBCOMPRT_TEST_ALIAS_VAR")
+	t.Setenv("http_proxy", "http://192.0.2.1:3128")
+	t.Setenv("DEBCOMPRT_TEST_HOST_VAR", "foo")
+	setComprtEnvVar("DEBCOMPRT_TEST_ALIAS_VAR", "bar")
+
+	var env string = strings.Join(chrootEnv(), "\n") + "\n"
+	for _, expected := range []string{
+		"PATH=" + chrootPath,
+		"HOME=/root",
+		"http_proxy=http://192.0.2.1:3128",
+		"DEBCOMPRT_TEST_ALIAS_VAR=bar",
+	} {
+		if !strings.Contains(env, expected+"\n") {
+			t.Fatalf("%v is missing from the env: %v", expected, env)
+		}
+	}
+	if strings.Contains(env, "DEBCOMPRT_TEST_HOST_VAR") {
+		t.Fatalf("the host's env was inherited: %v", env)
+	}
+
+	defer func(previous bool) { preserveEnv = previous }(preserveEnv)
+	preserveEnv = true
+	if env := chrootEnv(); !stringInArr("DEBCOMPRT_TEST_HOST_VAR=foo", &env) {
+		t.Fatal("the host's env was not inherited with --preserve-env")
+	}
+}
+
+func TestEnterChrootEnv(t *testing.T) {
+	t.Setenv("DEBCOMPRT_TEST_HOST_VAR", "foo")
+
+	exitChrootEnv := enterChrootEnv()
+	if _, ok := os.LookupEnv("DEBCOMPRT_TEST_HOST_VAR"); ok {
+		exitChrootEnv()
+		t.Fatal("the host's env was kept while chrooted")
+	} else if os.Getenv("PATH") != chrootPath {
+		exitChrootEnv()
+		t.Fatalf("expected: %v, actual: %v", chrootPath, os.Getenv("PATH"))
+	}
+
+	exitChrootEnv()
+	if os.Getenv("DEBCOMPRT_TEST_HOST_VAR") != "foo" {
+		t.Fatal("the host's env was not put back")
+	}
+}
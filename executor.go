@@ -0,0 +1,129 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// A type that carries out what creating and chrooting into a comprt asks of the
+// host: running commands, mounting filesystems and changing the process's root
+// dir. Those need root and a debian host, so the tests swap in their own.
+type executor interface {
+	// Run the command and wait for it to exit, as cmd.Run does.
+	Run(cmd *exec.Cmd) error
+	// Run the command and get what it wrote to stdout, as cmd.Output does.
+	Output(cmd *exec.Cmd) ([]byte, error)
+	// Find the program in the PATH, as exec.LookPath does.
+	LookPath(file string) (string, error)
+	Mount(source, target, fsType string, flags uintptr, data string) error
+	Unmount(target string, flags int) error
+	// The mounts the process sees, as listed in /proc/self/mountinfo.
+	Mounts() ([]mountInfo, error)
+	// Change the process's root dir to the target, a func is returned to change
+	// it back. The process is left in the new root dir.
+	Chroot(target string) (func() error, error)
+	// The path the comprt's files are found at while chrooted into the comprt.
+	Root() string
+}
+
+// The executor debcomprt uses, the host's own unless a test swaps it out.
+var progExecutor executor = hostExecutor{}
+
+// An executor that carries out everything on the host itself.
+type hostExecutor struct{}
+
+func (hostExecutor) Run(cmd *exec.Cmd) error {
+	return cmd.Run()
+}
+
+func (hostExecutor) Output(cmd *exec.Cmd) ([]byte, error) {
+	return cmd.Output()
+}
+
+func (hostExecutor) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func (hostExecutor) Mount(source, target, fsType string, flags uintptr, data string) error {
+	return syscall.Mount(source, target, fsType, flags, data)
+}
+
+func (hostExecutor) Unmount(target string, flags int) error {
+	return syscall.Unmount(target, flags)
+}
+
+func (hostExecutor) Mounts() ([]mountInfo, error) {
+	return readMountInfo(procSelfMountInfo)
+}
+
+func (hostExecutor) Chroot(target string) (func() error, error) {
+	// Returning back to the host's root dir goes through a file descriptor opened
+	// before entering the chroot. For reference:
+	// https://devsidestory.com/exit-from-a-chroot-with-golang/
+	root, err := os.Open("/")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Chroot(target); err != nil {
+		root.Close()
+		return nil, err
+	}
+	if err := syscall.Chdir("/"); err != nil { // makes sh happy, otherwise getcwd() for sh fails
+		root.Close()
+		return nil, err
+	}
+
+	return func() error {
+		defer root.Close()
+		if err := root.Chdir(); err != nil {
+			return err
+		}
+
+		return syscall.Chroot(".")
+	}, nil
+}
+
+func (hostExecutor) Root() string {
+	return "/"
+}
+
+// Run the commands through progExecutor with the stdout of writeCmd piped into
+// the stdin of readCmd. The pipe is closed by debcomprt once each command is
+// done with it, that way readCmd sees the end of the output and writeCmd is not
+// left writing to a readCmd that failed.
+func runPipe(writeCmd, readCmd *exec.Cmd) error {
+	pipeReader, pipeWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	writeCmd.Stdout, readCmd.Stdin = pipeWriter, pipeReader
+
+	read := make(chan error, 1)
+	go func() {
+		read <- progExecutor.Run(readCmd)
+		pipeReader.Close()
+	}()
+	err = progExecutor.Run(writeCmd)
+	pipeWriter.Close()
+	if readErr := <-read; err == nil {
+		err = readErr
+	}
+
+	return err
+}
@@ -0,0 +1,279 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// An executor that runs nothing, it records the commands it is given and keeps
+// track of what would be mounted. That way creating and chrooting into a comprt
+// can be tested without root.
+type fakeExecutor struct {
+	cmds   [][]string
+	mounts []mountInfo
+	root   string
+}
+
+func (e *fakeExecutor) Run(cmd *exec.Cmd) error {
+	e.cmds = append(e.cmds, cmd.Args)
+	return nil
+}
+
+func (e *fakeExecutor) Output(cmd *exec.Cmd) ([]byte, error) {
+	e.cmds = append(e.cmds, cmd.Args)
+	return nil, nil
+}
+
+func (e *fakeExecutor) LookPath(file string) (string, error) {
+	return filepath.Join("/usr/bin", file), nil
+}
+
+func (e *fakeExecutor) Mount(source, target, fsType string, flags uintptr, data string) error {
+	// remounts and propagation changes are done on an existing mount
+	if flags&(syscall.MS_REMOUNT|syscall.MS_PRIVATE) == 0 {
+		e.mounts = append(e.mounts, mountInfo{mountPoint: target, fsType: fsType, source: source})
+	}
+	return nil
+}
+
+func (e *fakeExecutor) Unmount(target string, flags int) error {
+	for i := len(e.mounts) - 1; i >= 0; i-- {
+		if e.mounts[i].mountPoint == target {
+			e.mounts = append(e.mounts[:i], e.mounts[i+1:]...)
+			return nil
+		}
+	}
+	return syscall.EINVAL
+}
+
+func (e *fakeExecutor) Mounts() ([]mountInfo, error) {
+	return e.mounts, nil
+}
+
+func (e *fakeExecutor) Chroot(target string) (func() error, error) {
+	e.root = target
+	return func() error {
+		e.root = "/"
+		return nil
+	}, nil
+}
+
+func (e *fakeExecutor) Root() string {
+	return e.root
+}
+
+// Swap in a fake executor for the test, a func is returned to put back the
+// previous executor.
+func setupFakeExecutor(t *testing.T) (*fakeExecutor, func()) {
+	t.Helper()
+	var previous executor = progExecutor
+	fake := &fakeExecutor{root: "/"}
+	progExecutor = fake
+
+	return fake, func() { progExecutor = previous }
+}
+
+func TestChrootFakeExecutor(t *testing.T) {
+	fake, restore := setupFakeExecutor(t)
+	defer restore()
+
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	exitChroot, errs := Chroot(tempDirPath)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if fake.Root() != tempDirPath {
+		t.Fatalf("expected: %v, actual: %v", tempDirPath, fake.Root())
+	}
+	var mountPoints []string
+	for _, mount := range fake.mounts {
+		mountPoints = append(mountPoints, strings.TrimPrefix(mount.mountPoint, tempDirPath))
+	}
+	if expected := "/sys /proc /dev /dev/pts"; strings.Join(mountPoints, " ") != expected {
+		t.Fatalf("expected: %v, actual: %v", expected, mountPoints)
+	}
+
+	if err := exitChroot(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.mounts) != 0 {
+		t.Fatalf("%v were still mounted after exiting the chroot", fake.mounts)
+	} else if fake.Root() != "/" {
+		t.Fatal("was unable to exit chroot")
+	}
+}
+
+func TestRunInteractiveChrootFakeExecutor(t *testing.T) {
+	fake, restore := setupFakeExecutor(t)
+	defer restore()
+
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if errs := runInteractiveChroot(tempDirPath, "foo", nil, "/src", hostNamespace, hostNamespace, nil); errs != nil {
+		t.Fatal(errs)
+	}
+	if len(fake.cmds) != 1 {
+		t.Fatalf("expected a single command, got %v", fake.cmds)
+	}
+	if expected := "/usr/bin/su --shell /usr/bin/bash --login --command cd -- '/src' && exec /usr/bin/bash --login foo"; strings.Join(fake.cmds[0], " ") != expected {
+		t.Fatalf("expected: %v, actual: %v", expected, strings.Join(fake.cmds[0], " "))
+	}
+}
+
+func TestCreateComprtFakeExecutor(t *testing.T) {
+	fake, restore := setupFakeExecutor(t)
+	defer restore()
+
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var comprtConfigPath string = filepath.Join(tempDirPath, comprtConfigFile)
+	var target string = filepath.Join(tempDirPath, "target")
+	if err := createTestFile(comprtConfigPath, testComprtConfigFileContents); err != nil {
+		t.Fatal(err)
+	}
+	// what debootstrap would have laid down for the apt sources and policy-rc.d
+	for _, dir := range []string{"etc/apt", "usr/sbin"} {
+		if err := os.MkdirAll(filepath.Join(target, dir), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var debootstrapCmdArr []string = []string{"--variant=minbase", testCodeCame, target, "http://deb.debian.org/debian"}
+	var users []comprtUser = []comprtUser{{name: "foo", uid: defaultComprtUid, gid: defaultComprtUid}}
+	if errs := createComprt(createOptions{
+		comprtConfigPath:  comprtConfigPath,
+		target:            target,
+		alias:             noAlias,
+		users:             users,
+		quiet:             true,
+		debootstrapCmdArr: &debootstrapCmdArr,
+	}); errs != nil {
+		t.Fatal(errs)
+	}
+
+	var cmds []string
+	for _, cmd := range fake.cmds {
+		cmds = append(cmds, strings.Join(cmd, " "))
+	}
+	for _, expected := range []string{
+		"/usr/bin/debootstrap --variant=minbase " + testCodeCame + " " + target + " http://deb.debian.org/debian",
+		"/usr/bin/apt-get update",
+		"/usr/bin/sh /" + comprtConfigFile,
+	} {
+		if !stringInArr(expected, &cmds) {
+			t.Fatalf("expected %q in %q", expected, cmds)
+		}
+	}
+	var usersSetup []string
+	for _, setupCmdArr := range usersSetupCmdArrs(users, noAlias) {
+		usersSetup = append(usersSetup, strings.Join(setupCmdArr, " "))
+	}
+	if len(usersSetup) == 0 || len(cmds) < len(usersSetup) || strings.Join(cmds[len(cmds)-len(usersSetup):], "\n") != strings.Join(usersSetup, "\n") {
+		t.Fatalf("expected the users to be setup last with %q, got %q", usersSetup, cmds)
+	}
+	if len(fake.mounts) != 0 {
+		t.Fatalf("%v were still mounted after creating the comprt", fake.mounts)
+	}
+	if !stageDone(target, userDoneStage) {
+		t.Fatal("the comprt's stages were not marked in the comprt")
+	}
+}
+
+func TestMountsFakeExecutor(t *testing.T) {
+	fake, restore := setupFakeExecutor(t)
+	defer restore()
+
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	mergedDir, unMountOverlay, err := mountEphemeralOverlay(tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.mounts) != 2 || fake.mounts[1].mountPoint != mergedDir || fake.mounts[1].fsType != "overlay" {
+		t.Fatalf("expected a tmpfs with the overlay mounted on it, got %v", fake.mounts)
+	}
+	// nothing was really mounted, so the overlay's dirs are left where the tmpfs
+	// would have been
+	for _, dir := range []string{"upper", "work", "merged"} {
+		if err := os.Remove(filepath.Join(filepath.Dir(mergedDir), dir)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := unMountOverlay(); err != nil {
+		t.Fatal(err)
+	} else if len(fake.mounts) != 0 {
+		t.Fatalf("%v were still mounted after unmounting the overlay", fake.mounts)
+	}
+
+	fake.mounts = []mountInfo{
+		{mountPoint: filepath.Join(tempDirPath, "foo/proc")},
+		{mountPoint: filepath.Join(tempDirPath, "bar/proc")},
+	}
+	unMounted, err := unMountStaleMounts([]string{filepath.Join(tempDirPath, "foo")}, append([]mountInfo{}, fake.mounts...))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(unMounted) != 1 || unMounted[0] != filepath.Join(tempDirPath, "foo/proc") {
+		t.Fatalf("expected: %v, actual: %v", filepath.Join(tempDirPath, "foo/proc"), unMounted)
+	} else if len(fake.mounts) != 1 {
+		t.Fatalf("expected only the stale mount to be unmounted, got %v", fake.mounts)
+	}
+}
+
+func TestHelperCommandsFakeExecutor(t *testing.T) {
+	fake, restore := setupFakeExecutor(t)
+	defer restore()
+
+	if err := runAnsiblePlaybooks([]ansiblePlaybook{{Playbook: "/site.yml"}}, "/srv/foo", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyComprt("/srv/foo", "/srv/bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSigningKey("foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is ran on the host, each command goes through the executor
+	var programs []string
+	for _, cmd := range fake.cmds {
+		programs = append(programs, filepath.Base(cmd[0]))
+	}
+	if expected := ansiblePlaybookProgram + " cp gpg"; strings.Join(programs, " ") != expected {
+		t.Fatalf("expected: %v, actual: %v", expected, programs)
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultExportFormat = "tar"
+	lxdExportFormat     = "lxd"
+	dockerExportFormat  = "docker"
+
+	exportRootfsName = "rootfs.tar"
+	lxdMetadataName  = "metadata.tar"
+	lxdMetadataFile  = "metadata.yaml"
+)
+
+// Mappings of debian's architecture names to the architecture names LXD uses
+// (the kernel's), for reference:
+// https://github.com/lxc/lxd/blob/master/shared/osarch/architectures.go
+var lxdArchMappings = map[string]string{
+	"amd64":    "x86_64",
+	"arm64":    "aarch64",
+	"armhf":    "armv7l",
+	"i386":     "i686",
+	"mips64el": "mips64",
+	"ppc64el":  "ppc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// The container engines a comprt can be imported into, in the order they are
+// looked for when one is not picked.
+var containerEngines = []string{"docker", "podman"}
+
+// A type used to store how a comprt is to be exported.
+type exportOptions struct {
+	// The dir the archives are written into, and the codec they are compressed
+	// with.
+	dir   string
+	codec codec
+	// The container engine (e.g. podman) the comprt is imported into, along with
+	// the tags and labels the image is given.
+	engine string
+	tags   []string
+	labels map[string]string
+}
+
+// A type that exports a comprt into something another tool (e.g. LXD) imports.
+type exporter interface {
+	// The name used to select the exporter (e.g. --format lxd).
+	Name() string
+	// Export the comprt, returns what was exported (e.g. the paths of the
+	// archives written).
+	Export(target string, opts exportOptions) ([]string, error)
+}
+
+// Mappings of export formats to their respective exporter.
+var exporters = map[string]exporter{}
+
+func init() {
+	registerExporter(tarExporter{})
+	registerExporter(lxdExporter{})
+	registerExporter(dockerExporter{})
+	registerExporter(pbuilderExporter{})
+}
+
+// Add the exporter to the registry of exporters.
+func registerExporter(e exporter) {
+	exporters[e.Name()] = e
+}
+
+// Get the exporter by its format.
+func getExporter(format string) (exporter, error) {
+	e, ok := exporters[format]
+	if !ok {
+		return nil, fmt.Errorf("%v is not a supported export format, use one of: %v", format, strings.Join(exportFormats(), ", "))
+	}
+
+	return e, nil
+}
+
+// Get the formats of all the exporters registered.
+func exportFormats() []string {
+	var formats []string
+	for format := range exporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	return formats
+}
+
+// Write an archive compressed with the codec to the path, what the archive
+// contains is written by write. The archive is written to a temp file first, so
+// a failed export never leaves a partial archive behind.
+func writeArchive(path string, c codec, write func(w io.Writer) error) error {
+	archiveFile, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, ModeFile|(OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path + ".tmp")
+	defer archiveFile.Close()
+
+	w, err := c.NewWriter(archiveFile)
+	if err != nil {
+		return err
+	}
+	if err := write(w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := archiveFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// Write the comprt's root filesystem as an archive into the dir.
+func exportRootfs(target, dir string, c codec) (string, error) {
+	var rootfsPath string = filepath.Join(dir, exportRootfsName+c.Ext())
+	if err := writeArchive(rootfsPath, c, func(w io.Writer) error {
+		return writeExportTar(target, w)
+	}); err != nil {
+		return "", err
+	}
+
+	return rootfsPath, nil
+}
+
+// An exporter that writes the comprt's root filesystem as is.
+type tarExporter struct{}
+
+func (tarExporter) Name() string { return defaultExportFormat }
+
+func (tarExporter) Export(target string, opts exportOptions) ([]string, error) {
+	rootfsPath, err := exportRootfs(target, opts.dir, opts.codec)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{rootfsPath}, nil
+}
+
+// An exporter that writes the comprt as a LXD split image, a metadata archive
+// and a root filesystem archive, for reference:
+// https://linuxcontainers.org/lxd/docs/master/image-handling/
+type lxdExporter struct{}
+
+func (lxdExporter) Name() string { return lxdExportFormat }
+
+func (lxdExporter) Export(target string, opts exportOptions) ([]string, error) {
+	metadata, err := getComprtMetadata(target)
+	if err != nil {
+		return nil, err
+	}
+	imageMetadata, err := lxdImageMetadata(*metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	modTime, err := exportModTime()
+	if err != nil {
+		return nil, err
+	}
+
+	var metadataPath string = filepath.Join(opts.dir, lxdMetadataName+opts.codec.Ext())
+	if err := writeArchive(metadataPath, opts.codec, func(w io.Writer) error {
+		tarW := tar.NewWriter(w)
+		if err := tarW.WriteHeader(&tar.Header{
+			Name:    lxdMetadataFile,
+			Mode:    int64(OS_USER_R | OS_USER_W | OS_GROUP_R | OS_OTH_R),
+			Size:    int64(len(imageMetadata)),
+			ModTime: modTime,
+		}); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tarW, imageMetadata); err != nil {
+			return err
+		}
+		return tarW.Close()
+	}); err != nil {
+		return nil, err
+	}
+
+	rootfsPath, err := exportRootfs(target, opts.dir, opts.codec)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{metadataPath, rootfsPath}, nil
+}
+
+// Generate the metadata.yaml of a LXD image of the comprt. The yaml is written
+// out by hand, its strings are quoted the same as json's (which yaml accepts).
+func lxdImageMetadata(metadata comprtMetadata) (string, error) {
+	lxdArch, ok := lxdArchMappings[metadata.Arch]
+	if !ok {
+		return "", fmt.Errorf("LXD does not support the %v architecture", metadata.Arch)
+	}
+
+	var osName string = "debian"
+	if isUbuntuCodename(metadata.CodeName) {
+		osName = "ubuntu"
+	}
+	var created time.Time = metadata.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "architecture: %v\n", strconv.Quote(lxdArch))
+	fmt.Fprintf(&sb, "creation_date: %v\n", created.Unix())
+	fmt.Fprintf(&sb, "properties:\n")
+	fmt.Fprintf(&sb, "  architecture: %v\n", strconv.Quote(metadata.Arch))
+	fmt.Fprintf(&sb, "  description: %v\n", strconv.Quote(fmt.Sprintf("%v %v %v (%v %v)", osName, metadata.CodeName, metadata.Arch, progname, progVersion)))
+	fmt.Fprintf(&sb, "  os: %v\n", strconv.Quote(osName))
+	fmt.Fprintf(&sb, "  release: %v\n", strconv.Quote(metadata.CodeName))
+	fmt.Fprintf(&sb, "templates: {}\n")
+
+	return sb.String(), nil
+}
+
+// Import the archives of a LXD export into LXD's image store, with the alias
+// (if any).
+func lxdImportImage(paths []string, alias string) error {
+	lxcPath, err := progExecutor.LookPath("lxc")
+	if err != nil {
+		return err
+	}
+
+	var args []string = append([]string{"image", "import"}, paths...)
+	if alias != "" {
+		args = append(args, "--alias", alias)
+	}
+	lxcCmd := exec.Command(lxcPath, args...)
+	traceCommand(lxcCmd)
+	lxcCmd.Stdout = os.Stdout
+	lxcCmd.Stderr = os.Stderr
+	return progExecutor.Run(lxcCmd)
+}
+
+// Find the container engine by its name, or the first of the container engines
+// installed if no name is given.
+func findContainerEngine(name string) (string, error) {
+	if name != "" {
+		return progExecutor.LookPath(name)
+	}
+
+	for _, engine := range containerEngines {
+		if enginePath, err := progExecutor.LookPath(engine); err == nil {
+			return enginePath, nil
+		}
+	}
+	return "", fmt.Errorf("none of %v are installed", strings.Join(containerEngines, ", "))
+}
+
+// Get the args of a container engine's import that import a tar stream from
+// stdin as the image tagged with the tag, along with the labels.
+func containerImportArgs(tag string, labels map[string]string) []string {
+	var keys []string
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string = []string{"import"}
+	for _, key := range keys {
+		args = append(args, "--change", "LABEL "+key+"="+strconv.Quote(labels[key]))
+	}
+	return append(args, "-", tag)
+}
+
+// An exporter that streams the comprt's root filesystem into a container
+// engine (docker or podman) as an image. Nothing is written to the disk by
+// debcomprt itself.
+type dockerExporter struct{}
+
+func (dockerExporter) Name() string { return dockerExportFormat }
+
+func (dockerExporter) Export(target string, opts exportOptions) ([]string, error) {
+	if len(opts.tags) == 0 {
+		return nil, errors.New("a tag is needed to import the comprt into a container engine")
+	}
+	enginePath, err := findContainerEngine(opts.engine)
+	if err != nil {
+		return nil, err
+	}
+
+	importCmd := exec.Command(enginePath, containerImportArgs(opts.tags[0], opts.labels)...)
+	traceCommand(importCmd)
+	importCmd.Stdout = io.Discard
+	importCmd.Stderr = os.Stderr
+	pipeReader, pipeWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	importCmd.Stdin = pipeReader
+	imported := make(chan error, 1)
+	go func() {
+		imported <- progExecutor.Run(importCmd)
+		pipeReader.Close()
+	}()
+
+	// the engine is always waited on, even if the tar failed part way through
+	writeErr := writeExportTar(target, pipeWriter)
+	pipeWriter.Close()
+	if err := <-imported; err != nil {
+		return nil, err
+	} else if writeErr != nil {
+		return nil, writeErr
+	}
+
+	for _, tag := range opts.tags[1:] {
+		tagCmd := exec.Command(enginePath, "tag", opts.tags[0], tag)
+		traceCommand(tagCmd)
+		tagCmd.Stderr = os.Stderr
+		if err := progExecutor.Run(tagCmd); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts.tags, nil
+}
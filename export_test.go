@@ -0,0 +1,211 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetExporter(t *testing.T) {
+	for _, format := range []string{defaultExportFormat, lxdExportFormat, dockerExportFormat, pbuilderExportFormat} {
+		if e, err := getExporter(format); err != nil {
+			t.Fatal(err)
+		} else if e.Name() != format {
+			t.Fatalf("expected: %v, actual: %v", format, e.Name())
+		}
+	}
+
+	if _, err := getExporter("foo"); err == nil {
+		t.Fatal("an unknown export format was accepted")
+	}
+}
+
+func TestLxdImageMetadata(t *testing.T) {
+	created := time.Date(2021, time.October, 1, 0, 0, 0, 0, time.UTC)
+	imageMetadata, err := lxdImageMetadata(comprtMetadata{CodeName: testCodeCame, Arch: "arm64", Created: created})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		`architecture: "aarch64"`,
+		"creation_date: 1633046400",
+		`  architecture: "arm64"`,
+		`  os: "debian"`,
+		`  release: "` + testCodeCame + `"`,
+		"templates: {}",
+	} {
+		if !strings.Contains(imageMetadata, line+"\n") {
+			t.Fatalf("%q is missing from:\n%v", line, imageMetadata)
+		}
+	}
+
+	if _, err := lxdImageMetadata(comprtMetadata{CodeName: testCodeCame, Arch: "foo"}); err == nil {
+		t.Fatal("an architecture LXD does not support was accepted")
+	}
+}
+
+func TestLxdExporterExport(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	target := filepath.Join(tempDirPath, "foo")
+	if err := os.Mkdir(target, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeComprtMetadata(target, comprtMetadata{CodeName: testCodeCame, Arch: "amd64", Created: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(tempDirPath, "dest")
+	if err := os.Mkdir(dest, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := getCodec(defaultCodecName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := lxdExporter{}.Export(target, exportOptions{dir: dest, codec: c})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{filepath.Join(dest, lxdMetadataName+c.Ext()), filepath.Join(dest, exportRootfsName+c.Ext())}
+	if len(paths) != len(expected) || paths[0] != expected[0] || paths[1] != expected[1] {
+		t.Fatalf("expected: %v, actual: %v", expected, paths)
+	}
+
+	metadataFile, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer metadataFile.Close()
+	r, err := c.NewReader(metadataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	tarR := tar.NewReader(r)
+	header, err := tarR.Next()
+	if err != nil {
+		t.Fatal(err)
+	} else if header.Name != lxdMetadataFile {
+		t.Fatalf("expected: %v, actual: %v", lxdMetadataFile, header.Name)
+	}
+	contents, err := io.ReadAll(tarR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(contents), `architecture: "x86_64"`) {
+		t.Fatalf("unexpected %v:\n%s", lxdMetadataFile, contents)
+	}
+
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("temp files were left behind in %v", dest)
+	}
+}
+
+func TestContainerImportArgs(t *testing.T) {
+	expected := []string{"import", "--change", `LABEL purpose="ci"`, "--change", `LABEL team="infra"`, "-", "foo:bar"}
+	actual := containerImportArgs("foo:bar", map[string]string{"team": "infra", "purpose": "ci"})
+	if strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestDockerExporterExport(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	target := filepath.Join(tempDirPath, "foo")
+	if err := os.Mkdir(target, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "bar"), []byte("bar"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// a stand-in for docker that records what it was ran with
+	binDir := filepath.Join(tempDirPath, "bin")
+	if err := os.Mkdir(binDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	argsPath, tarPath := filepath.Join(tempDirPath, "args"), filepath.Join(tempDirPath, "import.tar")
+	if err := os.WriteFile(filepath.Join(binDir, "docker"), []byte(
+		"#!/bin/sh\necho \"$*\" >> "+argsPath+"\nif [ \"$1\" = import ]; then cat > "+tarPath+"; fi\n",
+	), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	exported, err := dockerExporter{}.Export(target, exportOptions{engine: "docker", tags: []string{"foo:bar", "foo:latest"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 2 {
+		t.Fatalf("expected both tags, actual: %v", exported)
+	}
+
+	args, err := os.ReadFile(argsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "import - foo:bar\ntag foo:bar foo:latest\n"; string(args) != expected {
+		t.Fatalf("expected: %q, actual: %q", expected, args)
+	}
+
+	tarFile, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tarFile.Close()
+	var names []string
+	tarR := tar.NewReader(tarFile)
+	for {
+		header, err := tarR.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+	if !stringInArr("./bar", &names) {
+		t.Fatalf("the comprt was not streamed into the import, actual: %v", names)
+	}
+
+	if _, err := (dockerExporter{}).Export(target, exportOptions{engine: "docker"}); err == nil {
+		t.Fatal("an import without a tag was accepted")
+	}
+}
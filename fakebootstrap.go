@@ -0,0 +1,248 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	debootstrapBackend   = "debootstrap"
+	fakeBootstrapBackend = "fake"
+
+	// Setting this to a non-empty value has create use the fake bootstrap
+	// backend, as if by --backend fake.
+	fakeBootstrapEnvVar = "DEBCOMPRT_FAKE_BOOTSTRAP"
+)
+
+// Whether comprts are created from a skeleton rootfs instead of by debootstrap,
+// set by create's hidden --backend flag. Meant for testing debcomprt itself
+// (e.g. in CI), the comprt has no packages.
+var fakeBootstrap bool
+
+// The host's programs copied into the skeleton rootfs, enough to run a comprt
+// config file and setup the comprt's users. Those the host lacks are left out,
+// except for sh.
+var skeletonPrograms = []string{
+	"sh",
+	"bash",
+	"cat",
+	"chmod",
+	"chown",
+	"cp",
+	"cut",
+	"env",
+	"getent",
+	"groupadd",
+	"ln",
+	"ls",
+	"mkdir",
+	"mv",
+	"rm",
+	"touch",
+	"useradd",
+	"usermod",
+	"chpasswd",
+	"visudo",
+}
+
+// The programs that manage packages, a skeleton rootfs has no packages so they
+// are laid down as stubs that do nothing.
+var skeletonStubPrograms = []string{
+	"apt-get",
+	"dpkg",
+	"dpkg-divert",
+	"dpkg-query",
+}
+
+var skeletonStub = []byte(`#!/bin/sh
+# Laid down by debcomprt's fake bootstrap, there are no packages to manage.
+exit 0
+`)
+
+// eatmydata is only passed through, the command after it is still ran.
+var skeletonEatmydataStub = []byte(`#!/bin/sh
+# Laid down by debcomprt's fake bootstrap.
+exec "$@"
+`)
+
+// The files of the skeleton rootfs, keyed by their path in the comprt.
+var skeletonFiles = map[string]string{
+	"/etc/passwd":          "root:x:0:0:root:/root:/bin/sh\n",
+	"/etc/group":           fmt.Sprintf("root:x:0:\ntty:x:%v:\n", ttyGid),
+	"/etc/shadow":          "root:*::0:99999:7:::\n",
+	"/etc/gshadow":         "root:*::\ntty:*::\n",
+	"/etc/nsswitch.conf":   "passwd: files\ngroup: files\nshadow: files\n",
+	"/etc/os-release":      "PRETTY_NAME=\"debcomprt fake bootstrap\"\nID=debian\n",
+	"/var/lib/dpkg/status": "",
+}
+
+// Lay down a minimal rootfs in the target, in place of what debootstrap would
+// bootstrap. The rootfs is merged /usr and has the host's sh (along with the
+// other skeleton programs and the libraries they need), stubs for the package
+// management programs and a root user.
+func layDownSkeletonRootfs(target string) error {
+	for _, dir := range []string{
+		"/dev",
+		"/etc/apt/apt.conf.d",
+		"/etc/apt/keyrings",
+		"/etc/apt/preferences.d",
+		"/etc/apt/sources.list.d",
+		"/etc/apt/trusted.gpg.d",
+		"/etc/skel",
+		"/home",
+		"/proc",
+		"/run",
+		"/sys",
+		"/usr/bin",
+		"/usr/lib",
+		"/usr/lib64",
+		"/usr/local/bin",
+		"/usr/sbin",
+		"/usr/share/keyrings",
+		"/var/cache/apt",
+		"/var/lib/dpkg/info",
+		"/var/log",
+	} {
+		if err := os.MkdirAll(filepath.Join(target, dir), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(target, "/root"), os.ModeDir|OS_USER_R|OS_USER_W|OS_USER_X); err != nil {
+		return err
+	}
+	for _, dir := range []string{"/tmp", "/var/tmp"} {
+		if err := os.MkdirAll(filepath.Join(target, dir), os.ModePerm); err != nil {
+			return err
+		}
+		// sticky and writable by everyone, the same as the host's
+		if err := os.Chmod(filepath.Join(target, dir), os.ModeSticky|os.ModePerm); err != nil {
+			return err
+		}
+	}
+	for _, dir := range []string{"bin", "lib", "lib64", "sbin"} {
+		if err := os.Symlink(filepath.Join("usr", dir), filepath.Join(target, dir)); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+
+	for path, contents := range skeletonFiles {
+		if err := os.WriteFile(filepath.Join(target, path), []byte(contents), OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R); err != nil {
+			return err
+		}
+	}
+	// useradd reads its defaults (e.g. the range of uids) from login.defs
+	if err := copySkeletonFile("/etc/login.defs", target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for _, program := range skeletonPrograms {
+		path, err := hostProgramPath(program)
+		if errors.Is(err, fs.ErrNotExist) && program != "sh" {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := copySkeletonProgram(path, target); err != nil {
+			return err
+		}
+	}
+	for _, program := range skeletonStubPrograms {
+		if err := os.WriteFile(filepath.Join(target, "/usr/bin", program), skeletonStub, ModeFile|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(target, "/usr/bin/eatmydata"), skeletonEatmydataStub, ModeFile|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Find the program on the host in the same dirs the comprt's PATH has, that way
+// programs in sbin are found even if the host's PATH lacks them.
+func hostProgramPath(program string) (string, error) {
+	for _, dir := range filepath.SplitList(chrootPath) {
+		var path string = filepath.Join(dir, program)
+		if fileInfo, err := os.Stat(path); err == nil && fileInfo.Mode().IsRegular() && fileInfo.Mode().Perm()&(OS_USER_X|OS_GROUP_X|OS_OTH_X) != 0 {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("%v is not on the host: %w", program, fs.ErrNotExist)
+}
+
+// Copy the host's program into the same path in the comprt, along with the
+// libraries it needs.
+func copySkeletonProgram(path, target string) error {
+	if err := copySkeletonFile(path, target); err != nil {
+		return err
+	}
+
+	// a statically linked program has no libraries, ldd fails for it
+	out, err := progExecutor.Output(exec.Command("ldd", path))
+	if err != nil {
+		return nil
+	}
+	for _, lib := range lddLibraries(out) {
+		if err := copySkeletonFile(lib, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Copy the host's file (what it points to, if a symlink) into the same path in
+// the comprt. A file already in the comprt is left be.
+func copySkeletonFile(path, target string) error {
+	hostPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	var dest string = filepath.Join(target, path)
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return err
+	}
+	if err := copy(hostPath, dest); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Get the paths of the libraries listed in ldd's output, e.g.
+// 'libc.so.6 => /lib/x86_64-linux-gnu/libc.so.6 (0x00007f...)' and the dynamic
+// linker's '/lib64/ld-linux-x86-64.so.2 (0x00007f...)'.
+func lddLibraries(out []byte) []string {
+	var libs []string
+	for _, line := range strings.Split(string(out), "\n") {
+		for _, field := range strings.Fields(line) {
+			if strings.HasPrefix(field, "/") {
+				libs = append(libs, field)
+				break
+			}
+		}
+	}
+
+	return libs
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLddLibraries(t *testing.T) {
+	var out string = "\tlinux-vdso.so.1 (0x00007ffd)\n" +
+		"\tlibc.so.6 => /lib/x86_64-linux-gnu/libc.so.6 (0x00007f12)\n" +
+		"\t/lib64/ld-linux-x86-64.so.2 (0x00007f34)\n"
+	if expected := "/lib/x86_64-linux-gnu/libc.so.6 /lib64/ld-linux-x86-64.so.2"; strings.Join(lddLibraries([]byte(out)), " ") != expected {
+		t.Fatalf("expected: %v, actual: %v", expected, lddLibraries([]byte(out)))
+	}
+}
+
+func TestLayDownSkeletonRootfs(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if err := layDownSkeletonRootfs(tempDirPath); err != nil {
+		t.Fatal(err)
+	}
+
+	shPath, err := hostProgramPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{shPath, "/usr/bin/apt-get", "/usr/bin/dpkg-query", "/usr/bin/eatmydata"} {
+		if fileInfo, err := os.Stat(filepath.Join(tempDirPath, path)); err != nil {
+			t.Fatal(err)
+		} else if fileInfo.Mode().Perm()&OS_USER_X == 0 {
+			t.Fatalf("%v is not executable", path)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(tempDirPath, "bin")); err != nil {
+		t.Fatal(err)
+	} else if link != "usr/bin" {
+		t.Fatalf("expected: %v, actual: %v", "usr/bin", link)
+	}
+	if loginName, err := comprtUserName(tempDirPath, rootUid); err != nil {
+		t.Fatal(err)
+	} else if loginName != "root" {
+		t.Fatalf("expected: %v, actual: %v", "root", loginName)
+	}
+
+	// laying down the skeleton again leaves what is there be
+	if err := layDownSkeletonRootfs(tempDirPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateComprtFakeBootstrap(t *testing.T) {
+	fake, restore := setupFakeExecutor(t)
+	defer restore()
+	defer func(previous bool) { fakeBootstrap = previous }(fakeBootstrap)
+	fakeBootstrap = true
+
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var comprtConfigPath string = filepath.Join(tempDirPath, comprtConfigFile)
+	var target string = filepath.Join(tempDirPath, "target")
+	if err := createTestFile(comprtConfigPath, testComprtConfigFileContents); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(target, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	var debootstrapCmdArr []string = []string{testCodeCame, target, "http://deb.debian.org/debian"}
+	var users []comprtUser = []comprtUser{{name: "foo", uid: defaultComprtUid, gid: defaultComprtUid}}
+	if errs := createComprt(createOptions{
+		comprtConfigPath:  comprtConfigPath,
+		target:            target,
+		alias:             noAlias,
+		users:             users,
+		quiet:             true,
+		debootstrapCmdArr: &debootstrapCmdArr,
+	}); errs != nil {
+		t.Fatal(errs)
+	}
+
+	for _, cmd := range fake.cmds {
+		if filepath.Base(cmd[0]) == debootstrapBackend {
+			t.Fatalf("debootstrap was ran with the fake bootstrap backend: %v", cmd)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(target, "/usr/bin/apt-get")); err != nil {
+		t.Fatalf("the skeleton rootfs was not laid down: %v", err)
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// How long a temp dir of debcomprt's is left alone, a younger one may still
+	// be in use.
+	gcTempDirAge = 24 * time.Hour
+	// The caches that are not written to within this long are pruned by default.
+	defaultGcCacheAge = 30 * 24 * time.Hour
+)
+
+// A type used to describe something in debcomprt's data dir (or the temp dir)
+// that is no longer needed.
+type gcItem struct {
+	path   string
+	reason string
+	// The apparent size freed by removing it.
+	size   int64
+	remove func() error
+}
+
+// Get the time the newest file in the dir was modified.
+func newestModTime(dirPath string) (time.Time, error) {
+	var newest time.Time
+	err := filepath.WalkDir(dirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if fileInfo.ModTime().After(newest) {
+			newest = fileInfo.ModTime()
+		}
+		return nil
+	})
+
+	return newest, err
+}
+
+// Get an item that removes the path when collected.
+func newGcItem(path, reason string) (gcItem, error) {
+	size, err := comprtSize(path)
+	if err != nil {
+		return gcItem{}, err
+	}
+
+	return gcItem{path: path, reason: reason, size: size, remove: func() error { return os.RemoveAll(path) }}, nil
+}
+
+// Find the caches that have not been written to within maxAge, a maxAge of 0
+// keeps every cache.
+func findOldCaches(maxAge time.Duration, now time.Time) ([]gcItem, error) {
+	if maxAge == 0 {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(progDataDir, cachesDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var items []gcItem
+	for _, entry := range entries {
+		var cachePath string = filepath.Join(progDataDir, cachesDir, entry.Name())
+		modTime, err := newestModTime(cachePath)
+		if err != nil {
+			return nil, err
+		}
+		if now.Sub(modTime) < maxAge {
+			continue
+		}
+
+		item, err := newGcItem(cachePath, fmt.Sprintf("cache not used since %v", modTime.Format("2006-01-02")))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Find the clones of alias sources that are no longer configured.
+func findStaleAliasSources(sources []aliasSource) ([]gcItem, error) {
+	entries, err := os.ReadDir(filepath.Join(progDataDir, aliasSourcesDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var configured map[string]bool = make(map[string]bool)
+	for _, source := range sources {
+		configured[source.repoPath()] = true
+	}
+
+	var items []gcItem
+	for _, entry := range entries {
+		var repoPath string = filepath.Join(progDataDir, aliasSourcesDir, entry.Name())
+		if configured[repoPath] {
+			continue
+		}
+
+		item, err := newGcItem(repoPath, "alias source no longer configured")
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// The temp dirs made by makeTempDir, each is kept open (and locked) until
+// debcomprt exits.
+var tempDirLocks []*os.File
+
+// Make a temp dir as os.MkdirTemp does, the dir is locked until debcomprt exits
+// so gc can tell it is still in use. Mounts made under the dir in debcomprt's
+// private mount namespace (e.g. an --ephemeral overlay) cannot be seen by gc.
+func makeTempDir(dir, pattern string) (string, error) {
+	dirPath, err := os.MkdirTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+
+	dirFd, err := os.Open(dirPath)
+	if err != nil {
+		os.Remove(dirPath)
+		return "", err
+	}
+	if err := syscall.Flock(int(dirFd.Fd()), syscall.LOCK_SH); err != nil {
+		dirFd.Close()
+		os.Remove(dirPath)
+		return "", err
+	}
+	tempDirLocks = append(tempDirLocks, dirFd)
+
+	return dirPath, nil
+}
+
+// Whether the temp dir is locked by a debcomprt that is still running (see
+// makeTempDir).
+func tempDirLocked(dirPath string) (bool, error) {
+	dirFd, err := os.Open(dirPath)
+	if err != nil {
+		return false, err
+	}
+	defer dirFd.Close()
+
+	if err := syscall.Flock(int(dirFd.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); errors.Is(err, syscall.EWOULDBLOCK) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// Find the temp dirs left behind by runs (or tests) of debcomprt that crashed.
+// Dirs that are locked or have anything mounted under them are still in use
+// (e.g. a build dir).
+func findOrphanedTempDirs(tempDirPath string, mounts []mountInfo, now time.Time) ([]gcItem, error) {
+	entries, err := os.ReadDir(tempDirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []gcItem
+	for _, entry := range entries {
+		if !entry.IsDir() || !(strings.HasPrefix(entry.Name(), progname) || strings.HasPrefix(entry.Name(), "_"+progname)) {
+			continue
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		var dirPath string = filepath.Join(tempDirPath, entry.Name())
+		if now.Sub(fileInfo.ModTime()) < gcTempDirAge || len(mountsUnder(dirPath, mounts)) > 0 {
+			continue
+		}
+		if locked, err := tempDirLocked(dirPath); err != nil {
+			return nil, err
+		} else if locked {
+			continue
+		}
+
+		item, err := newGcItem(dirPath, "orphaned temp dir")
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Find the registry entries of comprts that no longer exist, along with the
+// package states recorded for comprts that no longer exist.
+func findStaleRegistryEntries(entries []registryEntry) ([]gcItem, error) {
+	var items []gcItem
+	var registered map[string]bool = make(map[string]bool)
+	for _, entry := range entries {
+		if _, err := os.Stat(entry.Target); err == nil {
+			registered[entry.Target] = true
+			continue
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		var target string = entry.Target
+		items = append(items, gcItem{
+			path:   target,
+			reason: "registered comprt no longer exists",
+			remove: func() error { return unregisterComprt(target) },
+		})
+	}
+
+	stateEntries, err := os.ReadDir(filepath.Join(progDataDir, packagesDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return items, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, stateEntry := range stateEntries {
+		target, err := url.PathUnescape(strings.TrimSuffix(stateEntry.Name(), ".json"))
+		if err != nil || registered[target] {
+			continue
+		}
+		if _, err := os.Stat(target); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		item, err := newGcItem(filepath.Join(progDataDir, packagesDir, stateEntry.Name()), "package state of a comprt that no longer exists")
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Find what debcomprt no longer needs, in its data dir and the temp dir.
+func findGarbage(maxCacheAge time.Duration, now time.Time) ([]gcItem, error) {
+	sources, err := loadAliasSources()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := readMountInfo(procSelfMountInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []gcItem
+	for _, find := range []func() ([]gcItem, error){
+		func() ([]gcItem, error) { return findOldCaches(maxCacheAge, now) },
+		func() ([]gcItem, error) { return findStaleAliasSources(sources) },
+		func() ([]gcItem, error) { return findOrphanedTempDirs(os.TempDir(), mounts, now) },
+		func() ([]gcItem, error) { return findStaleRegistryEntries(entries) },
+	} {
+		found, err := find()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, found...)
+	}
+
+	return items, nil
+}
+
+// Format the size in MiB, as the free space checks do.
+func formatMiB(size int64) string {
+	return fmt.Sprintf("%.1f MiB", float64(size)/(1024*1024))
+}
+
+// Remove the items, reporting each along with the space freed. Nothing is
+// removed if dryRun is set.
+func collectGarbage(items []gcItem, dryRun bool, w io.Writer) error {
+	var verb string = "removed"
+	if dryRun {
+		verb = "would remove"
+	}
+
+	var freed int64
+	for _, item := range items {
+		if !dryRun {
+			if err := item.remove(); err != nil {
+				return fmt.Errorf("%v: %w", item.path, err)
+			}
+		}
+		freed += item.size
+		fmt.Fprintf(w, "%v %v (%v, %v)\n", verb, item.path, item.reason, formatMiB(item.size))
+	}
+
+	if dryRun {
+		fmt.Fprintf(w, "%v would be freed\n", formatMiB(freed))
+	} else {
+		fmt.Fprintf(w, "%v freed\n", formatMiB(freed))
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindOldCaches(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var now time.Time = time.Now()
+	for name, age := range map[string]time.Duration{"apt": 40 * 24 * time.Hour, "pip": time.Hour} {
+		var cachePath string = filepath.Join(progDataDir, cachesDir, name)
+		if err := os.MkdirAll(cachePath, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(filepath.Join(cachePath, "foo"), "foo\n"); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{filepath.Join(cachePath, "foo"), cachePath} {
+			if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	items, err := findOldCaches(defaultGcCacheAge, now)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(items) != 1 || filepath.Base(items[0].path) != "apt" {
+		t.Fatalf("expected only the apt cache to be old, got %+v", items)
+	} else if items[0].size != 4 {
+		t.Fatalf("expected the apt cache to be 4 bytes, got %v", items[0].size)
+	}
+
+	if items, err := findOldCaches(0, now); err != nil {
+		t.Fatal(err)
+	} else if len(items) != 0 {
+		t.Fatalf("expected every cache to be kept, got %+v", items)
+	}
+}
+
+func TestFindStaleAliasSources(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	for _, name := range []string{"work", "old"} {
+		if err := os.MkdirAll(filepath.Join(progDataDir, aliasSourcesDir, name), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := findStaleAliasSources([]aliasSource{{Name: "work"}, {Name: comprtConfigsRepoName}})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(items) != 1 || filepath.Base(items[0].path) != "old" {
+		t.Fatalf("expected only the old source to be stale, got %+v", items)
+	}
+}
+
+func TestFindOrphanedTempDirs(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var now time.Time = time.Now()
+	for name, age := range map[string]time.Duration{
+		"_" + progname + "123":    48 * time.Hour,
+		progname + "-overlay-456": 48 * time.Hour,
+		progname + "-alias-789":   time.Minute,
+		"unrelated":               48 * time.Hour,
+	} {
+		var dirPath string = filepath.Join(tempDirPath, name)
+		if err := os.Mkdir(dirPath, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(dirPath, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the overlay is still mounted
+	items, err := findOrphanedTempDirs(tempDirPath, []mountInfo{{mountPoint: filepath.Join(tempDirPath, progname+"-overlay-456", "merged")}}, now)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(items) != 1 || filepath.Base(items[0].path) != "_"+progname+"123" {
+		t.Fatalf("expected only the test's temp dir to be orphaned, got %+v", items)
+	}
+}
+
+func TestFindOrphanedTempDirsLocked(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// the overlay is mounted in a private mount namespace, only its lock is seen
+	var now time.Time = time.Now()
+	lockedDirPath, err := makeTempDir(tempDirPath, progname+"-overlay-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlockedDirPath := filepath.Join(tempDirPath, progname+"-alias-123")
+	if err := os.Mkdir(unlockedDirPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for _, dirPath := range []string{lockedDirPath, unlockedDirPath} {
+		if err := os.Chtimes(dirPath, now.Add(-48*time.Hour), now.Add(-48*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := findOrphanedTempDirs(tempDirPath, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(items) != 1 || items[0].path != unlockedDirPath {
+		t.Fatalf("expected only the unlocked temp dir to be orphaned, got %+v", items)
+	}
+}
+
+func TestFindStaleRegistryEntries(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var existingTarget, goneTarget string = filepath.Join(progDataDir, "existing"), filepath.Join(progDataDir, "gone")
+	if err := os.Mkdir(existingTarget, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(progDataDir, packagesDir), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{existingTarget, goneTarget} {
+		if err := registerComprt(registryEntry{Target: target, CodeName: testCodeCame}); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(filepath.Join(progDataDir, packagesDir, url.PathEscape(target)+".json"), "{}\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := loadRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := findStaleRegistryEntries(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := collectGarbage(items, false, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry, err := lookupComprt(goneTarget); err != nil {
+		t.Fatal(err)
+	} else if entry != nil {
+		t.Fatalf("%v was still found in the registry", goneTarget)
+	}
+	if entry, err := lookupComprt(existingTarget); err != nil {
+		t.Fatal(err)
+	} else if entry == nil {
+		t.Fatalf("%v was removed from the registry", existingTarget)
+	}
+	if _, err := os.Stat(filepath.Join(progDataDir, packagesDir, url.PathEscape(goneTarget)+".json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("the package state of %v was not removed", goneTarget)
+	}
+	if !strings.Contains(buf.String(), "removed "+goneTarget+" (registered comprt no longer exists, 0.0 MiB)\n") {
+		t.Fatalf("expected %v to be reported as removed, got:\n%v", goneTarget, buf.String())
+	}
+}
+
+func TestCollectGarbageDryRun(t *testing.T) {
+	var removed bool
+	var items []gcItem = []gcItem{{path: "/foo", reason: "orphaned temp dir", size: 3 * 1024 * 1024, remove: func() error {
+		removed = true
+		return nil
+	}}}
+
+	var buf bytes.Buffer
+	if err := collectGarbage(items, true, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if removed {
+		t.Fatal("an item was removed on a dry run")
+	}
+
+	var expected string = "would remove /foo (orphaned temp dir, 3.0 MiB)\n3.0 MiB would be freed\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+const (
+	// The env var with the passphrase to an alias source's SSH key, if the key
+	// has one.
+	sshKeyPassphraseEnvVar = "DEBCOMPRT_SSH_KEY_PASSPHRASE"
+	defaultSshUser         = "git"
+)
+
+// The keys ssh(1) tries by default, in the order it tries them.
+var defaultSshKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// Get how to authenticate with the alias source's repo. For SSH, the source's
+// key is used, otherwise ssh-agent or the user's default keys. For HTTP(S), the
+// token in the source's token env var is used, otherwise whatever the system's
+// git credential helpers have for the repo. Returns nil if the repo should be
+// accessed anonymously.
+func aliasSourceAuth(source aliasSource) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(source.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch endpoint.Protocol {
+	case "ssh":
+		var user string = endpoint.User
+		if user == "" {
+			user = defaultSshUser
+		}
+
+		if source.SSHKey != "" {
+			return ssh.NewPublicKeysFromFile(user, source.SSHKey, os.Getenv(sshKeyPassphraseEnvVar))
+		} else if os.Getenv("SSH_AUTH_SOCK") != "" {
+			return ssh.NewSSHAgentAuth(user)
+		}
+
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		for _, key := range defaultSshKeys {
+			keyPath := filepath.Join(homeDir, ".ssh", key)
+			if _, err := os.Stat(keyPath); err == nil {
+				return ssh.NewPublicKeysFromFile(user, keyPath, os.Getenv(sshKeyPassphraseEnvVar))
+			}
+		}
+	case "http", "https":
+		if source.TokenEnv != "" {
+			token := os.Getenv(source.TokenEnv)
+			if token == "" {
+				return nil, fmt.Errorf("alias source %v requires a token in %v", source.Name, source.TokenEnv)
+			}
+
+			var user string = endpoint.User
+			if user == "" {
+				// most git hosts only check the token, though a username is required
+				user = progname
+			}
+			return &http.BasicAuth{Username: user, Password: token}, nil
+		}
+
+		if user, password := gitCredentialFill(endpoint); password != "" {
+			return &http.BasicAuth{Username: user, Password: password}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Ask the system's git credential helpers for the credentials to the endpoint,
+// as if by 'git credential fill'. Git is never allowed to prompt for them.
+// Returns empty credentials if git is not installed or no helper had them.
+func gitCredentialFill(endpoint *transport.Endpoint) (string, string) {
+	gitPath, err := progExecutor.LookPath("git")
+	if err != nil {
+		return "", ""
+	}
+
+	var host string = endpoint.Host
+	if endpoint.Port != 0 {
+		host = fmt.Sprintf("%v:%v", endpoint.Host, endpoint.Port)
+	}
+
+	var credential string = fmt.Sprintf(
+		"protocol=%v\nhost=%v\npath=%v\n",
+		endpoint.Protocol,
+		host,
+		strings.TrimPrefix(endpoint.Path, "/"),
+	)
+	if endpoint.User != "" {
+		credential += fmt.Sprintf("username=%v\n", endpoint.User)
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(gitPath, "credential", "fill")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	cmd.Stdin = strings.NewReader(credential + "\n")
+	cmd.Stdout = &stdout
+	if err := progExecutor.Run(cmd); err != nil {
+		return "", ""
+	}
+
+	return parseGitCredential(stdout.String())
+}
+
+// Parse the username and password from the output of 'git credential fill'.
+func parseGitCredential(output string) (string, string) {
+	var user, password string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		i := strings.Index(scanner.Text(), "=")
+		if i < 1 {
+			continue
+		}
+
+		switch scanner.Text()[:i] {
+		case "username":
+			user = scanner.Text()[i+1:]
+		case "password":
+			password = scanner.Text()[i+1:]
+		}
+	}
+
+	return user, password
+}
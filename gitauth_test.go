@@ -0,0 +1,108 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+func TestParseGitCredential(t *testing.T) {
+	user, password := parseGitCredential("protocol=https\nhost=example.com\nusername=foo\npassword=b=ar\n")
+	if user != "foo" || password != "b=ar" {
+		t.Fatalf("unexpected credentials parsed: %v %v", user, password)
+	}
+}
+
+func TestAliasSourceAuthHttp(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// keeps the user's own git config (and credentials) out of the test
+	var gitConfigPath string = filepath.Join(tempDirPath, "gitconfig")
+	t.Setenv("GIT_CONFIG_GLOBAL", gitConfigPath)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("HOME", tempDirPath)
+
+	source := aliasSource{Name: "work", URL: "https://git.example.com/comprts.git"}
+	if auth, err := aliasSourceAuth(source); err != nil {
+		t.Fatal(err)
+	} else if auth != nil {
+		t.Fatalf("expected no auth without a token or credential helper, got %v", auth)
+	}
+
+	if err := createTestFile(
+		gitConfigPath,
+		"[credential]\n\thelper = \"!f() { echo username=foo; echo password=bar; }; f\"\n",
+	); err != nil {
+		t.Fatal(err)
+	}
+	if auth, err := aliasSourceAuth(source); err != nil {
+		t.Fatal(err)
+	} else if basicAuth, ok := auth.(*http.BasicAuth); !ok || basicAuth.Username != "foo" || basicAuth.Password != "bar" {
+		t.Fatalf("the credential helper's credentials were not used, got %v", auth)
+	}
+
+	// a token is preferred over a credential helper
+	source.TokenEnv = "DEBCOMPRT_TEST_TOKEN"
+	if _, err := aliasSourceAuth(source); err == nil {
+		t.Fatal("a source was accessed without its token")
+	}
+	t.Setenv(source.TokenEnv, "baz")
+	if auth, err := aliasSourceAuth(source); err != nil {
+		t.Fatal(err)
+	} else if basicAuth, ok := auth.(*http.BasicAuth); !ok || basicAuth.Password != "baz" {
+		t.Fatalf("the source's token was not used, got %v", auth)
+	}
+}
+
+func TestAliasSourceAuthSsh(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyPath string = filepath.Join(tempDirPath, "deploy_key")
+	if err := createTestFile(keyPath, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}))); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := aliasSourceAuth(aliasSource{Name: "work", URL: "deploy@git.example.com:infra/comprts.git", SSHKey: keyPath})
+	if err != nil {
+		t.Fatal(err)
+	} else if publicKeys, ok := auth.(*ssh.PublicKeys); !ok || publicKeys.User != "deploy" {
+		t.Fatalf("the source's SSH key was not used, got %v", auth)
+	}
+}
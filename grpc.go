@@ -0,0 +1,231 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	debcomprtpb "github.com/cavcrosby/debcomprt/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The most of an exported tarball sent in a single chunk.
+const exportChunkSize = 64 * 1024
+
+// A type used to serve the daemon's API as the gRPC service defined in
+// api/debcomprt.proto, the jobs are the daemon's own so they can be followed
+// from either API.
+type grpcComprtsServer struct {
+	debcomprtpb.UnimplementedComprtsServer
+	d *daemon
+}
+
+// Get a gRPC server with the comprts service registered on it.
+func newGrpcServer(d *daemon) *grpc.Server {
+	server := grpc.NewServer()
+	debcomprtpb.RegisterComprtsServer(server, &grpcComprtsServer{d: d})
+	return server
+}
+
+// Get the time as a protobuf timestamp, nil if the time was never set.
+func timestampProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
+
+func jobProto(job *daemonJob) *debcomprtpb.Job {
+	job = job.snapshot()
+	var jobStatus debcomprtpb.Job_Status
+	switch job.Status {
+	case jobRunning:
+		jobStatus = debcomprtpb.Job_RUNNING
+	case jobSucceeded:
+		jobStatus = debcomprtpb.Job_SUCCEEDED
+	case jobFailed:
+		jobStatus = debcomprtpb.Job_FAILED
+	}
+
+	return &debcomprtpb.Job{
+		Id:        job.ID,
+		Operation: job.Operation,
+		Target:    job.Target,
+		Args:      job.Args,
+		Status:    jobStatus,
+		ExitCode:  int32(job.ExitCode),
+		Error:     job.Error,
+		Started:   timestampProto(job.Started),
+		Finished:  timestampProto(job.Finished),
+	}
+}
+
+func (s *grpcComprtsServer) ListComprts(ctx context.Context, req *debcomprtpb.ListComprtsRequest) (*debcomprtpb.ListComprtsResponse, error) {
+	inventory, err := getInventory()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	var resp *debcomprtpb.ListComprtsResponse = &debcomprtpb.ListComprtsResponse{}
+	for _, item := range inventory {
+		resp.Comprts = append(resp.Comprts, &debcomprtpb.Comprt{
+			Target:           item.Target,
+			Codename:         item.CodeName,
+			Arch:             item.Arch,
+			Mirror:           item.Mirror,
+			Alias:            item.Alias,
+			User:             item.User,
+			Created:          timestampProto(item.Created),
+			Updated:          timestampProto(item.Updated),
+			Labels:           item.Labels,
+			Size:             item.Size,
+			Status:           item.Status,
+			DebcomprtVersion: item.Version,
+		})
+	}
+	return resp, nil
+}
+
+func (s *grpcComprtsServer) CreateComprt(ctx context.Context, req *debcomprtpb.CreateComprtRequest) (*debcomprtpb.Job, error) {
+	args, err := createRequest{
+		CodeName:    req.GetCodename(),
+		Target:      req.GetTarget(),
+		Mirrors:     req.GetMirrors(),
+		Flags:       req.GetFlags(),
+		Debootstrap: req.GetDebootstrap(),
+	}.args()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return jobProto(s.d.startJob("create", req.GetTarget(), args, "")), nil
+}
+
+func (s *grpcComprtsServer) DeleteComprt(ctx context.Context, req *debcomprtpb.DeleteComprtRequest) (*debcomprtpb.Job, error) {
+	if err := checkApiTarget(req.GetTarget()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if err := checkIsComprt(req.GetTarget()); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	return jobProto(s.d.startJob("delete", req.GetTarget(), []string{"delete", req.GetTarget()}, "")), nil
+}
+
+func (s *grpcComprtsServer) ExecComprt(ctx context.Context, req *debcomprtpb.ExecComprtRequest) (*debcomprtpb.Job, error) {
+	if err := checkApiTarget(req.GetTarget()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	script, err := writeExecScript(req.GetCommand())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var args []string = []string{"provision", "--config-path=" + script, req.GetTarget()}
+	return jobProto(s.d.startJob("exec", req.GetTarget(), args, script)), nil
+}
+
+// A type used to send what is written to it as export chunks.
+type exportChunkWriter struct {
+	stream debcomprtpb.Comprts_ExportComprtServer
+}
+
+func (w exportChunkWriter) Write(p []byte) (int, error) {
+	for written := 0; written < len(p); {
+		var end int = written + exportChunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+		if err := w.stream.Send(&debcomprtpb.ExportChunk{Data: p[written:end]}); err != nil {
+			return written, err
+		}
+		written = end
+	}
+
+	return len(p), nil
+}
+
+// Stream the comprt as a tarball, unlike the http api a failed export is
+// reported as the stream's error.
+func (s *grpcComprtsServer) ExportComprt(req *debcomprtpb.ExportComprtRequest, stream debcomprtpb.Comprts_ExportComprtServer) error {
+	var target string = req.GetTarget()
+	if err := checkApiTarget(target); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	var compression string = req.GetCompression()
+	if compression == "" {
+		compression = noCodecName
+	}
+	c, err := getCodec(compression)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	mounts, err := readMountInfo(procSelfMountInfo)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	} else if err := checkTargetUnmounted(target, mounts); err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	} else if err := checkNoSecrets(target); err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	cw, err := c.NewWriter(exportChunkWriter{stream: stream})
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if err := writeExportTar(target, cw); err != nil {
+		cw.Close()
+		return status.Errorf(codes.Internal, "exporting %v failed: %v", target, err)
+	}
+	if err := cw.Close(); err != nil {
+		return status.Errorf(codes.Internal, "exporting %v failed: %v", target, err)
+	}
+
+	return nil
+}
+
+func (s *grpcComprtsServer) ListJobs(ctx context.Context, req *debcomprtpb.ListJobsRequest) (*debcomprtpb.ListJobsResponse, error) {
+	var resp *debcomprtpb.ListJobsResponse = &debcomprtpb.ListJobsResponse{}
+	for _, job := range s.d.listJobs() {
+		resp.Jobs = append(resp.Jobs, jobProto(job))
+	}
+	return resp, nil
+}
+
+func (s *grpcComprtsServer) GetJob(ctx context.Context, req *debcomprtpb.GetJobRequest) (*debcomprtpb.Job, error) {
+	job := s.d.job(req.GetId())
+	if job == nil {
+		return nil, status.Errorf(codes.NotFound, "there is no job %v", req.GetId())
+	}
+
+	return jobProto(job), nil
+}
+
+// Stream the job's output from the start until the job finishes, the same as
+// the http api's ?follow=true.
+func (s *grpcComprtsServer) StreamJobOutput(req *debcomprtpb.GetJobRequest, stream debcomprtpb.Comprts_StreamJobOutputServer) error {
+	job := s.d.job(req.GetId())
+	if job == nil {
+		return status.Errorf(codes.NotFound, "there is no job %v", req.GetId())
+	}
+
+	return followJobOutput(stream.Context(), job, func(output []byte) error {
+		return stream.Send(&debcomprtpb.JobOutput{Data: output})
+	})
+}
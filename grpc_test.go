@@ -0,0 +1,139 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	debcomprtpb "github.com/cavcrosby/debcomprt/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// Serve the daemon's gRPC api on a unix socket in the dir, a client of it is
+// returned along with a func that stops serving.
+func setupGrpcServer(t *testing.T, d *daemon, dirPath string) (debcomprtpb.ComprtsClient, func()) {
+	t.Helper()
+	var socketPath string = filepath.Join(dirPath, "debcomprt-grpc.sock")
+	listener, err := listenUnixSocket(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newGrpcServer(d)
+	go server.Serve(listener)
+
+	conn, err := grpc.Dial("unix:"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		server.Stop()
+		t.Fatal(err)
+	}
+
+	return debcomprtpb.NewComprtsClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func TestGrpcStreamJobOutput(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var exePath string = filepath.Join(tempDirPath, "debcomprt")
+	if err := createTestFile(exePath, "#!/bin/sh\necho first\nsleep 0.5\necho second\n"); err != nil {
+		t.Fatal(err)
+	}
+	client, stop := setupGrpcServer(t, newDaemon(exePath), tempDirPath)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	job, err := client.CreateComprt(ctx, &debcomprtpb.CreateComprtRequest{
+		Codename: testCodeCame,
+		Target:   tempDirPath,
+		Flags:    []string{"--password=hunter2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if job.GetStatus() != debcomprtpb.Job_RUNNING {
+		t.Fatalf("expected: %v, actual: %v", debcomprtpb.Job_RUNNING, job.GetStatus())
+	} else if strings.Contains(strings.Join(job.GetArgs(), " "), "hunter2") {
+		t.Fatalf("expected the job's password to be redacted, got %v", job.GetArgs())
+	}
+
+	stream, err := client.StreamJobOutput(ctx, &debcomprtpb.GetJobRequest{Id: job.GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output []byte
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		output = append(output, chunk.GetData()...)
+	}
+	if expected := "first\nsecond\n"; string(output) != expected {
+		t.Fatalf("expected %q, got %q", expected, output)
+	}
+
+	// the stream ends once the job has finished
+	if job, err = client.GetJob(ctx, &debcomprtpb.GetJobRequest{Id: job.GetId()}); err != nil {
+		t.Fatal(err)
+	} else if job.GetStatus() != debcomprtpb.Job_SUCCEEDED || job.GetFinished() == nil {
+		t.Fatalf("expected the job to succeed, got %v", job)
+	}
+}
+
+func TestGrpcErrorCodes(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	client, stop := setupGrpcServer(t, newDaemon("/bin/echo"), tempDirPath)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := client.GetJob(ctx, &debcomprtpb.GetJobRequest{Id: "1"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected: %v, actual: %v", codes.NotFound, err)
+	}
+	if _, err := client.CreateComprt(ctx, &debcomprtpb.CreateComprtRequest{Codename: testCodeCame, Target: "relative"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected: %v, actual: %v", codes.InvalidArgument, err)
+	}
+	if _, err := client.DeleteComprt(ctx, &debcomprtpb.DeleteComprtRequest{Target: filepath.Join(tempDirPath, "missing")}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected: %v, actual: %v", codes.InvalidArgument, err)
+	}
+	if _, err := client.DeleteComprt(ctx, &debcomprtpb.DeleteComprtRequest{Target: tempDirPath}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected: %v, actual: %v", codes.FailedPrecondition, err)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// The dir next to the comprt config file with a dir of hook scripts per
+	// lifecycle stage (e.g. hooks.d/post-bootstrap/10-cache).
+	hooksDirName = "hooks.d"
+
+	// The host-side scripts next to the comprt config file, the first and last
+	// things ran on the host when a comprt is created.
+	hostPreScript  = "host-pre"
+	hostPostScript = "host-post"
+
+	preBootstrapHook  = "pre-bootstrap"
+	postBootstrapHook = "post-bootstrap"
+	preConfigHook     = "pre-config"
+	postConfigHook    = "post-config"
+
+	hookStageEnvVar    = "DEBCOMPRT_HOOK"
+	hookTargetEnvVar   = "DEBCOMPRT_TARGET"
+	hookCodeNameEnvVar = "DEBCOMPRT_CODENAME"
+)
+
+var hookStages = []string{preBootstrapHook, postBootstrapHook, preConfigHook, postConfigHook}
+
+// A type used to store the hook scripts ran on the host at each lifecycle stage
+// of a comprt.
+type comprtHooks struct {
+	scripts map[string][]string
+	// Ran before the pre-bootstrap hook scripts and after everything at the
+	// post-config stage, respectively.
+	hostPre  string
+	hostPost string
+	// Ran after the post-config hook scripts.
+	playbooks []ansiblePlaybook
+	target    string
+	codeName  string
+	quiet     bool
+}
+
+// Collect the hook scripts found in the hooks dir next to the comprt config
+// file, followed by the hook scripts passed in (in the STAGE=PATH form). Hook
+// scripts in the hooks dir are ran in lexical order. The host-pre and host-post
+// scripts next to the comprt config file are collected as well.
+func newComprtHooks(comprtConfigPath string, hookFlags []string, target, codeName string, quiet bool) (*comprtHooks, error) {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks *comprtHooks = &comprtHooks{
+		scripts:  make(map[string][]string),
+		target:   absTarget,
+		codeName: codeName,
+		quiet:    quiet,
+	}
+
+	for _, script := range []struct {
+		name string
+		path *string
+	}{
+		{hostPreScript, &hooks.hostPre},
+		{hostPostScript, &hooks.hostPost},
+	} {
+		scriptPath, err := filepath.Abs(filepath.Join(filepath.Dir(comprtConfigPath), script.name))
+		if err != nil {
+			return nil, err
+		}
+		if fileInfo, err := os.Stat(scriptPath); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if !fileInfo.Mode().IsRegular() {
+			return nil, fmt.Errorf("%v is not a file", scriptPath)
+		}
+		*script.path = scriptPath
+	}
+
+	for _, stage := range hookStages {
+		stageDir := filepath.Join(filepath.Dir(comprtConfigPath), hooksDirName, stage)
+		entries, err := os.ReadDir(stageDir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			// e.g. editor backup files
+			if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") || strings.HasSuffix(entry.Name(), "~") {
+				continue
+			}
+
+			scriptPath, err := filepath.Abs(filepath.Join(stageDir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			hooks.scripts[stage] = append(hooks.scripts[stage], scriptPath)
+		}
+	}
+
+	for _, hookFlag := range hookFlags {
+		i := strings.Index(hookFlag, "=")
+		if i < 1 || i == len(hookFlag)-1 {
+			return nil, fmt.Errorf("%v is not a properly formatted hook (e.g. STAGE=PATH)", hookFlag)
+		}
+
+		stage := hookFlag[:i]
+		if !stringInArr(stage, &hookStages) {
+			return nil, fmt.Errorf("%v is not a hook stage, use one of: %v", stage, strings.Join(hookStages, ", "))
+		}
+
+		scriptPath, err := filepath.Abs(hookFlag[i+1:])
+		if err != nil {
+			return nil, err
+		} else if _, err := os.Stat(scriptPath); err != nil {
+			return nil, err
+		}
+		hooks.scripts[stage] = append(hooks.scripts[stage], scriptPath)
+	}
+
+	return hooks, nil
+}
+
+// Get the env the hook scripts for the stage are ran with, target is the path
+// of the comprt as seen by the hook scripts.
+func (h *comprtHooks) env(stage, target string) []string {
+	return []string{
+		hookStageEnvVar + "=" + stage,
+		hookTargetEnvVar + "=" + target,
+		hookCodeNameEnvVar + "=" + h.codeName,
+	}
+}
+
+// Run the hook script on the host, stage is what the hook script is told it is
+// ran for.
+func (h *comprtHooks) runScript(stage, scriptPath string) error {
+	hookCmd := exec.Command(scriptPath)
+	traceCommand(hookCmd)
+	hookCmd.Env = append(os.Environ(), h.env(stage, h.target)...)
+	hookCmd.Stdout, hookCmd.Stderr = buildLogOutput(h.quiet)
+	if err := progExecutor.Run(hookCmd); err != nil {
+		return fmt.Errorf("%v hook %v failed: %w", stage, scriptPath, err)
+	}
+
+	return nil
+}
+
+// Run the hook scripts for the stage, stopping at the first one that fails.
+// Running the hooks of a nil comprtHooks does nothing.
+func (h *comprtHooks) run(stage string) error {
+	if h == nil {
+		return nil
+	}
+
+	if stage == preBootstrapHook && h.hostPre != "" {
+		if err := h.runScript(hostPreScript, h.hostPre); err != nil {
+			return err
+		}
+	}
+
+	for _, scriptPath := range h.scripts[stage] {
+		if err := h.runScript(stage, scriptPath); err != nil {
+			return err
+		}
+	}
+
+	if stage == postConfigHook {
+		if err := runAnsiblePlaybooks(h.playbooks, h.target, h.quiet); err != nil {
+			return err
+		}
+		if h.hostPost != "" {
+			return h.runScript(hostPostScript, h.hostPost)
+		}
+	}
+	return nil
+}
+
+// Get the mmdebstrap hook args that run the hook scripts for the stage. The
+// hook scripts are ran by mmdebstrap, so the comprt is seen by them at
+// mmdebstrap's temporary root ("$1").
+func (h *comprtHooks) mmdebstrapArgs(hookFlag, stage string) []string {
+	if h == nil {
+		return nil
+	}
+
+	hookArg := func(stage, scriptPath string) string {
+		return strings.Join([]string{
+			hookFlag + "=env",
+			shellQuote(hookStageEnvVar + "=" + stage),
+			shellQuote(hookTargetEnvVar+"=") + `"$1"`,
+			shellQuote(hookCodeNameEnvVar + "=" + h.codeName),
+			shellQuote(scriptPath),
+		}, " ")
+	}
+
+	var args []string
+	if stage == preBootstrapHook && h.hostPre != "" {
+		args = append(args, hookArg(hostPreScript, h.hostPre))
+	}
+	for _, scriptPath := range h.scripts[stage] {
+		args = append(args, hookArg(stage, scriptPath))
+	}
+	if stage == postConfigHook && h.hostPost != "" {
+		args = append(args, hookArg(hostPostScript, h.hostPost))
+	}
+
+	return args
+}
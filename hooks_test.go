@@ -0,0 +1,169 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewComprtHooks(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	stageDir := filepath.Join(tempDirPath, hooksDirName, postBootstrapHook)
+	if err := os.MkdirAll(stageDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range []string{"20-bar", "10-foo", "10-foo~", ".baz"} {
+		if err := createTestFile(filepath.Join(stageDir, script), "#!/bin/sh\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var flagScript string = filepath.Join(tempDirPath, "qux")
+	if err := createTestFile(flagScript, "#!/bin/sh\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks, err := newComprtHooks(
+		filepath.Join(tempDirPath, comprtConfigFile),
+		[]string{postBootstrapHook + "=" + flagScript},
+		"foo",
+		testCodeCame,
+		true,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(stageDir, "10-foo"), filepath.Join(stageDir, "20-bar"), flagScript}
+	if !reflect.DeepEqual(hooks.scripts[postBootstrapHook], expected) {
+		t.Fatalf("expected %v, got %v", expected, hooks.scripts[postBootstrapHook])
+	}
+
+	for _, hookFlag := range []string{"foo=" + flagScript, postBootstrapHook, postBootstrapHook + "="} {
+		if _, err := newComprtHooks(filepath.Join(tempDirPath, comprtConfigFile), []string{hookFlag}, "foo", testCodeCame, true); err == nil {
+			t.Fatalf("%v was accepted as a hook", hookFlag)
+		}
+	}
+}
+
+func TestComprtHooksRun(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var envPath string = filepath.Join(tempDirPath, "env")
+	var script string = filepath.Join(tempDirPath, "hook")
+	if err := createTestFile(script, "#!/bin/sh\necho \"$DEBCOMPRT_HOOK $DEBCOMPRT_TARGET $DEBCOMPRT_CODENAME\" > "+shellQuote(envPath)+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks, err := newComprtHooks(
+		filepath.Join(tempDirPath, comprtConfigFile),
+		[]string{preConfigHook + "=" + script},
+		filepath.Join(tempDirPath, "foo"),
+		testCodeCame,
+		true,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hooks.run(preConfigHook); err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := os.ReadFile(envPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := strings.Join([]string{preConfigHook, filepath.Join(tempDirPath, "foo"), testCodeCame}, " ") + "\n"; string(env) != expected {
+		t.Fatalf("expected %q, got %q", expected, env)
+	}
+
+	var nilHooks *comprtHooks
+	if err := nilHooks.run(preConfigHook); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestComprtHooksRunHostScripts(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var orderPath string = filepath.Join(tempDirPath, "order")
+	for _, script := range []string{
+		hostPreScript,
+		hostPostScript,
+		filepath.Join(hooksDirName, preBootstrapHook, "10-foo"),
+		filepath.Join(hooksDirName, postConfigHook, "10-bar"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(tempDirPath, script)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(
+			filepath.Join(tempDirPath, script),
+			"#!/bin/sh\necho \"$DEBCOMPRT_HOOK $(basename \"$0\")\" >> "+shellQuote(orderPath)+"\n",
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hooks, err := newComprtHooks(filepath.Join(tempDirPath, comprtConfigFile), nil, "foo", testCodeCame, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stage := range hookStages {
+		if err := hooks.run(stage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	order, err := os.ReadFile(orderPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "host-pre host-pre\npre-bootstrap 10-foo\npost-config 10-bar\nhost-post host-post\n"; string(order) != expected {
+		t.Fatalf("expected %q, got %q", expected, order)
+	}
+
+	args := hooks.mmdebstrapArgs("--setup-hook", preBootstrapHook)
+	if len(args) != 2 || !strings.Contains(args[0], shellQuote(filepath.Join(tempDirPath, hostPreScript))) {
+		t.Fatalf("host-pre was not ran first by mmdebstrap: %v", args)
+	}
+}
+
+func TestComprtHooksMmdebstrapArgs(t *testing.T) {
+	hooks := &comprtHooks{
+		scripts:  map[string][]string{postConfigHook: {"/srv/notify"}},
+		codeName: testCodeCame,
+	}
+
+	args := hooks.mmdebstrapArgs("--customize-hook", postConfigHook)
+	expected := []string{`--customize-hook=env 'DEBCOMPRT_HOOK=post-config' 'DEBCOMPRT_TARGET='"$1" 'DEBCOMPRT_CODENAME=buster' '/srv/notify'`}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("expected %v, got %v", expected, args)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	jsonOutput = "json"
+	csvOutput  = "csv"
+
+	comprtStatusOk         = "ok"
+	comprtStatusMissing    = "missing"
+	comprtStatusIncomplete = "incomplete"
+)
+
+// A type used to store a registry entry along with the comprt's current state.
+type inventoryEntry struct {
+	registryEntry
+	// The apparent size of the comprt in bytes.
+	Size   int64  `json:"size"`
+	Status string `json:"status"`
+}
+
+// Get the inventory of all the comprts in the registry.
+func getInventory() ([]inventoryEntry, error) {
+	entries, err := loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	var inventory []inventoryEntry
+	for _, entry := range entries {
+		item := inventoryEntry{registryEntry: entry, Status: comprtStatusOk}
+		if _, err := os.Stat(entry.Target); errors.Is(err, fs.ErrNotExist) {
+			item.Status = comprtStatusMissing
+		} else if err != nil {
+			return nil, err
+		} else if item.Size, err = comprtSize(entry.Target); err != nil {
+			return nil, err
+		} else if entry.Incomplete {
+			item.Status = comprtStatusIncomplete
+		}
+		inventory = append(inventory, item)
+	}
+
+	return inventory, nil
+}
+
+// Get the apparent size of the files in the target. Filesystems mounted under
+// the target (e.g. /proc from a chroot session) are not counted.
+func comprtSize(target string) (int64, error) {
+	var targetStat *syscall.Stat_t = &syscall.Stat_t{}
+	if err := syscall.Lstat(target, targetStat); err != nil {
+		return 0, err
+	}
+
+	var size int64
+	err := filepath.WalkDir(target, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if fileStat, ok := fileInfo.Sys().(*syscall.Stat_t); ok && fileStat.Dev != targetStat.Dev {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fileInfo.Mode().IsRegular() {
+			size += fileInfo.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
+
+// Write the inventory in the format passed in (e.g. json, csv).
+func writeInventory(w io.Writer, format string, inventory []inventoryEntry) error {
+	switch format {
+	case jsonOutput:
+		if inventory == nil {
+			inventory = []inventoryEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(inventory)
+	case csvOutput:
+		csvWriter := csv.NewWriter(w)
+		if err := csvWriter.Write([]string{
+			"target", "codename", "mirror", "alias", "created", "updated", "size", "status", "labels",
+		}); err != nil {
+			return err
+		}
+		for _, item := range inventory {
+			var labels []string
+			for k, v := range item.Labels {
+				labels = append(labels, k+"="+v)
+			}
+			sort.Strings(labels)
+
+			if err := csvWriter.Write([]string{
+				item.Target,
+				item.CodeName,
+				item.Mirror,
+				item.Alias,
+				item.Created.Format(time.RFC3339),
+				item.Updated.Format(time.RFC3339),
+				strconv.FormatInt(item.Size, 10),
+				item.Status,
+				strings.Join(labels, ";"),
+			}); err != nil {
+				return err
+			}
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	default:
+		return fmt.Errorf("%v is not a supported output format", format)
+	}
+}
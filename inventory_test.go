@@ -0,0 +1,68 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetInventory(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var fileContents string = "hello\nthere!\n"
+	var presentTarget string = progDataDir
+	if err := createTestFile(filepath.Join(presentTarget, "foo"), fileContents); err != nil {
+		t.Fatal(err)
+	}
+	var missingTarget string = filepath.Join(progDataDir, "missing")
+	for _, target := range []string{presentTarget, missingTarget} {
+		if err := registerComprt(registryEntry{Target: target, CodeName: testCodeCame}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inventory, err := getInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range inventory {
+		switch item.Target {
+		case presentTarget:
+			if item.Status != comprtStatusOk || item.Size < int64(len(fileContents)) {
+				t.Fatalf("found the following inventory entry %+v", item)
+			}
+		case missingTarget:
+			if item.Status != comprtStatusMissing {
+				t.Fatalf("found the following inventory entry %+v", item)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeInventory(&out, csvOutput, inventory); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(inventory)+1 {
+		t.Fatalf("found %d csv records for %d inventory entries", len(records), len(inventory))
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+const lockFile = "debcomprt.lock.json"
+
+// A type used to describe what a comprt was created from, that way the comprt
+// can be created again as it was (see create's --locked flag).
+type comprtLock struct {
+	CodeName       string `json:"codename"`
+	Mirror         string `json:"mirror"`
+	Arch           string `json:"arch"`
+	Backend        string `json:"backend"`
+	BackendVersion string `json:"backend_version,omitempty"`
+	Alias          string `json:"alias"`
+	// The commit of the repo the alias was found in, empty if the alias is not
+	// in a git repo.
+	AliasCommit  string   `json:"alias_commit,omitempty"`
+	AliasEnvVars []string `json:"alias_env_vars,omitempty"`
+	// When the comprt was created, the snapshot mirrors are used as of then.
+	Created  time.Time         `json:"created"`
+	Packages map[string]string `json:"packages"`
+}
+
+// Get the program that bootstraps comprts and its version, the version is empty
+// if the program is unable to report it.
+func bootstrapBackend(rootless bool) (string, string) {
+	if fakeBootstrap {
+		return fakeBootstrapBackend, ""
+	}
+
+	var backend string = debootstrapBackend
+	if rootless {
+		backend = "mmdebstrap"
+	}
+
+	out, err := progExecutor.Output(exec.Command(backend, "--version"))
+	if err != nil {
+		return backend, ""
+	}
+	// e.g. 'debootstrap 1.0.123' or 'mmdebstrap 1.3.5'
+	var fields []string = strings.Fields(strings.SplitN(string(out), "\n", 2)[0])
+	if len(fields) < 1 {
+		return backend, ""
+	}
+
+	return backend, fields[len(fields)-1]
+}
+
+// Get the HEAD commit of the git repo the alias is in, empty if the alias is not
+// in a git repo (e.g. a local alias).
+func aliasCommit(aliasPath string) (string, error) {
+	repo, err := git.PlainOpenWithOptions(aliasPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+
+	return head.Hash().String(), nil
+}
+
+// Get the alias env vars passed in by the user, the ones set by debcomprt itself
+// are left out.
+func userAliasEnvVars(envVars []string) []string {
+	var userEnvVars []string
+	for _, envVar := range envVars {
+		if !strings.HasPrefix(envVar, "DEBCOMPRT_DEFAULT_LOGIN_UID=") {
+			userEnvVars = append(userEnvVars, envVar)
+		}
+	}
+
+	return userEnvVars
+}
+
+// Write the lock to path.
+func (lock comprtLock) write(path string) error {
+	contents, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(contents, '\n'), OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R)
+}
+
+// Read in a lock written after a comprt was created.
+func loadComprtLock(path string) (*comprtLock, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var lock comprtLock
+	if err := json.Unmarshal(contents, &lock); err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	} else if lock.CodeName == "" {
+		return nil, fmt.Errorf("%v: the lock has no codename", path)
+	} else if lock.Created.IsZero() {
+		return nil, fmt.Errorf("%v: the lock has no creation time", path)
+	}
+
+	return &lock, nil
+}
+
+// Get the lock's packages as pinned packages (e.g. 'git=1:2.30.2-1'), sorted by
+// name.
+func (lock comprtLock) pinnedPkgs() []string {
+	var pinnedPkgs []string
+	for pkg, version := range lock.Packages {
+		pinnedPkgs = append(pinnedPkgs, pkg+"="+version)
+	}
+	sort.Strings(pinnedPkgs)
+
+	return pinnedPkgs
+}
+
+// Get the lock of the comprt just created from the mirror debootstrap used.
+func newComprtLock(pconfs *progConfigs, mirror string, created time.Time) (*comprtLock, error) {
+	pkgs, err := readInstalledPackages(pconfs.target)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, version := bootstrapBackend(pconfs.rootless)
+	return &comprtLock{
+		CodeName:       pconfs.codeName,
+		Mirror:         mirror,
+		Arch:           comprtArch(pconfs.passThroughFlags),
+		Backend:        backend,
+		BackendVersion: version,
+		Alias:          pconfs.alias,
+		AliasCommit:    pconfs.aliasCommit,
+		AliasEnvVars:   userAliasEnvVars(pconfs.aliasEnvVars),
+		Created:        created,
+		Packages:       pkgs,
+	}, nil
+}
+
+// Configure the comprt to be created as the lock describes. The alias is taken
+// from the lock unless aliasPassedIn, it is used from the locked commit unless
+// another ref is passed in.
+func applyComprtLock(pconfs *progConfigs, aliasPassedIn bool) error {
+	var lock *comprtLock = pconfs.lock
+	if arch := comprtArch(pconfs.passThroughFlags); lock.Arch != "" && arch != lock.Arch {
+		for _, flag := range pconfs.passThroughFlags {
+			if strings.HasPrefix(flag, "--arch=") {
+				return fmt.Errorf("the comprt was locked for %v, not %v", lock.Arch, arch)
+			}
+		}
+		pconfs.passThroughFlags = append(pconfs.passThroughFlags, "--arch="+lock.Arch)
+	}
+
+	if !aliasPassedIn {
+		pconfs.alias = lock.Alias
+	}
+	if _, ok := localAliasPath(pconfs.alias); !ok && pconfs.alias == lock.Alias && pconfs.aliasRef == "" {
+		pconfs.aliasRef = lock.AliasCommit
+	}
+
+	for _, envVar := range lock.AliasEnvVars {
+		if stringInArr(envVar, &pconfs.aliasEnvVars) {
+			continue
+		} else if reFindEnvVar.FindStringIndex(envVar) == nil {
+			return fmt.Errorf("%v is not a properly formatted env var", envVar)
+		}
+		envVarArr := reFindEnvVar.FindStringSubmatch(envVar)
+		setComprtEnvVar(envVarArr[1], envVarArr[2])
+		pconfs.aliasEnvVars = append(pconfs.aliasEnvVars, envVar)
+		pconfs.preprocessAliases = true
+	}
+
+	if backend, version := bootstrapBackend(pconfs.rootless); backend != lock.Backend || version != lock.BackendVersion {
+		warnf(
+			"the comprt was locked with %v %v, it is being created with %v %v",
+			lock.Backend,
+			lock.BackendVersion,
+			backend,
+			version,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestComprtLockWriteAndLoad(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var lock comprtLock = comprtLock{
+		CodeName:     testCodeCame,
+		Mirror:       debianArchiveMirror,
+		Arch:         "amd64",
+		Backend:      "debootstrap",
+		Alias:        noAlias,
+		AliasEnvVars: []string{"foo=bar"},
+		Created:      time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC),
+		Packages:     map[string]string{"git": "1:2.20.1-2+deb10u3", "base-files": "10.3+deb10u13"},
+	}
+	var lockPath string = filepath.Join(tempDirPath, lockFile)
+	if err := lock.write(lockPath); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedLock, err := loadComprtLock(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(*loadedLock, lock) {
+		t.Fatalf("expected %+v, got %+v", lock, *loadedLock)
+	}
+
+	var expected []string = []string{"base-files=10.3+deb10u13", "git=1:2.20.1-2+deb10u3"}
+	if pinnedPkgs := loadedLock.pinnedPkgs(); !reflect.DeepEqual(pinnedPkgs, expected) {
+		t.Fatalf("expected %v, got %v", expected, pinnedPkgs)
+	}
+
+	if err := createTestFile(lockPath, "{\"codename\": \"buster\"}\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadComprtLock(lockPath); err == nil {
+		t.Fatal("a lock without a creation time was loaded")
+	}
+}
+
+func TestApplyComprtLock(t *testing.T) {
+	var pconfs progConfigs = progConfigs{
+		alias:        noAlias,
+		aliasEnvVars: []string{"DEBCOMPRT_DEFAULT_LOGIN_UID=1000"},
+		lock: &comprtLock{
+			CodeName:     testCodeCame,
+			Arch:         "armhf",
+			Alias:        "python3",
+			AliasCommit:  "0123456789abcdef0123456789abcdef01234567",
+			AliasEnvVars: []string{"DEBCOMPRT_TEST_LOCK=foo"},
+		},
+	}
+	defer os.Unsetenv("DEBCOMPRT_TEST_LOCK")
+
+	if err := applyComprtLock(&pconfs, false); err != nil {
+		t.Fatal(err)
+	}
+	if pconfs.alias != "python3" || pconfs.aliasRef != pconfs.lock.AliasCommit {
+		t.Fatalf("the alias was not locked, got %v at %v", pconfs.alias, pconfs.aliasRef)
+	} else if comprtArch(pconfs.passThroughFlags) != "armhf" {
+		t.Fatalf("the arch was not locked, got %v", pconfs.passThroughFlags)
+	} else if !pconfs.preprocessAliases || os.Getenv("DEBCOMPRT_TEST_LOCK") != "foo" {
+		t.Fatal("the locked alias env vars were not used")
+	}
+
+	pconfs.passThroughFlags = []string{"--arch=arm64"}
+	if err := applyComprtLock(&pconfs, false); err == nil {
+		t.Fatal("an arch other than the locked one was used")
+	}
+}
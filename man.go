@@ -0,0 +1,192 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	manSection = "1"
+	// The hidden command that generates the man pages (e.g. when packaging).
+	genManCmdName = "gen-man"
+)
+
+// Matches the placeholder of a flag's value in its usage (e.g. 'create up to `N`
+// comprts at once'), as the cli does.
+var reUsagePlaceholder = regexp.MustCompile("`([^`]*)`")
+
+// A type used to describe a man page, either of debcomprt or one of its
+// commands.
+type manPage struct {
+	name        string
+	usage       string
+	synopsis    string
+	description string
+	version     string
+	flags       []cli.Flag
+	commands    []*cli.Command
+	seeAlso     []string
+}
+
+// Escape the text so roff prints it as is.
+func roffEscape(text string) string {
+	text = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(text)
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+
+	return text
+}
+
+// Get the flag's names (with the placeholder of its value) and its usage, as
+// they are shown in a man page.
+func manFlag(flag cli.Flag) (string, string) {
+	var names []string
+	for _, name := range flag.Names() {
+		if len(name) == 1 {
+			names = append(names, `\fB\-`+roffEscape(name)+`\fR`)
+		} else {
+			names = append(names, `\fB\-\-`+roffEscape(name)+`\fR`)
+		}
+	}
+
+	docFlag, ok := flag.(cli.DocGenerationFlag)
+	if !ok {
+		return strings.Join(names, ", "), ""
+	}
+	var usage string = strings.ReplaceAll(docFlag.GetUsage(), "<flag>", "--"+flag.Names()[0])
+	var placeholder string = "value"
+	if match := reUsagePlaceholder.FindStringSubmatch(usage); match != nil {
+		placeholder = match[1]
+		usage = strings.Replace(usage, match[0], match[1], 1)
+	}
+
+	var nameText string = strings.Join(names, ", ")
+	if docFlag.TakesValue() {
+		nameText += ` \fI` + roffEscape(placeholder) + `\fR`
+	}
+	if boolFlag, ok := flag.(*cli.BoolFlag); ok && boolFlag.Value {
+		usage += " (default: true)"
+	} else if value := docFlag.GetValue(); docFlag.TakesValue() && value != "" {
+		usage += fmt.Sprintf(" (default: %v)", value)
+	}
+
+	return nameText, roffEscape(usage)
+}
+
+// Write the man page in roff. The page is not dated, that way the same version of
+// debcomprt always generates the same pages.
+func (page manPage) write(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, ".TH %q %q \"\" %q \"User Commands\"\n", strings.ToUpper(page.name), manSection, progname+" "+page.version)
+	fmt.Fprintf(&buf, ".SH NAME\n%v \\- %v\n", roffEscape(page.name), roffEscape(page.usage))
+	if page.synopsis != "" {
+		fmt.Fprintf(&buf, ".SH SYNOPSIS\n.B %v\n", roffEscape(page.synopsis))
+	}
+	if page.description != "" {
+		fmt.Fprintf(&buf, ".SH DESCRIPTION\n%v\n", roffEscape(page.description))
+	}
+
+	if len(page.flags) > 0 {
+		fmt.Fprintf(&buf, ".SH OPTIONS\n")
+		for _, flag := range page.flags {
+			names, usage := manFlag(flag)
+			fmt.Fprintf(&buf, ".TP\n%v\n%v\n", names, usage)
+		}
+	}
+
+	if len(page.commands) > 0 {
+		fmt.Fprintf(&buf, ".SH COMMANDS\n")
+		for _, command := range page.commands {
+			fmt.Fprintf(&buf, ".TP\n\\fB%v\\fR\n%v, see \\fB%v\\fR(%v)\n", roffEscape(command.Name), roffEscape(command.Usage), roffEscape(progname+"-"+command.Name), manSection)
+		}
+	}
+
+	if len(page.seeAlso) > 0 {
+		var refs []string
+		for _, name := range page.seeAlso {
+			refs = append(refs, fmt.Sprintf("\\fB%v\\fR(%v)", roffEscape(name), manSection))
+		}
+		fmt.Fprintf(&buf, ".SH SEE ALSO\n%v\n", strings.Join(refs, ", "))
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Get the man pages of debcomprt and each of its commands that are not hidden.
+func manPages(app *cli.App) []manPage {
+	var commands []*cli.Command = app.VisibleCommands()
+	var seeAlso []string
+	for _, command := range commands {
+		seeAlso = append(seeAlso, progname+"-"+command.Name)
+	}
+
+	var pages []manPage = []manPage{{
+		name:        progname,
+		usage:       app.Usage,
+		synopsis:    app.UsageText,
+		description: app.Description,
+		version:     app.Version,
+		flags:       app.VisibleFlags(),
+		commands:    commands,
+		seeAlso:     seeAlso,
+	}}
+	for _, command := range commands {
+		pages = append(pages, manPage{
+			name:        progname + "-" + command.Name,
+			usage:       command.Usage,
+			synopsis:    command.UsageText,
+			description: command.Description,
+			version:     app.Version,
+			flags:       command.VisibleFlags(),
+			seeAlso:     []string{progname},
+		})
+	}
+
+	return pages
+}
+
+// Write the man pages into the dir, returns the paths of the pages written.
+func writeManPages(app *cli.App, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return nil, err
+	}
+
+	var pagePaths []string
+	for _, page := range manPages(app) {
+		var buf bytes.Buffer
+		if err := page.write(&buf); err != nil {
+			return nil, err
+		}
+
+		var pagePath string = filepath.Join(dir, page.name+"."+manSection)
+		if err := os.WriteFile(pagePath, buf.Bytes(), OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R); err != nil {
+			return nil, err
+		}
+		pagePaths = append(pagePaths, pagePath)
+	}
+
+	return pagePaths, nil
+}
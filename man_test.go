@@ -0,0 +1,99 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestWriteManPages(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	app := &cli.App{
+		Name:      progname,
+		Usage:     "manages debian compartments",
+		UsageText: "debcomprt [global options] [command]",
+		Version:   "1.2.0",
+		Flags: []cli.Flag{
+			&cli.DurationFlag{Name: "retry-delay", Value: time.Second, Usage: "the `DELAY` before retrying"},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:      "apply",
+				Usage:     "creates the comprts declared in a file",
+				UsageText: "debcomprt apply FILE",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "rm-on-failure", Value: true, Usage: "remove failed creates"},
+					&cli.StringSliceFlag{Name: "label", Usage: "label the comprt (ex. <flag> team=infra)"},
+				},
+			},
+			{Name: genManCmdName, Hidden: true},
+		},
+	}
+
+	pagePaths, err := writeManPages(app, filepath.Join(tempDirPath, "man1"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(pagePaths) != 2 {
+		t.Fatalf("expected a page for debcomprt and apply only, got %v", pagePaths)
+	}
+
+	for pagePath, lines := range map[string][]string{
+		filepath.Join(tempDirPath, "man1", "debcomprt.1"): {
+			`.TH "DEBCOMPRT" "1" "" "debcomprt 1.2.0" "User Commands"`,
+			`\fB\-\-retry\-delay\fR \fIDELAY\fR`,
+			`the DELAY before retrying (default: 1s)`,
+			`creates the comprts declared in a file, see \fBdebcomprt\-apply\fR(1)`,
+		},
+		filepath.Join(tempDirPath, "man1", "debcomprt-apply.1"): {
+			`debcomprt\-apply \- creates the comprts declared in a file`,
+			`remove failed creates (default: true)`,
+			`label the comprt (ex. \-\-label team=infra)`,
+			`.SH SEE ALSO`,
+		},
+	} {
+		page, err := os.ReadFile(pagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range lines {
+			if !strings.Contains(string(page), line+"\n") {
+				t.Fatalf("expected the line %q in %v:\n%s", line, pagePath, page)
+			}
+		}
+	}
+}
+
+func TestRoffEscape(t *testing.T) {
+	for text, expected := range map[string]string{
+		"--foo":        `\-\-foo`,
+		`C:\dir`:       `C:\edir`,
+		".not a macro": `\&.not a macro`,
+	} {
+		if escaped := roffEscape(text); escaped != expected {
+			t.Fatalf("expected %q, got %q", expected, escaped)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A type used to declare what a comprt should have, beyond what the comprt
+// config file does.
+type comprtManifest struct {
+	Users []manifestUser `json:"users,omitempty"`
+	Repos []aptRepo      `json:"repos,omitempty"`
+	Copy  []comprtCopy   `json:"copy,omitempty"`
+	// Mounted into the comprt by the chroot and provision commands.
+	Caches []cacheMount `json:"caches,omitempty"`
+	// Ran against the comprt after the comprt config file.
+	Ansible []ansiblePlaybook `json:"ansible,omitempty"`
+
+	// The dir of the manifest, relative paths in the manifest are relative to it.
+	dir string
+}
+
+// A type used to declare a user to create in the comprt.
+type manifestUser struct {
+	Name string `json:"name"`
+	Uid  int    `json:"uid"`
+	// Defaults to the uid.
+	Gid    *int     `json:"gid,omitempty"`
+	Shell  string   `json:"shell,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	// Public keys or files of them.
+	SSHKeys       []string `json:"ssh_keys,omitempty"`
+	Sudo          string   `json:"sudo,omitempty"`
+	CryptPassword string   `json:"crypt_password,omitempty"`
+}
+
+// Read in the yaml manifest, fields that are not known are an error as they are
+// likely a typo.
+func loadManifest(manifestPath string) (*comprtManifest, error) {
+	manifestBytes, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest comprtManifest
+	if err := decodeStrictYaml(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %w", manifestPath, err)
+	}
+
+	absManifestPath, err := filepath.Abs(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest.dir = filepath.Dir(absManifestPath)
+
+	return &manifest, nil
+}
+
+// Get the path in the manifest relative to the manifest's dir.
+func (manifest *comprtManifest) path(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(manifest.dir, path)
+}
+
+// Get the users declared in the manifest. A user cannot share a name or uid
+// with another user, including the users passed in (e.g. the default comprt
+// user).
+func (manifest *comprtManifest) comprtUsers(existingUsers []comprtUser) ([]comprtUser, error) {
+	var names, uids map[string]bool = make(map[string]bool), make(map[string]bool)
+	for _, user := range existingUsers {
+		names[user.name], uids[fmt.Sprint(user.uid)] = true, true
+	}
+
+	var users []comprtUser
+	for _, declaredUser := range manifest.Users {
+		user := comprtUser{
+			name:          declaredUser.Name,
+			uid:           declaredUser.Uid,
+			gid:           declaredUser.Uid,
+			shell:         declaredUser.Shell,
+			groups:        declaredUser.Groups,
+			cryptPassword: declaredUser.CryptPassword,
+			sudo:          declaredUser.Sudo,
+		}
+		if declaredUser.Gid != nil {
+			user.gid = *declaredUser.Gid
+		}
+		if user.shell == "" {
+			user.shell = defaultComprtUserShell
+		}
+
+		if err := user.validate(); err != nil {
+			return nil, err
+		} else if names[user.name] || uids[fmt.Sprint(user.uid)] {
+			return nil, fmt.Errorf("the name or uid of user %v is already used by another user", user.name)
+		} else if user.sudo != "" && !stringInArr(user.sudo, &sudoModes) {
+			return nil, fmt.Errorf("%v is not a sudo mode of user %v", user.sudo, user.name)
+		}
+		if err := checkCryptPassword(user.cryptPassword); err != nil {
+			warnf("user %v: %v", user.name, err)
+		}
+		names[user.name], uids[fmt.Sprint(user.uid)] = true, true
+
+		var sshKeys []string
+		for _, sshKey := range declaredUser.SSHKeys {
+			if _, err := os.Stat(manifest.path(sshKey)); err == nil {
+				sshKey = manifest.path(sshKey)
+			}
+			sshKeys = append(sshKeys, sshKey)
+		}
+		var err error
+		if user.sshKeys, err = readSshKeys(sshKeys); err != nil {
+			return nil, fmt.Errorf("user %v: %w", user.name, err)
+		}
+
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// Get the third-party apt repos declared in the manifest, with the paths of
+// their keys made relative to the manifest.
+func (manifest *comprtManifest) aptRepos() []aptRepo {
+	var repos []aptRepo
+	for _, repo := range manifest.Repos {
+		if repo.Key != "" && !repo.keyIsURL() {
+			repo.Key = manifest.path(repo.Key)
+		}
+		repos = append(repos, repo)
+	}
+
+	return repos
+}
+
+// Get the copies declared in the manifest, with their srcs made relative to the
+// manifest.
+func (manifest *comprtManifest) comprtCopies() []comprtCopy {
+	var copies []comprtCopy
+	for _, comprtCp := range manifest.Copy {
+		comprtCp.Src = manifest.path(comprtCp.Src)
+		copies = append(copies, comprtCp)
+	}
+
+	return copies
+}
+
+// Get the ansible playbooks declared in the manifest, with their paths made
+// relative to the manifest.
+func (manifest *comprtManifest) ansiblePlaybooks() []ansiblePlaybook {
+	var playbooks []ansiblePlaybook
+	for _, playbook := range manifest.Ansible {
+		playbook.Playbook = manifest.path(playbook.Playbook)
+		playbooks = append(playbooks, playbook)
+	}
+
+	return playbooks
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifestUsers(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if err := createTestFile(filepath.Join(tempDirPath, "builder.pub"), testSshKeys[1]+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	var manifestPath string = filepath.Join(tempDirPath, "manifest.yaml")
+	if err := createTestFile(manifestPath, `users:
+  - name: builder
+    uid: 2000
+    groups: [adm]
+    ssh_keys: [builder.pub]
+    sudo: nopasswd
+  - name: tester
+    uid: 2001
+    gid: 100
+    shell: /bin/sh
+    ssh_keys:
+      - "`+testSshKeys[0]+`"
+repos:
+  - name: docker
+    url: https://download.docker.com/linux/debian
+    suite: buster
+    components: [stable]
+    key: docker.gpg
+copy:
+  - src: builder.pub
+    dest: /etc/builder.pub
+    mode: 0644
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := loadManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := manifest.comprtUsers([]comprtUser{defaultComprtUser()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []comprtUser = []comprtUser{
+		{
+			name:    "builder",
+			uid:     2000,
+			gid:     2000,
+			shell:   defaultComprtUserShell,
+			groups:  []string{"adm"},
+			sshKeys: []string{testSshKeys[1]},
+			sudo:    sudoNoPasswd,
+		},
+		{
+			name:    "tester",
+			uid:     2001,
+			gid:     100,
+			shell:   "/bin/sh",
+			sshKeys: []string{testSshKeys[0]},
+		},
+	}
+	if !reflect.DeepEqual(users, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, users)
+	}
+
+	if repos := manifest.aptRepos(); len(repos) != 1 || repos[0].Key != filepath.Join(tempDirPath, "docker.gpg") {
+		t.Fatalf("the repo's key was not made relative to the manifest: %+v", repos)
+	}
+	if copies := manifest.comprtCopies(); len(copies) != 1 || copies[0].Src != filepath.Join(tempDirPath, "builder.pub") {
+		t.Fatalf("the copy's src was not made relative to the manifest: %+v", copies)
+	} else if copies[0].Mode != "0644" {
+		t.Fatalf("expected: %v, actual: %v", "0644", copies[0].Mode)
+	}
+}
+
+func TestManifestUsersInvalid(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var manifestPath string = filepath.Join(tempDirPath, "manifest.yaml")
+	for _, contents := range []string{
+		`{"users": [{"name": "builder", "uid": 2000, "sudoers": "nopasswd"}]}`,
+		`{"users": [{"name": "builder", "uid": 2000}, {"name": "builder", "uid": 2001}]}`,
+		`{"users": [{"name": "builder", "uid": 1224}]}`,
+		`{"users": [{"name": "builder", "uid": 2000, "sudo": "always"}]}`,
+	} {
+		if err := createTestFile(manifestPath, contents); err != nil {
+			t.Fatal(err)
+		}
+
+		manifest, err := loadManifest(manifestPath)
+		if err == nil {
+			_, err = manifest.comprtUsers([]comprtUser{defaultComprtUser()})
+		}
+		if err == nil {
+			t.Fatalf("an invalid manifest was accepted: %v", contents)
+		}
+	}
+
+	// a password that does not look hashed is only warned about
+	if err := createTestFile(manifestPath, `{"users": [{"name": "builder", "uid": 2000, "crypt_password": "hunter2"}]}`); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := loadManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := manifest.comprtUsers([]comprtUser{defaultComprtUser()}); err != nil {
+		t.Fatal(err)
+	}
+}
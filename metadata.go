@@ -0,0 +1,161 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// Where the comprt's metadata is kept in the comprt, that way the metadata
+	// goes wherever the comprt does (e.g. when it is exported).
+	comprtMetadataPath = "/etc/debcomprt/metadata.json"
+
+	textOutput = "text"
+)
+
+// A type used to describe how a comprt was created.
+type comprtMetadata struct {
+	CodeName string `json:"codename"`
+	Arch     string `json:"arch"`
+	Alias    string `json:"alias"`
+	Mirror   string `json:"mirror"`
+	// The user logged in as by the chroot command, empty if it was unknown when
+	// the comprt was created.
+	User    string    `json:"user,omitempty"`
+	Created time.Time `json:"created"`
+	Version string    `json:"debcomprt_version"`
+	// How long each phase of creating the comprt took, the phases are only known
+	// by the comprt itself when it was not created rootless.
+	Phases []phaseDuration `json:"phases,omitempty"`
+	// The root hash of the comprt's digest, empty if no digest was recorded (see
+	// the digest command).
+	Digest string `json:"digest,omitempty"`
+}
+
+// Write the metadata into the comprt.
+func writeComprtMetadata(target string, metadata comprtMetadata) error {
+	contents, err := json.MarshalIndent(metadata, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	var metadataPath string = filepath.Join(target, comprtMetadataPath)
+	if err := os.MkdirAll(filepath.Dir(metadataPath), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return err
+	}
+
+	return os.WriteFile(metadataPath, append(contents, '\n'), OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R)
+}
+
+// Read in the metadata of the comprt, nil is returned for a comprt created before
+// debcomprt kept metadata.
+func readComprtMetadata(target string) (*comprtMetadata, error) {
+	contents, err := os.ReadFile(filepath.Join(target, comprtMetadataPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var metadata comprtMetadata
+	if err := json.Unmarshal(contents, &metadata); err != nil {
+		return nil, fmt.Errorf("%v: %w", comprtMetadataPath, err)
+	}
+
+	return &metadata, nil
+}
+
+// Get the name of the user in the comprt with the uid, empty if there is no such
+// user.
+func comprtUserName(target string, uid int) (string, error) {
+	var loginNameIndex, uidIndex int = 0, 2
+	return locateField(
+		filepath.Join(target, "/etc/passwd"),
+		regexp.MustCompile(":"),
+		uidIndex,
+		loginNameIndex,
+		regexp.MustCompile("^"+strconv.Itoa(uid)+"$"),
+	)
+}
+
+// Get the metadata of the comprt, falling back on its registry entry for a comprt
+// created before debcomprt kept metadata.
+func getComprtMetadata(target string) (*comprtMetadata, error) {
+	metadata, err := readComprtMetadata(target)
+	if err != nil || metadata != nil {
+		return metadata, err
+	}
+
+	entry, err := lookupComprt(target)
+	if err != nil {
+		return nil, err
+	} else if entry == nil {
+		return nil, fmt.Errorf("%v has no metadata and is not in the registry", target)
+	}
+
+	return &comprtMetadata{
+		CodeName: entry.CodeName,
+		Arch:     entry.Arch,
+		Alias:    entry.Alias,
+		Mirror:   entry.Mirror,
+		User:     entry.User,
+		Created:  entry.Created,
+		Version:  entry.Version,
+		Digest:   entry.Digest,
+	}, nil
+}
+
+// Write the comprt's metadata in the format (text or json).
+func writeComprtInfo(w io.Writer, format string, metadata comprtMetadata) error {
+	switch format {
+	case jsonOutput:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(metadata)
+	case textOutput:
+		tabWriter := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, field := range [][]string{
+			{"codename", metadata.CodeName},
+			{"arch", metadata.Arch},
+			{"alias", metadata.Alias},
+			{"mirror", metadata.Mirror},
+			{"user", metadata.User},
+			{"created", metadata.Created.Format(time.RFC3339)},
+			{"debcomprt version", metadata.Version},
+		} {
+			fmt.Fprintf(tabWriter, "%v:\t%v\n", field[0], field[1])
+		}
+		if metadata.Digest != "" {
+			fmt.Fprintf(tabWriter, "digest:\t%v\n", metadata.Digest)
+		}
+		for _, phase := range metadata.Phases {
+			fmt.Fprintf(tabWriter, "%v phase:\t%.1fs\n", phase.Name, phase.Seconds)
+		}
+		return tabWriter.Flush()
+	default:
+		return fmt.Errorf("%v is not a supported output format", format)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testComprtMetadata = comprtMetadata{
+	CodeName: testCodeCame,
+	Arch:     "amd64",
+	Alias:    noAlias,
+	Mirror:   defaultDebianMirror,
+	User:     defaultComprtUserName,
+	Created:  time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC),
+	Version:  "1.0.0",
+}
+
+func TestGetComprtMetadata(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var testTarget string = filepath.Join(progDataDir, "testChroot")
+	if err := os.Mkdir(testTarget, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := getComprtMetadata(testTarget); err == nil {
+		t.Fatal("metadata was found for a comprt without any")
+	}
+
+	// e.g. a comprt created before debcomprt kept metadata
+	if err := registerComprt(registryEntry{Target: testTarget, CodeName: testCodeCame, Mirror: defaultDebianMirror}); err != nil {
+		t.Fatal(err)
+	}
+	if metadata, err := getComprtMetadata(testTarget); err != nil {
+		t.Fatal(err)
+	} else if metadata.CodeName != testCodeCame || metadata.Mirror != defaultDebianMirror {
+		t.Fatalf("expected the metadata from the registry, got %+v", *metadata)
+	}
+
+	if err := writeComprtMetadata(testTarget, testComprtMetadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata, err := getComprtMetadata(testTarget); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(*metadata, testComprtMetadata) {
+		t.Fatalf("expected %+v, got %+v", testComprtMetadata, *metadata)
+	}
+}
+
+func TestWriteComprtInfo(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeComprtInfo(&buf, textOutput, testComprtMetadata); err != nil {
+		t.Fatal(err)
+	}
+	var expected string = "codename:           buster\n" +
+		"arch:               amd64\n" +
+		"alias:              none\n" +
+		"mirror:             http://ftp.us.debian.org/debian/\n" +
+		"user:               debcomprt\n" +
+		"created:            2024-01-15T00:00:00Z\n" +
+		"debcomprt version:  1.0.0\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+
+	if err := writeComprtInfo(&buf, csvOutput, testComprtMetadata); err == nil {
+		t.Fatalf("the metadata was written as %v", csvOutput)
+	}
+}
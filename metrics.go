@@ -0,0 +1,293 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	metricsPath = "/metrics"
+	// The content type of the prometheus text format.
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	procDir = "/proc"
+)
+
+// A type used to store the metrics of the comprts on the host. The counters are
+// taken from the audit log, so they include the operations not ran by the
+// daemon.
+type comprtMetrics struct {
+	creates       int
+	createsFailed int
+	// The phases in the order they were first seen.
+	phaseNames   []string
+	phaseSeconds map[string]float64
+	phaseCounts  map[string]int
+	cacheHits    int
+	cacheMisses  int
+	// The chroot sessions running on the host.
+	chrootSessions int
+	// The daemon's jobs that are running.
+	jobsRunning int
+}
+
+// A type used to keep the metrics taken from the audit log between scrapes,
+// that way only the records appended since the last scrape are read.
+type auditLogMetrics struct {
+	mu      sync.Mutex
+	metrics *comprtMetrics
+	// The audit log read so far, and how far into it was read.
+	fileInfo os.FileInfo
+	offset   int64
+}
+
+func newComprtMetrics() *comprtMetrics {
+	return &comprtMetrics{phaseSeconds: make(map[string]float64), phaseCounts: make(map[string]int)}
+}
+
+// Get a copy of the metrics that can be added to without changing them.
+func (metrics *comprtMetrics) clone() *comprtMetrics {
+	var cloned comprtMetrics = *metrics
+	cloned.phaseNames = append([]string{}, metrics.phaseNames...)
+	cloned.phaseSeconds, cloned.phaseCounts = make(map[string]float64), make(map[string]int)
+	for name := range metrics.phaseCounts {
+		cloned.phaseSeconds[name] = metrics.phaseSeconds[name]
+		cloned.phaseCounts[name] = metrics.phaseCounts[name]
+	}
+
+	return &cloned
+}
+
+// Add the audit log's records to the metrics, a record that cannot be read (e.g.
+// a line cut short by a full disk) is skipped. How much of the audit log was
+// read is returned, a last line without a newline is left unread as it may
+// still be being appended.
+func (metrics *comprtMetrics) addAuditLog(r io.Reader) (int64, error) {
+	var read int64
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return read, nil
+		} else if err != nil {
+			return read, err
+		}
+		read += int64(len(line))
+
+		var record auditRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			continue
+		}
+
+		metrics.cacheHits += record.CacheHits
+		metrics.cacheMisses += record.CacheMisses
+		if record.Command != "create" {
+			continue
+		}
+		metrics.creates++
+		if record.Result == auditFailure {
+			metrics.createsFailed++
+		}
+		for _, phase := range record.Phases {
+			if _, ok := metrics.phaseCounts[phase.Name]; !ok {
+				metrics.phaseNames = append(metrics.phaseNames, phase.Name)
+			}
+			metrics.phaseSeconds[phase.Name] += phase.Seconds
+			metrics.phaseCounts[phase.Name]++
+		}
+	}
+}
+
+// Get the metrics taken from the audit log, reading only what was appended
+// since the last time. A replaced (or truncated) audit log is read from the
+// start.
+func (audit *auditLogMetrics) update(auditLogPath string) (*comprtMetrics, error) {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	auditLog, err := os.Open(auditLogPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		audit.metrics, audit.fileInfo, audit.offset = newComprtMetrics(), nil, 0
+		return audit.metrics.clone(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer auditLog.Close()
+
+	fileInfo, err := auditLog.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if audit.metrics == nil || audit.fileInfo == nil || !os.SameFile(audit.fileInfo, fileInfo) || fileInfo.Size() < audit.offset {
+		audit.metrics, audit.offset = newComprtMetrics(), 0
+	}
+	audit.fileInfo = fileInfo
+
+	if _, err := auditLog.Seek(audit.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	read, err := audit.metrics.addAuditLog(auditLog)
+	audit.offset += read
+	if err != nil {
+		return nil, err
+	}
+
+	return audit.metrics.clone(), nil
+}
+
+// Check whether the process is debcomprt (exe) running the chroot command.
+func isChrootSession(procPath, exe string) bool {
+	if procExe, err := os.Readlink(filepath.Join(procPath, "exe")); err != nil || procExe != exe {
+		return false
+	}
+	cmdline, err := os.ReadFile(filepath.Join(procPath, "cmdline"))
+	if err != nil {
+		return false
+	}
+
+	for _, arg := range strings.Split(string(cmdline), "\x00") {
+		if arg == "chroot" {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the parent pid of the process.
+func parentPid(procPath string) (string, error) {
+	stat, err := os.ReadFile(filepath.Join(procPath, "stat"))
+	if err != nil {
+		return "", err
+	}
+
+	// e.g. '42 (debcomprt) S 1 ...', the command may have spaces in it
+	var fields []string = strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	if len(fields) < 2 {
+		return "", fmt.Errorf("%v: unexpected format", filepath.Join(procPath, "stat"))
+	}
+
+	return fields[1], nil
+}
+
+// Count the chroot sessions running on the host. A session re-executed into its
+// own mount namespace is only counted once, by not counting a session whose
+// parent is a session too.
+func countChrootSessions(procDir, exe string) (int, error) {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return 0, err
+	}
+
+	var sessions map[string]bool = make(map[string]bool)
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err == nil && isChrootSession(filepath.Join(procDir, entry.Name()), exe) {
+			sessions[entry.Name()] = true
+		}
+	}
+
+	var count int
+	for pid := range sessions {
+		ppid, err := parentPid(filepath.Join(procDir, pid))
+		if errors.Is(err, fs.ErrNotExist) {
+			// the session has since ended
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		if !sessions[ppid] {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Collect the metrics of the comprts on the host.
+func (d *daemon) collectMetrics(auditLogPath, procDir string) (*comprtMetrics, error) {
+	metrics, err := d.auditMetrics.update(auditLogPath)
+	if err != nil {
+		return nil, err
+	}
+
+	exe, err := os.Readlink(filepath.Join(procDir, "self", "exe"))
+	if err != nil {
+		return nil, err
+	}
+	if metrics.chrootSessions, err = countChrootSessions(procDir, exe); err != nil {
+		return nil, err
+	}
+
+	for _, job := range d.listJobs() {
+		if job.Status == jobRunning {
+			metrics.jobsRunning++
+		}
+	}
+
+	return metrics, nil
+}
+
+// Write the metrics in the prometheus text format.
+func writeMetrics(w io.Writer, metrics *comprtMetrics) error {
+	var buf bytes.Buffer
+	writeMetric := func(name, metricType, help string, value interface{}) {
+		fmt.Fprintf(&buf, "# HELP %v %v\n# TYPE %v %v\n%v %v\n", name, help, name, metricType, name, value)
+	}
+
+	writeMetric("debcomprt_creates_total", "counter", "Comprts created on the host, including the creates that failed.", metrics.creates)
+	writeMetric("debcomprt_creates_failed_total", "counter", "Comprts that failed to be created on the host.", metrics.createsFailed)
+
+	fmt.Fprintf(&buf, "# HELP debcomprt_create_phase_seconds How long each phase of creating a comprt took.\n")
+	fmt.Fprintf(&buf, "# TYPE debcomprt_create_phase_seconds summary\n")
+	for _, name := range metrics.phaseNames {
+		fmt.Fprintf(&buf, "debcomprt_create_phase_seconds_sum{phase=%q} %v\n", name, metrics.phaseSeconds[name])
+		fmt.Fprintf(&buf, "debcomprt_create_phase_seconds_count{phase=%q} %v\n", name, metrics.phaseCounts[name])
+	}
+
+	writeMetric("debcomprt_cache_hits_total", "counter", "Caches that were warm when mounted into a comprt.", metrics.cacheHits)
+	writeMetric("debcomprt_cache_misses_total", "counter", "Caches that were cold when mounted into a comprt.", metrics.cacheMisses)
+	writeMetric("debcomprt_chroot_sessions_active", "gauge", "Chroot sessions running on the host.", metrics.chrootSessions)
+	writeMetric("debcomprt_jobs_running", "gauge", "Jobs the daemon is running.", metrics.jobsRunning)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (d *daemon) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJsonError(w, http.StatusMethodNotAllowed, fmt.Errorf("%v is not allowed", r.Method))
+		return
+	}
+
+	metrics, err := d.collectMetrics(filepath.Join(progDataDir, auditLogFile), procDir)
+	if err != nil {
+		writeJsonError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", metricsContentType)
+	writeMetrics(w, metrics)
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Create a process in the fake proc dir.
+func createTestProc(procDir, pid, ppid, exe string, args []string) error {
+	var procPath string = filepath.Join(procDir, pid)
+	if err := os.Mkdir(procPath, os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Symlink(exe, filepath.Join(procPath, "exe")); err != nil {
+		return err
+	}
+	if err := createTestFile(filepath.Join(procPath, "cmdline"), strings.Join(args, "\x00")+"\x00"); err != nil {
+		return err
+	}
+
+	return createTestFile(filepath.Join(procPath, "stat"), pid+" (debcomprt bin) S "+ppid+" 1 1 0\n")
+}
+
+func TestCountChrootSessions(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var exe string = "/usr/local/bin/debcomprt"
+	for _, proc := range []struct {
+		pid  string
+		ppid string
+		exe  string
+		args []string
+	}{
+		// a session re-executed into its own mount namespace
+		{"10", "1", exe, []string{"debcomprt", "chroot", "/srv/foo"}},
+		{"11", "10", exe, []string{"debcomprt", "chroot", "/srv/foo"}},
+		{"20", "1", exe, []string{"debcomprt", "--rootless", "chroot", "/srv/bar"}},
+		{"30", "1", exe, []string{"debcomprt", "create", testCodeCame, "/srv/baz"}},
+		{"40", "1", "/usr/bin/chroot", []string{"chroot", "/srv/foo"}},
+	} {
+		if err := createTestProc(tempDirPath, proc.pid, proc.ppid, proc.exe, proc.args); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count, err := countChrootSessions(tempDirPath, exe); err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Fatalf("expected 2 chroot sessions, got %v", count)
+	}
+}
+
+func TestAddAuditLog(t *testing.T) {
+	var auditLog string = strings.Join([]string{
+		`{"command": "create", "result": "success", "phases": [{"name": "bootstrap download", "seconds": 10}, {"name": "apt update", "seconds": 2}], "cache_hits": 1}`,
+		`{"command": "create", "result": "failure", "cache_misses": 1}`,
+		`{"command": "create", "result": "success", "phases": [{"name": "bootstrap download", "seconds": 20}]}`,
+		`{"command": "chroot", "result": "success", "cache_hits": 2}`,
+		`{"command": "create", "resu`,
+	}, "\n")
+
+	var metrics *comprtMetrics = newComprtMetrics()
+	if read, err := metrics.addAuditLog(strings.NewReader(auditLog)); err != nil {
+		t.Fatal(err)
+	} else if expected := int64(strings.LastIndex(auditLog, "\n") + 1); read != expected {
+		t.Fatalf("expected the last line to be left unread, read %v of %v", read, expected)
+	}
+
+	if metrics.creates != 3 || metrics.createsFailed != 1 {
+		t.Fatalf("expected 3 creates with 1 failed, got %v with %v failed", metrics.creates, metrics.createsFailed)
+	} else if metrics.cacheHits != 3 || metrics.cacheMisses != 1 {
+		t.Fatalf("expected 3 cache hits and 1 miss, got %v and %v", metrics.cacheHits, metrics.cacheMisses)
+	} else if metrics.phaseSeconds[bootstrapDownloadPhase] != 30 || metrics.phaseCounts[bootstrapDownloadPhase] != 2 {
+		t.Fatalf("expected 30s over 2 bootstrap downloads, got %vs over %v", metrics.phaseSeconds[bootstrapDownloadPhase], metrics.phaseCounts[bootstrapDownloadPhase])
+	}
+}
+
+func TestAuditLogMetricsUpdate(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var auditLogPath string = filepath.Join(tempDirPath, auditLogFile)
+	var audit auditLogMetrics
+	for _, tc := range []struct {
+		appended string
+		creates  int
+	}{
+		{`{"command": "create", "result": "success"}` + "\n" + `{"command": "create", "re`, 1},
+		// only what was appended is read, including the rest of a cut off line
+		{`sult": "failure"}` + "\n", 2},
+		{`{"command": "chroot", "result": "success"}` + "\n", 2},
+	} {
+		auditLog, err := os.OpenFile(auditLogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = auditLog.WriteString(tc.appended)
+		auditLog.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		metrics, err := audit.update(auditLogPath)
+		if err != nil {
+			t.Fatal(err)
+		} else if metrics.creates != tc.creates {
+			t.Fatalf("expected: %v, actual: %v", tc.creates, metrics.creates)
+		}
+	}
+
+	// a truncated audit log is read from the start
+	if err := createTestFile(auditLogPath, `{"command": "create", "result": "failure"}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if metrics, err := audit.update(auditLogPath); err != nil {
+		t.Fatal(err)
+	} else if metrics.creates != 1 || metrics.createsFailed != 1 {
+		t.Fatalf("expected 1 failed create, got %v with %v failed", metrics.creates, metrics.createsFailed)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	var metrics *comprtMetrics = &comprtMetrics{
+		creates:        3,
+		createsFailed:  1,
+		phaseNames:     []string{bootstrapDownloadPhase},
+		phaseSeconds:   map[string]float64{bootstrapDownloadPhase: 30.5},
+		phaseCounts:    map[string]int{bootstrapDownloadPhase: 2},
+		chrootSessions: 1,
+	}
+
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, metrics); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE debcomprt_creates_total counter",
+		"debcomprt_creates_total 3",
+		"debcomprt_creates_failed_total 1",
+		`debcomprt_create_phase_seconds_sum{phase="bootstrap download"} 30.5`,
+		`debcomprt_create_phase_seconds_count{phase="bootstrap download"} 2`,
+		"debcomprt_chroot_sessions_active 1",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Fatalf("expected the line %q in:\n%v", line, buf.String())
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	minimizeDpkgCfgPath = "/etc/dpkg/dpkg.cfg.d/" + progname + "-minimize"
+	aptListsDir         = "/var/lib/apt/lists"
+	aptCacheDir         = "/var/cache/apt"
+)
+
+// A type used to describe the files left out of a minimized comprt, in dpkg's
+// path-exclude/path-include glob format (where * also matches a '/').
+type minimizePolicy struct {
+	excludes []string
+	includes []string
+}
+
+// The kinds of files a minimized comprt is without, unless kept. The copyrights
+// are kept, as debian's policy requires them to be shipped.
+var minimizeCategories = map[string]minimizePolicy{
+	"docs": {
+		excludes: []string{"/usr/share/doc/*", "/usr/share/info/*"},
+		includes: []string{"/usr/share/doc/*/copyright"},
+	},
+	"man": {
+		excludes: []string{"/usr/share/man/*"},
+	},
+	"locales": {
+		excludes: []string{"/usr/share/locale/*"},
+		includes: []string{"/usr/share/locale/locale.alias"},
+	},
+}
+
+// Get the policy a comprt is minimized with. Each kept value is either one of
+// the categories, which is then left as is, or a path glob to keep (e.g.
+// /usr/share/locale/en*).
+func newMinimizePolicy(keep []string) (minimizePolicy, error) {
+	var categories []string
+	for category := range minimizeCategories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	var policy minimizePolicy
+	for _, kept := range keep {
+		if _, ok := minimizeCategories[kept]; !ok && !filepath.IsAbs(kept) {
+			return minimizePolicy{}, fmt.Errorf("%v is not one of %v or an absolute path to keep", kept, strings.Join(categories, ", "))
+		}
+	}
+	for _, category := range categories {
+		if stringInArr(category, &keep) {
+			continue
+		}
+		policy.excludes = append(policy.excludes, minimizeCategories[category].excludes...)
+		policy.includes = append(policy.includes, minimizeCategories[category].includes...)
+	}
+	for _, kept := range keep {
+		if filepath.IsAbs(kept) {
+			policy.includes = append(policy.includes, kept)
+		}
+	}
+
+	return policy, nil
+}
+
+// Generate the dpkg config that keeps the packages installed later on from
+// putting back what was removed, for reference:
+// https://manpages.debian.org/dpkg.1#path~2
+func (policy minimizePolicy) dpkgCfg() []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# written by %v for --minimize\n", progname)
+	for _, exclude := range policy.excludes {
+		fmt.Fprintf(&sb, "path-exclude=%v\n", exclude)
+	}
+	for _, include := range policy.includes {
+		fmt.Fprintf(&sb, "path-include=%v\n", include)
+	}
+
+	return []byte(sb.String())
+}
+
+// Compile the glob into a regexp that matches the same paths as dpkg, which
+// matches globs with fnmatch(3) without FNM_PATHNAME.
+func compileDpkgGlob(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			j := strings.IndexByte(glob[i:], ']')
+			if j == -1 {
+				return nil, fmt.Errorf("the glob %v is missing a ]", glob)
+			}
+			class := glob[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += j
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+		}
+	}
+	sb.WriteString("$")
+
+	return regexp.Compile(sb.String())
+}
+
+// Get a func that checks whether a path in the comprt is left out by the
+// policy.
+func (policy minimizePolicy) matcher() (func(path string) bool, error) {
+	var excludes, includes []*regexp.Regexp
+	for _, exclude := range policy.excludes {
+		re, err := compileDpkgGlob(exclude)
+		if err != nil {
+			return nil, err
+		}
+		excludes = append(excludes, re)
+	}
+	for _, include := range policy.includes {
+		re, err := compileDpkgGlob(include)
+		if err != nil {
+			return nil, err
+		}
+		includes = append(includes, re)
+	}
+
+	return func(path string) bool {
+		var matched bool
+		for _, re := range excludes {
+			if re.MatchString(path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+		for _, re := range includes {
+			if re.MatchString(path) {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
+// Remove the files under the dir in the comprt that match, returning the
+// number of bytes freed. Dirs are left as is, dpkg expects them to be there.
+func removeMatching(target, dir string, match func(path string) bool) (int64, error) {
+	if err := checkComprtPath(target, dir); err != nil {
+		return 0, err
+	}
+
+	var freed int64
+	err := filepath.WalkDir(filepath.Join(target, dir), func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if entry.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(target, path)
+		if err != nil {
+			return err
+		}
+		if !match(filepath.Join("/", relPath)) {
+			return nil
+		}
+
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		freed += fileInfo.Size()
+
+		return nil
+	})
+
+	return freed, err
+}
+
+// Minimize the comprt, once it is configured. The files left out by the policy
+// are removed and dpkg is configured to leave them out from then on. apt's
+// package lists and caches are cleared, running apt-get update brings back the
+// lists. Returns the number of bytes freed.
+func minimizeComprt(target string, policy minimizePolicy) (int64, error) {
+	excluded, err := policy.matcher()
+	if err != nil {
+		return 0, err
+	}
+
+	var freed int64
+	for _, exclude := range policy.excludes {
+		// only the dir before the first wildcard needs to be walked
+		dir := exclude
+		if i := strings.IndexAny(exclude, "*?["); i > -1 {
+			dir = filepath.Dir(exclude[:i+1])
+		}
+		removed, err := removeMatching(target, dir, excluded)
+		freed += removed
+		if err != nil {
+			return freed, err
+		}
+	}
+
+	if err := checkComprtPath(target, minimizeDpkgCfgPath); err != nil {
+		return freed, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(target, minimizeDpkgCfgPath)), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return freed, err
+	}
+	if err := os.WriteFile(filepath.Join(target, minimizeDpkgCfgPath), policy.dpkgCfg(), OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R); err != nil {
+		return freed, err
+	}
+
+	removed, err := removeMatching(target, aptListsDir, func(path string) bool {
+		return filepath.Base(path) != "lock"
+	})
+	freed += removed
+	if err != nil {
+		return freed, err
+	}
+	removed, err = removeMatching(target, aptCacheDir, func(path string) bool {
+		return strings.HasSuffix(path, ".bin") || strings.HasSuffix(path, ".deb")
+	})
+	freed += removed
+
+	return freed, err
+}
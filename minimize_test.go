@@ -0,0 +1,142 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewMinimizePolicy(t *testing.T) {
+	policy, err := newMinimizePolicy([]string{"man", "/usr/share/locale/en*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dpkgCfg string = string(policy.dpkgCfg())
+	if strings.Contains(dpkgCfg, "/usr/share/man") {
+		t.Fatalf("the man pages were not kept:\n%v", dpkgCfg)
+	}
+	for _, line := range []string{
+		"path-exclude=/usr/share/doc/*",
+		"path-include=/usr/share/doc/*/copyright",
+		"path-exclude=/usr/share/locale/*",
+		"path-include=/usr/share/locale/en*",
+	} {
+		if !strings.Contains(dpkgCfg, line+"\n") {
+			t.Fatalf("%q is missing from:\n%v", line, dpkgCfg)
+		}
+	}
+
+	if _, err := newMinimizePolicy([]string{"foo"}); err == nil {
+		t.Fatal("an unknown category was accepted")
+	}
+}
+
+func TestCompileDpkgGlob(t *testing.T) {
+	for glob, paths := range map[string]map[string]bool{
+		"/usr/share/doc/*": {
+			"/usr/share/doc/git/changelog.gz": true,
+			"/usr/share/doc-base/git":         false,
+		},
+		"/usr/share/doc/*/copyright": {
+			"/usr/share/doc/git/copyright":           true,
+			"/usr/share/doc/git/contrib/copyright":   true,
+			"/usr/share/doc/git/copyright/README.md": false,
+		},
+		"/usr/share/locale/[!d]?/*": {
+			"/usr/share/locale/en/LC_MESSAGES/git.mo": true,
+			"/usr/share/locale/de/LC_MESSAGES/git.mo": false,
+		},
+	} {
+		re, err := compileDpkgGlob(glob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for path, expected := range paths {
+			if actual := re.MatchString(path); actual != expected {
+				t.Fatalf("%v matching %v, expected: %v, actual: %v", glob, path, expected, actual)
+			}
+		}
+	}
+}
+
+func TestMinimizeComprt(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	for path, contents := range map[string]string{
+		"/usr/share/doc/git/changelog.gz":            "foo",
+		"/usr/share/doc/git/copyright":               "bar",
+		"/usr/share/man/man1/git.1.gz":               "baz",
+		"/usr/share/locale/de/LC_MESSAGES/git.mo":    "qux",
+		"/usr/share/locale/en/LC_MESSAGES/git.mo":    "quux",
+		"/usr/share/locale/locale.alias":             "corge",
+		aptListsDir + "/deb.debian.org_debian_dists": "grault",
+		aptListsDir + "/lock":                        "",
+		aptCacheDir + "/pkgcache.bin":                "garply",
+		aptCacheDir + "/archives/git_1.0_all.deb":    "waldo",
+		"/usr/bin/git":                               "fred",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(tempDirPath, path)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(filepath.Join(tempDirPath, path), contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy, err := newMinimizePolicy([]string{"/usr/share/locale/en/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	freed, err := minimizeComprt(tempDirPath, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := int64(len("foo" + "baz" + "qux" + "grault" + "garply" + "waldo")); freed != expected {
+		t.Fatalf("expected: %v, actual: %v", expected, freed)
+	}
+
+	for path, kept := range map[string]bool{
+		"/usr/share/doc/git/changelog.gz":            false,
+		"/usr/share/doc/git/copyright":               true,
+		"/usr/share/man/man1/git.1.gz":               false,
+		"/usr/share/man/man1":                        true,
+		"/usr/share/locale/de/LC_MESSAGES/git.mo":    false,
+		"/usr/share/locale/en/LC_MESSAGES/git.mo":    true,
+		"/usr/share/locale/locale.alias":             true,
+		aptListsDir + "/deb.debian.org_debian_dists": false,
+		aptListsDir + "/lock":                        true,
+		aptCacheDir + "/pkgcache.bin":                false,
+		aptCacheDir + "/archives/git_1.0_all.deb":    false,
+		"/usr/bin/git":                               true,
+		minimizeDpkgCfgPath:                          true,
+	} {
+		if _, err := os.Lstat(filepath.Join(tempDirPath, path)); err == nil && !kept {
+			t.Fatalf("%v was not removed", path)
+		} else if errors.Is(err, fs.ErrNotExist) && kept {
+			t.Fatalf("%v was removed", path)
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal(err)
+		}
+	}
+}
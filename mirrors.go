@@ -0,0 +1,203 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	fileUrlScheme = "file://"
+
+	debianSnapshotUrl = "http://snapshot.debian.org/archive/"
+	ubuntuSnapshotUrl = "http://snapshot.ubuntu.com/"
+	// The timestamp format used in snapshot mirror URLs.
+	snapshotTimestampLayout = "20060102T150405Z"
+)
+
+// Matches the errors debootstrap exits with when it is unable to download from
+// a mirror. For reference, see debootstrap's functions file.
+var debootstrapDownloadErrorRegex = regexp.MustCompile(
+	`(?m)^E: (Couldn't download|Failed getting release file|Failed getting release signature file|Invalid Release signature)`,
+)
+
+// Run debootstrap (retrying per the program's retry policy) against the mirror
+// at the end of cmdArr. If debootstrap is unable to download from the mirror, the
+// next of the fallback mirrors is tried. cmdArr is left with the mirror
+// debootstrap was last ran with.
+//
+// debootstrap picks up where it left off (e.g. the packages already downloaded
+// are kept), that way a mirror hiccup is retried without starting over.
+func runDebootstrap(cmdArr, fallbackMirrors []string, quiet bool) error {
+	var mirrors []string = append([]string{cmdArr[len(cmdArr)-1]}, fallbackMirrors...)
+	var err error
+	for i, mirror := range mirrors {
+		cmdArr[len(cmdArr)-1] = mirror
+		var stderr bytes.Buffer
+		err = retryWithTimeout(context.Background(), progRetryPolicy, func(attempt int, err error) {
+			infof("debootstrap failed (%v), trying again", err)
+		}, func(ctx context.Context) error {
+			stderr.Reset()
+			// a retried debootstrap starts over with downloading the packages
+			createPhases.start(bootstrapDownloadPhase)
+			// inspired by:
+			// https://stackoverflow.com/questions/39173430/how-to-print-the-realtime-output-of-running-child-process-in-go
+			debootstrapCmd := exec.CommandContext(ctx, cmdArr[0], cmdArr[1:]...)
+			traceCommand(debootstrapCmd)
+			stdoutWriter, stderrWriter := buildLogOutput(quiet)
+			stderrWriter = io.MultiWriter(stderrWriter, &stderr)
+			debootstrapCmd.Stdout = createPhases.watch(stdoutWriter, debootstrapPhaseMarkers)
+			debootstrapCmd.Stderr = createPhases.watch(stderrWriter, debootstrapPhaseMarkers)
+			// only a debootstrap that ran and failed is tried again
+			var exitErr *exec.ExitError
+			err := progExecutor.Run(debootstrapCmd)
+			if err != nil && !errors.As(err, &exitErr) {
+				return permanent(err)
+			}
+			return err
+		})
+		if err == nil {
+			return nil
+		} else if i == len(mirrors)-1 || !debootstrapDownloadErrorRegex.Match(stderr.Bytes()) {
+			return err
+		}
+
+		infof("unable to download from %v, falling back to %v", mirror, mirrors[i+1])
+	}
+
+	return err
+}
+
+// Get the local dir of a mirror that is either a file:// URL or a plain path
+// (e.g. a debmirror or aptly snapshot), ok is false for a remote mirror.
+func localMirrorDir(mirror string) (dir string, ok bool, err error) {
+	if strings.HasPrefix(mirror, fileUrlScheme) {
+		dir = strings.TrimPrefix(mirror, fileUrlScheme)
+	} else if !strings.Contains(mirror, "://") {
+		dir = mirror
+	} else {
+		return "", false, nil
+	}
+
+	if dir, err = filepath.Abs(dir); err != nil {
+		return "", false, err
+	}
+	return dir, true, nil
+}
+
+// Check the local mirror dir has the codename's release, that way a mirror that
+// is missing the codename is found out about before debootstrap is ran.
+func checkLocalMirror(dir, codeName string) error {
+	var releaseDir string = filepath.Join(dir, "dists", codeName)
+	for _, release := range []string{"InRelease", "Release"} {
+		if _, err := os.Stat(filepath.Join(releaseDir, release)); err == nil {
+			return nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%v is not a mirror of %v, neither %v/InRelease nor %v/Release exist", dir, codeName, releaseDir, releaseDir)
+}
+
+// Turn the local mirrors into file:// URLs (debootstrap only takes URLs) after
+// checking they have the codename's release. The local mirrors are bind mounted
+// read-only at the same path in the comprt, that way apt in the comprt can use
+// them too.
+func resolveLocalMirrors(mirrors []string, codeName string) ([]string, []bindMount, error) {
+	var resolved []string
+	var binds []bindMount
+	for _, mirror := range mirrors {
+		dir, ok, err := localMirrorDir(mirror)
+		if err != nil {
+			return nil, nil, err
+		} else if !ok {
+			resolved = append(resolved, mirror)
+			continue
+		}
+
+		if err := checkLocalMirror(dir, codeName); err != nil {
+			return nil, nil, err
+		}
+		resolved = append(resolved, fileUrlScheme+dir+"/")
+		binds = append(binds, bindMount{hostPath: dir, comprtPath: dir, readOnly: true})
+	}
+
+	return resolved, binds, nil
+}
+
+// Get the snapshot mirror (snapshot.debian.org or snapshot.ubuntu.com) of the
+// mirror as it was at the time.
+func snapshotMirror(mirror string, at time.Time) (string, error) {
+	var timestamp string = at.UTC().Format(snapshotTimestampLayout)
+	if _, ok := snapshotTime(mirror); ok {
+		// a snapshot mirror is moved to the time
+		var parts []string = strings.Split(strings.TrimSuffix(mirror, "/"), "/")
+		return strings.Join(parts[:len(parts)-1], "/") + "/" + timestamp + "/", nil
+	}
+
+	switch {
+	case strings.Contains(mirror, "ubuntu-ports"):
+		return ubuntuSnapshotUrl + "ubuntu-ports/" + timestamp + "/", nil
+	case strings.Contains(mirror, "ubuntu"):
+		return ubuntuSnapshotUrl + "ubuntu/" + timestamp + "/", nil
+	case strings.Contains(mirror, "debian-security"):
+		return debianSnapshotUrl + "debian-security/" + timestamp + "/", nil
+	case strings.Contains(mirror, "debian"):
+		return debianSnapshotUrl + "debian/" + timestamp + "/", nil
+	}
+
+	return "", fmt.Errorf("%v is not a debian or ubuntu mirror, it has no snapshot mirror (pass in a MIRROR)", mirror)
+}
+
+// Get the timestamp of a snapshot mirror, ok is false if the mirror is not a
+// snapshot mirror.
+func snapshotTime(mirror string) (time.Time, bool) {
+	if !strings.HasPrefix(mirror, debianSnapshotUrl) && !strings.HasPrefix(mirror, ubuntuSnapshotUrl) {
+		return time.Time{}, false
+	}
+
+	var parts []string = strings.Split(strings.TrimSuffix(mirror, "/"), "/")
+	at, err := time.Parse(snapshotTimestampLayout, parts[len(parts)-1])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return at, true
+}
+
+// Parse the time of a snapshot (e.g. '2024-01-15T00:00:00Z'), it cannot be in
+// the future since the snapshot mirrors would change until then.
+func parseSnapshotTime(value string, now time.Time) (time.Time, error) {
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%v is not a snapshot time (ex. 2024-01-15T00:00:00Z)", value)
+	} else if at.After(now) {
+		return time.Time{}, fmt.Errorf("the snapshot time %v is in the future", value)
+	}
+
+	return at, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunDebootstrap(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// a fake debootstrap that is only able to download from the good mirror
+	var debootstrapPath string = filepath.Join(tempDirPath, "debootstrap")
+	if err := createTestFile(debootstrapPath, `#!/bin/sh
+for mirror; do :; done
+if [ "${mirror}" = "http://good.example/debian/" ]; then
+	exit 0
+elif [ "${mirror}" = "http://broken.example/debian/" ]; then
+	echo "E: Couldn't find these debs: foo" >&2
+	exit 1
+fi
+echo "E: Failed getting release file ${mirror}dists/buster/Release" >&2
+exit 1
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(policy retryPolicy) { progRetryPolicy = policy }(progRetryPolicy)
+	progRetryPolicy = testRetryPolicy
+
+	var cmdArr []string = []string{debootstrapPath, testCodeCame, "foo", "http://bad.example/debian/"}
+	if err := runDebootstrap(cmdArr, []string{"http://good.example/debian/"}, true); err != nil {
+		t.Fatal(err)
+	} else if cmdArr[len(cmdArr)-1] != "http://good.example/debian/" {
+		t.Fatalf("the mirror debootstrap succeeded with was not kept: %v", cmdArr)
+	}
+
+	cmdArr = []string{debootstrapPath, testCodeCame, "foo", "http://broken.example/debian/"}
+	if err := runDebootstrap(cmdArr, []string{"http://good.example/debian/"}, true); err == nil {
+		t.Fatal("a mirror was fallen back on for an error other than a download error")
+	}
+
+	cmdArr = []string{debootstrapPath, testCodeCame, "foo", "http://bad.example/debian/"}
+	if err := runDebootstrap(cmdArr, []string{"http://bad.example/ubuntu/"}, true); err == nil {
+		t.Fatal("debootstrap succeeded without a mirror it could download from")
+	}
+}
+
+func TestResolveLocalMirrors(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var releaseDir string = filepath.Join(tempDirPath, "dists", testCodeCame)
+	if err := os.MkdirAll(releaseDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(releaseDir, "Release"), "Codename: "+testCodeCame+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	mirrors, binds, err := resolveLocalMirrors(
+		[]string{tempDirPath, "file://" + tempDirPath, defaultMirrorMappings[testCodeCame]},
+		testCodeCame,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mirrors, []string{"file://" + tempDirPath + "/", "file://" + tempDirPath + "/", defaultMirrorMappings[testCodeCame]}) {
+		t.Fatalf("unexpected mirrors: %v", mirrors)
+	} else if len(binds) != 2 || binds[0] != (bindMount{hostPath: tempDirPath, comprtPath: tempDirPath, readOnly: true}) {
+		t.Fatalf("the local mirrors were not bind mounted into the comprt: %+v", binds)
+	}
+
+	if _, _, err := resolveLocalMirrors([]string{tempDirPath}, "bullseye"); err == nil {
+		t.Fatal("a local mirror without the codename's release was accepted")
+	}
+}
+
+func TestSnapshotMirror(t *testing.T) {
+	var at time.Time = time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)
+	for mirror, expected := range map[string]string{
+		defaultDebianMirror:  "http://snapshot.debian.org/archive/debian/20240115T000000Z/",
+		debianArchiveMirror:  "http://snapshot.debian.org/archive/debian/20240115T000000Z/",
+		debianSecurityMirror: "http://snapshot.debian.org/archive/debian-security/20240115T000000Z/",
+		defaultUbuntuMirror:  "http://snapshot.ubuntu.com/ubuntu/20240115T000000Z/",
+		ubuntuPortsMirror:    "http://snapshot.ubuntu.com/ubuntu-ports/20240115T000000Z/",
+		"http://snapshot.debian.org/archive/debian/20230101T000000Z/": "http://snapshot.debian.org/archive/debian/20240115T000000Z/",
+	} {
+		snapshot, err := snapshotMirror(mirror, at)
+		if err != nil {
+			t.Fatal(err)
+		} else if snapshot != expected {
+			t.Fatalf("expected %v for %v, got %v", expected, mirror, snapshot)
+		}
+	}
+
+	if _, err := snapshotMirror("file:///srv/mirror/", at); err == nil {
+		t.Fatal("a local mirror was given a snapshot mirror")
+	}
+
+	if snapshotAt, ok := snapshotTime("http://snapshot.debian.org/archive/debian/20240115T000000Z/"); !ok || !snapshotAt.Equal(at) {
+		t.Fatalf("expected %v, got %v", at, snapshotAt)
+	} else if _, ok := snapshotTime(defaultDebianMirror); ok {
+		t.Fatalf("%v was taken for a snapshot mirror", defaultDebianMirror)
+	}
+}
+
+func TestParseSnapshotTime(t *testing.T) {
+	var now time.Time = time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)
+	if at, err := parseSnapshotTime("2024-01-15T00:00:00Z", now); err != nil {
+		t.Fatal(err)
+	} else if expected := time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC); !at.Equal(expected) {
+		t.Fatalf("expected %v, got %v", expected, at)
+	}
+
+	for _, value := range []string{"2024-01-15", "2024-03-01T00:00:00Z"} {
+		if _, err := parseSnapshotTime(value, now); err == nil {
+			t.Fatalf("%v was taken for a snapshot time", value)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const procSelfMountInfo = "/proc/self/mountinfo"
+
+// A type used to store a line from a mountinfo file. For reference:
+// https://man7.org/linux/man-pages/man5/proc.5.html
+type mountInfo struct {
+	mountId    int
+	parentId   int
+	root       string
+	mountPoint string
+	options    string
+	fsType     string
+	source     string
+}
+
+// Read in the mounts from a mountinfo file (e.g. /proc/self/mountinfo).
+func readMountInfo(fPath string) ([]mountInfo, error) {
+	file, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var mounts []mountInfo
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		mount, err := parseMountInfoLine(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, mount)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return mounts, nil
+}
+
+// Parse a line from a mountinfo file, for example:
+// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfoLine(line string) (mountInfo, error) {
+	var mount mountInfo
+	fields := strings.Fields(line)
+	// the optional fields end with a lone hyphen
+	var separatorIndex int = -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			separatorIndex = i
+			break
+		}
+	}
+	if len(fields) < 7 || separatorIndex < 0 || len(fields) < separatorIndex+3 {
+		return mount, fmt.Errorf("%v is not a properly formatted mountinfo line", line)
+	}
+
+	var err error
+	if mount.mountId, err = strconv.Atoi(fields[0]); err != nil {
+		return mount, err
+	}
+	if mount.parentId, err = strconv.Atoi(fields[1]); err != nil {
+		return mount, err
+	}
+	mount.root = unescapeMountInfoField(fields[3])
+	mount.mountPoint = unescapeMountInfoField(fields[4])
+	mount.options = fields[5]
+	mount.fsType = fields[separatorIndex+1]
+	mount.source = unescapeMountInfoField(fields[separatorIndex+2])
+
+	return mount, nil
+}
+
+// Replace the octal escapes used by the kernel for whitespace and backslashes
+// in mountinfo fields (e.g. \040 for a space).
+func unescapeMountInfoField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var unescaped strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if b, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				unescaped.WriteByte(byte(b))
+				i += 3
+				continue
+			}
+		}
+		unescaped.WriteByte(field[i])
+	}
+
+	return unescaped.String()
+}
+
+// Determine if the path is a mount point based on the mounts passed in.
+func isMountPoint(path string, mounts []mountInfo) bool {
+	for _, mount := range mounts {
+		if mount.mountPoint == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Determine if the path in the target (e.g. /proc) is a mount point based on the
+// mounts passed in, the target may be a relative path (or empty if the path is
+// absolute).
+func isMountPointIn(target, path string, mounts []mountInfo) (bool, error) {
+	absPath, err := filepath.Abs(filepath.Join(target, path))
+	if err != nil {
+		return false, err
+	}
+
+	return isMountPoint(absPath, mounts), nil
+}
+
+// Get the mounts beneath the path (not including a mount on the path itself).
+// The mounts are returned in the reverse order they were mounted in, that way
+// they can be unmounted in order.
+func mountsUnder(path string, mounts []mountInfo) []mountInfo {
+	var under []mountInfo
+	var prefix string = strings.TrimSuffix(path, "/") + "/"
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if strings.HasPrefix(mounts[i].mountPoint, prefix) {
+			under = append(under, mounts[i])
+		}
+	}
+
+	return under
+}
+
+// A type used to describe a process keeping a mount busy.
+type mountHolder struct {
+	pid     int
+	command string
+}
+
+func (holder mountHolder) String() string {
+	return fmt.Sprintf("%v (%v)", holder.pid, holder.command)
+}
+
+// Find the processes keeping the mount point busy, by their root, working dir,
+// executable or open files being under it.
+func mountHolders(procDir, mountPoint string) ([]mountHolder, error) {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var prefix string = strings.TrimSuffix(mountPoint, "/") + "/"
+	isUnder := func(path string) bool {
+		return path == mountPoint || strings.HasPrefix(path, prefix)
+	}
+
+	var holders []mountHolder
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		var procPath string = filepath.Join(procDir, entry.Name())
+		var links []string = []string{filepath.Join(procPath, "root"), filepath.Join(procPath, "cwd"), filepath.Join(procPath, "exe")}
+		// the process may have since exited, or not be readable by us
+		if fds, err := os.ReadDir(filepath.Join(procPath, "fd")); err == nil {
+			for _, fd := range fds {
+				links = append(links, filepath.Join(procPath, "fd", fd.Name()))
+			}
+		}
+
+		for _, link := range links {
+			if path, err := os.Readlink(link); err == nil && isUnder(path) {
+				comm, _ := os.ReadFile(filepath.Join(procPath, "comm"))
+				holders = append(holders, mountHolder{pid: pid, command: strings.TrimSpace(string(comm))})
+				break
+			}
+		}
+	}
+
+	return holders, nil
+}
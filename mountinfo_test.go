@@ -0,0 +1,142 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseMountInfoLine(t *testing.T) {
+	mount, err := parseMountInfoLine(`36 35 98:0 /mnt1 /mnt\0402 rw,noatime master:1 shared:2 - ext3 /dev/root rw,errors=continue`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedMount := mountInfo{
+		mountId:    36,
+		parentId:   35,
+		root:       "/mnt1",
+		mountPoint: "/mnt 2",
+		options:    "rw,noatime",
+		fsType:     "ext3",
+		source:     "/dev/root",
+	}
+	if mount != expectedMount {
+		t.Fatalf("found the following mount %+v", mount)
+	}
+
+	if _, err := parseMountInfoLine("36 35 98:0 /mnt1"); err == nil {
+		t.Fatal("a malformed mountinfo line was parsed without error")
+	}
+}
+
+func TestReadMountInfo(t *testing.T) {
+	mounts, err := readMountInfo(procSelfMountInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isMountPoint("/", mounts) {
+		t.Fatal("/ was not found to be a mount point")
+	}
+}
+
+func TestMountsUnder(t *testing.T) {
+	mounts := []mountInfo{
+		{mountId: 1, mountPoint: "/srv/foo"},
+		{mountId: 2, mountPoint: "/srv/foo/proc"},
+		{mountId: 3, mountPoint: "/srv/foobar/proc"},
+		{mountId: 4, mountPoint: "/srv/foo/dev"},
+		{mountId: 5, mountPoint: "/srv/foo/dev/pts"},
+	}
+
+	var mountIds []int
+	for _, mount := range mountsUnder("/srv/foo", mounts) {
+		mountIds = append(mountIds, mount.mountId)
+	}
+	if !reflect.DeepEqual(mountIds, []int{5, 4, 2}) {
+		t.Fatalf("expected the mounts under /srv/foo last mounted first, got %v", mountIds)
+	}
+}
+
+func TestMountHolders(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var mountPoint string = "/srv/foo/proc"
+	for _, proc := range []struct {
+		pid   string
+		comm  string
+		links map[string]string
+	}{
+		{"10", "bash", map[string]string{"cwd": "/srv/foo/proc/1", "root": "/"}},
+		{"20", "tail", map[string]string{"cwd": "/", "fd/3": "/srv/foo/proc/meminfo"}},
+		{"30", "sleep", map[string]string{"cwd": "/srv/foo/proc-not", "root": "/"}},
+	} {
+		var procPath string = filepath.Join(tempDirPath, proc.pid)
+		if err := os.MkdirAll(filepath.Join(procPath, "fd"), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(filepath.Join(procPath, "comm"), proc.comm+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		for link, path := range proc.links {
+			if err := os.Symlink(path, filepath.Join(procPath, link)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	holders, err := mountHolders(tempDirPath, mountPoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []mountHolder = []mountHolder{{pid: 10, command: "bash"}, {pid: 20, command: "tail"}}
+	if !reflect.DeepEqual(holders, expected) {
+		t.Fatalf("expected %v, got %v", expected, holders)
+	}
+}
+
+func TestIsMountPointIn(t *testing.T) {
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mounts []mountInfo = []mountInfo{{mountPoint: "/srv/foo/proc"}, {mountPoint: filepath.Join(workDir, "bar", "proc")}}
+	for _, tc := range []struct {
+		target   string
+		path     string
+		expected bool
+	}{
+		{"/srv/foo", "/proc", true},
+		{"/srv/foo/", "proc", true},
+		{"bar", "/proc", true},
+		{"", "/srv/foo/proc", true},
+		{"/srv/foo", "/sys", false},
+	} {
+		if mounted, err := isMountPointIn(tc.target, tc.path, mounts); err != nil {
+			t.Fatal(err)
+		} else if mounted != tc.expected {
+			t.Fatalf("expected %v in %v to be mounted: %v", tc.path, tc.target, tc.expected)
+		}
+	}
+}
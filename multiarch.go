@@ -0,0 +1,75 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Debian's architecture names, for reference:
+// https://wiki.debian.org/SupportedArchitectures
+var debianArchRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Get the foreign architectures to enable in a comprt of the architecture, from
+// the architectures passed in (e.g. --add-architecture armhf). An architecture
+// passed in more than once is only enabled once.
+func parseForeignArchs(archs []string, comprtArch string) ([]string, error) {
+	var foreignArchs []string
+	for _, arch := range archs {
+		if !debianArchRegex.MatchString(arch) {
+			return nil, fmt.Errorf("%v is not a debian architecture", arch)
+		} else if arch == comprtArch {
+			return nil, fmt.Errorf("%v is the comprt's own architecture, it cannot be added as a foreign one", arch)
+		} else if stringInArr(arch, &foreignArchs) {
+			continue
+		}
+		foreignArchs = append(foreignArchs, arch)
+	}
+
+	return foreignArchs, nil
+}
+
+// Check whether the package (which may be pinned, e.g. libc6:armhf=2.36-9) is
+// qualified with an architecture.
+func isArchQualifiedPkg(pkg string) bool {
+	return strings.Contains(strings.SplitN(pkg, "=", 2)[0], ":")
+}
+
+// Enable the architectures in the comprt with dpkg, the package lists are to be
+// updated afterwards. Expected to be called while chrooted into the comprt.
+func addForeignArchs(archs []string, quiet bool) error {
+	if len(archs) == 0 {
+		return nil
+	}
+
+	dpkgPath, err := progExecutor.LookPath("dpkg")
+	if err != nil {
+		return err
+	}
+
+	for _, arch := range archs {
+		dpkgCmd := exec.Command(dpkgPath, "--add-architecture", arch)
+		traceCommand(dpkgCmd)
+		dpkgCmd.Stdout, dpkgCmd.Stderr = buildLogOutput(quiet)
+		if err := progExecutor.Run(dpkgCmd); err != nil {
+			return fmt.Errorf("unable to add the %v architecture: %w", arch, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseForeignArchs(t *testing.T) {
+	foreignArchs, err := parseForeignArchs([]string{"armhf", "i386", "armhf"}, "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(foreignArchs, []string{"armhf", "i386"}) {
+		t.Fatalf("expected armhf and i386 once each, actual: %v", foreignArchs)
+	}
+
+	for _, arch := range []string{"amd64", "ARMHF", "armhf;ls", ""} {
+		if _, err := parseForeignArchs([]string{arch}, "amd64"); err == nil {
+			t.Fatalf("%q was accepted as a foreign architecture", arch)
+		}
+	}
+}
+
+func TestIsArchQualifiedPkg(t *testing.T) {
+	for pkg, expected := range map[string]bool{
+		"libc6:armhf":            true,
+		"libc6:armhf=2.36-9":     true,
+		"git":                    false,
+		"git=1:2.20.1-2+deb10u3": false,
+	} {
+		if actual := isArchQualifiedPkg(pkg); actual != expected {
+			t.Fatalf("%v: expected: %v, actual: %v", pkg, expected, actual)
+		}
+	}
+}
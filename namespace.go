@@ -0,0 +1,244 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// The hidden argument used to have debcomprt re-execute itself as the reaper
+	// (init) process of a new PID namespace.
+	reaperCmdName = "__reaper"
+
+	// Set in the env of a process ran in a new mount namespace by debcomprt.
+	mountNsEnvVar = "DEBCOMPRT_MOUNT_NS"
+	// Set in the env of the reaper to denote how a new network namespace should
+	// be setup.
+	networkNsEnvVar = "DEBCOMPRT_NETWORK_NS"
+
+	hostNamespace    = "host"
+	privateNamespace = "private"
+	noNamespace      = "none"
+)
+
+// Wrap the command so it is ran by debcomprt's reaper process inside of the new
+// namespaces denoted by cloneFlags. If a new PID namespace is requested, the
+// reaper will be the namespace's init process, mount a new /proc and reap any
+// orphaned processes.
+//
+// /proc/self/exe is used to find debcomprt, this works even if the process has
+// chrooted as /proc/self/exe is a 'magic' link.
+func nsCommand(cmd *exec.Cmd, cloneFlags uintptr) *exec.Cmd {
+	nsCmd := exec.Command("/proc/self/exe", append([]string{reaperCmdName}, cmd.Args...)...)
+	nsCmd.Env = cmd.Env
+	if cloneFlags&syscall.CLONE_NEWNS != 0 {
+		if nsCmd.Env == nil {
+			nsCmd.Env = os.Environ()
+		}
+		nsCmd.Env = append(nsCmd.Env, mountNsEnvVar+"="+privateNamespace)
+	}
+	nsCmd.Dir = cmd.Dir
+	nsCmd.Stdin = cmd.Stdin
+	nsCmd.Stdout = cmd.Stdout
+	nsCmd.Stderr = cmd.Stderr
+	nsCmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: cloneFlags,
+	}
+
+	return nsCmd
+}
+
+// Run the command passed in, normally as the init process of a PID namespace
+// and/or in a new mount namespace. Signals received are forwarded to the
+// command. Returns the exit status of the command.
+//
+// DISCUSS(cavcrosby): any process created in a PID namespace will be labeled as
+// the 'init' process for the namespace. Thus, some form of 'init' software needs
+// to be run vs just using a shell instance. Otherwise, if the shell instance
+// exits, then all processes in the PID namespace will be killed by the kernel.
+// Orphaned processes are also reparented to the 'init' process. For reference:
+// https://man7.org/linux/man-pages/man7/pid_namespaces.7.html
+func runReaper(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "%s: %s requires a command to run\n", progname, reaperCmdName)
+		return 1
+	}
+
+	if os.Getenv(mountNsEnvVar) == privateNamespace {
+		// Ensure mounts made in the new mount namespace stay in it, the copied mounts
+		// would otherwise still propagate to the host if they are shared. Making '/'
+		// private is not possible if the process has chrooted into a target that is
+		// not a mount point, in this case mountChrootFileSystems will have made the
+		// target's mounts private already.
+		if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil &&
+			!errors.Is(err, syscall.EINVAL) {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", progname, err)
+			return 1
+		}
+	}
+
+	if os.Getenv(networkNsEnvVar) == privateNamespace {
+		// a new network namespace only has a loopback interface, which starts down
+		if err := setLinkUp("lo"); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", progname, err)
+			return 1
+		}
+	}
+
+	if os.Getpid() == 1 {
+		// a new /proc will only show processes in the new PID namespace
+		if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", progname, err)
+			return 1
+		}
+	}
+
+	cmdPath, err := exec.LookPath(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", progname, err)
+		return 1
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals)
+	defer signal.Stop(signals)
+
+	os.Unsetenv(networkNsEnvVar)
+	cmd := exec.Command(cmdPath, args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", progname, err)
+		return 1
+	}
+
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGCHLD {
+				continue
+			}
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	// cmd.Wait is not used, as it would only wait on the command and not on any
+	// orphaned processes
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, 0, nil)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", progname, err)
+			return 1
+		}
+
+		if pid != cmd.Process.Pid {
+			continue
+		} else if status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return status.ExitStatus()
+	}
+}
+
+// Get the clone flags needed to create the namespaces for a session, based on
+// the PID and network namespace modes passed in.
+func sessionCloneFlags(pidNamespace, networkNamespace string) uintptr {
+	var cloneFlags uintptr
+	if pidNamespace == privateNamespace {
+		cloneFlags |= syscall.CLONE_NEWPID | syscall.CLONE_NEWNS
+	}
+	if networkNamespace != hostNamespace {
+		cloneFlags |= syscall.CLONE_NEWNET
+	}
+
+	return cloneFlags
+}
+
+// Set the network interface's state to up, as if by 'ip link set NAME up'.
+func setLinkUp(name string) error {
+	// inspired by:
+	// https://man7.org/linux/man-pages/man7/netdevice.7.html
+	var ifreq struct {
+		name  [syscall.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	// copy is not used as it is shadowed by debcomprt's copy
+	for i := 0; i < len(name) && i < syscall.IFNAMSIZ-1; i++ {
+		ifreq.name[i] = name[i]
+	}
+
+	sockFd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(sockFd)
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(sockFd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&ifreq))); errno != 0 {
+		return fmt.Errorf("unable to get the flags of %v: %w", name, errno)
+	}
+	ifreq.flags |= syscall.IFF_UP
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(sockFd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&ifreq))); errno != 0 {
+		return fmt.Errorf("unable to bring %v up: %w", name, errno)
+	}
+
+	return nil
+}
+
+// Re-execute debcomprt in a new mount namespace, that way any mounts made by
+// debcomprt never appear in the host's mount table. Even if debcomprt were to
+// crash, the mounts are released by the kernel once the namespace has no more
+// processes. The hashed password passed in (if any) is handed down to the
+// re-executed debcomprt. Returns the exit status of the re-executed debcomprt.
+func reexecInMountNamespace(cryptPassword *string) int {
+	cmd := nsCommand(exec.Command("/proc/self/exe", os.Args[1:]...), syscall.CLONE_NEWNS)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if cryptPassword != nil {
+		passwordReader, err := handDownCryptPassword(cmd, *cryptPassword)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", progname, err)
+			return 1
+		}
+		defer passwordReader.Close()
+	}
+
+	// the re-executed debcomprt should be the one to handle signals (e.g. ctrl-c)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", progname, err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// Allow the test binary to act as the reaper, as nsCommand re-executes
+// /proc/self/exe.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == reaperCmdName {
+		os.Exit(runReaper(os.Args[2:]))
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestNsCommandPidNamespace(t *testing.T) {
+	nsCmd := nsCommand(exec.Command("ls", "/proc"), syscall.CLONE_NEWPID|syscall.CLONE_NEWNS)
+	out, err := nsCmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the reaper and ls should be visible
+	var pids []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if _, err := strconv.Atoi(line); err == nil {
+			pids = append(pids, line)
+		}
+	}
+	if len(pids) != 2 || !stringInArr("1", &pids) {
+		t.Fatalf("found the following processes in the new PID namespace %v", pids)
+	}
+	if stringInArr(strconv.Itoa(os.Getpid()), &pids) {
+		t.Fatal("a process outside of the new PID namespace was visible in /proc")
+	}
+
+	if _, err := os.Stat("/proc/self/cmdline"); err != nil {
+		t.Fatalf("the host's /proc was affected by the new PID namespace: %v", err)
+	}
+}
+
+func TestNsCommandExitStatus(t *testing.T) {
+	nsCmd := nsCommand(exec.Command("sh", "-c", "exit 3"), syscall.CLONE_NEWPID|syscall.CLONE_NEWNS)
+	err := nsCmd.Run()
+
+	var exitErr *exec.ExitError
+	if err == nil {
+		t.Fatal("the command's exit status was not returned by the reaper")
+	} else if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("a non-expected error has occurred: %v", err)
+	}
+}
+
+func TestNsCommandMountNamespace(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var tempDirStat *syscall.Stat_t = &syscall.Stat_t{}
+	if err := stat(tempDirPath, tempDirStat); err != nil {
+		t.Fatal(err)
+	}
+
+	nsCmd := nsCommand(exec.Command("mount", "--types", "tmpfs", "tmpfs", tempDirPath), syscall.CLONE_NEWNS)
+	if out, err := nsCmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	var testDirStat *syscall.Stat_t = &syscall.Stat_t{}
+	if err := stat(tempDirPath, testDirStat); err != nil {
+		t.Fatal(err)
+	}
+	if tempDirStat.Dev != testDirStat.Dev {
+		syscall.Unmount(tempDirPath, 0x0)
+		t.Fatal("a mount made in the new mount namespace appeared in the host's mount table")
+	}
+}
+
+func TestNsCommandNetworkNamespace(t *testing.T) {
+	for _, networkNamespace := range []string{noNamespace, privateNamespace} {
+		cmd := exec.Command("ip", "-o", "link")
+		cmd.Env = append(os.Environ(), networkNsEnvVar+"="+networkNamespace)
+		out, err := nsCommand(cmd, sessionCloneFlags(hostNamespace, networkNamespace)).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// only the loopback interface should exist
+		links := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if len(links) != 1 || !strings.Contains(links[0], "lo:") {
+			t.Fatalf("found the following links in a %v network %v", networkNamespace, links)
+		}
+
+		var loUp bool = strings.Contains(links[0], ",UP")
+		if networkNamespace == privateNamespace && !loUp {
+			t.Fatalf("loopback was not up in a %v network: %v", networkNamespace, links[0])
+		} else if networkNamespace == noNamespace && loUp {
+			t.Fatalf("loopback was up in a %v network: %v", networkNamespace, links[0])
+		}
+	}
+}
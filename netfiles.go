@@ -0,0 +1,159 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	resolvConfPath = "/etc/resolv.conf"
+	hostsPath      = "/etc/hosts"
+)
+
+// Puts the file passed in as the second argument at the path passed in as the
+// third argument, relative to the target passed in as the first argument. The
+// comprt's own file is moved aside to be put back by restoreNetworkFileScript.
+// Ran on the host by sh.
+const installNetworkFileScript = `set -e
+if [ -e "$1$3" ] || [ -L "$1$3" ]; then mv "$1$3" "$1$3.` + progname + `"; fi
+printf '%s' "$2" > "$1$3"
+`
+
+// Puts back the comprt's own file at the path passed in as the second argument,
+// relative to the target passed in as the first argument. Ran on the host by sh.
+const restoreNetworkFileScript = `set -e
+rm -f "$1$2"
+if [ -e "$1$2.` + progname + `" ] || [ -L "$1$2.` + progname + `" ]; then mv "$1$2.` + progname + `" "$1$2"; fi
+`
+
+// A type used to describe the network files put into a comprt while it is
+// being created, so the comprt config file can resolve names.
+type networkFiles struct {
+	// The files' contents, keyed by their path in the comprt.
+	files map[string][]byte
+}
+
+// Get the network files to put into the comprt. The host's resolv.conf is used
+// unless nameservers are passed in, the host's hosts file is only used if hosts
+// is true.
+func newNetworkFiles(nameservers []string, hosts bool) (networkFiles, error) {
+	var netFiles networkFiles = networkFiles{files: make(map[string][]byte)}
+	if len(nameservers) > 0 {
+		var resolvConf strings.Builder
+		for _, nameserver := range nameservers {
+			if net.ParseIP(nameserver) == nil {
+				return networkFiles{}, fmt.Errorf("%v is not the IP address of a nameserver", nameserver)
+			}
+			fmt.Fprintf(&resolvConf, "nameserver %v\n", nameserver)
+		}
+		netFiles.files[resolvConfPath] = []byte(resolvConf.String())
+	} else {
+		resolvConf, err := os.ReadFile(resolvConfPath)
+		if err != nil {
+			return networkFiles{}, err
+		}
+		netFiles.files[resolvConfPath] = resolvConf
+	}
+
+	if hosts {
+		hostsFile, err := os.ReadFile(hostsPath)
+		if err != nil {
+			return networkFiles{}, err
+		}
+		netFiles.files[hostsPath] = hostsFile
+	}
+
+	return netFiles, nil
+}
+
+// Put the network files into the comprt. A func is returned to remove them,
+// putting back the files the comprt already had (e.g. a resolv.conf symlink
+// into /run, which is dangling in a chroot).
+func (netFiles networkFiles) install(target string) (func() error, error) {
+	var installed []string
+	restore := func() error {
+		for _, path := range installed {
+			comprtPath := filepath.Join(target, path)
+			if err := os.Remove(comprtPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if err := os.Rename(comprtPath+"."+progname, comprtPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, path := range netFiles.paths() {
+		comprtPath := filepath.Join(target, path)
+		if _, err := os.Lstat(comprtPath); err == nil {
+			if err := os.Rename(comprtPath, comprtPath+"."+progname); err != nil {
+				restore()
+				return nil, err
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			restore()
+			return nil, err
+		}
+		installed = append(installed, path)
+
+		if err := os.WriteFile(comprtPath, netFiles.files[path], OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R); err != nil {
+			restore()
+			return nil, err
+		}
+	}
+
+	return restore, nil
+}
+
+// Get the mmdebstrap hooks that put the network files into the comprt and the
+// hooks that remove them, the same as install does.
+func (netFiles networkFiles) mmdebstrapArgs() (installArgs, restoreArgs []string) {
+	for _, path := range netFiles.paths() {
+		installArgs = append(installArgs, fmt.Sprintf(
+			"--customize-hook=sh -c %v sh \"$1\" %v %v",
+			shellQuote(installNetworkFileScript),
+			shellQuote(string(netFiles.files[path])),
+			shellQuote(path),
+		))
+		restoreArgs = append(restoreArgs, fmt.Sprintf(
+			"--customize-hook=sh -c %v sh \"$1\" %v",
+			shellQuote(restoreNetworkFileScript),
+			shellQuote(path),
+		))
+	}
+
+	return installArgs, restoreArgs
+}
+
+// Get the paths of the network files in the order they are put into the comprt.
+func (netFiles networkFiles) paths() []string {
+	var paths []string
+	for _, path := range []string{resolvConfPath, hostsPath} {
+		if _, ok := netFiles.files[path]; ok {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewNetworkFiles(t *testing.T) {
+	netFiles, err := newNetworkFiles([]string{"192.0.2.53", "2001:db8::53"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected string = "nameserver 192.0.2.53\nnameserver 2001:db8::53\n"
+	if resolvConf := string(netFiles.files[resolvConfPath]); resolvConf != expected {
+		t.Fatalf("expected %q, got %q", expected, resolvConf)
+	} else if _, ok := netFiles.files[hostsPath]; ok {
+		t.Fatal("the host's hosts file was used without being asked for")
+	}
+
+	if _, err := newNetworkFiles([]string{"ns1.example.com"}, false); err == nil {
+		t.Fatal("a nameserver that is not an IP address was accepted")
+	}
+}
+
+func TestNetworkFilesInstall(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// the resolv.conf is often a symlink to a file under /run
+	var etcPath string = filepath.Join(tempDirPath, "etc")
+	if err := os.Mkdir(etcPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../run/systemd/resolve/stub-resolv.conf", filepath.Join(etcPath, "resolv.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	netFiles := networkFiles{files: map[string][]byte{
+		resolvConfPath: []byte("nameserver 192.0.2.53\n"),
+		hostsPath:      []byte("127.0.0.1 localhost\n"),
+	}}
+	removeNetFiles, err := netFiles.install(tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range netFiles.files {
+		if contents, err := os.ReadFile(filepath.Join(tempDirPath, path)); err != nil {
+			t.Fatal(err)
+		} else if string(contents) != string(expected) {
+			t.Fatalf("expected %q in %v, got %q", expected, path, contents)
+		}
+	}
+
+	if err := removeNetFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if link, err := os.Readlink(filepath.Join(etcPath, "resolv.conf")); err != nil {
+		t.Fatal(err)
+	} else if link != "../run/systemd/resolve/stub-resolv.conf" {
+		t.Fatalf("the comprt's resolv.conf was not put back: %v", link)
+	}
+	if _, err := os.Lstat(filepath.Join(etcPath, "hosts")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("the hosts file put into the comprt was not removed: %v", err)
+	}
+}
+
+func TestNetworkFilesScripts(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var etcPath string = filepath.Join(tempDirPath, "etc")
+	if err := os.Mkdir(etcPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(etcPath, "resolv.conf"), "nameserver 127.0.0.53\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	if output, err := exec.Command("sh", "-c", installNetworkFileScript, "sh", tempDirPath, "nameserver 192.0.2.53\n", resolvConfPath).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	if contents, err := os.ReadFile(filepath.Join(etcPath, "resolv.conf")); err != nil {
+		t.Fatal(err)
+	} else if string(contents) != "nameserver 192.0.2.53\n" {
+		t.Fatalf("the resolv.conf was not put into the comprt: %q", contents)
+	}
+
+	if output, err := exec.Command("sh", "-c", restoreNetworkFileScript, "sh", tempDirPath, resolvConfPath).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	if contents, err := os.ReadFile(filepath.Join(etcPath, "resolv.conf")); err != nil {
+		t.Fatal(err)
+	} else if string(contents) != "nameserver 127.0.0.53\n" {
+		t.Fatalf("the comprt's resolv.conf was not put back: %q", contents)
+	}
+}
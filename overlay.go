@@ -0,0 +1,86 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Mount an overlayfs over the target, with the overlay's writable layer living
+// on a tmpfs. Any changes made through the returned path are discarded once the
+// overlay is unmounted, leaving the target as is. Returns the path of the
+// overlay and a func to unmount it.
+func mountEphemeralOverlay(target string) (string, func() error, error) {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", nil, err
+	}
+	// overlayfs uses these characters to separate its mount options
+	if strings.ContainsAny(absTarget, ",:") {
+		return "", nil, fmt.Errorf("%v cannot be used with an overlay, as it contains a ',' or ':'", absTarget)
+	}
+
+	overlayDir, err := makeTempDir("", progname+"-overlay-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := progExecutor.Mount("tmpfs", overlayDir, "tmpfs", 0, "mode=0700"); err != nil {
+		os.Remove(overlayDir)
+		return "", nil, err
+	}
+	// the mount would otherwise propagate if the parent mount is shared
+	if err := progExecutor.Mount("", overlayDir, "", syscall.MS_PRIVATE, ""); err != nil {
+		progExecutor.Unmount(overlayDir, 0)
+		os.Remove(overlayDir)
+		return "", nil, err
+	}
+
+	var upperDir, workDir, mergedDir string = filepath.Join(overlayDir, "upper"), filepath.Join(overlayDir, "work"), filepath.Join(overlayDir, "merged")
+	for _, dir := range []string{upperDir, workDir, mergedDir} {
+		if err := os.Mkdir(dir, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+			progExecutor.Unmount(overlayDir, 0)
+			os.Remove(overlayDir)
+			return "", nil, err
+		}
+	}
+
+	if err := progExecutor.Mount(
+		"overlay",
+		mergedDir,
+		"overlay",
+		0,
+		fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", absTarget, upperDir, workDir),
+	); err != nil {
+		progExecutor.Unmount(overlayDir, 0)
+		os.Remove(overlayDir)
+		return "", nil, err
+	}
+
+	return mergedDir, func() error {
+		if err := unMountChrootFileSystem(mergedDir, "", " is busy, trying again"); err != nil {
+			return err
+		}
+		if err := unMountChrootFileSystem(overlayDir, "", " is busy, trying again"); err != nil {
+			return err
+		}
+
+		return os.Remove(overlayDir)
+	}, nil
+}
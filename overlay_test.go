@@ -0,0 +1,63 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMountEphemeralOverlay(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if err := os.WriteFile(filepath.Join(tempDirPath, "foo"), []byte("foo"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	overlayPath, unMountOverlay, err := mountEphemeralOverlay(tempDirPath)
+	if err != nil {
+		t.Skipf("unable to mount an overlay on this host: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(overlayPath, "bar"), []byte("bar"), os.ModePerm); err != nil {
+		unMountOverlay()
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(overlayPath, "foo")); err != nil {
+		unMountOverlay()
+		t.Fatal(err)
+	}
+
+	if err := unMountOverlay(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDirPath, "foo")); err != nil {
+		t.Fatalf("a file removed in the overlay was removed from the target: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDirPath, "bar")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("a file created in the overlay was found in the target")
+	}
+	if _, err := os.Stat(filepath.Dir(overlayPath)); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("the overlay's dir was not removed")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	dpkgStatusFile = "/var/lib/dpkg/status"
+	packagesDir    = "packages"
+)
+
+// Get the packages installed in the comprt, mapped to their versions. dpkg's
+// status file is read directly, that way the comprt does not need to be
+// chrooted into.
+func readInstalledPackages(target string) (map[string]string, error) {
+	statusFile, err := os.Open(filepath.Join(target, dpkgStatusFile))
+	if err != nil {
+		return nil, err
+	}
+	defer statusFile.Close()
+
+	// inspired by:
+	// https://www.debian.org/doc/debian-policy/ch-controlfields.html
+	var pkgs map[string]string = make(map[string]string)
+	var pkg, version string
+	var installed bool
+	addPkg := func() {
+		if pkg != "" && installed {
+			pkgs[pkg] = version
+		}
+		pkg, version, installed = "", "", false
+	}
+
+	scanner := bufio.NewScanner(statusFile)
+	// the description of some packages can be quite long
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			addPkg()
+		case strings.HasPrefix(line, "Package:"):
+			pkg = strings.TrimSpace(strings.TrimPrefix(line, "Package:"))
+		case strings.HasPrefix(line, "Version:"):
+			version = strings.TrimSpace(strings.TrimPrefix(line, "Version:"))
+		case strings.HasPrefix(line, "Status:"):
+			installed = strings.HasSuffix(strings.TrimSpace(line), " installed")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	addPkg()
+
+	return pkgs, nil
+}
+
+// Get the path of the file recording the target's package state.
+func packageStatePath(target string) (string, error) {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(progDataDir, packagesDir, url.PathEscape(absTarget)+".json"), nil
+}
+
+// Record the package state for the target.
+func savePackageState(target string, pkgs map[string]string) error {
+	statePath, err := packageStatePath(target)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(statePath), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return err
+	}
+
+	stateBytes, err := json.MarshalIndent(pkgs, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(statePath, append(stateBytes, '\n'), ModeFile|(OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R))
+}
+
+// Describe how the packages changed between the two package states, one line
+// per package (e.g. 'foo 1.0 -> 1.1'), sorted by package name.
+func diffPackages(oldPkgs, newPkgs map[string]string) []string {
+	var diff []string
+	for pkg, version := range newPkgs {
+		if oldVersion, ok := oldPkgs[pkg]; !ok {
+			diff = append(diff, pkg+" (new) -> "+version)
+		} else if oldVersion != version {
+			diff = append(diff, pkg+" "+oldVersion+" -> "+version)
+		}
+	}
+	for pkg, oldVersion := range oldPkgs {
+		if _, ok := newPkgs[pkg]; !ok {
+			diff = append(diff, pkg+" "+oldVersion+" -> (removed)")
+		}
+	}
+	sort.Strings(diff)
+
+	return diff
+}
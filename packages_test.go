@@ -0,0 +1,71 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadInstalledPackages(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var dpkgStatus string = `Package: bash
+Status: install ok installed
+Priority: required
+Version: 5.1-2+deb11u1
+Description: GNU Bourne Again SHell
+ Bash is an sh-compatible command language interpreter.
+
+Package: foo
+Status: deinstall ok config-files
+Version: 1.0
+
+Package: sudo
+Status: install ok installed
+Version: 1.9.5p2-3
+`
+	if err := os.MkdirAll(filepath.Join(tempDirPath, filepath.Dir(dpkgStatusFile)), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDirPath, dpkgStatusFile), []byte(dpkgStatus), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	pkgs, err := readInstalledPackages(tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"bash": "5.1-2+deb11u1", "sudo": "1.9.5p2-3"}; !reflect.DeepEqual(pkgs, expected) {
+		t.Fatalf("expected %v, got %v", expected, pkgs)
+	}
+}
+
+func TestDiffPackages(t *testing.T) {
+	diff := diffPackages(
+		map[string]string{"bash": "5.1-2", "foo": "1.0", "sudo": "1.9.5p2-3"},
+		map[string]string{"bash": "5.1-2+deb11u1", "bar": "2.0", "sudo": "1.9.5p2-3"},
+	)
+	expected := []string{"bar (new) -> 2.0", "bash 5.1-2 -> 5.1-2+deb11u1", "foo 1.0 -> (removed)"}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Fatalf("expected %v, got %v", expected, diff)
+	}
+}
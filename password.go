@@ -0,0 +1,151 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// The env var telling debcomprt re-executed in a mount namespace which fd to
+// read the already hashed password from, that way the password is only read in
+// once (e.g. from stdin).
+const cryptPasswordFdEnvVar = "DEBCOMPRT_CRYPT_PASSWORD_FD"
+
+// Read the password from the first line of the reader.
+func readPassword(reader io.Reader) (string, error) {
+	password, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return strings.TrimRight(password, "\r\n"), nil
+}
+
+// Read the password from the first line of the file.
+func readPasswordFile(path string) (string, error) {
+	passwordFile, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer passwordFile.Close()
+
+	return readPassword(passwordFile)
+}
+
+// Check whether the file descriptor refers to a terminal.
+func isTerminal(fd uintptr) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
+
+// Read a line from the terminal without echoing it back.
+func readNoEcho(terminal *os.File) (string, error) {
+	var termios syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, terminal.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&termios))); errno != 0 {
+		return "", errno
+	}
+
+	noEchoTermios := termios
+	noEchoTermios.Lflag &^= syscall.ECHO
+	noEchoTermios.Lflag |= syscall.ICANON
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, terminal.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&noEchoTermios))); errno != 0 {
+		return "", errno
+	}
+	defer syscall.Syscall(syscall.SYS_IOCTL, terminal.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&termios)))
+
+	return readPassword(terminal)
+}
+
+// Prompt for the user's password on the terminal, having it typed twice. An
+// empty password leaves the user without one.
+func promptPassword(terminal *os.File, out io.Writer, userName string) (string, error) {
+	fmt.Fprintf(out, "Password for %v (empty for none): ", userName)
+	password, err := readNoEcho(terminal)
+	fmt.Fprintln(out)
+	if err != nil || password == "" {
+		return password, err
+	}
+
+	fmt.Fprint(out, "Retype password: ")
+	retyped, err := readNoEcho(terminal)
+	fmt.Fprintln(out)
+	if err != nil {
+		return "", err
+	} else if password != retyped {
+		return "", errors.New("the passwords typed do not match")
+	}
+
+	return password, nil
+}
+
+// Hand the hashed password down to the command through a pipe, the command is
+// told the pipe's fd by cryptPasswordFdEnvVar. The read end of the pipe is
+// returned, to be closed once the command is started.
+func handDownCryptPassword(cmd *exec.Cmd, cryptPassword string) (*os.File, error) {
+	passwordReader, passwordWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	// a hashed password fits in the pipe's buffer, nothing waits on the command
+	if _, err := passwordWriter.WriteString(cryptPassword); err != nil {
+		passwordReader.Close()
+		passwordWriter.Close()
+		return nil, err
+	}
+	passwordWriter.Close()
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, passwordReader)
+	// the fds in ExtraFiles start at 3, after stdin, stdout and stderr
+	cmd.Env = append(cmd.Env, cryptPasswordFdEnvVar+"="+strconv.Itoa(2+len(cmd.ExtraFiles)))
+
+	return passwordReader, nil
+}
+
+// Read the hashed password handed down by the debcomprt that re-executed this
+// one, inherited is false if none was handed down. The env var is unset so the
+// commands debcomprt runs do not inherit it.
+func readInheritedCryptPassword() (cryptPassword string, inherited bool, err error) {
+	fdValue, ok := os.LookupEnv(cryptPasswordFdEnvVar)
+	if !ok {
+		return "", false, nil
+	}
+	os.Unsetenv(cryptPasswordFdEnvVar)
+
+	fd, err := strconv.Atoi(fdValue)
+	if err != nil {
+		return "", false, fmt.Errorf("%v is not a fd: %w", cryptPasswordFdEnvVar, err)
+	}
+	passwordReader := os.NewFile(uintptr(fd), cryptPasswordFdEnvVar)
+	defer passwordReader.Close()
+	contents, err := io.ReadAll(passwordReader)
+	if err != nil {
+		return "", false, err
+	}
+
+	return string(contents), true, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// Open a new pseudoterminal, returning its master and slave ends.
+func openTestPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unlock, ptyNumber int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		master.Close()
+		return nil, nil, errno
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&ptyNumber))); errno != 0 {
+		master.Close()
+		return nil, nil, errno
+	}
+
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(ptyNumber)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	return master, slave, nil
+}
+
+func TestReadPassword(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if password, err := readPassword(strings.NewReader("foo bar\r\nbaz\n")); err != nil {
+		t.Fatal(err)
+	} else if password != "foo bar" {
+		t.Fatalf("expected the first line to be read, got %q", password)
+	}
+
+	var passwordPath string = filepath.Join(tempDirPath, "password")
+	if err := createTestFile(passwordPath, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := readPasswordFile(passwordPath); err != nil {
+		t.Fatal(err)
+	} else if password != "foo" {
+		t.Fatalf("expected the password file to be read, got %q", password)
+	}
+
+	passwordFile, err := os.Open(passwordPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer passwordFile.Close()
+	if isTerminal(passwordFile.Fd()) {
+		t.Fatal("a regular file was taken as a terminal")
+	}
+}
+
+func TestPromptPassword(t *testing.T) {
+	master, slave, err := openTestPty()
+	if err != nil {
+		t.Skipf("unable to open a pseudoterminal: %v", err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	if !isTerminal(slave.Fd()) {
+		t.Fatal("a pseudoterminal was not taken as a terminal")
+	}
+
+	if _, err := master.WriteString("foo\nfoo\n"); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := promptPassword(slave, io.Discard, defaultComprtUserName); err != nil {
+		t.Fatal(err)
+	} else if password != "foo" {
+		t.Fatalf("expected the typed password, got %q", password)
+	}
+
+	if _, err := master.WriteString("foo\nbar\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := promptPassword(slave, io.Discard, defaultComprtUserName); err == nil {
+		t.Fatal("passwords that did not match were taken")
+	}
+}
+
+func TestHandDownCryptPassword(t *testing.T) {
+	var cryptPassword string = "$6$1234$foo"
+	cmd := exec.Command("sh", "-c", `cat <&"$`+cryptPasswordFdEnvVar+`"`)
+	passwordReader, err := handDownCryptPassword(cmd, cryptPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer passwordReader.Close()
+
+	if out, err := cmd.Output(); err != nil {
+		t.Fatal(err)
+	} else if string(out) != cryptPassword {
+		t.Fatalf("expected: %v, actual: %v", cryptPassword, string(out))
+	}
+}
+
+func TestReadInheritedCryptPassword(t *testing.T) {
+	defer os.Unsetenv(cryptPasswordFdEnvVar)
+
+	if _, inherited, err := readInheritedCryptPassword(); err != nil {
+		t.Fatal(err)
+	} else if inherited {
+		t.Fatal("a password was inherited without one being handed down")
+	}
+
+	passwordReader, passwordWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := passwordWriter.WriteString("$6$1234$foo"); err != nil {
+		t.Fatal(err)
+	}
+	passwordWriter.Close()
+	// the fd is closed once read, so it is handed over instead of shared
+	fd, err := syscall.Dup(int(passwordReader.Fd()))
+	passwordReader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(cryptPasswordFdEnvVar, strconv.Itoa(fd))
+
+	cryptPassword, inherited, err := readInheritedCryptPassword()
+	if err != nil {
+		t.Fatal(err)
+	} else if !inherited || cryptPassword != "$6$1234$foo" {
+		t.Fatalf("expected: %v, actual: %v (inherited: %v)", "$6$1234$foo", cryptPassword, inherited)
+	}
+	if _, ok := os.LookupEnv(cryptPasswordFdEnvVar); ok {
+		t.Fatalf("%v was left set", cryptPasswordFdEnvVar)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	pbuilderExportFormat = "pbuilder"
+
+	pbuilderBaseName     = "base"
+	pbuilderAptConfPath  = "/etc/apt/apt.conf.d/99" + progname + "-pbuilder"
+	pbuilderAptCachePath = "/var/cache/apt/archives"
+)
+
+// The packages pbuilder expects to find in a base tarball, the same as
+// pbuilder create installs.
+var pbuilderPkgs = []string{"apt", "build-essential", "dpkg-dev"}
+
+// Packages are built with as little installed as possible, the same as
+// pbuilder's default of not installing recommends.
+var pbuilderAptConf = []byte("// written by " + progname + " for pbuilder\n" +
+	"APT::Install-Recommends \"false\";\n")
+
+// Get the name of the base tarball pbuilder is pointed at (--basetgz), pbuilder
+// expects a gzip'd tarball unless told otherwise (COMPRESSPROG).
+func pbuilderBaseTarball(c codec) string {
+	if c.Name() == defaultCodecName {
+		return pbuilderBaseName + ".tgz"
+	}
+
+	return pbuilderBaseName + ".tar" + c.Ext()
+}
+
+// Get the files added to (or replaced in) the comprt's root filesystem for
+// pbuilder, mapped to their contents.
+func pbuilderFiles() map[string][]byte {
+	return map[string][]byte{
+		policyRcDPath:       policyRcDDenyAll,
+		pbuilderAptConfPath: pbuilderAptConf,
+	}
+}
+
+// Write the comprt's root filesystem as a pbuilder base tarball to w. The comprt
+// itself is left as is, the tar of it is rewritten on the way through instead.
+// The packages cached by apt are dropped, the same as pbuilder does with apt-get
+// clean.
+func writePbuilderTar(target string, w io.Writer) error {
+	modTime, err := exportModTime()
+	if err != nil {
+		return err
+	}
+
+	files := pbuilderFiles()
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeExportTar(target, pw))
+	}()
+	defer pr.Close()
+
+	tarR := tar.NewReader(pr)
+	tarW := tar.NewWriter(w)
+	for {
+		header, err := tarR.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		var path string = filepath.Clean("/" + header.Name)
+		if _, ok := files[path]; ok {
+			continue
+		} else if filepath.Dir(path) == pbuilderAptCachePath && strings.HasSuffix(path, ".deb") {
+			continue
+		}
+
+		if err := tarW.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tarW, tarR); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		var mode int64 = int64(OS_USER_R | OS_USER_W | OS_GROUP_R | OS_OTH_R)
+		if name == policyRcDPath {
+			mode |= int64(OS_USER_X | OS_GROUP_X | OS_OTH_X)
+		}
+		if err := tarW.WriteHeader(&tar.Header{
+			Name:    "." + name,
+			Mode:    mode,
+			Size:    int64(len(files[name])),
+			ModTime: modTime,
+		}); err != nil {
+			return err
+		}
+		if _, err := tarW.Write(files[name]); err != nil {
+			return err
+		}
+	}
+
+	return tarW.Close()
+}
+
+// An exporter that writes the comprt as a base tarball pbuilder (and cowbuilder,
+// once unpacked) can build packages in, for reference:
+// https://pbuilder-team.pages.debian.net/pbuilder/
+type pbuilderExporter struct{}
+
+func (pbuilderExporter) Name() string { return pbuilderExportFormat }
+
+func (pbuilderExporter) Export(target string, opts exportOptions) ([]string, error) {
+	pkgs, err := readInstalledPackages(target)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pbuilderPkgs {
+		if _, ok := pkgs[pkg]; !ok {
+			warnf("%v is not installed in %v, pbuilder expects it in the base tarball", pkg, target)
+		}
+	}
+
+	var basePath string = filepath.Join(opts.dir, pbuilderBaseTarball(opts.codec))
+	if err := writeArchive(basePath, opts.codec, func(w io.Writer) error {
+		return writePbuilderTar(target, w)
+	}); err != nil {
+		return nil, err
+	}
+
+	return []string{basePath}, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPbuilderBaseTarball(t *testing.T) {
+	for name, expected := range map[string]string{
+		defaultCodecName: "base.tgz",
+		noCodecName:      "base.tar",
+		"zstd":           "base.tar.zst",
+	} {
+		c, err := getCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := pbuilderBaseTarball(c); actual != expected {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+	}
+}
+
+func TestPbuilderExporterExport(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	target := filepath.Join(tempDirPath, "foo")
+	for path, contents := range map[string]string{
+		dpkgStatusFile: "Package: build-essential\nStatus: install ok installed\nVersion: 12.9\n",
+		policyRcDPath:  "#!/bin/sh\nexit 0\n",
+		pbuilderAptCachePath + "/foo_1.0_all.deb": "foo",
+		"/bar": "bar",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(target, path)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(target, path), []byte(contents), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dest := filepath.Join(tempDirPath, "dest")
+	if err := os.Mkdir(dest, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := getCodec(defaultCodecName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := pbuilderExporter{}.Export(target, exportOptions{dir: dest, codec: c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || filepath.Base(paths[0]) != "base.tgz" {
+		t.Fatalf("expected only base.tgz, actual: %v", paths)
+	}
+
+	baseFile, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer baseFile.Close()
+	r, err := c.NewReader(baseFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	contents := make(map[string]string)
+	tarR := tar.NewReader(r)
+	for {
+		header, err := tarR.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := contents[header.Name]; ok {
+			t.Fatalf("%v is in the tarball more than once", header.Name)
+		}
+		data, err := io.ReadAll(tarR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[header.Name] = string(data)
+	}
+
+	if contents["./bar"] != "bar" {
+		t.Fatalf("the comprt's files are missing from the tarball, actual: %v", contents)
+	} else if contents["."+policyRcDPath] != string(policyRcDDenyAll) {
+		t.Fatalf("expected policy-rc.d: %q, actual: %q", policyRcDDenyAll, contents["."+policyRcDPath])
+	} else if contents["."+pbuilderAptConfPath] != string(pbuilderAptConf) {
+		t.Fatalf("expected apt config: %q, actual: %q", pbuilderAptConf, contents["."+pbuilderAptConfPath])
+	} else if _, ok := contents["."+pbuilderAptCachePath+"/foo_1.0_all.deb"]; ok {
+		t.Fatal("the packages cached by apt were not left out of the tarball")
+	}
+
+	// the comprt itself is not changed
+	if data, err := os.ReadFile(filepath.Join(target, policyRcDPath)); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "#!/bin/sh\nexit 0\n" {
+		t.Fatalf("the comprt's policy-rc.d was changed, actual: %q", data)
+	}
+}
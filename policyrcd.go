@@ -0,0 +1,207 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const policyRcDPath = "/usr/sbin/policy-rc.d"
+
+// Exiting with 101 denies every action, for reference:
+// https://people.debian.org/~hmh/invokerc.d-policyrc.d-specification.txt
+var policyRcDDenyAll = []byte("#!/bin/sh\n# installed by " + progname + ", services are not to be started in the comprt\nexit 101\n")
+
+// Maintainer scripts that start their daemons without invoke-rc.d (e.g. by
+// running their init script) are stopped by start-stop-daemon doing nothing,
+// the same as debootstrap does while it bootstraps.
+var fakeStartStopDaemon = []byte("#!/bin/sh\n# installed by " + progname + ", services are not to be started in the comprt\n" +
+	"echo \"Warning: Fake start-stop-daemon called, doing nothing\" >&2\nexit 0\n")
+
+// Installs the policy-rc.d passed in as the first argument and diverts
+// start-stop-daemon to install the fake passed in as the second argument, the
+// same as suppressServiceStarts does. Ran in the comprt by sh.
+const suppressServiceStartsScript = `set -e
+if [ -e ` + policyRcDPath + ` ] || [ -L ` + policyRcDPath + ` ]; then mv ` + policyRcDPath + ` ` + policyRcDPath + `.` + progname + `; fi
+printf '%s' "$1" > ` + policyRcDPath + `
+chmod 0755 ` + policyRcDPath + `
+ssd="$(dpkg-query --listfiles dpkg | grep '/sbin/start-stop-daemon$' | head -n 1)"
+if [ -n "$ssd" ] && [ "$(dpkg-divert --truename "$ssd")" = "$ssd" ]; then
+    dpkg-divert --local --rename --add "$ssd" > /dev/null
+    printf '%s' "$2" > "$ssd"
+    chmod 0755 "$ssd"
+fi
+`
+
+// Puts back start-stop-daemon and the comprt's own policy-rc.d, undoing
+// suppressServiceStartsScript. Ran in the comprt by sh.
+const restoreServiceStartsScript = `set -e
+ssd="$(dpkg-query --listfiles dpkg | grep '/sbin/start-stop-daemon$' | head -n 1)"
+if [ -n "$ssd" ] && [ "$(dpkg-divert --truename "$ssd")" = "$ssd.distrib" ] && grep -q 'installed by ` + progname + `' "$ssd"; then
+    rm -f "$ssd"
+    dpkg-divert --local --rename --remove "$ssd" > /dev/null
+fi
+rm -f ` + policyRcDPath + `
+if [ -e ` + policyRcDPath + `.` + progname + ` ] || [ -L ` + policyRcDPath + `.` + progname + ` ]; then mv ` + policyRcDPath + `.` + progname + ` ` + policyRcDPath + `; fi
+`
+
+// Install a policy-rc.d in the comprt that stops packages from starting their
+// services while the comprt is worked on. A func is returned to remove it,
+// putting back any policy-rc.d the comprt already had.
+func installPolicyRcD(target string) (func() error, error) {
+	policyRcD := filepath.Join(target, policyRcDPath)
+	policyRcDBackup := policyRcD + "." + progname
+
+	// the policy-rc.d left behind by an interrupted create is not backed up over
+	// the comprt's own
+	existing, err := os.ReadFile(policyRcD)
+	var leftBehind bool = err == nil && bytes.Equal(existing, policyRcDDenyAll)
+	if _, err := os.Lstat(policyRcD); err == nil && !leftBehind {
+		if err := os.Rename(policyRcD, policyRcDBackup); err != nil {
+			return nil, err
+		}
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := os.WriteFile(policyRcD, policyRcDDenyAll, ModeFile|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		os.Rename(policyRcDBackup, policyRcD)
+		return nil, err
+	}
+
+	return func() error {
+		if err := os.Remove(policyRcD); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := os.Rename(policyRcDBackup, policyRcD); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	}, nil
+}
+
+// Get the path of start-stop-daemon in the comprt, as the comprt's dpkg knows
+// it (it moved from /sbin to /usr/sbin). The path is empty if dpkg does not
+// ship it. Expected to be called while chrooted into the comprt.
+func startStopDaemonPath() (string, error) {
+	output, err := progExecutor.Output(exec.Command("dpkg-query", "--listfiles", "dpkg"))
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if path := strings.TrimSpace(scanner.Text()); strings.HasSuffix(path, "/sbin/start-stop-daemon") {
+			return path, nil
+		}
+	}
+
+	return "", scanner.Err()
+}
+
+// Divert the comprt's start-stop-daemon and install a fake in its place, that
+// way dpkg keeps the real one up to date if dpkg is upgraded. A func is returned
+// to put back the real one. Nothing is diverted if start-stop-daemon is missing
+// or already diverted by something else. Expected to be called while chrooted
+// into the comprt.
+func divertStartStopDaemon(quiet bool) (func() error, error) {
+	path, err := startStopDaemonPath()
+	if err != nil {
+		return nil, err
+	} else if path == "" {
+		return func() error { return nil }, nil
+	}
+
+	output, err := progExecutor.Output(exec.Command("dpkg-divert", "--truename", path))
+	if err != nil {
+		return nil, err
+	}
+	var truename string = strings.TrimSpace(string(output))
+	// the fake left behind by an interrupted create is put back this time
+	existing, err := os.ReadFile(filepath.Join(progExecutor.Root(), path))
+	var leftBehind bool = truename == path+".distrib" && err == nil && bytes.Equal(existing, fakeStartStopDaemon)
+	if truename != path && !leftBehind {
+		return func() error { return nil }, nil
+	} else if !leftBehind {
+		if err := runDpkgDivert(quiet, "--add", path); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(progExecutor.Root(), path), fakeStartStopDaemon, ModeFile|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+			runDpkgDivert(quiet, "--remove", path)
+			return nil, err
+		}
+	}
+
+	return func() error {
+		if err := os.Remove(filepath.Join(progExecutor.Root(), path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		return runDpkgDivert(quiet, "--remove", path)
+	}, nil
+}
+
+// Add or remove (per the action passed in) the local diversion of the path,
+// which renames the path to path.distrib (and back).
+func runDpkgDivert(quiet bool, action, path string) error {
+	dpkgDivertCmd := exec.Command("dpkg-divert", "--local", "--rename", action, path)
+	traceCommand(dpkgDivertCmd)
+	dpkgDivertCmd.Stdout, dpkgDivertCmd.Stderr = buildLogOutput(quiet)
+
+	return progExecutor.Run(dpkgDivertCmd)
+}
+
+// Stop packages from starting their services in the comprt while it is
+// provisioned, by installing a policy-rc.d that denies every action and
+// diverting start-stop-daemon. A func is returned to undo both. Expected to be
+// called while chrooted into the comprt.
+func suppressServiceStarts(quiet bool) (func() error, error) {
+	removePolicyRcD, err := installPolicyRcD(progExecutor.Root())
+	if err != nil {
+		return nil, err
+	}
+
+	restoreStartStopDaemon, err := divertStartStopDaemon(quiet)
+	if err != nil {
+		removePolicyRcD()
+		return nil, err
+	}
+
+	return func() error {
+		if err := restoreStartStopDaemon(); err != nil {
+			return err
+		}
+
+		return removePolicyRcD()
+	}, nil
+}
+
+// Get the mmdebstrap hooks that stop packages from starting their services in
+// the comprt and the hooks that undo it, the same as suppressServiceStarts does.
+func serviceStartsMmdebstrapArgs() (suppressArgs, restoreArgs []string) {
+	suppressArgs = append(suppressArgs, `--customize-hook=chroot "$1" sh -c `+shellQuote(suppressServiceStartsScript)+
+		" sh "+shellQuote(string(policyRcDDenyAll))+" "+shellQuote(string(fakeStartStopDaemon)))
+	restoreArgs = append(restoreArgs, `--customize-hook=chroot "$1" sh -c `+shellQuote(restoreServiceStartsScript))
+
+	return suppressArgs, restoreArgs
+}
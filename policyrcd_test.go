@@ -0,0 +1,92 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallPolicyRcDKeepsExisting(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	policyRcD := filepath.Join(tempDirPath, policyRcDPath)
+	if err := os.MkdirAll(filepath.Dir(policyRcD), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	var existingPolicyRcD []byte = []byte("#!/bin/sh\nexit 0\n")
+	if err := os.WriteFile(policyRcD, existingPolicyRcD, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	removePolicyRcD, err := installPolicyRcD(tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policyRcDBytes, err := os.ReadFile(policyRcD); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(policyRcDBytes, policyRcDDenyAll) {
+		t.Fatalf("the installed policy-rc.d does not deny all actions: %q", policyRcDBytes)
+	}
+
+	if err := removePolicyRcD(); err != nil {
+		t.Fatal(err)
+	}
+	if policyRcDBytes, err := os.ReadFile(policyRcD); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(policyRcDBytes, existingPolicyRcD) {
+		t.Fatalf("the comprt's policy-rc.d was not put back: %q", policyRcDBytes)
+	}
+}
+
+func TestInstallPolicyRcDLeftBehind(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// as left behind by an interrupted create, with the comprt's own backed up
+	policyRcD := filepath.Join(tempDirPath, policyRcDPath)
+	if err := os.MkdirAll(filepath.Dir(policyRcD), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	var existingPolicyRcD []byte = []byte("#!/bin/sh\nexit 0\n")
+	if err := os.WriteFile(policyRcD+"."+progname, existingPolicyRcD, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(policyRcD, policyRcDDenyAll, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	removePolicyRcD, err := installPolicyRcD(tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := removePolicyRcD(); err != nil {
+		t.Fatal(err)
+	}
+	if policyRcDBytes, err := os.ReadFile(policyRcD); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(policyRcDBytes, existingPolicyRcD) {
+		t.Fatalf("the comprt's policy-rc.d was not put back: %q", policyRcDBytes)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const (
+	procFilesystems = "/proc/filesystems"
+
+	debianArchiveKeyring = "/usr/share/keyrings/debian-archive-keyring.gpg"
+	ubuntuArchiveKeyring = "/usr/share/keyrings/ubuntu-archive-keyring.gpg"
+
+	mebibyte = 1 << 20
+
+	// What the registry, aliases and caches in the progDataDir are expected to
+	// need, aliases are cloned in there.
+	progDataDirSizeEstimate = 64 * mebibyte
+)
+
+// Rough sizes of a freshly created comprt per debootstrap variant, with some
+// headroom for the packages the comprtconfig installs. The empty variant is
+// debootstrap's default.
+var variantSizeEstimates = map[string]uint64{
+	"":           600 * mebibyte,
+	"buildd":     500 * mebibyte,
+	"fakechroot": 400 * mebibyte,
+	"minbase":    350 * mebibyte,
+}
+
+// Get the debootstrap variant a comprt is created with, debootstrap uses its
+// default variant unless --variant is passed through to it.
+func debootstrapVariant(passThroughFlags []string) string {
+	for _, flag := range passThroughFlags {
+		if strings.HasPrefix(flag, "--variant=") {
+			return strings.TrimPrefix(flag, "--variant=")
+		}
+	}
+
+	return ""
+}
+
+// Estimate how much space a comprt will take up. Ubuntu's base system is larger
+// than debian's.
+func estimateComprtSize(variant string, ubuntu bool) uint64 {
+	estimate, ok := variantSizeEstimates[variant]
+	if !ok {
+		estimate = variantSizeEstimates[""]
+	}
+	if ubuntu {
+		estimate += estimate / 4
+	}
+
+	return estimate
+}
+
+// Get the free space (to unprivileged users) of the filesystem that path is or
+// would be on, path itself does not need to exist yet.
+func freeSpace(path string) (uint64, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		var stat syscall.Statfs_t
+		err := syscall.Statfs(path, &stat)
+		if err == nil {
+			return stat.Bavail * uint64(stat.Bsize), nil
+		} else if !errors.Is(err, fs.ErrNotExist) || path == filepath.Dir(path) {
+			return 0, err
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+// Check the filesystem path is or would be on has at least needed bytes free.
+func checkFreeSpace(path string, needed uint64) error {
+	free, err := freeSpace(path)
+	if err != nil {
+		return err
+	}
+	if free < needed {
+		return fmt.Errorf(
+			"%v: only %v MiB is free but about %v MiB is needed, free up some space or pick a path on another filesystem",
+			path,
+			free/mebibyte,
+			needed/mebibyte,
+		)
+	}
+
+	return nil
+}
+
+// Read in the filesystems the kernel supports from a filesystems file
+// (e.g. /proc/filesystems).
+func readKernelFilesystems(fPath string) ([]string, error) {
+	file, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var filesystems []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// e.g. 'nodev	proc' or '	ext4'
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			filesystems = append(filesystems, fields[len(fields)-1])
+		}
+	}
+
+	return filesystems, scanner.Err()
+}
+
+// Check the kernel supports each of the filesystems.
+func checkKernelFilesystems(fPath string, required []string) error {
+	filesystems, err := readKernelFilesystems(fPath)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, filesys := range required {
+		if !stringInArr(filesys, &filesystems) {
+			missing = append(missing, filesys)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf(
+			"the kernel does not support the %v filesystem(s), load the module(s) (e.g. modprobe %v) or run on a kernel that does",
+			strings.Join(missing, ", "),
+			missing[0],
+		)
+	}
+
+	return nil
+}
+
+// Check a program is on the PATH, pkg is the debian package that provides it.
+func checkProgram(name, pkg string) error {
+	if _, err := progExecutor.LookPath(name); err != nil {
+		return fmt.Errorf("%v was not found on the PATH, install it (e.g. apt-get install %v)", name, pkg)
+	}
+
+	return nil
+}
+
+// Get the keyring debootstrap (or mmdebstrap) verifies the comprt's release
+// with, an empty keyring means the release will not be verified against one
+// from the host.
+func comprtKeyring(passThroughFlags []string, ubuntu bool) string {
+	for _, flag := range passThroughFlags {
+		if flag == "--no-check-gpg" {
+			return ""
+		} else if strings.HasPrefix(flag, "--keyring=") {
+			return strings.TrimPrefix(flag, "--keyring=")
+		}
+	}
+	if ubuntu {
+		return ubuntuArchiveKeyring
+	}
+
+	return debianArchiveKeyring
+}
+
+// Check the keyring exists, that way a missing keyring is not found out about
+// after debootstrap has started.
+func checkKeyring(keyring string) error {
+	if keyring == "" {
+		return nil
+	}
+	if _, err := os.Stat(keyring); errors.Is(err, fs.ErrNotExist) {
+		var pkg string = "debian-archive-keyring"
+		if keyring == ubuntuArchiveKeyring {
+			pkg = "ubuntu-keyring"
+		}
+		return fmt.Errorf("the keyring %v was not found, install it (e.g. apt-get install %v) or pass --keyring=KEYRING through to debootstrap", keyring, pkg)
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Check the host is able to create the comprt before anything is done. All of the
+// checks are ran so every problem is reported at once.
+func preflightCreate(pconfs *progConfigs) (errs []error) {
+	var ubuntu bool = pconfs.sources.ubuntu()
+	if err := checkFreeSpace(
+		pconfs.target,
+		estimateComprtSize(debootstrapVariant(pconfs.passThroughFlags), ubuntu),
+	); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkFreeSpace(progDataDir, progDataDirSizeEstimate); err != nil {
+		errs = append(errs, err)
+	}
+
+	if pconfs.rootless {
+		if err := checkProgram("mmdebstrap", "mmdebstrap"); err != nil {
+			errs = append(errs, err)
+		}
+	} else {
+		if !fakeBootstrap {
+			if err := checkProgram("debootstrap", "debootstrap"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		var required []string = []string{"proc", "sysfs", "devpts"}
+		if pconfs.buildInTmpfs {
+			required = append(required, "tmpfs")
+		}
+		if err := checkKernelFilesystems(procFilesystems, required); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// a skeleton rootfs is not downloaded and has the host's binaries
+	if fakeBootstrap {
+		return errs
+	}
+	if err := checkKeyring(comprtKeyring(pconfs.passThroughFlags, ubuntu)); err != nil {
+		errs = append(errs, err)
+	}
+	// debootstrap's second stage runs the comprt's binaries
+	if err := ensureBinfmt(binfmtMiscDir, binfmtConfDirs, comprtArch(pconfs.passThroughFlags)); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEstimateComprtSize(t *testing.T) {
+	if variant := debootstrapVariant([]string{"--include=git", "--variant=minbase"}); variant != "minbase" {
+		t.Fatalf("expected the minbase variant, got %v", variant)
+	} else if estimateComprtSize(variant, false) >= estimateComprtSize("", false) {
+		t.Fatal("the minbase variant was not estimated to be smaller than the default variant")
+	}
+
+	if estimateComprtSize("", true) <= estimateComprtSize("", false) {
+		t.Fatal("ubuntu was not estimated to be larger than debian")
+	} else if estimateComprtSize("foo", false) != estimateComprtSize("", false) {
+		t.Fatal("an unknown variant was not estimated as the default variant")
+	}
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// the target does not have to exist yet
+	var target string = filepath.Join(tempDirPath, "foo", "bar")
+	if err := checkFreeSpace(target, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFreeSpace(target, math.MaxUint64); err == nil {
+		t.Fatal("more space than is free was accepted")
+	}
+}
+
+func TestCheckKernelFilesystems(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var filesystemsPath string = filepath.Join(tempDirPath, "filesystems")
+	if err := createTestFile(filesystemsPath, "nodev\tsysfs\nnodev\tproc\nnodev\tdevpts\n\text4\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkKernelFilesystems(filesystemsPath, []string{"proc", "sysfs", "devpts", "ext4"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkKernelFilesystems(filesystemsPath, []string{"proc", "tmpfs"}); err == nil {
+		t.Fatal("a filesystem the kernel does not support was accepted")
+	}
+}
+
+func TestComprtKeyring(t *testing.T) {
+	if keyring := comprtKeyring(nil, false); keyring != debianArchiveKeyring {
+		t.Fatalf("expected the debian keyring, got %v", keyring)
+	} else if keyring := comprtKeyring(nil, true); keyring != ubuntuArchiveKeyring {
+		t.Fatalf("expected the ubuntu keyring, got %v", keyring)
+	} else if keyring := comprtKeyring([]string{"--keyring=/foo.gpg"}, false); keyring != "/foo.gpg" {
+		t.Fatalf("expected the passed through keyring, got %v", keyring)
+	}
+
+	if err := checkKeyring(comprtKeyring([]string{"--no-check-gpg"}, false)); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkKeyring(filepath.Join(os.TempDir(), "_"+tempDir, "foo.gpg")); err == nil {
+		t.Fatal("a keyring that does not exist was accepted")
+	}
+}
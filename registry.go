@@ -0,0 +1,240 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	registryFile     = "registry.json"
+	registryLockFile = "registry.lock"
+)
+
+// A type used to store what is known about a comprt created on this host.
+type registryEntry struct {
+	Target   string `json:"target"`
+	CodeName string `json:"codename"`
+	Arch     string `json:"arch,omitempty"`
+	Mirror   string `json:"mirror"`
+	Alias    string `json:"alias"`
+	// The user logged in as by the chroot command, empty if the comprt was
+	// created by an alias.
+	User    string            `json:"user,omitempty"`
+	Created time.Time         `json:"created"`
+	Updated time.Time         `json:"updated"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	// The caches mounted into the comprt by the chroot and provision commands.
+	Caches []cacheMount `json:"caches,omitempty"`
+	// Set while the comprt is being created, a comprt left incomplete is from a
+	// create that was interrupted.
+	Incomplete bool `json:"incomplete,omitempty"`
+	// The version of debcomprt that created the comprt.
+	Version string `json:"debcomprt_version,omitempty"`
+	// The root hash of the comprt's digest, kept outside of the comprt so a
+	// rewritten digest can be caught by the verify command.
+	Digest string `json:"digest,omitempty"`
+}
+
+// Read in the registry of comprts. A registry that does not exist yet is
+// treated as empty.
+func loadRegistry() ([]registryEntry, error) {
+	var entries []registryEntry
+	registryBytes, err := os.ReadFile(filepath.Join(progDataDir, registryFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(registryBytes, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Write out the registry of comprts, sorted by target.
+func saveRegistry(entries []registryEntry) error {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Target < entries[j].Target
+	})
+	registryBytes, err := json.MarshalIndent(entries, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	// written to a temp file first so a crash does not leave a truncated registry
+	registryPath := filepath.Join(progDataDir, registryFile)
+	if err := os.WriteFile(
+		registryPath+".tmp",
+		append(registryBytes, '\n'),
+		ModeFile|(OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R),
+	); err != nil {
+		return err
+	}
+
+	return os.Rename(registryPath+".tmp", registryPath)
+}
+
+// Lock the file in debcomprt's data dir, as multiple debcomprt processes may be
+// using what it guards. The returned func unlocks it.
+func lockProgDataFile(name string) (func(), error) {
+	if err := os.MkdirAll(progDataDir, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return nil, err
+	}
+
+	lockFd, err := os.OpenFile(
+		filepath.Join(progDataDir, name),
+		os.O_CREATE|os.O_RDWR,
+		ModeFile|(OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(lockFd.Fd()), syscall.LOCK_EX); err != nil {
+		lockFd.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(lockFd.Fd()), syscall.LOCK_UN)
+		lockFd.Close()
+	}, nil
+}
+
+// Read in the registry, have fn modify the entries and write the registry back
+// out. The registry is locked throughout, as multiple debcomprt processes may
+// be updating it.
+func updateRegistry(fn func(entries *[]registryEntry) error) error {
+	unlock, err := lockProgDataFile(registryLockFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := loadRegistry()
+	if err != nil {
+		return err
+	}
+	if err := fn(&entries); err != nil {
+		return err
+	}
+
+	return saveRegistry(entries)
+}
+
+// Add the entry to the registry, replacing any entry for the same target. The
+// creation time of a replaced entry is kept.
+func registerComprt(entry registryEntry) error {
+	absTarget, err := filepath.Abs(entry.Target)
+	if err != nil {
+		return err
+	}
+	entry.Target = absTarget
+
+	return updateRegistry(func(entries *[]registryEntry) error {
+		for i := range *entries {
+			if (*entries)[i].Target == entry.Target {
+				if entry.Created.IsZero() {
+					entry.Created = (*entries)[i].Created
+				}
+				(*entries)[i] = entry
+				return nil
+			}
+		}
+		*entries = append(*entries, entry)
+		return nil
+	})
+}
+
+// Remove the target's entry from the registry, if the target is in the registry.
+func unregisterComprt(target string) error {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	return updateRegistry(func(entries *[]registryEntry) error {
+		for i := range *entries {
+			if (*entries)[i].Target == absTarget {
+				*entries = append((*entries)[:i], (*entries)[i+1:]...)
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// Mark the target's registry entry as updated now, if the target is in the
+// registry.
+func touchComprt(target string) error {
+	entry, err := lookupComprt(target)
+	if err != nil || entry == nil {
+		return err
+	}
+	entry.Updated = time.Now().UTC()
+
+	return registerComprt(*entry)
+}
+
+// Find the registry entry for the target. Returns nil if the target is not in
+// the registry.
+func lookupComprt(target string) (*registryEntry, error) {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if entries[i].Target == absTarget {
+			return &entries[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Parse labels in the KEY=VALUE form into a map.
+func parseLabels(labels []string) (map[string]string, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	var labelMap map[string]string = make(map[string]string)
+	for _, label := range labels {
+		i := strings.Index(label, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("%v is not a properly formatted label (e.g. KEY=VALUE)", label)
+		}
+		labelMap[label[:i]] = label[i+1:]
+	}
+
+	return labelMap, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Point progDataDir to a temp dir for the duration of a test. The returned
+// function restores progDataDir and removes the temp dir.
+func setupTempProgDataDir(t *testing.T) func() {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousProgDataDir := progDataDir
+	progDataDir = tempDirPath
+	return func() {
+		progDataDir = previousProgDataDir
+		os.RemoveAll(tempDirPath)
+	}
+}
+
+func TestRegisterComprt(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	created := time.Date(2021, time.December, 4, 0, 0, 0, 0, time.UTC)
+	var testTarget string = filepath.Join(progDataDir, "testChroot")
+	if err := registerComprt(registryEntry{
+		Target:   testTarget,
+		CodeName: testCodeCame,
+		Created:  created,
+		Updated:  created,
+		Labels:   map[string]string{"team": "infra"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// re-registering the target should replace the entry but keep its creation time
+	updated := created.Add(time.Hour)
+	if err := registerComprt(registryEntry{
+		Target:   testTarget,
+		CodeName: testCodeCame,
+		Updated:  updated,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := loadRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("found %d registry entries", len(entries))
+	}
+
+	entry, err := lookupComprt(testTarget)
+	if err != nil {
+		t.Fatal(err)
+	} else if entry == nil {
+		t.Fatalf("%v was not found in the registry", testTarget)
+	}
+	if !entry.Created.Equal(created) || !entry.Updated.Equal(updated) {
+		t.Fatalf("found the following registry entry %+v", entry)
+	}
+
+	if err := unregisterComprt(testTarget); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := lookupComprt(testTarget); err != nil {
+		t.Fatal(err)
+	} else if entry != nil {
+		t.Fatalf("%v was still found in the registry", testTarget)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels([]string{"team=infra", "tech.cavcrosby.purpose=ci=cd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["team"] != "infra" || labels["tech.cavcrosby.purpose"] != "ci=cd" {
+		t.Fatalf("found the following labels %v", labels)
+	}
+
+	if _, err := parseLabels([]string{"=infra"}); err == nil {
+		t.Fatal("a malformed label was parsed without error")
+	}
+}
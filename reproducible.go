@@ -0,0 +1,100 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The env var that makes exports reproducible, for reference:
+// https://reproducible-builds.org/specs/source-date-epoch/
+const sourceDateEpochEnvVar = "SOURCE_DATE_EPOCH"
+
+// The files in a comprt that identify the machine it runs on (or are
+// regenerated by it), these are left out of a reproducible export. Each is a
+// tar exclude pattern, relative to the comprt.
+var machineSpecificPaths = []string{
+	"./etc/machine-id",
+	"./var/lib/dbus/machine-id",
+	"./etc/ssh/ssh_host_*",
+	"./var/lib/systemd/random-seed",
+	"./var/cache/ldconfig/aux-cache",
+}
+
+// Get the time exports are made reproducible for, from SOURCE_DATE_EPOCH.
+// Returns false if SOURCE_DATE_EPOCH is not set.
+func sourceDateEpoch() (time.Time, bool, error) {
+	value, ok := os.LookupEnv(sourceDateEpochEnvVar)
+	if !ok || value == "" {
+		return time.Time{}, false, nil
+	}
+
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || epoch < 0 {
+		return time.Time{}, false, fmt.Errorf("%v=%v is not the number of seconds since the unix epoch", sourceDateEpochEnvVar, value)
+	}
+
+	return time.Unix(epoch, 0).UTC(), true, nil
+}
+
+// Get the modification time of the files an export generates (e.g. LXD's
+// metadata.yaml), SOURCE_DATE_EPOCH if it is set.
+func exportModTime() (time.Time, error) {
+	epoch, ok, err := sourceDateEpoch()
+	if err != nil {
+		return time.Time{}, err
+	} else if !ok {
+		return time.Now(), nil
+	}
+
+	return epoch, nil
+}
+
+// Get the tar args that make a tarball of the comprt the same each time it is
+// written: the entries are sorted by name, their modification times are
+// clamped to the epoch, the access and change times are left out (along with
+// the PIDs GNU tar names the pax headers by) and the machine specific files are
+// excluded.
+func reproducibleTarArgs(epoch time.Time) []string {
+	var args []string = []string{
+		"--sort=name",
+		fmt.Sprintf("--mtime=@%d", epoch.Unix()),
+		"--clamp-mtime",
+		"--pax-option=exthdr.name=%d/PaxHeaders/%f,delete=atime,delete=ctime",
+		"--anchored",
+	}
+	for _, path := range machineSpecificPaths {
+		args = append(args, "--exclude="+path)
+	}
+
+	return args
+}
+
+// Write the comprt as a tarball to w for an export, which is reproducible if
+// SOURCE_DATE_EPOCH is set.
+func writeExportTar(target string, w io.Writer) error {
+	epoch, ok, err := sourceDateEpoch()
+	if err != nil {
+		return err
+	} else if !ok {
+		return writeComprtTar(target, w)
+	}
+
+	return writeComprtTar(target, w, reproducibleTarArgs(epoch)...)
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSourceDateEpoch(t *testing.T) {
+	t.Setenv(sourceDateEpochEnvVar, "")
+	if _, ok, err := sourceDateEpoch(); err != nil || ok {
+		t.Fatalf("expected no epoch, actual: %v (%v)", ok, err)
+	}
+
+	t.Setenv(sourceDateEpochEnvVar, "1700000000")
+	if epoch, ok, err := sourceDateEpoch(); err != nil || !ok {
+		t.Fatalf("expected an epoch, actual: %v (%v)", ok, err)
+	} else if !epoch.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("expected: %v, actual: %v", time.Unix(1700000000, 0), epoch)
+	}
+
+	t.Setenv(sourceDateEpochEnvVar, "yesterday")
+	if _, _, err := sourceDateEpoch(); err == nil {
+		t.Fatal("a malformed epoch was accepted")
+	}
+}
+
+func TestWriteExportTarReproducible(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	for path, contents := range map[string]string{
+		"/etc/machine-id":                    "0123456789abcdef0123456789abcdef\n",
+		"/etc/ssh/ssh_host_ed25519_key":      "foo",
+		"/etc/ssh/sshd_config":               "bar",
+		"/usr/share/doc/git/changelog.gz":    "baz",
+		"/var/lib/dbus/machine-id":           "0123456789abcdef0123456789abcdef\n",
+		"/var/cache/ldconfig/aux-cache":      "qux",
+		"/var/lib/systemd/random-seed":       "quux",
+		"/usr/share/doc/git/README.Debian":   "corge",
+		"/usr/share/doc/git/NEWS.Debian.gz":  "grault",
+		"/usr/share/doc/git/contrib/example": "garply",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(tempDirPath, path)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(filepath.Join(tempDirPath, path), contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv(sourceDateEpochEnvVar, "1700000000")
+	var first, second bytes.Buffer
+	if err := writeExportTar(tempDirPath, &first); err != nil {
+		t.Fatal(err)
+	}
+	// the comprt being touched (or read) in between does not change the export
+	if err := os.Chtimes(filepath.Join(tempDirPath, "etc", "ssh", "sshd_config"), time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeExportTar(tempDirPath, &second); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatal("exporting the comprt twice did not give the same tarball")
+	}
+
+	var names []string
+	tarR := tar.NewReader(&first)
+	for {
+		header, err := tarR.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if header.ModTime.After(time.Unix(1700000000, 0)) {
+			t.Fatalf("the modification time of %v was not clamped, actual: %v", header.Name, header.ModTime)
+		}
+		names = append(names, header.Name)
+	}
+	for _, name := range names {
+		for _, excluded := range []string{"./etc/machine-id", "./var/lib/dbus/machine-id", "./etc/ssh/ssh_host_ed25519_key", "./var/lib/systemd/random-seed", "./var/cache/ldconfig/aux-cache"} {
+			if name == excluded {
+				t.Fatalf("the machine specific %v was not left out of the export", name)
+			}
+		}
+	}
+	if !stringInArr("./etc/ssh/sshd_config", &names) {
+		t.Fatalf("expected ./etc/ssh/sshd_config in the export, actual: %v", names)
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] > names[i] && filepath.Dir(names[i-1]) == filepath.Dir(names[i]) {
+			t.Fatalf("the entries are not sorted by name: %v", names)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// A type used to describe how an operation that may fail transiently (e.g.
+// unmounting a busy filesystem, cloning over the network) should be retried.
+type retryPolicy struct {
+	// The number of attempts made, including the first one.
+	attempts int
+	// The delay before the second attempt, the delay doubles for each
+	// attempt after.
+	delay time.Duration
+	// The cap on the delay between attempts.
+	maxDelay time.Duration
+	// The fraction of the delay that is randomized, so callers retrying at the
+	// same time do not do so in lockstep.
+	jitter float64
+	// The time an attempt is given before it is cancelled, zero means an
+	// attempt is never cancelled.
+	timeout time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	attempts: 3,
+	delay:    1 * time.Second,
+	maxDelay: 30 * time.Second,
+	jitter:   0.2,
+}
+
+// The retry policy used by debcomprt, configurable by the global retry flags.
+var progRetryPolicy = defaultRetryPolicy
+
+// A *rand.Rand is not safe for concurrent use, so jitterRand is guarded by
+// jitterMu for retries run from several goroutines.
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// A type used to denote an error that should not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Wrap the error so retry will return it right away.
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Get the delay to wait before the attempt following the one passed in.
+// Attempts start at 1.
+func (p retryPolicy) delayFor(attempt int) time.Duration {
+	var delay time.Duration = p.delay
+	for i := 1; i < attempt && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	if p.maxDelay > 0 && delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+
+	if p.jitter > 0 {
+		spread := float64(delay) * p.jitter
+		jitterMu.Lock()
+		r := jitterRand.Float64()
+		jitterMu.Unlock()
+		delay += time.Duration(spread * (2*r - 1))
+	}
+
+	return delay
+}
+
+// Run fn until it succeeds, returns a permanent error, the policy's attempts are
+// exhausted or the context is cancelled. The last error returned by fn is
+// returned. onRetry, if passed in, is called before waiting on the next attempt.
+func retry(ctx context.Context, policy retryPolicy, onRetry func(attempt int, err error), fn func() error) error {
+	return retryWithTimeout(ctx, policy, onRetry, func(context.Context) error {
+		return fn()
+	})
+}
+
+// Like retry, though fn is passed a context that is cancelled once the policy's
+// timeout for the attempt is up. fn is expected to give up on the attempt when
+// the context is cancelled (e.g. by using exec.CommandContext).
+func retryWithTimeout(ctx context.Context, policy retryPolicy, onRetry func(attempt int, err error), fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.timeout)
+		}
+		err = fn(attemptCtx)
+		if err != nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("attempt timed out after %v: %w", policy.timeout, err)
+		}
+		cancel()
+		var permErr *permanentError
+		if err == nil {
+			return nil
+		} else if errors.As(err, &permErr) {
+			return permErr.err
+		} else if attempt >= policy.attempts {
+			return err
+		}
+
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+
+		timer := time.NewTimer(policy.delayFor(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = retryPolicy{
+	attempts: 3,
+	delay:    1 * time.Millisecond,
+	maxDelay: 2 * time.Millisecond,
+}
+
+func TestRetry(t *testing.T) {
+	var calls, retries int
+	err := retry(context.Background(), testRetryPolicy, func(attempt int, err error) {
+		retries += 1
+	}, func() error {
+		calls += 1
+		if calls < 2 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 2 || retries != 1 {
+		t.Fatalf("fn was called %d times and retried %d times", calls, retries)
+	}
+}
+
+func TestRetryAttemptsExhausted(t *testing.T) {
+	var calls int
+	transientErr := errors.New("transient")
+	err := retry(context.Background(), testRetryPolicy, nil, func() error {
+		calls += 1
+		return transientErr
+	})
+
+	if !errors.Is(err, transientErr) {
+		t.Fatalf("a non-expected error has occurred: %v", err)
+	} else if calls != testRetryPolicy.attempts {
+		t.Fatalf("fn was called %d times", calls)
+	}
+}
+
+func TestRetryPermanentError(t *testing.T) {
+	var calls int
+	permErr := errors.New("permanent")
+	err := retry(context.Background(), testRetryPolicy, nil, func() error {
+		calls += 1
+		return permanent(permErr)
+	})
+
+	if err != permErr {
+		t.Fatalf("a non-expected error has occurred: %v", err)
+	} else if calls != 1 {
+		t.Fatalf("fn was called %d times", calls)
+	}
+}
+
+func TestRetryContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var calls int
+	retry(ctx, retryPolicy{attempts: 3, delay: time.Hour}, nil, func() error {
+		calls += 1
+		return errors.New("transient")
+	})
+
+	if calls != 1 {
+		t.Fatalf("fn was called %d times after the context was cancelled", calls)
+	}
+}
+
+func TestRetryPolicyDelayFor(t *testing.T) {
+	policy := retryPolicy{delay: 1 * time.Second, maxDelay: 3 * time.Second}
+	for attempt, expected := range map[int]time.Duration{1: 1 * time.Second, 2: 2 * time.Second, 3: 3 * time.Second, 10: 3 * time.Second} {
+		if delay := policy.delayFor(attempt); delay != expected {
+			t.Fatalf("delay for attempt %d was %v", attempt, delay)
+		}
+	}
+}
+
+func TestRetryPolicyDelayForConcurrentJitter(t *testing.T) {
+	policy := retryPolicy{delay: 1 * time.Second, maxDelay: 3 * time.Second, jitter: 0.5}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for attempt := 1; attempt < 100; attempt++ {
+				if delay := policy.delayFor(attempt); delay < 500*time.Millisecond || delay > 4500*time.Millisecond {
+					t.Errorf("delay for attempt %d was %v", attempt, delay)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRetryWithTimeout(t *testing.T) {
+	var calls int
+	policy := testRetryPolicy
+	policy.timeout = 1 * time.Millisecond
+	err := retryWithTimeout(context.Background(), policy, nil, func(ctx context.Context) error {
+		calls += 1
+		if calls < 2 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if calls != 2 {
+		t.Fatalf("fn was called %d times", calls)
+	}
+
+	err = retryWithTimeout(context.Background(), policy, nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("a non-expected error has occurred: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Get the program's data directory for a user that is not root, as root owns
+// the system wide progDataDir. For reference:
+// https://specifications.freedesktop.org/basedir-spec/basedir-spec-latest.html
+func userProgDataDir() (string, error) {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, progname), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".local", "share", progname), nil
+}
+
+// Create the mmdebstrap arg list used to create a comprt without root. The
+// comprt's apt sources are written, the comprt config file is ran and the
+// default comprt user is created (if no alias is used) as mmdebstrap customize
+// hooks, these run inside of
+// mmdebstrap's user namespace. The same goes for the comprt's lifecycle hooks,
+// and enabling the foreign architectures. No services are started in the comprt
+// while it is configured. The secrets in the host dir (if any)
+// are only in the comprt while the comprt config file runs.
+func createRootlessArgList(comprtConfigPath, alias string, users []comprtUser, debootstrapCmdArr, foreignArchs, pinnedPkgs []string, sources aptSources, netFiles networkFiles, secretsHostDir string, binds []bindMount, copies []comprtCopy, hooks *comprtHooks) []string {
+	// mmdebstrap requires a customize hook command to be a single shell string,
+	// with the target being passed in as "$1"
+	chrootHook := func(args ...string) string {
+		var quotedArgs []string
+		for _, arg := range args {
+			quotedArgs = append(quotedArgs, shellQuote(arg))
+		}
+		return `--customize-hook=chroot "$1" ` + strings.Join(quotedArgs, " ")
+	}
+
+	var args []string = []string{"--mode=unshare"}
+	args = append(args, eatmydataMmdebstrapArgs()...)
+	args = append(args, hooks.mmdebstrapArgs("--setup-hook", preBootstrapHook)...)
+	args = append(args, sources.mmdebstrapArgs()...)
+	for _, comprtCp := range copies {
+		args = append(args, comprtCp.mmdebstrapArgs()...)
+	}
+	args = append(args, hooks.mmdebstrapArgs("--customize-hook", postBootstrapHook)...)
+	args = append(args, hooks.mmdebstrapArgs("--customize-hook", preConfigHook)...)
+	installNetFilesArgs, restoreNetFilesArgs := netFiles.mmdebstrapArgs()
+	args = append(args, installNetFilesArgs...)
+	mountBindsArgs, unMountBindsArgs := bindMountsMmdebstrapArgs(binds)
+	args = append(args, mountBindsArgs...)
+	suppressServiceStartsArgs, restoreServiceStartsArgs := serviceStartsMmdebstrapArgs()
+	args = append(args, suppressServiceStartsArgs...)
+	for _, arch := range foreignArchs {
+		args = append(args, chrootHook("dpkg", "--add-architecture", arch))
+	}
+	args = append(args, chrootHook(append(append([]string{"env"}, aptNonInteractiveEnv...), "apt-get", "update")...))
+	if len(pinnedPkgs) > 0 {
+		var aptGetArgs []string = append([]string{"env"}, aptNonInteractiveEnv...)
+		aptGetArgs = append(aptGetArgs, "apt-get")
+		aptGetArgs = append(aptGetArgs, pinnedPkgsAptGetArgs()...)
+		args = append(args, chrootHook(append(aptGetArgs, pinnedPkgs...)...))
+	}
+
+	// without a comprt config path, there is no comprt config to run
+	if comprtConfigPath != "" {
+		var chrootComprtConfigPath string = comprtConfigDest(comprtConfigPath)
+		// the same as Chroot, the comprt config file does not inherit mmdebstrap's env
+		var configEnvArgs []string
+		if !preserveEnv {
+			configEnvArgs = append(append([]string{"env", "-i"}, chrootEnv()...), comprtConfigEnv()...)
+		} else if env := comprtConfigEnv(); len(env) > 0 {
+			configEnvArgs = append([]string{"env"}, env...)
+		}
+		args = append(args, comprtCopy{Src: comprtConfigPath, Dest: chrootComprtConfigPath}.mmdebstrapArgs()...)
+		mountSecretsArgs, unMountSecretsArgs := secretsMmdebstrapArgs(secretsHostDir)
+		args = append(args, mountSecretsArgs...)
+		if fileInfo, err := os.Stat(comprtConfigPath); err == nil && fileInfo.IsDir() {
+			// the same as runComprtConfig, every executable in the dir is ran in lexical order
+			args = append(args, chrootHook(append(
+				configEnvArgs,
+				"sh",
+				"-c",
+				`for f in "$1"/*; do if [ -f "$f" ] && [ -x "$f" ]; then "$f" || exit $?; fi; done`,
+				"sh",
+				chrootComprtConfigPath,
+			)...))
+		} else {
+			args = append(args, chrootHook(append(configEnvArgs, "sh", chrootComprtConfigPath)...))
+		}
+		args = append(args, unMountSecretsArgs...)
+	}
+	for _, setupCmdArr := range usersSetupCmdArrs(users, alias) {
+		args = append(args, chrootHook(setupCmdArr...))
+	}
+	args = append(args, restoreServiceStartsArgs...)
+	args = append(args, unMountBindsArgs...)
+	args = append(args, restoreNetFilesArgs...)
+	args = append(args, hooks.mmdebstrapArgs("--customize-hook", postConfigHook)...)
+
+	// mmdebstrap takes every mirror, apt then falls back on the mirrors after the first
+	args = append(args, debootstrapCmdArr...)
+	return append(args, sources.fallbackMirrors...)
+}
+
+// Create a debian comprt without root, by using mmdebstrap's unshare mode. For
+// reference:
+// https://gitlab.mister-muffin.de/josch/mmdebstrap/src/branch/main/mmdebstrap
+func createRootlessComprt(comprtConfigPath, alias string, users []comprtUser, quiet bool, debootstrapCmdArr *[]string, foreignArchs, pinnedPkgs []string, sources aptSources, netFiles networkFiles, secrets comprtSecrets, binds []bindMount, copies []comprtCopy, hooks *comprtHooks) (errs []error) {
+	mmdebstrapPath, err := progExecutor.LookPath("mmdebstrap")
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	// the comprt config file is optional
+	if _, err := os.Stat(comprtConfigPath); errors.Is(err, fs.ErrNotExist) {
+		comprtConfigPath = ""
+	}
+
+	// mmdebstrap copies the secrets in from the host, instead of them being passed
+	// in its args (which any user can see)
+	secretsHostDir, removeSecretsHostDir, err := secrets.writeHostDir()
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+	defer func() {
+		if err := removeSecretsHostDir(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+
+	mmdebstrapCmd := exec.Command(
+		mmdebstrapPath,
+		append(bootstrapVerbosityArgs(), createRootlessArgList(comprtConfigPath, alias, users, *debootstrapCmdArr, foreignArchs, pinnedPkgs, sources, netFiles, secretsHostDir, binds, copies, hooks)...)...,
+	)
+	traceCommand(mmdebstrapCmd)
+	stdoutWriter, stderrWriter := buildLogOutput(quiet)
+	mmdebstrapCmd.Stdout = createPhases.watch(stdoutWriter, mmdebstrapPhaseMarkers)
+	mmdebstrapCmd.Stderr = createPhases.watch(stderrWriter, mmdebstrapPhaseMarkers)
+	createPhases.start(bootstrapDownloadPhase)
+	defer createPhases.stop()
+	if err := progExecutor.Run(mmdebstrapCmd); err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	return nil
+}
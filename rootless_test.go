@@ -0,0 +1,118 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateRootlessArgList(t *testing.T) {
+	var debootstrapCmdArr []string = []string{"--include=git", testCodeCame, "foo", defaultMirrorMappings[testCodeCame]}
+	args := createRootlessArgList(filepath.Join("bar", comprtConfigFile), noAlias, []comprtUser{defaultComprtUser()}, debootstrapCmdArr, nil, nil, testAptSources, networkFiles{}, "", nil, nil, nil)
+
+	if args[0] != "--mode=unshare" {
+		t.Fatalf("mmdebstrap was not ran in unshare mode: %v", args)
+	}
+	if !strings.HasSuffix(strings.Join(args, " "), strings.Join(debootstrapCmdArr, " ")) {
+		t.Fatalf("the debootstrap args were not passed to mmdebstrap: %v", args)
+	}
+
+	var hooks string = strings.Join(args, "\n")
+	for _, expected := range []string{
+		`--customize-hook=upload 'bar/comprtconfig' '/comprtconfig'`,
+		`--customize-hook=chroot "$1" 'env' '-i' 'PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin' 'HOME=/root' 'LANG=C.UTF-8'`,
+		`'DEBIAN_FRONTEND=noninteractive' 'DEBCONF_NONINTERACTIVE_SEEN=true' 'APT_LISTCHANGES_FRONTEND=none' 'sh' '/comprtconfig'`,
+		`--customize-hook=chroot "$1" 'sh' '-c' 'getent group "$1" > /dev/null || groupadd --gid "$1" "$2"' 'sh' '1224' 'debcomprt'`,
+		`--customize-hook=chroot "$1" 'useradd'`,
+		`buster/updates main`,
+		`--customize-hook=chroot "$1" 'env' 'DEBIAN_FRONTEND=noninteractive' 'DEBCONF_NONINTERACTIVE_SEEN=true' 'APT_LISTCHANGES_FRONTEND=none' 'apt-get' 'update'`,
+	} {
+		if !strings.Contains(hooks, expected) {
+			t.Fatalf("%v was not found in the mmdebstrap args: %v", expected, args)
+		}
+	}
+
+	suppressArgs, restoreArgs := serviceStartsMmdebstrapArgs()
+	if i := strings.Index(hooks, suppressArgs[0]); i == -1 || i > strings.Index(hooks, "'apt-get' 'update'") {
+		t.Fatalf("services were not suppressed before the package lists were updated: %v", args)
+	} else if i := strings.Index(hooks, restoreArgs[0]); i == -1 || i < strings.Index(hooks, "'useradd'") {
+		t.Fatalf("services were not restored after the comprt was configured: %v", args)
+	}
+
+	args = createRootlessArgList(comprtConfigFile, noAlias, []comprtUser{defaultComprtUser()}, debootstrapCmdArr, nil, []string{"git=1:2.20.1-2+deb10u3"}, testAptSources, networkFiles{}, "", nil, nil, nil)
+	if !strings.Contains(strings.Join(args, "\n"), `'apt-get' 'install' '--yes' '--allow-downgrades' '--no-install-recommends' 'git=1:2.20.1-2+deb10u3'`) {
+		t.Fatalf("the pinned packages were not installed by mmdebstrap: %v", args)
+	}
+
+	args = createRootlessArgList(comprtConfigFile, noAlias, []comprtUser{defaultComprtUser()}, debootstrapCmdArr, []string{"armhf"}, nil, testAptSources, networkFiles{}, "", nil, nil, nil)
+	if joined := strings.Join(args, "\n"); !strings.Contains(joined, `--customize-hook=chroot "$1" 'dpkg' '--add-architecture' 'armhf'`+"\n"+`--customize-hook=chroot "$1" 'env'`) {
+		t.Fatalf("armhf was not enabled before the package lists were updated: %v", args)
+	}
+
+	defer func(previous bool) { noninteractiveConfig = previous }(noninteractiveConfig)
+	defer func(previous bool) { preserveEnv = previous }(preserveEnv)
+	noninteractiveConfig, preserveEnv = false, true
+	args = createRootlessArgList(comprtConfigFile, noAlias, []comprtUser{defaultComprtUser()}, debootstrapCmdArr, nil, nil, testAptSources, networkFiles{}, "", nil, nil, nil)
+	if !strings.Contains(strings.Join(args, "\n"), `--customize-hook=chroot "$1" 'sh' '/comprtconfig'`) {
+		t.Fatalf("the comprt config file was not ran as is with --noninteractive=false and --preserve-env: %v", args)
+	}
+	noninteractiveConfig, preserveEnv = true, false
+
+	sources := testAptSources
+	sources.fallbackMirrors = []string{"http://deb.debian.org/debian/"}
+	args = createRootlessArgList(comprtConfigFile, noAlias, []comprtUser{defaultComprtUser()}, debootstrapCmdArr, nil, nil, sources, networkFiles{}, "", nil, nil, nil)
+	if args[len(args)-1] != sources.fallbackMirrors[0] {
+		t.Fatalf("the fallback mirrors were not passed to mmdebstrap: %v", args)
+	}
+
+	netFiles := networkFiles{files: map[string][]byte{resolvConfPath: []byte("nameserver 192.0.2.53\n")}}
+	args = createRootlessArgList(comprtConfigFile, noAlias, []comprtUser{defaultComprtUser()}, debootstrapCmdArr, nil, nil, testAptSources, netFiles, "", nil, nil, nil)
+	if !strings.Contains(strings.Join(args, "\n"), `'nameserver 192.0.2.53`) {
+		t.Fatalf("the resolv.conf was not put into the comprt by mmdebstrap: %v", args)
+	} else if !strings.Contains(args[len(args)-len(debootstrapCmdArr)-1], shellQuote(restoreNetworkFileScript)) {
+		t.Fatalf("the resolv.conf was not removed last by mmdebstrap: %v", args)
+	}
+
+	args = createRootlessArgList(comprtConfigFile, noAlias, []comprtUser{defaultComprtUser()}, debootstrapCmdArr, nil, nil, testAptSources, networkFiles{}, "/tmp/debcomprt-secrets1", nil, nil, nil)
+	if joined := strings.Join(args, "\n"); !strings.Contains(joined, `cp -a '/tmp/debcomprt-secrets1/.' "$1"'/run/debcomprt-secrets'`+"\n"+`--customize-hook=chroot "$1" 'env' '-i'`) {
+		t.Fatalf("the secrets were not put into the comprt right before the comprt config file: %v", args)
+	} else if !strings.Contains(joined, `'/comprtconfig'`+"\n"+`--customize-hook=umount -l "$1"'/run/debcomprt-secrets'`) {
+		t.Fatalf("the secrets were not removed right after the comprt config file: %v", args)
+	}
+
+	user := defaultComprtUser()
+	user.sshKeys, user.sudo = []string{"ssh-ed25519 AAAAC3Nz foo@bar"}, sudoNoPasswd
+	args = createRootlessArgList(comprtConfigFile, noAlias, []comprtUser{user}, debootstrapCmdArr, nil, nil, testAptSources, networkFiles{}, "", nil, nil, nil)
+	if !strings.Contains(strings.Join(args, "\n"), `'1224' 'ssh-ed25519 AAAAC3Nz foo@bar'`) {
+		t.Fatalf("the public keys were not authorized by mmdebstrap: %v", args)
+	} else if !strings.Contains(strings.Join(args, "\n"), `'1224' 'NOPASSWD: ' '/etc/sudoers.d/debcomprt'`) {
+		t.Fatalf("sudo was not setup by mmdebstrap: %v", args)
+	}
+
+	// an alias takes care of creating its own users
+	args = createRootlessArgList(comprtConfigFile, "altaria", []comprtUser{defaultComprtUser()}, debootstrapCmdArr, nil, nil, testAptSources, networkFiles{}, "", nil, nil, nil)
+	if strings.Contains(strings.Join(args, " "), "useradd") {
+		t.Fatalf("the default comprt user was created with an alias: %v", args)
+	}
+
+	// though the users from a manifest are still created
+	user = comprtUser{name: "builder", uid: 2000, gid: 2000, shell: defaultComprtUserShell}
+	args = createRootlessArgList(comprtConfigFile, "altaria", []comprtUser{defaultComprtUser(), user}, debootstrapCmdArr, nil, nil, testAptSources, networkFiles{}, "", nil, nil, nil)
+	if strings.Count(strings.Join(args, " "), "'useradd'") != 1 || !strings.Contains(strings.Join(args, " "), "'builder'") {
+		t.Fatalf("only the manifest's user was expected to be created with an alias: %v", args)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// The least number of path components a target should have (e.g. /srv/foo).
+	defaultMinTargetDepth = 2
+	unsafeTargetFlagName  = "i-know-what-im-doing"
+)
+
+// Paths that should never be used as a target, debcomprt runs everything as
+// root so a typo here could wipe out or mount over the host's system.
+var protectedPaths = []string{
+	"/",
+	"/bin",
+	"/boot",
+	"/dev",
+	"/etc",
+	"/home",
+	"/lib",
+	"/lib32",
+	"/lib64",
+	"/libx32",
+	"/media",
+	"/mnt",
+	"/opt",
+	"/proc",
+	"/root",
+	"/run",
+	"/sbin",
+	"/srv",
+	"/sys",
+	"/tmp",
+	"/usr",
+	"/usr/bin",
+	"/usr/lib",
+	"/usr/local",
+	"/usr/sbin",
+	"/usr/share",
+	"/var",
+	"/var/lib",
+	"/var/tmp",
+}
+
+// The commands that use ZFS dataset snapshots, their target may be the
+// mountpoint of a dataset (see zfsSnapshotter).
+var zfsDatasetCommands = []string{"snapshot", "restore", "clone"}
+
+// Determine if it is safe to use the path as a target. A target should not be
+// a protected path, a mount point on the host or have less path components than
+// minDepth. The mountpoint of a ZFS dataset is let through if allowZfsDataset.
+func checkTargetSafety(target string, minDepth int, mounts []mountInfo, allowZfsDataset bool) error {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	if resolvedTarget, err := filepath.EvalSymlinks(absTarget); err == nil {
+		absTarget = resolvedTarget
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if stringInArr(absTarget, &protectedPaths) {
+		return fmt.Errorf("%v is a system path, refusing to use it as a target (see --%v)", absTarget, unsafeTargetFlagName)
+	} else if isMountPoint(absTarget, mounts) && !(allowZfsDataset && isZfsDatasetRoot(absTarget, mounts)) {
+		return fmt.Errorf("%v is a mount point, refusing to use it as a target (see --%v)", absTarget, unsafeTargetFlagName)
+	} else if depth := len(strings.Split(strings.Trim(absTarget, "/"), "/")); depth < minDepth {
+		return fmt.Errorf(
+			"%v is less than %d directories deep, refusing to use it as a target (see --%v)",
+			absTarget,
+			minDepth,
+			unsafeTargetFlagName,
+		)
+	}
+
+	return nil
+}
+
+// Determine if the path is the mountpoint of a ZFS dataset, going by what was
+// last mounted on it.
+func isZfsDatasetRoot(path string, mounts []mountInfo) bool {
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if mounts[i].mountPoint == path {
+			return mounts[i].fsType == "zfs"
+		}
+	}
+
+	return false
+}
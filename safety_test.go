@@ -0,0 +1,62 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckTargetSafety(t *testing.T) {
+	var mounts []mountInfo = []mountInfo{
+		{mountPoint: "/"},
+		{mountPoint: "/srv/data"},
+	}
+
+	for _, target := range []string{"/", "/usr", "/home/", "/usr/../home", "/srv/data", "/foo"} {
+		if err := checkTargetSafety(target, defaultMinTargetDepth, mounts, false); err == nil {
+			t.Fatalf("%v was deemed a safe target", target)
+		}
+	}
+
+	for _, target := range []string{"/srv/foo", "/srv/data/foo"} {
+		if err := checkTargetSafety(target, defaultMinTargetDepth, mounts, false); err != nil {
+			t.Fatalf("%v was deemed an unsafe target: %v", target, err)
+		}
+	}
+}
+
+func TestCheckTargetSafetyZfsDataset(t *testing.T) {
+	var mounts []mountInfo = []mountInfo{
+		{mountPoint: "/"},
+		{mountPoint: "/srv/data"},
+		{mountPoint: "/srv/tank/foo", fsType: "zfs", source: "tank/foo"},
+	}
+
+	// the mountpoint of a dataset is only a target for the commands using its snapshots
+	if err := checkTargetSafety("/srv/tank/foo", defaultMinTargetDepth, mounts, false); err == nil {
+		t.Fatal("the mountpoint of a dataset was deemed a safe target")
+	}
+	if err := checkTargetSafety("/srv/tank/foo", defaultMinTargetDepth, mounts, true); err != nil {
+		t.Fatalf("the mountpoint of a dataset was deemed an unsafe target: %v", err)
+	}
+	if err := checkTargetSafety("/srv/data", defaultMinTargetDepth, mounts, true); err == nil {
+		t.Fatal("a mount point that is not a dataset was deemed a safe target")
+	}
+	for _, command := range []string{"snapshot", "restore", "clone"} {
+		if !stringInArr(command, &zfsDatasetCommands) {
+			t.Fatalf("the mountpoint of a dataset is not a target for %v", command)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+const (
+	sbuildProfile     = "sbuild"
+	sbuildGroup       = "sbuild"
+	sbuildUnionType   = "overlay"
+	sbuildAptConfPath = "/etc/apt/apt.conf.d/99" + progname + "-sbuild"
+)
+
+// The packages sbuild expects to find in a chroot, the same as
+// sbuild-createchroot installs.
+var sbuildPkgs = []string{"build-essential", "fakeroot"}
+
+// Packages are built with as little installed as possible, the same as on a
+// buildd.
+var sbuildAptConf = []byte("// written by " + progname + " for sbuild\n" +
+	"APT::Install-Recommends \"false\";\n" +
+	"Acquire::Languages \"none\";\n")
+
+// Get the schroot definition sbuild uses for the comprt, named the way sbuild
+// looks chroots up (e.g. bookworm-amd64-sbuild). Members of the sbuild group may
+// use it, and each session gets a throwaway overlay of the comprt.
+func newSbuildSchrootEntry(target string) (*schrootEntry, error) {
+	metadata, err := getComprtMetadata(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []string = []string{"root", sbuildGroup}
+	entry, err := newSchrootEntry(target, fmt.Sprintf("%v-%v-sbuild", metadata.CodeName, metadata.Arch), nil, groups, sbuildProfile)
+	if err != nil {
+		return nil, err
+	}
+	entry.description = fmt.Sprintf("debian %v/%v autobuilder (%v)", metadata.CodeName, metadata.Arch, entry.directory)
+	entry.rootGroups = groups
+	entry.unionType = sbuildUnionType
+
+	return entry, nil
+}
+
+// Check whether the sbuild group exists on the host, it is created by installing
+// sbuild.
+func sbuildGroupExists() bool {
+	_, err := user.LookupGroup(sbuildGroup)
+	return err == nil
+}
+
+// Prepare the comprt for building packages with sbuild, installing what sbuild
+// expects and configuring apt. No services are started in the comprt.
+func prepareSbuildComprt(target string, quiet bool) (errs []error) {
+	if err := os.WriteFile(filepath.Join(target, sbuildAptConfPath), sbuildAptConf, OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R); err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	removePolicyRcD, err := installPolicyRcD(target)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+	defer func() {
+		if err := removePolicyRcD(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+
+	exitChroot, chrootErrs := Chroot(target)
+	if chrootErrs != nil {
+		errs = append(errs, chrootErrs...)
+		return
+	}
+	defer func() {
+		if err := exitChroot(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+
+	if err := updateAptLists(quiet); err != nil {
+		errs = append(errs, err)
+		return
+	}
+	if err := installPinnedPkgs(sbuildPkgs, quiet); err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSbuildSchrootEntry(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	target := filepath.Join(tempDirPath, "foo")
+	if err := os.Mkdir(target, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newSbuildSchrootEntry(target); err == nil {
+		t.Fatal("a comprt without metadata was registered")
+	}
+
+	if err := writeComprtMetadata(target, comprtMetadata{CodeName: testCodeCame, Arch: "amd64", Created: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := newSbuildSchrootEntry(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := testCodeCame + "-amd64-sbuild"; entry.name != expected {
+		t.Fatalf("expected: %v, actual: %v", expected, entry.name)
+	}
+
+	var config string = entry.String()
+	for _, line := range []string{
+		"groups=root," + sbuildGroup,
+		"root-groups=root," + sbuildGroup,
+		"profile=" + sbuildProfile,
+		"union-type=" + sbuildUnionType,
+	} {
+		if !strings.Contains(config, line+"\n") {
+			t.Fatalf("%q is missing from:\n%v", line, config)
+		}
+	}
+	if strings.Contains(config, "users=") {
+		t.Fatalf("the sbuild schroot was given users:\n%v", config)
+	}
+}
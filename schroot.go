@@ -0,0 +1,149 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	schrootChrootDir      = "/etc/schroot/chroot.d"
+	defaultSchrootProfile = "default"
+	schrootLinux32        = "linux32"
+)
+
+// The names schroot accepts for a chroot, as they are also the names of the
+// files in schroot's chroot.d dir.
+var schrootNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Mappings of 32-bit debian architecture names to the 64-bit architecture of a
+// host that runs them natively, a comprt of one is entered with the linux32
+// personality on such a host (so e.g. uname reports the comprt's architecture).
+var schrootLinux32Archs = map[string]string{
+	"i386":  "amd64",
+	"armel": "arm64",
+	"armhf": "arm64",
+}
+
+// A type used to store the definition of a comprt as a schroot chroot, for
+// reference:
+// https://manpages.debian.org/stable/schroot/schroot.conf.5.en.html
+type schrootEntry struct {
+	name        string
+	description string
+	directory   string
+	users       []string
+	groups      []string
+	// The users and groups that may use the schroot as root without a password.
+	rootUsers   []string
+	rootGroups  []string
+	profile     string
+	personality string
+	// Sessions are given a throwaway overlay of the schroot if set (e.g. overlay).
+	unionType string
+}
+
+// Create the schroot chroot definition of the comprt, named after the comprt's
+// dir if name is empty. The comprt's metadata is used to describe the chroot
+// (and pick its personality), when the comprt has any.
+func newSchrootEntry(target, name string, users, groups []string, profile string) (*schrootEntry, error) {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = filepath.Base(absTarget)
+	}
+	if !schrootNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("%v is not a valid schroot name (letters, digits, '.', '_' and '-')", name)
+	}
+	if len(users) == 0 && len(groups) == 0 {
+		return nil, errors.New("at least one user or group needs to be allowed to use the schroot")
+	}
+
+	var entry *schrootEntry = &schrootEntry{
+		name:        name,
+		description: fmt.Sprintf("debian compartment %v", absTarget),
+		directory:   absTarget,
+		users:       users,
+		groups:      groups,
+		profile:     profile,
+	}
+	if metadata, err := getComprtMetadata(target); err == nil {
+		entry.description = fmt.Sprintf("debian compartment %v (%v %v)", absTarget, metadata.CodeName, metadata.Arch)
+		if schrootLinux32Archs[metadata.Arch] == hostDebianArch() {
+			entry.personality = schrootLinux32
+		}
+	}
+
+	return entry, nil
+}
+
+// Get the definition in schroot's (ini) config format.
+func (entry schrootEntry) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# generated by %v %v\n", progname, progVersion)
+	fmt.Fprintf(&sb, "[%v]\n", entry.name)
+	fmt.Fprintf(&sb, "description=%v\n", entry.description)
+	fmt.Fprintf(&sb, "type=directory\n")
+	fmt.Fprintf(&sb, "directory=%v\n", entry.directory)
+	if len(entry.users) > 0 {
+		fmt.Fprintf(&sb, "users=%v\n", strings.Join(entry.users, ","))
+	}
+	if len(entry.groups) > 0 {
+		fmt.Fprintf(&sb, "groups=%v\n", strings.Join(entry.groups, ","))
+	}
+	if len(entry.rootUsers) > 0 {
+		fmt.Fprintf(&sb, "root-users=%v\n", strings.Join(entry.rootUsers, ","))
+	}
+	if len(entry.rootGroups) > 0 {
+		fmt.Fprintf(&sb, "root-groups=%v\n", strings.Join(entry.rootGroups, ","))
+	}
+	fmt.Fprintf(&sb, "profile=%v\n", entry.profile)
+	if entry.personality != "" {
+		fmt.Fprintf(&sb, "personality=%v\n", entry.personality)
+	}
+	if entry.unionType != "" {
+		fmt.Fprintf(&sb, "union-type=%v\n", entry.unionType)
+	}
+
+	return sb.String()
+}
+
+// Write the definition into the chroot.d dir, returns the path of the file
+// written. An existing definition of the same name is only replaced if forced.
+func writeSchrootEntry(chrootDir string, entry schrootEntry, force bool) (string, error) {
+	var entryPath string = filepath.Join(chrootDir, entry.name)
+	if _, err := os.Stat(entryPath); err == nil && !force {
+		return "", fmt.Errorf("%v already exists, pass --force to replace it", entryPath)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	if err := os.MkdirAll(chrootDir, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(entryPath, []byte(entry.String()), OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R); err != nil {
+		return "", err
+	}
+
+	return entryPath, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSchrootEntry(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	target := filepath.Join(tempDirPath, "foo")
+	if err := os.Mkdir(target, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeComprtMetadata(target, comprtMetadata{CodeName: testCodeCame, Arch: hostDebianArch(), Created: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := newSchrootEntry(target, "", []string{"altaria"}, nil, defaultSchrootProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.name != "foo" {
+		t.Fatalf("expected: foo, actual: %v", entry.name)
+	}
+
+	var config string = entry.String()
+	for _, line := range []string{
+		"[foo]",
+		"type=directory",
+		"directory=" + target,
+		"users=altaria",
+		"profile=" + defaultSchrootProfile,
+	} {
+		if !strings.Contains(config, line+"\n") {
+			t.Fatalf("%q is missing from:\n%v", line, config)
+		}
+	}
+	if strings.Contains(config, "personality=") {
+		t.Fatalf("a native comprt was given a personality:\n%v", config)
+	}
+
+	if _, err := newSchrootEntry(target, "foo/bar", []string{"altaria"}, nil, defaultSchrootProfile); err == nil {
+		t.Fatal("a name with a '/' was accepted")
+	}
+	if _, err := newSchrootEntry(target, "", nil, nil, defaultSchrootProfile); err == nil {
+		t.Fatal("a schroot no one can use was accepted")
+	}
+}
+
+func TestWriteSchrootEntry(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var chrootDir string = filepath.Join(tempDirPath, "chroot.d")
+	var entry schrootEntry = schrootEntry{name: "foo", directory: "/srv/foo", users: []string{"altaria"}, profile: defaultSchrootProfile}
+
+	entryPath, err := writeSchrootEntry(chrootDir, entry, false)
+	if err != nil {
+		t.Fatal(err)
+	} else if entryPath != filepath.Join(chrootDir, "foo") {
+		t.Fatalf("expected: %v, actual: %v", filepath.Join(chrootDir, "foo"), entryPath)
+	}
+	if _, err := writeSchrootEntry(chrootDir, entry, false); err == nil {
+		t.Fatal("an existing schroot was replaced without --force")
+	}
+
+	entry.groups = []string{"sbuild"}
+	if _, err := writeSchrootEntry(chrootDir, entry, true); err != nil {
+		t.Fatal(err)
+	}
+	config, err := os.ReadFile(entryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(config), "groups=sbuild\n") {
+		t.Fatalf("the schroot was not replaced:\n%s", config)
+	}
+}
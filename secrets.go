@@ -0,0 +1,203 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// The dir in the comprt the secrets are put in while the comprt config file
+// runs, it is a tmpfs so the secrets are never written to the comprt's disk.
+const secretsDir = "/run/" + progname + "-secrets"
+
+// A secret's name is used as its file name in the secrets dir.
+var secretNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// A type used to describe the secrets exposed to the comprt config file (e.g.
+// API tokens), that must not end up in the comprt.
+type comprtSecrets struct {
+	// The secrets' values, keyed by their names.
+	values map[string][]byte
+}
+
+// Parse the secrets passed in as NAME=VALUE, or as NAME=@PATH to read the value
+// from the host file.
+func parseComprtSecrets(secretFlags []string) (comprtSecrets, error) {
+	var secrets comprtSecrets = comprtSecrets{values: make(map[string][]byte)}
+	for _, secretFlag := range secretFlags {
+		parts := strings.SplitN(secretFlag, "=", 2)
+		if len(parts) != 2 || !secretNameRegex.MatchString(parts[0]) {
+			// the value is left out, the error may be logged
+			return comprtSecrets{}, fmt.Errorf("the secret %v is not NAME=VALUE or NAME=@PATH", strings.SplitN(secretFlag, "=", 2)[0])
+		} else if _, ok := secrets.values[parts[0]]; ok {
+			return comprtSecrets{}, fmt.Errorf("the secret %v is passed in more than once", parts[0])
+		}
+
+		if strings.HasPrefix(parts[1], "@") {
+			value, err := os.ReadFile(strings.TrimPrefix(parts[1], "@"))
+			if err != nil {
+				return comprtSecrets{}, err
+			}
+			secrets.values[parts[0]] = value
+			continue
+		}
+		secrets.values[parts[0]] = []byte(parts[1])
+	}
+
+	return secrets, nil
+}
+
+// Get the secrets' names in the order they are written.
+func (secrets comprtSecrets) names() []string {
+	var names []string
+	for name := range secrets.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Write the secrets as files (only readable by their owner) into the dir.
+func (secrets comprtSecrets) writeTo(dir string) error {
+	for _, name := range secrets.names() {
+		if err := os.WriteFile(filepath.Join(dir, name), secrets.values[name], OS_USER_R); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Mount a tmpfs at the secrets dir in the comprt and write the secrets into it.
+// A func is returned to unmount the tmpfs and remove the secrets dir, which is
+// lazily unmounted in case a process the comprt config file left behind still
+// has a secret open. There is nothing to mount without secrets.
+func (secrets comprtSecrets) mount(target string) (func() error, error) {
+	if len(secrets.values) == 0 {
+		return func() error { return nil }, nil
+	}
+
+	if err := checkComprtPath(target, secretsDir); err != nil {
+		return nil, err
+	}
+	var dir string = filepath.Join(target, secretsDir)
+	if err := os.MkdirAll(dir, os.ModeDir|OS_USER_R|OS_USER_W|OS_USER_X); err != nil {
+		return nil, err
+	}
+	if err := progExecutor.Mount("tmpfs", dir, "tmpfs", syscall.MS_NODEV|syscall.MS_NOSUID|syscall.MS_NOEXEC, "mode=0700"); err != nil {
+		os.Remove(dir)
+		return nil, err
+	}
+	unMount := func() error {
+		if err := progExecutor.Unmount(dir, syscall.MNT_DETACH); err != nil {
+			return err
+		}
+		if err := os.Remove(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	}
+
+	if err := secrets.writeTo(dir); err != nil {
+		unMount()
+		return nil, err
+	}
+
+	return unMount, nil
+}
+
+// Run fn with the secrets mounted into the comprt, the secrets are removed from
+// the comprt whether or not fn fails.
+func (secrets comprtSecrets) exposeWhile(target string, fn func() error) error {
+	unMount, err := secrets.mount(target)
+	if err != nil {
+		return err
+	}
+
+	fnErr := fn()
+	if err := unMount(); err != nil {
+		if fnErr != nil {
+			warnf("%v", err)
+			return fnErr
+		}
+		return err
+	}
+
+	return fnErr
+}
+
+// Write the secrets into a temporary host dir, that is only accessible by the
+// user, for mmdebstrap to copy into the comprt. A func is returned to remove
+// the dir. There is no dir without secrets.
+func (secrets comprtSecrets) writeHostDir() (string, func() error, error) {
+	if len(secrets.values) == 0 {
+		return "", func() error { return nil }, nil
+	}
+
+	dir, err := makeTempDir("", progname+"-secrets")
+	if err != nil {
+		return "", nil, err
+	}
+	remove := func() error { return os.RemoveAll(dir) }
+	if err := secrets.writeTo(dir); err != nil {
+		remove()
+		return "", nil, err
+	}
+
+	return dir, remove, nil
+}
+
+// Get the mmdebstrap hooks that mount a tmpfs at the secrets dir in the comprt
+// and copy the secrets in the host dir into it, and the hooks that unmount it
+// and remove the secrets dir, the same as mount does. There are no hooks
+// without a host dir.
+func secretsMmdebstrapArgs(hostDir string) (mountArgs, unMountArgs []string) {
+	if hostDir == "" {
+		return nil, nil
+	}
+
+	var mountPoint string = `"$1"` + shellQuote(secretsDir)
+	mountArgs = append(mountArgs, "--customize-hook=mkdir -p -m 0700 "+mountPoint+
+		" && mount -t tmpfs -o mode=0700,nodev,nosuid,noexec tmpfs "+mountPoint+
+		" && cp -a "+shellQuote(hostDir+"/.")+" "+mountPoint)
+	unMountArgs = append(unMountArgs, "--customize-hook=umount -l "+mountPoint+" && rmdir "+mountPoint)
+
+	return mountArgs, unMountArgs
+}
+
+// Check that no secrets were left in the comprt's secrets dir, e.g. by a create
+// that was killed before the secrets could be removed.
+func checkNoSecrets(target string) error {
+	entries, err := os.ReadDir(filepath.Join(target, secretsDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if len(entries) > 0 {
+		return fmt.Errorf("secrets were left in %v, remove them before continuing", filepath.Join(target, secretsDir))
+	}
+
+	return nil
+}
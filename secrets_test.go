@@ -0,0 +1,119 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseComprtSecrets(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var tokenPath string = filepath.Join(tempDirPath, "token")
+	if err := createTestFile(tokenPath, "bar\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets, err := parseComprtSecrets([]string{"API_TOKEN=foo=bar", "GITHUB_TOKEN=@" + tokenPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{
+		"API_TOKEN":    "foo=bar",
+		"GITHUB_TOKEN": "bar\n",
+	} {
+		if actual := string(secrets.values[name]); actual != expected {
+			t.Fatalf("expected: %q, actual: %q", expected, actual)
+		}
+	}
+
+	for _, secretFlag := range []string{"API_TOKEN", "../API_TOKEN=foo", "API_TOKEN=@" + filepath.Join(tempDirPath, "missing")} {
+		if _, err := parseComprtSecrets([]string{secretFlag}); err == nil {
+			t.Fatalf("%v was accepted", secretFlag)
+		}
+	}
+	if _, err := parseComprtSecrets([]string{"API_TOKEN=foo", "API_TOKEN=bar"}); err == nil {
+		t.Fatal("a secret passed in twice was accepted")
+	}
+
+	// the value is kept out of the error
+	if _, err := parseComprtSecrets([]string{"API-TOKEN=hunter2"}); err == nil || strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestComprtSecretsWriteHostDir(t *testing.T) {
+	secrets := comprtSecrets{values: map[string][]byte{"API_TOKEN": []byte("foo")}}
+	dir, remove, err := secrets.writeHostDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dirInfo, err := os.Stat(dir); err != nil {
+		t.Fatal(err)
+	} else if dirInfo.Mode().Perm() != OS_USER_R|OS_USER_W|OS_USER_X {
+		t.Fatalf("expected the dir to only be accessible by its owner, actual: %v", dirInfo.Mode())
+	}
+	if fileInfo, err := os.Stat(filepath.Join(dir, "API_TOKEN")); err != nil {
+		t.Fatal(err)
+	} else if fileInfo.Mode().Perm() != OS_USER_R {
+		t.Fatalf("expected the secret to only be readable by its owner, actual: %v", fileInfo.Mode())
+	}
+
+	if err := remove(); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(dir); err == nil {
+		t.Fatalf("%v was not removed", dir)
+	}
+
+	// there is nothing to write without secrets
+	if dir, _, err := (comprtSecrets{}).writeHostDir(); err != nil || dir != "" {
+		t.Fatalf("expected no dir, actual: %v (%v)", dir, err)
+	}
+}
+
+func TestCheckNoSecrets(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if err := checkNoSecrets(tempDirPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var dir string = filepath.Join(tempDirPath, secretsDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkNoSecrets(tempDirPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createTestFile(filepath.Join(dir, "API_TOKEN"), "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkNoSecrets(tempDirPath); err == nil {
+		t.Fatal("the secrets left in the comprt were not caught")
+	}
+}
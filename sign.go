@@ -0,0 +1,92 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// The extension of the armored detached signatures written next to the files
+// debcomprt signs (e.g. rootfs.tar.gz.asc).
+const signatureExt = ".asc"
+
+// Check gpg has the secret key to sign with, that way a missing key is caught
+// before the files to sign are written.
+func checkSigningKey(keyID string) error {
+	var out bytes.Buffer
+	cmd := exec.Command("gpg", "--batch", "--list-secret-keys", keyID)
+	traceCommand(cmd)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := progExecutor.Run(cmd); err != nil {
+		return fmt.Errorf("gpg has no secret key %v to sign with: %v", keyID, out.String())
+	}
+
+	return nil
+}
+
+// Sign the file with the gpg key, the armored detached signature is written next
+// to the file. Returns the path to the signature.
+func signFile(path, keyID string) (string, error) {
+	var signaturePath string = path + signatureExt
+	var out bytes.Buffer
+	cmd := exec.Command("gpg", "--batch", "--yes", "--armor", "--local-user", keyID, "--output", signaturePath, "--detach-sign", path)
+	traceCommand(cmd)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := progExecutor.Run(cmd); err != nil {
+		return "", fmt.Errorf("unable to sign %v with %v: %v", path, keyID, out.String())
+	}
+
+	return signaturePath, nil
+}
+
+// Verify the file's detached signature (the file's path with .asc) was made by a
+// key in the armored keyring.
+func verifyFileSignature(path, keyringPath string) error {
+	keyringFile, err := os.Open(keyringPath)
+	if err != nil {
+		return err
+	}
+	defer keyringFile.Close()
+	keyring, err := openpgp.ReadArmoredKeyRing(keyringFile)
+	if err != nil {
+		return fmt.Errorf("%v: %w", keyringPath, err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	signature, err := os.Open(path + signatureExt)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%v is not signed, %v does not exist", path, path+signatureExt)
+	} else if err != nil {
+		return err
+	}
+	defer signature.Close()
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, file, signature, nil); err != nil {
+		return fmt.Errorf("%v is not signed by a key in %v: %w", path, keyringPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// Write the entity's public key into an armored keyring at the path.
+func writeTestKeyring(path string, entity *openpgp.Entity) error {
+	var keyring bytes.Buffer
+	keyringWriter, err := armor.Encode(&keyring, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return err
+	}
+	if err := entity.Serialize(keyringWriter); err != nil {
+		return err
+	}
+	keyringWriter.Close()
+
+	return createTestFile(path, keyring.String())
+}
+
+func TestVerifyFileSignature(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	entity, err := openpgp.NewEntity(progname, "", progname+"@localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyringPath string = filepath.Join(tempDirPath, "keyring.asc")
+	if err := writeTestKeyring(keyringPath, entity); err != nil {
+		t.Fatal(err)
+	}
+
+	var lockPath string = filepath.Join(tempDirPath, lockFile)
+	if err := createTestFile(lockPath, `{"codename": "buster"}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFileSignature(lockPath, keyringPath); err == nil || !strings.Contains(err.Error(), "is not signed") {
+		t.Fatalf("expected an unsigned lockfile to be refused, actual: %v", err)
+	}
+
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, entity, strings.NewReader(`{"codename": "buster"}`+"\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(lockPath+signatureExt, signature.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFileSignature(lockPath, keyringPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// a lockfile changed since it was signed is refused
+	if err := createTestFile(lockPath, `{"codename": "bullseye"}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFileSignature(lockPath, keyringPath); err == nil {
+		t.Fatal("a changed lockfile was accepted")
+	}
+}
+
+func TestVerifyFileSignatureOtherKey(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	entity, err := openpgp.NewEntity(progname, "", progname+"@localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherEntity, err := openpgp.NewEntity("other", "", "other@localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyringPath string = filepath.Join(tempDirPath, "keyring.asc")
+	if err := writeTestKeyring(keyringPath, entity); err != nil {
+		t.Fatal(err)
+	}
+
+	var rootfsPath string = filepath.Join(tempDirPath, "rootfs.tar")
+	if err := createTestFile(rootfsPath, "foo\n"); err != nil {
+		t.Fatal(err)
+	}
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, otherEntity, strings.NewReader("foo\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(rootfsPath+signatureExt, signature.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFileSignature(rootfsPath, keyringPath); err == nil {
+		t.Fatal("a file signed by a key not in the keyring was accepted")
+	}
+}
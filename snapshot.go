@@ -0,0 +1,308 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const (
+	snapshotsDir   = "snapshots"
+	tarSnapshotExt = ".tar"
+)
+
+var reSnapshotName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// A type that can capture the state of a comprt and later roll the comprt back
+// to it.
+type snapshotter interface {
+	// The name used to refer to the snapshotter.
+	Name() string
+	Snapshot(target, name string) error
+	Restore(target, name string) error
+	// The names of the target's snapshots, sorted.
+	List(target string) ([]string, error)
+}
+
+// Get the snapshotter used for the target. Targets on btrfs or ZFS are
+// snapshotted natively by the filesystem where possible, as copying a multi-GB
+// comprt into an archive is slow.
+func getSnapshotter(target, compression string) (snapshotter, error) {
+	c, err := getCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+
+	var statfs syscall.Statfs_t
+	if err := syscall.Statfs(target, &statfs); err != nil {
+		return nil, err
+	}
+
+	switch uint32(statfs.Type) {
+	case btrfsSuperMagic:
+		if s, err := newBtrfsSnapshotter(target); err != nil {
+			return nil, err
+		} else if s != nil {
+			return s, nil
+		}
+	case zfsSuperMagic:
+		if s, err := newZfsSnapshotter(target); err != nil {
+			return nil, err
+		} else if s != nil {
+			return s, nil
+		}
+	}
+
+	return &tarSnapshotter{codec: c}, nil
+}
+
+// Ensure the snapshot name can be used as a file name.
+func validateSnapshotName(name string) error {
+	if !reSnapshotName.MatchString(name) {
+		return fmt.Errorf("%v is not a valid snapshot name, only letters, digits, '.', '_' and '-' are allowed", name)
+	}
+
+	return nil
+}
+
+// Get the dir where the target's snapshots are kept. The target's absolute path
+// is escaped into a single dir name, that way targets never share a dir.
+func targetSnapshotsDir(target string) (string, error) {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(progDataDir, snapshotsDir, url.PathEscape(absTarget)), nil
+}
+
+// Ensure nothing is mounted in the target, otherwise the mounted filesystems
+// would be removed along with the target's contents.
+func checkTargetUnmounted(target string, mounts []mountInfo) error {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	for _, mount := range mounts {
+		if strings.HasPrefix(mount.mountPoint, absTarget+"/") {
+			return fmt.Errorf("%v is mounted in %v, is a chroot session still running?", mount.mountPoint, absTarget)
+		}
+	}
+
+	return nil
+}
+
+// Replace the target with the dir passed in. The target's previous contents are
+// removed by removeFunc.
+func swapTarget(target, dir string, removeFunc func(path string) error) error {
+	oldTarget := dir + ".old"
+	if err := os.Rename(target, oldTarget); err != nil {
+		return err
+	}
+	if err := os.Rename(dir, target); err != nil {
+		// put the target back to how it was
+		os.Rename(oldTarget, target)
+		return err
+	}
+
+	return removeFunc(oldTarget)
+}
+
+// A snapshotter that stores snapshots as (compressed) tar archives, this works
+// on any filesystem.
+type tarSnapshotter struct {
+	codec codec
+}
+
+// Write the comprt as a tarball to w, the args passed in are given to tar as
+// well (e.g. to exclude files).
+func writeComprtTar(target string, w io.Writer, args ...string) error {
+	// the filesystems mounted in a chroot session should not be captured
+	var tarArgs []string = []string{
+		"--create",
+		"--file", "-",
+		"--directory", target,
+		"--numeric-owner",
+		"--xattrs",
+		"--acls",
+		"--one-file-system",
+	}
+	tarCmd := exec.Command("tar", append(append(tarArgs, args...), ".")...)
+	tarCmd.Stdout = w
+	tarCmd.Stderr = os.Stderr
+	return progExecutor.Run(tarCmd)
+}
+
+func (s *tarSnapshotter) Name() string { return "tar" }
+
+func (s *tarSnapshotter) Snapshot(target, name string) error {
+	snapshotsPath, err := targetSnapshotsDir(target)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(snapshotsPath, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X)); err != nil {
+		return err
+	}
+
+	if _, err := s.find(snapshotsPath, name); err == nil {
+		return fmt.Errorf("snapshot %v already exists for %v", name, target)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	snapshotPath := filepath.Join(snapshotsPath, name+tarSnapshotExt+s.codec.Ext())
+	// written to a temp file first so a failed snapshot is never restored from
+	snapshotFile, err := os.OpenFile(snapshotPath+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, ModeFile|(OS_USER_R|OS_USER_W))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(snapshotPath + ".tmp")
+	defer snapshotFile.Close()
+
+	w, err := s.codec.NewWriter(snapshotFile)
+	if err != nil {
+		return err
+	}
+
+	if err := writeComprtTar(target, w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := snapshotFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(snapshotPath+".tmp", snapshotPath)
+}
+
+func (s *tarSnapshotter) Restore(target, name string) error {
+	snapshotsPath, err := targetSnapshotsDir(target)
+	if err != nil {
+		return err
+	}
+
+	snapshotPath, err := s.find(snapshotsPath, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("snapshot %v does not exist for %v", name, target)
+	} else if err != nil {
+		return err
+	}
+
+	snapshotFile, err := os.Open(snapshotPath)
+	if err != nil {
+		return err
+	}
+	defer snapshotFile.Close()
+
+	// the snapshot may have been compressed with a codec other than the one passed in
+	c, snapshotReader, err := detectCodec(snapshotFile)
+	if err != nil {
+		return err
+	}
+	r, err := c.NewReader(snapshotReader)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// extracted next to the target so the target is left as is if extracting fails
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	restoreDir, err := os.MkdirTemp(filepath.Dir(absTarget), "."+filepath.Base(absTarget)+".restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(restoreDir)
+
+	tarCmd := exec.Command(
+		"tar",
+		"--extract",
+		"--file", "-",
+		"--directory", restoreDir,
+		"--numeric-owner",
+		"--same-permissions",
+		"--xattrs",
+		"--xattrs-include=*",
+		"--acls",
+	)
+	tarCmd.Stdin = r
+	tarCmd.Stderr = os.Stderr
+	if err := progExecutor.Run(tarCmd); err != nil {
+		return err
+	}
+	// tar may stop reading before the end of the archive
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+
+	return swapTarget(absTarget, restoreDir, os.RemoveAll)
+}
+
+func (s *tarSnapshotter) List(target string) ([]string, error) {
+	snapshotsPath, err := targetSnapshotsDir(target)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(snapshotsPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		i := strings.LastIndex(entry.Name(), tarSnapshotExt)
+		if i < 1 || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		names = append(names, entry.Name()[:i])
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Find the path of the snapshot, whatever codec it was compressed with.
+func (s *tarSnapshotter) find(snapshotsPath, name string) (string, error) {
+	for _, c := range codecs {
+		snapshotPath := filepath.Join(snapshotsPath, name+tarSnapshotExt+c.Ext())
+		if _, err := os.Stat(snapshotPath); err == nil {
+			return snapshotPath, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return "", fs.ErrNotExist
+}
@@ -0,0 +1,161 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const (
+	// For reference:
+	// https://man7.org/linux/man-pages/man2/statfs.2.html
+	btrfsSuperMagic = 0x9123683e
+	// The inode number of the root dir of every btrfs subvolume.
+	btrfsFirstFreeObjectId = 256
+)
+
+// A snapshotter that uses btrfs subvolume snapshots. Snapshots are read-only
+// subvolumes kept next to the target, as a snapshot has to be on the same
+// filesystem as its subvolume.
+type btrfsSnapshotter struct {
+	btrfsPath string
+}
+
+// Create a btrfs snapshotter for the target. Returns nil if the target is not a
+// subvolume or the btrfs command is not installed.
+func newBtrfsSnapshotter(target string) (*btrfsSnapshotter, error) {
+	btrfsPath, err := progExecutor.LookPath("btrfs")
+	if err != nil {
+		return nil, nil
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Stat(target, &stat); err != nil {
+		return nil, err
+	} else if stat.Ino != btrfsFirstFreeObjectId {
+		return nil, nil
+	}
+
+	return &btrfsSnapshotter{btrfsPath: btrfsPath}, nil
+}
+
+func (s *btrfsSnapshotter) Name() string { return "btrfs" }
+
+// Get the dir where the target's snapshots are kept.
+func (s *btrfsSnapshotter) snapshotsDir(target string) (string, error) {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(absTarget), "."+filepath.Base(absTarget)+"."+snapshotsDir), nil
+}
+
+func (s *btrfsSnapshotter) run(args ...string) error {
+	// stdout is not passed through, btrfs prints what it has done on success
+	btrfsCmd := exec.Command(s.btrfsPath, args...)
+	btrfsCmd.Stderr = os.Stderr
+	if err := progExecutor.Run(btrfsCmd); err != nil {
+		return fmt.Errorf("btrfs %v failed: %w", strings.Join(args[:2], " "), err)
+	}
+
+	return nil
+}
+
+func (s *btrfsSnapshotter) Snapshot(target, name string) error {
+	snapshotsPath, err := s.snapshotsDir(target)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(snapshotsPath, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X)); err != nil {
+		return err
+	}
+
+	snapshotPath := filepath.Join(snapshotsPath, name)
+	if _, err := os.Stat(snapshotPath); err == nil {
+		return fmt.Errorf("snapshot %v already exists for %v", name, target)
+	}
+
+	return s.run("subvolume", "snapshot", "-r", target, snapshotPath)
+}
+
+func (s *btrfsSnapshotter) Restore(target, name string) error {
+	snapshotsPath, err := s.snapshotsDir(target)
+	if err != nil {
+		return err
+	}
+
+	snapshotPath := filepath.Join(snapshotsPath, name)
+	if _, err := os.Stat(snapshotPath); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("snapshot %v does not exist for %v", name, target)
+	} else if err != nil {
+		return err
+	}
+
+	// a writable snapshot of the read-only snapshot becomes the target
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	restorePath := filepath.Join(filepath.Dir(absTarget), "."+filepath.Base(absTarget)+".restore")
+	if err := s.run("subvolume", "snapshot", snapshotPath, restorePath); err != nil {
+		return err
+	}
+
+	if err := swapTarget(absTarget, restorePath, func(path string) error {
+		return s.run("subvolume", "delete", path)
+	}); err != nil {
+		s.run("subvolume", "delete", restorePath)
+		return err
+	}
+
+	return nil
+}
+
+func (s *btrfsSnapshotter) List(target string) ([]string, error) {
+	snapshotsPath, err := s.snapshotsDir(target)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(snapshotsPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (s *btrfsSnapshotter) Clone(src, dest string) error {
+	return s.run("subvolume", "snapshot", src, dest)
+}
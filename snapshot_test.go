@@ -0,0 +1,148 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarSnapshotterSnapshotAndRestore(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	target := filepath.Join(tempDirPath, "foo")
+	if err := os.Mkdir(target, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "bar"), []byte("bar"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, codecName := range []string{noCodecName, defaultCodecName} {
+		t.Run(codecName, func(t *testing.T) {
+			s, err := getSnapshotter(target, codecName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Snapshot(target, codecName); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Snapshot(target, codecName); err == nil {
+				t.Fatal("an existing snapshot was overwritten")
+			}
+
+			if err := os.Remove(filepath.Join(target, "bar")); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(target, "baz"), []byte("baz"), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.Restore(target, codecName); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(target, "bar")); err != nil {
+				t.Fatalf("a file captured in the snapshot was not restored: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(target, "baz")); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatal("a file created after the snapshot was kept")
+			}
+		})
+	}
+
+	s, err := getSnapshotter(target, defaultCodecName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := s.List(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stringsInArr([]string{noCodecName, defaultCodecName}, &names) || len(names) != 2 {
+		t.Fatalf("the following snapshots were listed %v", names)
+	}
+
+	if err := s.Restore(target, "missing"); err == nil {
+		t.Fatal("a missing snapshot was restored without error")
+	}
+
+	// only the target should be left, no restore dirs
+	entries, err := os.ReadDir(tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("found %v entries next to the target", len(entries))
+	}
+}
+
+func TestValidateSnapshotName(t *testing.T) {
+	for _, name := range []string{"base", "post-config.1", "v2_final"} {
+		if err := validateSnapshotName(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"", ".hidden", "foo/bar", "../foo", "foo bar"} {
+		if err := validateSnapshotName(name); err == nil {
+			t.Fatalf("%q was considered a valid snapshot name", name)
+		}
+	}
+}
+
+func TestCheckTargetUnmounted(t *testing.T) {
+	mounts := []mountInfo{{mountPoint: "/"}, {mountPoint: "/srv/foo"}, {mountPoint: "/srv/foo/proc"}}
+	if err := checkTargetUnmounted("/srv/foo", mounts); err == nil {
+		t.Fatal("a target with mounts in it was considered unmounted")
+	}
+	if err := checkTargetUnmounted("/srv/bar", mounts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetSnapshotterFallsBackToTar(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// a plain dir is never a btrfs subvolume or ZFS dataset
+	s, err := getSnapshotter(tempDirPath, defaultCodecName)
+	if err != nil {
+		t.Fatal(err)
+	} else if s.Name() != "tar" {
+		t.Fatalf("the %v snapshotter was used for a plain dir", s.Name())
+	}
+}
+
+func TestFindZfsDataset(t *testing.T) {
+	zfsListOutput := "rpool\t/rpool\nrpool/comprts\t/srv/comprts\nrpool/comprts/foo\t/srv/comprts/foo\n"
+	if dataset := findZfsDataset(zfsListOutput, "/srv/comprts/foo"); dataset != "rpool/comprts/foo" {
+		t.Fatalf("%q was found as the dataset", dataset)
+	}
+	if dataset := findZfsDataset(zfsListOutput, "/srv/comprts/bar"); dataset != "" {
+		t.Fatalf("%q was found as the dataset of a dir that is not a mountpoint", dataset)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The f_type reported by statfs(2) for ZFS, for reference:
+// https://github.com/openzfs/zfs/blob/master/include/sys/zfs_vfsops.h
+const zfsSuperMagic = 0x2fc12fc1
+
+// A snapshotter that uses ZFS dataset snapshots, the target has to be the
+// mountpoint of a dataset.
+type zfsSnapshotter struct {
+	zfsPath string
+	dataset string
+}
+
+// Create a ZFS snapshotter for the target. Returns nil if the target is not
+// the mountpoint of a dataset or the zfs command is not installed.
+func newZfsSnapshotter(target string) (*zfsSnapshotter, error) {
+	zfsPath, err := progExecutor.LookPath("zfs")
+	if err != nil {
+		return nil, nil
+	}
+
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := progExecutor.Output(exec.Command(zfsPath, "list", "-H", "-t", "filesystem", "-o", "name,mountpoint"))
+	if err != nil {
+		return nil, err
+	}
+	dataset := findZfsDataset(string(out), absTarget)
+	if dataset == "" {
+		return nil, nil
+	}
+
+	return &zfsSnapshotter{zfsPath: zfsPath, dataset: dataset}, nil
+}
+
+// Find the dataset mounted at the mountpoint, from the output of
+// 'zfs list -H -o name,mountpoint'. Returns an empty string if there is none.
+func findZfsDataset(zfsListOutput, mountpoint string) string {
+	for _, line := range strings.Split(zfsListOutput, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 2 && fields[1] == mountpoint {
+			return fields[0]
+		}
+	}
+
+	return ""
+}
+
+func (s *zfsSnapshotter) Name() string { return "zfs" }
+
+func (s *zfsSnapshotter) run(args ...string) ([]byte, error) {
+	zfsCmd := exec.Command(s.zfsPath, args...)
+	zfsCmd.Stderr = os.Stderr
+	out, err := progExecutor.Output(zfsCmd)
+	if err != nil {
+		return nil, fmt.Errorf("zfs %v failed: %w", args[0], err)
+	}
+
+	return out, nil
+}
+
+func (s *zfsSnapshotter) Snapshot(target, name string) error {
+	_, err := s.run("snapshot", s.dataset+"@"+name)
+	return err
+}
+
+// Roll the dataset back to the snapshot. ZFS can only roll back to a dataset's
+// most recent snapshot, so restoring an older snapshot fails instead of
+// destroying the snapshots taken after it.
+func (s *zfsSnapshotter) Restore(target, name string) error {
+	names, err := s.List(target)
+	if err != nil {
+		return err
+	} else if !stringInArr(name, &names) {
+		return fmt.Errorf("snapshot %v does not exist for %v", name, target)
+	}
+
+	_, err = s.run("rollback", s.dataset+"@"+name)
+	return err
+}
+
+func (s *zfsSnapshotter) List(target string) ([]string, error) {
+	out, err := s.run("list", "-H", "-t", "snapshot", "-d", "1", "-o", "name", s.dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if i := strings.Index(line, "@"); i > -1 {
+			names = append(names, line[i+1:])
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Clone the dataset into a sibling dataset mounted at dest. The clone depends
+// on a snapshot of the src dataset, which is made for this purpose.
+func (s *zfsSnapshotter) Clone(src, dest string) error {
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+
+	snapshot := s.dataset + "@" + progname + "-clone-" + filepath.Base(absDest)
+	if _, err := s.run("snapshot", snapshot); err != nil {
+		return err
+	}
+	if _, err := s.run("clone", "-o", "mountpoint="+absDest, snapshot, path.Join(path.Dir(s.dataset), filepath.Base(absDest))); err != nil {
+		s.run("destroy", snapshot)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sourcesListPath   = "/etc/apt/sources.list"
+	deb822SourcesPath = "/etc/apt/sources.list.d/debcomprt.sources"
+	// Snapshot mirrors serve release files that have long since expired.
+	snapshotAptConfPath = "/etc/apt/apt.conf.d/99debcomprt-snapshot"
+	snapshotAptConf     = "Acquire::Check-Valid-Until \"false\";\n"
+
+	debianSecurityMirror        = "http://security.debian.org/debian-security/"
+	debianArchiveSecurityMirror = "http://archive.debian.org/debian-security/"
+	ubuntuSecurityMirror        = "http://security.ubuntu.com/ubuntu/"
+)
+
+// The debian codenames whose security suite is named '<codename>/updates',
+// newer codenames use '<codename>-security'.
+var oldDebianSecurityCodenames = []string{"wheezy", "jessie", "stretch", "buster"}
+
+// The codenames that never get security or updates suites.
+var rollingCodenames = []string{"sid", "unstable", "experimental", "rc-buggy"}
+
+// A type used to describe the apt sources written into a comprt.
+type aptSources struct {
+	codeName string
+	mirror   string
+	// The mirrors debootstrap falls back on when it is unable to download from
+	// the mirror, the mirror debootstrap succeeds with is written as the mirror.
+	fallbackMirrors []string
+	components      []string
+	security        bool
+	updates         bool
+	backports       bool
+	// Write the sources in the deb822 format instead of the one line format.
+	deb822 bool
+	// Third-party repos, always written into their own files.
+	repos []aptRepo
+}
+
+// A type used to describe a single apt source (e.g. the security suite).
+type aptSourcesEntry struct {
+	uri   string
+	suite string
+}
+
+// Check whether the sources are for an ubuntu mirror.
+func (sources aptSources) ubuntu() bool {
+	return sources.mirror == defaultUbuntuMirror || strings.Contains(sources.mirror, "ubuntu")
+}
+
+// Get the sources' entries, the codename's suite from the mirror always comes
+// first.
+func (sources aptSources) entries() []aptSourcesEntry {
+	var entries []aptSourcesEntry = []aptSourcesEntry{{sources.mirror, sources.codeName}}
+	if stringInArr(sources.codeName, &rollingCodenames) {
+		return entries
+	}
+
+	if sources.security {
+		// archived debian releases have their security suite archived too
+		var securityMirror string = debianSecurityMirror
+		if sources.mirror == debianArchiveMirror {
+			securityMirror = debianArchiveSecurityMirror
+		}
+		// as is the security suite of a snapshot mirror
+		at, snapshot := snapshotTime(sources.mirror)
+		if snapshot && !sources.ubuntu() {
+			securityMirror, _ = snapshotMirror(debianSecurityMirror, at)
+		}
+
+		switch {
+		// ports.ubuntu.com, old-releases.ubuntu.com and snapshot.ubuntu.com carry the security suite themselves
+		case sources.ubuntu() && (strings.Contains(sources.mirror, "ubuntu-ports") || sources.mirror == ubuntuArchiveMirror || snapshot):
+			entries = append(entries, aptSourcesEntry{sources.mirror, sources.codeName + "-security"})
+		case sources.ubuntu():
+			entries = append(entries, aptSourcesEntry{ubuntuSecurityMirror, sources.codeName + "-security"})
+		case stringInArr(sources.codeName, &oldDebianSecurityCodenames):
+			entries = append(entries, aptSourcesEntry{securityMirror, sources.codeName + "/updates"})
+		default:
+			entries = append(entries, aptSourcesEntry{securityMirror, sources.codeName + "-security"})
+		}
+	}
+	if sources.updates {
+		entries = append(entries, aptSourcesEntry{sources.mirror, sources.codeName + "-updates"})
+	}
+	if sources.backports {
+		entries = append(entries, aptSourcesEntry{sources.mirror, sources.codeName + "-backports"})
+	}
+
+	return entries
+}
+
+// Get the path of the file the sources are written to in the comprt.
+func (sources aptSources) path() string {
+	if sources.deb822 {
+		return deb822SourcesPath
+	}
+
+	return sourcesListPath
+}
+
+// Get the contents of the file the sources are written to.
+func (sources aptSources) contents() string {
+	var contents strings.Builder
+	for i, entry := range sources.entries() {
+		if sources.deb822 {
+			if i > 0 {
+				contents.WriteString("\n")
+			}
+			fmt.Fprintf(
+				&contents,
+				"Types: deb\nURIs: %v\nSuites: %v\nComponents: %v\n",
+				entry.uri,
+				entry.suite,
+				strings.Join(sources.components, " "),
+			)
+		} else {
+			fmt.Fprintf(&contents, "deb %v %v %v\n", entry.uri, entry.suite, strings.Join(sources.components, " "))
+		}
+	}
+
+	return contents.String()
+}
+
+// Write the sources into the comprt, replacing the single line debootstrap
+// wrote. With the deb822 format, the sources.list is left empty. With a snapshot
+// mirror, apt is configured to accept its expired release files.
+func (sources aptSources) write(target string) error {
+	for _, repo := range sources.repos {
+		if err := repo.write(target); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := snapshotTime(sources.mirror); ok {
+		if err := os.WriteFile(filepath.Join(target, snapshotAptConfPath), []byte(snapshotAptConf), OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R); err != nil {
+			return err
+		}
+	}
+
+	if sources.deb822 {
+		if err := os.MkdirAll(filepath.Join(target, filepath.Dir(deb822SourcesPath)), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(target, sourcesListPath), nil, OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(
+		filepath.Join(target, sources.path()),
+		[]byte(sources.contents()),
+		OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R,
+	)
+}
+
+// Get the mmdebstrap customize hooks that write the sources into the comprt,
+// the same as write does.
+func (sources aptSources) mmdebstrapArgs() []string {
+	var script string = fmt.Sprintf("printf '%%s' %v > \"$1\"%v", shellQuote(sources.contents()), shellQuote(sources.path()))
+	if sources.deb822 {
+		script = fmt.Sprintf("mkdir -p \"$1\"%v && : > \"$1\"%v && %v", shellQuote(filepath.Dir(deb822SourcesPath)), shellQuote(sourcesListPath), script)
+	}
+
+	var args []string
+	for _, repo := range sources.repos {
+		args = append(args, repo.mmdebstrapArgs()...)
+	}
+	if _, ok := snapshotTime(sources.mirror); ok {
+		args = append(
+			args,
+			"--aptopt="+strings.TrimSuffix(snapshotAptConf, "\n"),
+			fmt.Sprintf("--customize-hook=printf '%%s' %v > \"$1\"%v", shellQuote(snapshotAptConf), shellQuote(snapshotAptConfPath)),
+		)
+	}
+
+	return append(args, "--customize-hook="+script)
+}
+
+// Refresh the comprt's package lists, so the sources written are used. Expected
+// to be called while chrooted into the comprt.
+func updateAptLists(quiet bool) error {
+	aptGetPath, err := progExecutor.LookPath("apt-get")
+	if err != nil {
+		return err
+	}
+
+	aptGetCmdArr := eatmydataCmdArr([]string{aptGetPath, "update"})
+	aptGetCmd := exec.Command(aptGetCmdArr[0], aptGetCmdArr[1:]...)
+	traceCommand(aptGetCmd)
+	aptGetCmd.Env = append(os.Environ(), aptNonInteractiveEnv...)
+	aptGetCmd.Stdout, aptGetCmd.Stderr = buildLogOutput(quiet)
+
+	return progExecutor.Run(aptGetCmd)
+}
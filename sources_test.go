@@ -0,0 +1,105 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testAptSources = aptSources{
+	codeName:   testCodeCame,
+	mirror:     defaultDebianMirror,
+	components: []string{"main"},
+	security:   true,
+	updates:    true,
+}
+
+func TestAptSourcesContents(t *testing.T) {
+	var sources aptSources = testAptSources
+	var expected string = "deb http://ftp.us.debian.org/debian/ buster main\n" +
+		"deb http://security.debian.org/debian-security/ buster/updates main\n" +
+		"deb http://ftp.us.debian.org/debian/ buster-updates main\n"
+	if contents := sources.contents(); contents != expected {
+		t.Fatalf("expected %q, got %q", expected, contents)
+	}
+
+	sources.codeName, sources.components, sources.updates, sources.backports = "bullseye", []string{"main", "contrib"}, false, true
+	expected = "deb http://ftp.us.debian.org/debian/ bullseye main contrib\n" +
+		"deb http://security.debian.org/debian-security/ bullseye-security main contrib\n" +
+		"deb http://ftp.us.debian.org/debian/ bullseye-backports main contrib\n"
+	if contents := sources.contents(); contents != expected {
+		t.Fatalf("expected %q, got %q", expected, contents)
+	}
+
+	sources = aptSources{codeName: "focal", mirror: defaultUbuntuMirror, components: []string{"main"}, security: true, deb822: true}
+	expected = "Types: deb\nURIs: http://archive.ubuntu.com/ubuntu/\nSuites: focal\nComponents: main\n\n" +
+		"Types: deb\nURIs: http://security.ubuntu.com/ubuntu/\nSuites: focal-security\nComponents: main\n"
+	if contents := sources.contents(); contents != expected {
+		t.Fatalf("expected %q, got %q", expected, contents)
+	}
+
+	sources = aptSources{codeName: "buster", mirror: debianArchiveMirror, components: []string{"main"}, security: true}
+	expected = "deb http://archive.debian.org/debian/ buster main\n" +
+		"deb http://archive.debian.org/debian-security/ buster/updates main\n"
+	if contents := sources.contents(); contents != expected {
+		t.Fatalf("expected %q, got %q", expected, contents)
+	}
+
+	sources = aptSources{codeName: "bookworm", mirror: "http://snapshot.debian.org/archive/debian/20240115T000000Z/", components: []string{"main"}, security: true}
+	expected = "deb http://snapshot.debian.org/archive/debian/20240115T000000Z/ bookworm main\n" +
+		"deb http://snapshot.debian.org/archive/debian-security/20240115T000000Z/ bookworm-security main\n"
+	if contents := sources.contents(); contents != expected {
+		t.Fatalf("expected %q, got %q", expected, contents)
+	}
+
+	sources = aptSources{codeName: "sid", mirror: defaultDebianMirror, components: []string{"main"}, security: true, updates: true}
+	if entries := sources.entries(); len(entries) != 1 {
+		t.Fatalf("sid was given more than its own suite: %v", entries)
+	}
+}
+
+func TestAptSourcesWrite(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if err := os.MkdirAll(filepath.Join(tempDirPath, "etc", "apt"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(tempDirPath, sourcesListPath), "deb http://ftp.us.debian.org/debian/ buster main\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	var sources aptSources = testAptSources
+	sources.deb822 = true
+	if err := sources.write(tempDirPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if sourcesList, err := os.ReadFile(filepath.Join(tempDirPath, sourcesListPath)); err != nil {
+		t.Fatal(err)
+	} else if len(sourcesList) != 0 {
+		t.Fatalf("the sources.list was not emptied for the deb822 sources: %s", sourcesList)
+	}
+	if deb822Sources, err := os.ReadFile(filepath.Join(tempDirPath, deb822SourcesPath)); err != nil {
+		t.Fatal(err)
+	} else if string(deb822Sources) != sources.contents() {
+		t.Fatalf("expected %q, got %q", sources.contents(), deb822Sources)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Installs the public keys passed in as arguments into the authorized_keys of
+// the user with the uid passed in as the first argument. The user's home dir
+// and primary group are looked up in the comprt, as an alias may have created
+// the user. Ran in the comprt by sh.
+const authorizedKeysScript = `set -e
+entry="$(getent passwd "$1")"
+shift
+home="$(echo "${entry}" | cut -d : -f 6)"
+gid="$(echo "${entry}" | cut -d : -f 4)"
+uid="$(echo "${entry}" | cut -d : -f 3)"
+mkdir -p "${home}/.ssh"
+printf '%s\n' "$@" >> "${home}/.ssh/authorized_keys"
+chown "${uid}:${gid}" "${home}/.ssh" "${home}/.ssh/authorized_keys"
+chmod 700 "${home}/.ssh"
+chmod 600 "${home}/.ssh/authorized_keys"
+`
+
+// Matches a public key as found in an authorized_keys file, options (e.g.
+// 'from="10.0.0.?"') before the key's type are allowed.
+var reSshPublicKey = regexp.MustCompile(`(^|\s)(ssh-(rsa|dss|ed25519)|ecdsa-sha2-nistp(256|384|521)|sk-(ssh-ed25519|ecdsa-sha2-nistp256)@openssh\.com)\s+[A-Za-z0-9+/]+=*(\s|$)`)
+
+// Read in the public keys passed in, where each value is either a public key or
+// a file of them (e.g. ~/.ssh/id_ed25519.pub or an authorized_keys file).
+func readSshKeys(values []string) ([]string, error) {
+	var keys []string
+	for _, value := range values {
+		keyFile, err := os.Open(value)
+		if errors.Is(err, fs.ErrNotExist) {
+			if reSshPublicKey.FindStringIndex(value) == nil {
+				return nil, fmt.Errorf("%v is not a public key or a file of them", value)
+			}
+			keys = append(keys, strings.TrimSpace(value))
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(keyFile)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			} else if reSshPublicKey.FindStringIndex(line) == nil {
+				keyFile.Close()
+				return nil, fmt.Errorf("%v has a line that is not a public key: %v", value, line)
+			}
+			keys = append(keys, line)
+		}
+		keyFile.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// Get the command that installs the public keys for the user with the uid
+// passed in, to be ran in the comprt.
+func authorizedKeysArgs(uid int, keys []string) []string {
+	return append([]string{"sh", "-c", authorizedKeysScript, "sh", strconv.Itoa(uid)}, keys...)
+}
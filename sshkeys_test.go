@@ -0,0 +1,96 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testSshKeys = []string{
+	"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIEbVhlEBnVQFYkPDgs5gmcXoF3jpkRbAT1mLvG0UWkKq foo@bar",
+	`from="10.0.0.?" ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTY= baz@bar`,
+}
+
+func TestReadSshKeys(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var keysPath string = filepath.Join(tempDirPath, "authorized_keys")
+	if err := createTestFile(keysPath, "# deploy keys\n\n"+testSshKeys[1]+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := readSshKeys([]string{testSshKeys[0], keysPath})
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(keys, testSshKeys) {
+		t.Fatalf("expected %v, got %v", testSshKeys, keys)
+	}
+
+	if _, err := readSshKeys([]string{"./id_ed25519.pub"}); err == nil {
+		t.Fatal("a file that does not exist was taken as a public key")
+	}
+}
+
+func TestAuthorizedKeysArgs(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// getent is faked, that way the keys are installed into a home dir in the temp dir
+	var binPath, homePath string = filepath.Join(tempDirPath, "bin"), filepath.Join(tempDirPath, "home")
+	if err := os.Mkdir(binPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(
+		filepath.Join(binPath, "getent"),
+		[]byte(fmt.Sprintf("#!/bin/sh\necho '%v:x:%v:%v::%v:/bin/bash'\n", defaultComprtUserName, os.Getuid(), os.Getgid(), homePath)),
+		os.ModePerm,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	authorizedKeysCmdArr := authorizedKeysArgs(defaultComprtUid, testSshKeys)
+	authorizedKeysCmd := exec.Command(authorizedKeysCmdArr[0], authorizedKeysCmdArr[1:]...)
+	authorizedKeysCmd.Env = append(os.Environ(), "PATH="+binPath+":"+os.Getenv("PATH"))
+	if output, err := authorizedKeysCmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+
+	authorizedKeysPath := filepath.Join(homePath, ".ssh", "authorized_keys")
+	contents, err := os.ReadFile(authorizedKeysPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(contents) != testSshKeys[0]+"\n"+testSshKeys[1]+"\n" {
+		t.Fatalf("unexpected authorized_keys: %q", contents)
+	}
+
+	fileInfo, err := os.Stat(authorizedKeysPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if fileInfo.Mode().Perm() != OS_USER_R|OS_USER_W {
+		t.Fatalf("authorized_keys has the wrong permissions: %v", fileInfo.Mode())
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Where the stages of creating a comprt that are done are marked in the
+	// comprt, the markers are removed once the comprt is created.
+	comprtStagesPath = "/etc/debcomprt/stages"
+
+	bootstrapDoneStage = "bootstrap-done"
+	configDoneStage    = "config-done"
+	userDoneStage      = "user-done"
+)
+
+// Mark the stage of creating the comprt as done, that way a create that is
+// resumed (see --resume) can skip it.
+func markStageDone(target, stage string) error {
+	var stagesPath string = filepath.Join(target, comprtStagesPath)
+	if err := os.MkdirAll(stagesPath, os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return err
+	}
+
+	return os.WriteFile(
+		filepath.Join(stagesPath, stage),
+		[]byte(time.Now().UTC().Format(time.RFC3339)+"\n"),
+		OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R,
+	)
+}
+
+// Check whether the stage of creating the comprt was marked as done.
+func stageDone(target, stage string) bool {
+	_, err := os.Stat(filepath.Join(target, comprtStagesPath, stage))
+	return err == nil
+}
+
+// Remove the comprt's stage markers, e.g. once the comprt is created.
+func clearStages(target string) error {
+	if err := os.RemoveAll(filepath.Join(target, comprtStagesPath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStages(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if stageDone(tempDirPath, bootstrapDoneStage) {
+		t.Fatal("the bootstrap was done before it was marked as done")
+	}
+	if err := markStageDone(tempDirPath, bootstrapDoneStage); err != nil {
+		t.Fatal(err)
+	}
+	if !stageDone(tempDirPath, bootstrapDoneStage) {
+		t.Fatal("the bootstrap was not done after it was marked as done")
+	} else if stageDone(tempDirPath, configDoneStage) {
+		t.Fatal("the config was done without being marked as done")
+	}
+
+	if err := clearStages(tempDirPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDirPath, comprtStagesPath)); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the stage markers to be removed, got %v", err)
+	}
+	// the metadata is kept next to the markers
+	if _, err := os.Stat(filepath.Dir(filepath.Join(tempDirPath, comprtStagesPath))); err != nil {
+		t.Fatal(err)
+	}
+	if err := clearStages(tempDirPath); err != nil {
+		t.Fatal(err)
+	}
+}
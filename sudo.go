@@ -0,0 +1,57 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+)
+
+const (
+	// sudo asks for the user's password.
+	sudoPassword = "password"
+	// sudo never asks for the user's password.
+	sudoNoPasswd = "nopasswd"
+
+	sudoersFile = "/etc/sudoers.d/" + progname
+)
+
+var sudoModes = []string{sudoPassword, sudoNoPasswd}
+
+// Installs sudo and gives the user with the uid passed in as the first argument
+// root through it, the second argument is either empty or 'NOPASSWD: '. The
+// sudoers entry is validated by visudo before it is put in place, sudo ignores
+// files in sudoers.d with a '.' in their name. Ran in the comprt by sh.
+const sudoersScript = `set -e
+user="$(getent passwd "$1" | cut -d : -f 1)"
+if ! command -v visudo > /dev/null; then
+    apt-get install --yes --no-install-recommends sudo
+fi
+printf '%s ALL=(ALL:ALL) %sALL\n' "${user}" "$2" > "$3.tmp"
+chmod 440 "$3.tmp"
+visudo -c -q -f "$3.tmp" || { rm -f "$3.tmp"; exit 1; }
+mv "$3.tmp" "$3"
+`
+
+// Get the command that gives the user with the uid passed in root through sudo,
+// to be ran in the comprt.
+func sudoersArgs(uid int, sudoMode string) []string {
+	var tag string
+	if sudoMode == sudoNoPasswd {
+		tag = "NOPASSWD: "
+	}
+
+	args := append([]string{"env"}, aptNonInteractiveEnv...)
+	return append(args, "sh", "-c", sudoersScript, "sh", strconv.Itoa(uid), tag, sudoersFile)
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSudoersArgs(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	// getent and visudo are faked, visudo only fails for a user named root
+	var binPath string = filepath.Join(tempDirPath, "bin")
+	if err := os.Mkdir(binPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, script := range map[string]string{
+		"getent": "#!/bin/sh\necho \"${DEBCOMPRT_TEST_USER}:x:1224:1224::/home/debcomprt:/bin/bash\"\n",
+		"visudo": "#!/bin/sh\n! grep -q '^root ' \"$4\"\n",
+	} {
+		if err := os.WriteFile(filepath.Join(binPath, name), []byte(script), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runSudoers := func(user, sudoMode, sudoersPath string) error {
+		sudoersCmdArr := sudoersArgs(defaultComprtUid, sudoMode)
+		sudoersCmdArr[len(sudoersCmdArr)-1] = sudoersPath
+		sudoersCmd := exec.Command(sudoersCmdArr[0], sudoersCmdArr[1:]...)
+		sudoersCmd.Env = append(os.Environ(), "PATH="+binPath+":"+os.Getenv("PATH"), "DEBCOMPRT_TEST_USER="+user)
+		return sudoersCmd.Run()
+	}
+
+	var sudoersPath string = filepath.Join(tempDirPath, progname)
+	if err := runSudoers(defaultComprtUserName, sudoNoPasswd, sudoersPath); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(sudoersPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(contents) != defaultComprtUserName+" ALL=(ALL:ALL) NOPASSWD: ALL\n" {
+		t.Fatalf("unexpected sudoers entry: %q", contents)
+	}
+	if fileInfo, err := os.Stat(sudoersPath); err != nil {
+		t.Fatal(err)
+	} else if fileInfo.Mode().Perm() != OS_USER_R|OS_GROUP_R {
+		t.Fatalf("the sudoers entry has the wrong permissions: %v", fileInfo.Mode())
+	}
+
+	// an entry visudo rejects is never put in place
+	var invalidSudoersPath string = filepath.Join(tempDirPath, "invalid")
+	if err := runSudoers("root", sudoPassword, invalidSudoersPath); err == nil {
+		t.Fatal("an invalid sudoers entry was accepted")
+	}
+	for _, path := range []string{invalidSudoersPath, invalidSudoersPath + ".tmp"} {
+		if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("%v was left behind: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	sysrootDir           = "/etc/" + progname + "/sysroot"
+	sysrootToolchainFile = "toolchain.cmake"
+	sysrootPkgConfigFile = "pkg-config"
+)
+
+// A type used to store what a cross toolchain needs to know about an
+// architecture.
+type sysrootArch struct {
+	// The multiarch tuple the architecture's libraries are installed under (e.g.
+	// /usr/lib/aarch64-linux-gnu).
+	tuple string
+	// The prefix of the cross compilers debian ships for the architecture (e.g.
+	// aarch64-linux-gnu-gcc).
+	compilerPrefix string
+	// The name CMake knows the architecture's processor by.
+	processor string
+}
+
+// Mappings of debian's architecture names to what a cross toolchain needs to
+// know about them, for reference:
+// https://wiki.debian.org/Multiarch/Tuples
+var sysrootArchs = map[string]sysrootArch{
+	"amd64":    {"x86_64-linux-gnu", "x86_64-linux-gnu", "x86_64"},
+	"arm64":    {"aarch64-linux-gnu", "aarch64-linux-gnu", "aarch64"},
+	"armel":    {"arm-linux-gnueabi", "arm-linux-gnueabi", "arm"},
+	"armhf":    {"arm-linux-gnueabihf", "arm-linux-gnueabihf", "arm"},
+	"i386":     {"i386-linux-gnu", "i686-linux-gnu", "i686"},
+	"mips64el": {"mips64el-linux-gnuabi64", "mips64el-linux-gnuabi64", "mips64"},
+	"mipsel":   {"mipsel-linux-gnu", "mipsel-linux-gnu", "mips"},
+	"ppc64el":  {"powerpc64le-linux-gnu", "powerpc64le-linux-gnu", "ppc64le"},
+	"riscv64":  {"riscv64-linux-gnu", "riscv64-linux-gnu", "riscv64"},
+	"s390x":    {"s390x-linux-gnu", "s390x-linux-gnu", "s390x"},
+}
+
+// Get what a cross toolchain needs to know about the architecture.
+func getSysrootArch(arch string) (sysrootArch, error) {
+	sa, ok := sysrootArchs[arch]
+	if !ok {
+		var archs []string
+		for arch := range sysrootArchs {
+			archs = append(archs, arch)
+		}
+		sort.Strings(archs)
+		return sysrootArch{}, fmt.Errorf("%v is not a supported sysroot architecture, use one of: %v", arch, strings.Join(archs, ", "))
+	}
+
+	return sa, nil
+}
+
+// Check whether the package (which may be pinned, e.g. libssl-dev=3.0.11-1) is
+// a development package.
+func isDevPkg(pkg string) bool {
+	return strings.HasSuffix(strings.SplitN(pkg, "=", 2)[0], "-dev")
+}
+
+// Qualify the package (which may be pinned) with the architecture, e.g.
+// libssl-dev=3.0.11-1 becomes libssl-dev:arm64=3.0.11-1.
+func qualifyPkgArch(pkg, arch string) string {
+	parts := strings.SplitN(pkg, "=", 2)
+	parts[0] += ":" + arch
+	return strings.Join(parts, "=")
+}
+
+// Take the development packages out of debootstrap's --include and the pinned
+// packages. They are returned qualified with the architecture, to be installed
+// with apt-get once the architecture is enabled in the comprt.
+func takeSysrootDevPkgs(debootstrapCmdArr, pinnedPkgs *[]string, arch string) []string {
+	var devPkgs, args []string
+	for _, arg := range *debootstrapCmdArr {
+		if !strings.HasPrefix(arg, "--include=") {
+			args = append(args, arg)
+			continue
+		}
+
+		var includePkgs []string
+		for _, pkg := range strings.Split(strings.TrimPrefix(arg, "--include="), ",") {
+			if isDevPkg(pkg) {
+				devPkgs = append(devPkgs, qualifyPkgArch(pkg, arch))
+				continue
+			}
+			includePkgs = append(includePkgs, pkg)
+		}
+		if includePkgs != nil {
+			args = append(args, "--include="+strings.Join(includePkgs, ","))
+		}
+	}
+	*debootstrapCmdArr = args
+
+	var pkgs []string
+	for _, pkg := range *pinnedPkgs {
+		if isDevPkg(pkg) {
+			devPkgs = append(devPkgs, qualifyPkgArch(pkg, arch))
+			continue
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	*pinnedPkgs = pkgs
+
+	return devPkgs
+}
+
+// Rewrite the absolute symlinks in the comprt to be relative, that way they
+// resolve into the comprt when it is used as a sysroot from the host (e.g.
+// /usr/lib/aarch64-linux-gnu/libm.so -> /lib/aarch64-linux-gnu/libm.so.6).
+// The symlinks resolve the same as before in the comprt itself. Returns the
+// number of symlinks rewritten.
+func relativizeSymlinks(target string) (int, error) {
+	var rewritten int
+	err := filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		} else if !filepath.IsAbs(link) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(target, path)
+		if err != nil {
+			return err
+		}
+		relLink, err := filepath.Rel(filepath.Dir(filepath.Join("/", relPath)), link)
+		if err != nil {
+			return err
+		}
+
+		fileInfo, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if err := os.Symlink(relLink, path); err != nil {
+			return err
+		}
+		if stat, ok := fileInfo.Sys().(*syscall.Stat_t); ok {
+			if err := os.Lchown(path, int(stat.Uid), int(stat.Gid)); err != nil {
+				return err
+			}
+		}
+		rewritten++
+
+		return nil
+	})
+
+	return rewritten, err
+}
+
+// Generate a CMake toolchain file that cross compiles against the comprt (an
+// absolute path) as the sysroot, with debian's cross compilers for the
+// architecture.
+func sysrootToolchain(target string, sa sysrootArch) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# written by %v for the sysroot %v\n", progname, target)
+	fmt.Fprintf(&sb, "set(CMAKE_SYSTEM_NAME Linux)\n")
+	fmt.Fprintf(&sb, "set(CMAKE_SYSTEM_PROCESSOR %v)\n", sa.processor)
+	fmt.Fprintf(&sb, "set(CMAKE_SYSROOT %v)\n", strconv.Quote(target))
+	fmt.Fprintf(&sb, "set(CMAKE_LIBRARY_ARCHITECTURE %v)\n", sa.tuple)
+	fmt.Fprintf(&sb, "set(CMAKE_C_COMPILER %v-gcc)\n", sa.compilerPrefix)
+	fmt.Fprintf(&sb, "set(CMAKE_CXX_COMPILER %v-g++)\n", sa.compilerPrefix)
+	fmt.Fprintf(&sb, "set(PKG_CONFIG_EXECUTABLE %v)\n", strconv.Quote(filepath.Join(target, sysrootDir, sysrootPkgConfigFile)))
+	fmt.Fprintf(&sb, "set(CMAKE_FIND_ROOT_PATH_MODE_PROGRAM NEVER)\n")
+	fmt.Fprintf(&sb, "set(CMAKE_FIND_ROOT_PATH_MODE_LIBRARY ONLY)\n")
+	fmt.Fprintf(&sb, "set(CMAKE_FIND_ROOT_PATH_MODE_INCLUDE ONLY)\n")
+	fmt.Fprintf(&sb, "set(CMAKE_FIND_ROOT_PATH_MODE_PACKAGE ONLY)\n")
+
+	return sb.String()
+}
+
+// Generate a pkg-config wrapper that only finds the .pc files in the comprt (an
+// absolute path), with their paths prefixed by the comprt.
+func sysrootPkgConfig(target string, sa sysrootArch) string {
+	var libDirs []string
+	for _, dir := range []string{"/usr/lib/" + sa.tuple + "/pkgconfig", "/usr/share/pkgconfig", "/usr/lib/pkgconfig"} {
+		libDirs = append(libDirs, filepath.Join(target, dir))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#!/bin/sh\n")
+	fmt.Fprintf(&sb, "# written by %v for the sysroot %v\n", progname, target)
+	fmt.Fprintf(&sb, "export PKG_CONFIG_SYSROOT_DIR=%v\n", shellQuote(target))
+	fmt.Fprintf(&sb, "export PKG_CONFIG_LIBDIR=%v\n", shellQuote(strings.Join(libDirs, ":")))
+	fmt.Fprintf(&sb, "unset PKG_CONFIG_PATH\n")
+	fmt.Fprintf(&sb, "exec pkg-config \"$@\"\n")
+
+	return sb.String()
+}
+
+// Write the CMake toolchain file and pkg-config wrapper for cross compiling
+// against the comprt into the comprt, returns their paths.
+func writeSysrootFiles(target string, sa sysrootArch) ([]string, error) {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(absTarget, sysrootDir), os.ModeDir|(OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X)); err != nil {
+		return nil, err
+	}
+
+	var toolchainPath string = filepath.Join(absTarget, sysrootDir, sysrootToolchainFile)
+	if err := os.WriteFile(toolchainPath, []byte(sysrootToolchain(absTarget, sa)), OS_USER_R|OS_USER_W|OS_GROUP_R|OS_OTH_R); err != nil {
+		return nil, err
+	}
+	var pkgConfigPath string = filepath.Join(absTarget, sysrootDir, sysrootPkgConfigFile)
+	if err := os.WriteFile(pkgConfigPath, []byte(sysrootPkgConfig(absTarget, sa)), OS_USER_R|OS_USER_W|OS_USER_X|OS_GROUP_R|OS_GROUP_X|OS_OTH_R|OS_OTH_X); err != nil {
+		return nil, err
+	}
+
+	return []string{toolchainPath, pkgConfigPath}, nil
+}
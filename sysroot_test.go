@@ -0,0 +1,141 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetSysrootArch(t *testing.T) {
+	sa, err := getSysrootArch("i386")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// debian's i386 libraries and cross compilers go by different tuples
+	if sa.tuple != "i386-linux-gnu" || sa.compilerPrefix != "i686-linux-gnu" {
+		t.Fatalf("unexpected i386 tuples: %+v", sa)
+	}
+
+	if _, err := getSysrootArch("foo"); err == nil {
+		t.Fatal("an unknown architecture was accepted")
+	}
+}
+
+func TestTakeSysrootDevPkgs(t *testing.T) {
+	debootstrapCmdArr := []string{"--include=git,libssl-dev,zlib1g-dev", "--variant=minbase", testCodeCame, "foo", "http://deb.debian.org/debian/"}
+	pinnedPkgs := []string{"vim=2:9.0.1378-2", "libcurl4-openssl-dev=7.88.1-10"}
+
+	devPkgs := takeSysrootDevPkgs(&debootstrapCmdArr, &pinnedPkgs, "arm64")
+	if expected := "libssl-dev:arm64 zlib1g-dev:arm64 libcurl4-openssl-dev:arm64=7.88.1-10"; strings.Join(devPkgs, " ") != expected {
+		t.Fatalf("expected: %v, actual: %v", expected, devPkgs)
+	}
+	if debootstrapCmdArr[0] != "--include=git" || len(debootstrapCmdArr) != 5 {
+		t.Fatalf("the -dev packages were not taken out of --include, actual: %v", debootstrapCmdArr)
+	}
+	if len(pinnedPkgs) != 1 || pinnedPkgs[0] != "vim=2:9.0.1378-2" {
+		t.Fatalf("the -dev packages were not taken out of the pinned packages, actual: %v", pinnedPkgs)
+	}
+
+	// an --include of only -dev packages is dropped
+	debootstrapCmdArr = []string{"--include=libssl-dev", testCodeCame}
+	pinnedPkgs = nil
+	takeSysrootDevPkgs(&debootstrapCmdArr, &pinnedPkgs, "arm64")
+	if len(debootstrapCmdArr) != 1 || debootstrapCmdArr[0] != testCodeCame {
+		t.Fatalf("expected only the codename, actual: %v", debootstrapCmdArr)
+	}
+}
+
+func TestRelativizeSymlinks(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	libDir := filepath.Join(tempDirPath, "usr", "lib", "aarch64-linux-gnu")
+	if err := os.MkdirAll(libDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/lib/aarch64-linux-gnu/libm.so.6", filepath.Join(libDir, "libm.so")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("libz.so.1", filepath.Join(libDir, "libz.so")); err != nil {
+		t.Fatal(err)
+	}
+
+	rewritten, err := relativizeSymlinks(tempDirPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if rewritten != 1 {
+		t.Fatalf("expected 1 symlink to be rewritten, actual: %v", rewritten)
+	}
+
+	for name, expected := range map[string]string{
+		"libm.so": "../../../lib/aarch64-linux-gnu/libm.so.6",
+		"libz.so": "libz.so.1",
+	} {
+		if link, err := os.Readlink(filepath.Join(libDir, name)); err != nil {
+			t.Fatal(err)
+		} else if link != expected {
+			t.Fatalf("expected: %v, actual: %v", expected, link)
+		}
+	}
+}
+
+func TestWriteSysrootFiles(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	sa, err := getSysrootArch("arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := writeSysrootFiles(tempDirPath, sa)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(paths) != 2 {
+		t.Fatalf("expected a toolchain file and a pkg-config wrapper, actual: %v", paths)
+	}
+
+	toolchain, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`set(CMAKE_SYSROOT "` + tempDirPath + `")`,
+		"set(CMAKE_C_COMPILER aarch64-linux-gnu-gcc)",
+		`set(PKG_CONFIG_EXECUTABLE "` + paths[1] + `")`,
+	} {
+		if !strings.Contains(string(toolchain), line+"\n") {
+			t.Fatalf("%q is missing from:\n%s", line, toolchain)
+		}
+	}
+
+	pkgConfig, err := os.ReadFile(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := "export PKG_CONFIG_SYSROOT_DIR=" + shellQuote(tempDirPath); !strings.Contains(string(pkgConfig), line+"\n") {
+		t.Fatalf("%q is missing from:\n%s", line, pkgConfig)
+	} else if !strings.Contains(string(pkgConfig), filepath.Join(tempDirPath, "/usr/lib/aarch64-linux-gnu/pkgconfig")) {
+		t.Fatalf("the multiarch pkgconfig dir is missing from:\n%s", pkgConfig)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Get the values the alias files are preprocessed with. Values from a values
+// file are overridden by the files after it, and all are overridden by the env
+// vars passed in (e.g. from --alias-envvar).
+func aliasTemplateValues(valuesPaths []string, envVars []string) (map[string]string, error) {
+	var values map[string]string = make(map[string]string)
+	var fileEnvVars []string
+	for _, valuesPath := range valuesPaths {
+		envVarsInFile, err := parseEnvFile(valuesPath)
+		if err != nil {
+			return nil, err
+		}
+		fileEnvVars = append(fileEnvVars, envVarsInFile...)
+	}
+	envVars = append(fileEnvVars, envVars...)
+
+	for _, envVar := range envVars {
+		i := strings.Index(envVar, "=")
+		values[envVar[:i]] = envVar[i+1:]
+	}
+
+	return values, nil
+}
+
+// Render the file as a golang text/template with the values passed in, writing
+// the result to dest. Referencing a value that was not passed in is an error,
+// as a config script ran with an empty value can do damage. For reference:
+// https://pkg.go.dev/text/template
+func renderTemplate(src, dest string, values map[string]string) error {
+	srcBytes, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.New(filepath.Base(src)).Option("missingkey=error").Parse(string(srcBytes))
+	if err != nil {
+		return err
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, values); err != nil {
+		return err
+	}
+
+	fileInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dest, rendered.Bytes(), fileInfo.Mode().Perm())
+}
+
+// Preprocess the alias's comprt config, includes and host-side scripts into a
+// new temporary dir, leaving the comprtconfigs repo as is. Returns the temporary
+// dir, the caller is responsible for removing it.
+func preprocessAlias(aliasPath string, values map[string]string) (string, error) {
+	preprocessedDir, err := makeTempDir("", progname+"-alias-")
+	if err != nil {
+		return "", err
+	}
+
+	for _, aliasFile := range append([]string{comprtIncludeFile}, aliasStageFiles...) {
+		if err := renderTemplate(
+			filepath.Join(aliasPath, aliasFile),
+			filepath.Join(preprocessedDir, aliasFile),
+			values,
+		); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			os.RemoveAll(preprocessedDir)
+			return "", err
+		}
+	}
+
+	// the alias's hook scripts are found next to its comprt config file
+	if _, err := os.Stat(filepath.Join(aliasPath, hooksDirName)); err == nil {
+		if err := os.Symlink(filepath.Join(aliasPath, hooksDirName), filepath.Join(preprocessedDir, hooksDirName)); err != nil {
+			os.RemoveAll(preprocessedDir)
+			return "", err
+		}
+	}
+
+	return preprocessedDir, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAliasTemplateValues(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var valuesPath, envFilePath string = filepath.Join(tempDirPath, "values"), filepath.Join(tempDirPath, "ci.env")
+	if err := createTestFile(valuesPath, "# the user's editor\nEDITOR=vim\nSHELL=zsh\nPAGER=less\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(envFilePath, "PAGER=cat\nSHELL=sh\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := aliasTemplateValues([]string{valuesPath, envFilePath}, []string{"SHELL=bash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"EDITOR": "vim", "SHELL": "bash", "PAGER": "cat"}; !reflect.DeepEqual(values, expected) {
+		t.Fatalf("expected %v, got %v", expected, values)
+	}
+}
+
+func TestPreprocessAlias(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	var comprtConfigContents string = "#!/bin/sh\n\nuseradd --shell /bin/{{ .SHELL }} foo\n"
+	if err := createTestFile(filepath.Join(tempDirPath, comprtConfigFile), comprtConfigContents); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(filepath.Join(tempDirPath, comprtIncludeFile), "{{ .SHELL }}\ngit\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	preprocessedDir, err := preprocessAlias(tempDirPath, map[string]string{"SHELL": "zsh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(preprocessedDir)
+
+	for aliasFile, expected := range map[string]string{
+		comprtConfigFile:  "#!/bin/sh\n\nuseradd --shell /bin/zsh foo\n",
+		comprtIncludeFile: "zsh\ngit\n",
+	} {
+		contents, err := os.ReadFile(filepath.Join(preprocessedDir, aliasFile))
+		if err != nil {
+			t.Fatal(err)
+		} else if string(contents) != expected {
+			t.Fatalf("expected %q, got %q", expected, contents)
+		}
+	}
+
+	// the alias itself should be left as is
+	if contents, err := os.ReadFile(filepath.Join(tempDirPath, comprtConfigFile)); err != nil {
+		t.Fatal(err)
+	} else if string(contents) != comprtConfigContents {
+		t.Fatalf("the alias's comprt config file was modified: %q", contents)
+	}
+
+	if _, err := preprocessAlias(tempDirPath, map[string]string{}); err == nil {
+		t.Fatal("an alias referencing a missing value was preprocessed without error")
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	aliasFetchPhase        = "alias fetch"
+	bootstrapDownloadPhase = "bootstrap download"
+	bootstrapExtractPhase  = "bootstrap extract"
+	customizeHooksPhase    = "customize hooks"
+	aptUpdatePhase         = "apt update"
+	pinnedPkgsPhase        = "pinned packages"
+	comprtConfigPhase      = "config script"
+	userCreationPhase      = "user creation"
+	initramfsPhase         = "initramfs"
+	syncBuildDirPhase      = "sync"
+	sysrootPhase           = "sysroot"
+	minimizePhase          = "minimize"
+
+	// The precision phase durations are kept at.
+	phaseDurationPrecision = 100 * time.Millisecond
+)
+
+// A type used to start a phase when a line of output starts with the prefix.
+type phaseMarker struct {
+	prefix string
+	phase  string
+}
+
+// The lines debootstrap outputs as it moves on from downloading the packages.
+var debootstrapPhaseMarkers = []phaseMarker{
+	{"I: Extracting", bootstrapExtractPhase},
+}
+
+// The lines mmdebstrap outputs as it moves on from downloading the packages, and
+// then to running the customize hooks (e.g. the comprt config file).
+var mmdebstrapPhaseMarkers = []phaseMarker{
+	{"I: extracting archives", bootstrapExtractPhase},
+	{"I: running --customize-hook", customizeHooksPhase},
+}
+
+// A type used to store how long a phase took.
+type phaseDuration struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+// A type used to time the phases of creating a comprt. A phase started more
+// than once (e.g. a retried download) has its durations added together.
+type phaseTimer struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	names     []string
+	durations map[string]time.Duration
+	current   string
+	started   time.Time
+	// Where a header is written to as each phase starts.
+	headers []io.Writer
+}
+
+// The phases of the comprt being created.
+var createPhases = newPhaseTimer(time.Now)
+
+func newPhaseTimer(now func() time.Time) *phaseTimer {
+	return &phaseTimer{now: now, durations: make(map[string]time.Duration)}
+}
+
+// Stop the current phase (if any), not locking the timer.
+func (timer *phaseTimer) stopLocked() {
+	if timer.current != "" {
+		timer.durations[timer.current] += timer.now().Sub(timer.started)
+		timer.current = ""
+	}
+}
+
+// Start the phase, stopping the current one. Starting the current phase again
+// leaves it running.
+func (timer *phaseTimer) start(phase string) {
+	timer.mu.Lock()
+	defer timer.mu.Unlock()
+
+	if phase != timer.current {
+		for _, w := range timer.headers {
+			fmt.Fprintln(w, colorize(w, phaseHeaderColor, "==> "+phase))
+		}
+	}
+	timer.stopLocked()
+	if _, ok := timer.durations[phase]; !ok {
+		timer.names = append(timer.names, phase)
+		timer.durations[phase] = 0
+	}
+	timer.current, timer.started = phase, timer.now()
+}
+
+// Stop the current phase.
+func (timer *phaseTimer) stop() {
+	timer.mu.Lock()
+	defer timer.mu.Unlock()
+
+	timer.stopLocked()
+}
+
+// Get how long each phase took, in the order the phases were first started.
+func (timer *phaseTimer) phases() []phaseDuration {
+	timer.mu.Lock()
+	defer timer.mu.Unlock()
+
+	var phases []phaseDuration
+	for _, name := range timer.names {
+		phases = append(phases, phaseDuration{Name: name, Seconds: timer.durations[name].Round(phaseDurationPrecision).Seconds()})
+	}
+
+	return phases
+}
+
+// A type used to start phases as a command's output is written.
+type phaseWatcher struct {
+	timer   *phaseTimer
+	w       io.Writer
+	markers []phaseMarker
+	line    bytes.Buffer
+}
+
+// Get a writer that passes the output written to it on to w, starting a phase
+// whenever a line of the output starts with one of the markers' prefix. The
+// output before the line is passed on first, that way the phase's header comes
+// before the line.
+func (timer *phaseTimer) watch(w io.Writer, markers []phaseMarker) io.Writer {
+	return &phaseWatcher{timer: timer, w: w, markers: markers}
+}
+
+func (watcher *phaseWatcher) Write(p []byte) (int, error) {
+	var written, lineStart int
+	for i, b := range p {
+		if b != '\n' {
+			watcher.line.WriteByte(b)
+			continue
+		}
+
+		for _, marker := range watcher.markers {
+			if strings.HasPrefix(watcher.line.String(), marker.prefix) {
+				if _, err := watcher.w.Write(p[written:lineStart]); err != nil {
+					return written, err
+				}
+				written = lineStart
+				watcher.timer.start(marker.phase)
+			}
+		}
+		watcher.line.Reset()
+		lineStart = i + 1
+	}
+
+	n, err := watcher.w.Write(p[written:])
+	return written + n, err
+}
+
+// Write a summary of how long each phase took, along with the total.
+func writePhaseSummary(w io.Writer, phases []phaseDuration) error {
+	tabWriter := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	var total float64
+	for _, phase := range phases {
+		total += phase.Seconds
+		fmt.Fprintf(tabWriter, "%v\t%.1fs\n", phase.Name, phase.Seconds)
+	}
+	fmt.Fprintf(tabWriter, "total\t%.1fs\n", total)
+
+	return tabWriter.Flush()
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Get a clock that moves forward by a second every time it is read.
+func testClock() func() time.Time {
+	var now time.Time = time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+func TestPhaseTimer(t *testing.T) {
+	var timer *phaseTimer = newPhaseTimer(testClock())
+	timer.start(bootstrapDownloadPhase)
+	// e.g. debootstrap being retried
+	timer.start(bootstrapDownloadPhase)
+	timer.start(comprtConfigPhase)
+	timer.stop()
+	timer.stop()
+
+	var expected []phaseDuration = []phaseDuration{
+		{Name: bootstrapDownloadPhase, Seconds: 2},
+		{Name: comprtConfigPhase, Seconds: 1},
+	}
+	if phases := timer.phases(); !reflect.DeepEqual(phases, expected) {
+		t.Fatalf("expected %v, got %v", expected, phases)
+	}
+}
+
+func TestPhaseWatcher(t *testing.T) {
+	var timer *phaseTimer = newPhaseTimer(testClock())
+	var output bytes.Buffer
+	var w io.Writer = timer.watch(&output, debootstrapPhaseMarkers)
+
+	timer.start(bootstrapDownloadPhase)
+	for _, chunk := range []string{"I: Retrieving InRelease\nI: Valid", "ating Packages\nI: Extr", "acting base-files...\n"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	timer.stop()
+
+	if output.String() != "I: Retrieving InRelease\nI: Validating Packages\nI: Extracting base-files...\n" {
+		t.Fatalf("the output was not passed on, got %q", output.String())
+	}
+	var expected []phaseDuration = []phaseDuration{
+		{Name: bootstrapDownloadPhase, Seconds: 1},
+		{Name: bootstrapExtractPhase, Seconds: 1},
+	}
+	if phases := timer.phases(); !reflect.DeepEqual(phases, expected) {
+		t.Fatalf("expected %v, got %v", expected, phases)
+	}
+}
+
+func TestWritePhaseSummary(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writePhaseSummary(&buf, []phaseDuration{
+		{Name: bootstrapDownloadPhase, Seconds: 312.4},
+		{Name: comprtConfigPhase, Seconds: 95.1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var expected string = "bootstrap download  312.4s\n" +
+		"config script       95.1s\n" +
+		"total               407.5s\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestPhaseHeaders(t *testing.T) {
+	var timer *phaseTimer = newPhaseTimer(testClock())
+	var output bytes.Buffer
+	timer.headers = []io.Writer{&output}
+	var w io.Writer = timer.watch(&output, debootstrapPhaseMarkers)
+
+	timer.start(bootstrapDownloadPhase)
+	if _, err := w.Write([]byte("I: Validating Packages\nI: Extracting base-files...\nI: Extracting dash...\n")); err != nil {
+		t.Fatal(err)
+	}
+	timer.stop()
+
+	var expected string = "==> bootstrap download\nI: Validating Packages\n==> bootstrap extract\nI: Extracting base-files...\nI: Extracting dash...\n"
+	if output.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, output.String())
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// The env needed for apt-get and dpkg to never prompt.
+var aptNonInteractiveEnv = []string{
+	"DEBIAN_FRONTEND=noninteractive",
+	"DEBCONF_NONINTERACTIVE_SEEN=true",
+	"APT_LISTCHANGES_FRONTEND=none",
+}
+
+// Whether the comprt config file is ran with the env needed for apt-get and dpkg
+// to never prompt, set by the --noninteractive flag of create and provision.
+var noninteractiveConfig bool = true
+
+// Get the env the comprt config file is ran with, on top of debcomprt's own.
+func comprtConfigEnv() []string {
+	if !noninteractiveConfig {
+		return nil
+	}
+
+	return aptNonInteractiveEnv
+}
+
+// Create the apt-get arg lists used to upgrade a comprt. Configuration files
+// changed in the comprt are kept over the package's new version.
+func upgradeAptGetArgLists() [][]string {
+	return [][]string{
+		{"update"},
+		{
+			"--yes",
+			"--option", "Dpkg::Options::=--force-confdef",
+			"--option", "Dpkg::Options::=--force-confold",
+			"dist-upgrade",
+		},
+	}
+}
+
+// Upgrade the packages installed in the comprt. Services are kept from starting
+// while packages are upgraded. Returns the packages installed before and after
+// the upgrade.
+func upgradeComprt(target string, quiet bool) (oldPkgs, newPkgs map[string]string, errs []error) {
+	oldPkgs, err := readInstalledPackages(target)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	removePolicyRcD, err := installPolicyRcD(target)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+	defer func() {
+		if err := removePolicyRcD(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+
+	if err := func() (errs []error) {
+		exitChroot, errs := Chroot(target)
+		if errs != nil {
+			return
+		}
+		defer func() {
+			if err := exitChroot(); err != nil {
+				errs = append(errs, err)
+			}
+		}()
+
+		aptGetPath, err := progExecutor.LookPath("apt-get")
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		for _, aptGetArgs := range upgradeAptGetArgLists() {
+			aptGetCmd := exec.Command(aptGetPath, aptGetArgs...)
+			traceCommand(aptGetCmd)
+			aptGetCmd.Env = append(os.Environ(), aptNonInteractiveEnv...)
+			if !quiet {
+				aptGetCmd.Stdout = os.Stdout
+				aptGetCmd.Stderr = os.Stderr
+			}
+			if err := progExecutor.Run(aptGetCmd); err != nil {
+				errs = append(errs, err)
+				return
+			}
+		}
+
+		return nil
+	}(); err != nil {
+		errs = append(errs, err...)
+		return
+	}
+
+	newPkgs, err = readInstalledPackages(target)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	return oldPkgs, newPkgs, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const defaultComprtUserShell = "/bin/bash"
+
+// Matches the user and group names useradd/groupadd accept by default on debian.
+var reUserName = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// A type used to describe a user created in the comprt.
+type comprtUser struct {
+	name          string
+	uid           int
+	gid           int
+	shell         string
+	groups        []string
+	cryptPassword string
+	sshKeys       []string
+	sudo          string
+}
+
+// Get the comprt's default user, before any flags are applied.
+func defaultComprtUser() comprtUser {
+	return comprtUser{
+		name:  defaultComprtUserName,
+		uid:   defaultComprtUid,
+		gid:   defaultComprtUid,
+		shell: defaultComprtUserShell,
+	}
+}
+
+// Check that the user can be created by useradd.
+func (user comprtUser) validate() error {
+	if reUserName.FindStringIndex(user.name) == nil {
+		return fmt.Errorf("%v is not a valid user name", user.name)
+	} else if user.uid < 0 || user.gid < 0 {
+		return fmt.Errorf("the uid and gid of %v cannot be negative", user.name)
+	} else if !filepath.IsAbs(user.shell) {
+		return fmt.Errorf("the shell of %v is not an absolute path: %v", user.name, user.shell)
+	}
+
+	for _, group := range user.groups {
+		if reUserName.FindStringIndex(group) == nil {
+			return fmt.Errorf("%v is not a valid group name", group)
+		}
+	}
+
+	return nil
+}
+
+// Get the command that creates the user's primary group, to be ran in the
+// comprt. If a group already has the user's gid (e.g. 100 for 'users'), that
+// group is used instead.
+func (user comprtUser) groupAddArgs() []string {
+	return []string{
+		"sh",
+		"-c",
+		`getent group "$1" > /dev/null || groupadd --gid "$1" "$2"`,
+		"sh",
+		strconv.Itoa(user.gid),
+		user.name,
+	}
+}
+
+// Get the command that creates the user, to be ran in the comprt.
+//
+// DISCUSS(cavcrosby): it might be fun to reimplement the creation of the default
+// user and group using the more primitive system calls for Unix/Linux. I would
+// like to circle around at some point and look into this.
+func (user comprtUser) userAddArgs() []string {
+	var args []string = []string{
+		"useradd",
+		"--create-home",
+		"--home-dir",
+		"/home/" + user.name,
+		"--uid",
+		strconv.Itoa(user.uid),
+		"--gid",
+		strconv.Itoa(user.gid),
+		"--shell",
+		user.shell,
+	}
+	if len(user.groups) > 0 {
+		args = append(args, "--groups", strings.Join(user.groups, ","))
+	}
+
+	return append(args, user.name, "--password", user.cryptPassword)
+}
+
+// Get the commands that setup the user, to be ran in the comprt in order. The
+// user (and its primary group) are only created if create is true, otherwise
+// the user is expected to already exist with the user's uid.
+func (user comprtUser) setupCmdArrs(create bool) [][]string {
+	var cmdArrs [][]string
+	if create {
+		cmdArrs = append(cmdArrs, user.groupAddArgs(), user.userAddArgs())
+	}
+	if len(user.sshKeys) > 0 {
+		cmdArrs = append(cmdArrs, authorizedKeysArgs(user.uid, user.sshKeys))
+	}
+	if user.sudo != "" {
+		cmdArrs = append(cmdArrs, sudoersArgs(user.uid, user.sudo))
+	}
+
+	return cmdArrs
+}
+
+// Get the commands that setup the users, to be ran in the comprt in order. The
+// first user is the default comprt user, which an alias creates itself.
+func usersSetupCmdArrs(users []comprtUser, alias string) [][]string {
+	var cmdArrs [][]string
+	for i, user := range users {
+		cmdArrs = append(cmdArrs, user.setupCmdArrs(i > 0 || alias == noAlias)...)
+	}
+
+	return cmdArrs
+}
+
+// Get the name of the user to login as in the comprt. The user recorded in the
+// comprt's metadata when the comprt was created is used, otherwise the user with
+// the default comprt uid (e.g. a comprt created before debcomprt kept metadata).
+func comprtLoginName(target string) (string, error) {
+	metadata, err := getComprtMetadata(target)
+	if err == nil && metadata.User != "" {
+		return metadata.User, nil
+	}
+
+	loginName, err := comprtUserName(target, defaultComprtUid)
+	if err != nil {
+		return "", err
+	} else if loginName == "" {
+		return "", errors.New("unable to find the user to login as in the comprt")
+	}
+
+	return loginName, nil
+}
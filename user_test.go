@@ -0,0 +1,102 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComprtUserArgs(t *testing.T) {
+	user := defaultComprtUser()
+	user.name, user.uid, user.gid, user.shell, user.groups = "builder", 2000, 100, "/bin/zsh", []string{"adm", "video"}
+	if err := user.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var userAddArgs string = strings.Join(user.userAddArgs(), " ")
+	for _, expected := range []string{
+		"--home-dir /home/builder",
+		"--uid 2000",
+		"--gid 100",
+		"--shell /bin/zsh",
+		"--groups adm,video",
+	} {
+		if !strings.Contains(userAddArgs, expected) {
+			t.Fatalf("%v was not found in the useradd args: %v", expected, userAddArgs)
+		}
+	}
+
+	if cmdArrs := user.setupCmdArrs(false); len(cmdArrs) != 0 {
+		t.Fatalf("a user that already exists was created: %v", cmdArrs)
+	}
+	user.sudo = sudoPassword
+	if cmdArrs := user.setupCmdArrs(true); len(cmdArrs) != 3 {
+		t.Fatalf("expected the user to be created and given sudo: %v", cmdArrs)
+	}
+
+	for _, invalidUser := range []comprtUser{
+		{name: "Builder", shell: defaultComprtUserShell},
+		{name: "builder", uid: -1, shell: defaultComprtUserShell},
+		{name: "builder", shell: "zsh"},
+		{name: "builder", shell: defaultComprtUserShell, groups: []string{"adm video"}},
+	} {
+		if err := invalidUser.validate(); err == nil {
+			t.Fatalf("an invalid user was accepted: %+v", invalidUser)
+		}
+	}
+}
+
+func TestComprtLoginName(t *testing.T) {
+	defer setupTempProgDataDir(t)()
+
+	var testTarget string = filepath.Join(progDataDir, "testChroot")
+	if err := os.MkdirAll(filepath.Join(testTarget, "etc"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(
+		filepath.Join(testTarget, "etc", "passwd"),
+		"root:x:0:0:root:/root:/bin/bash\nfoo:x:12240:12240::/home/foo:/bin/bash\naltaria:x:1224:1224::/home/altaria:/bin/bash\n",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// e.g. a comprt created by an alias
+	if loginName, err := comprtLoginName(testTarget); err != nil {
+		t.Fatal(err)
+	} else if loginName != "altaria" {
+		t.Fatalf("expected the user with the default comprt uid, got %v", loginName)
+	}
+
+	if err := registerComprt(registryEntry{Target: testTarget, User: "builder"}); err != nil {
+		t.Fatal(err)
+	}
+	if loginName, err := comprtLoginName(testTarget); err != nil {
+		t.Fatal(err)
+	} else if loginName != "builder" {
+		t.Fatalf("expected the user recorded in the registry, got %v", loginName)
+	}
+
+	if err := writeComprtMetadata(testTarget, comprtMetadata{CodeName: testCodeCame, User: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if loginName, err := comprtLoginName(testTarget); err != nil {
+		t.Fatal(err)
+	} else if loginName != "foo" {
+		t.Fatalf("expected the user recorded in the comprt's metadata, got %v", loginName)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// A type used to describe how much debcomprt outputs.
+type verbosityLevel int
+
+const (
+	// Only errors (and warnings) are output.
+	veryQuietVerbosity verbosityLevel = iota - 2
+	// The progress of an operation (e.g. debootstrap's output) is not output,
+	// what an operator should still see is (e.g. a busy mount).
+	quietVerbosity
+	normalVerbosity
+	// The internals of an operation are output too (e.g. debootstrap's verbose
+	// output, the filesystems mounted into a comprt).
+	verboseVerbosity
+	// The commands ran are output too.
+	veryVerboseVerbosity
+)
+
+// The commands that take the verbosity flags.
+var verbosityCommands = []string{"chroot", "cleanup", "create", "delete", "provision", "register-sbuild", "upgrade"}
+
+var progVerbosity verbosityLevel = normalVerbosity
+
+// A type used to store the verbosity flags passed in.
+type verbosityFlagValues struct {
+	quiet       bool
+	veryQuiet   bool
+	verbose     bool
+	veryVerbose bool
+}
+
+// Get the verbosity flags of a command, bound to the values.
+func verbosityFlags(values *verbosityFlagValues) []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "quiet",
+			Aliases:     []string{"q"},
+			Value:       false,
+			Usage:       "quiet (no progress output)",
+			Destination: &values.quiet,
+		},
+		&cli.BoolFlag{
+			Name:        "very-quiet",
+			Aliases:     []string{"qq"},
+			Value:       false,
+			Usage:       "very quiet (no output other than errors)",
+			Destination: &values.veryQuiet,
+		},
+		&cli.BoolFlag{
+			Name:        "verbose",
+			Aliases:     []string{"v"},
+			Value:       false,
+			Usage:       "verbose (output debootstrap's internals, the filesystems mounted)",
+			Destination: &values.verbose,
+		},
+		&cli.BoolFlag{
+			Name:        "very-verbose",
+			Aliases:     []string{"vv"},
+			Value:       false,
+			Usage:       "very verbose (also output the commands ran)",
+			Destination: &values.veryVerbose,
+		},
+	}
+}
+
+// Get the verbosity level of the flags passed in, the most extreme of each kind
+// of flag wins.
+func (values verbosityFlagValues) level() (verbosityLevel, error) {
+	if (values.quiet || values.veryQuiet) && (values.verbose || values.veryVerbose) {
+		return normalVerbosity, errors.New("--quiet (or --very-quiet) cannot be used with --verbose (or --very-verbose)")
+	}
+
+	switch {
+	case values.veryQuiet:
+		return veryQuietVerbosity, nil
+	case values.quiet:
+		return quietVerbosity, nil
+	case values.veryVerbose:
+		return veryVerboseVerbosity, nil
+	case values.verbose:
+		return verboseVerbosity, nil
+	}
+	return normalVerbosity, nil
+}
+
+// Output a notice an operator should see, unless debcomprt is very quiet.
+func infof(format string, a ...interface{}) {
+	if progVerbosity > veryQuietVerbosity {
+		fmt.Printf("%s: "+format+"\n", append([]interface{}{progname}, a...)...)
+	}
+}
+
+// Output the internals of an operation, if debcomprt is verbose.
+func verbosef(format string, a ...interface{}) {
+	if progVerbosity >= verboseVerbosity {
+		fmt.Printf("%s: "+format+"\n", append([]interface{}{progname}, a...)...)
+	}
+}
+
+// Output the command about to be ran, if debcomprt is very verbose. The command
+// is output as it would be typed into a shell, to stderr (the same as sh -x).
+func traceCommand(cmd *exec.Cmd) {
+	if progVerbosity < veryVerboseVerbosity {
+		return
+	}
+
+	var quotedArgs []string
+	for _, arg := range cmd.Args {
+		quotedArgs = append(quotedArgs, shellQuote(arg))
+	}
+	fmt.Fprintf(os.Stderr, "+ %v\n", strings.Join(quotedArgs, " "))
+}
+
+// Get the args that make debootstrap (or mmdebstrap) as verbose as debcomprt.
+func bootstrapVerbosityArgs() []string {
+	if progVerbosity >= verboseVerbosity {
+		return []string{"--verbose"}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestVerbosityFlagValuesLevel(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		expected verbosityLevel
+	}{
+		{nil, normalVerbosity},
+		{[]string{"-q"}, quietVerbosity},
+		{[]string{"-qq"}, veryQuietVerbosity},
+		{[]string{"-q", "-qq"}, veryQuietVerbosity},
+		{[]string{"-v"}, verboseVerbosity},
+		{[]string{"--very-verbose"}, veryVerboseVerbosity},
+		{[]string{"-v", "-vv"}, veryVerboseVerbosity},
+	} {
+		var values verbosityFlagValues
+		var set *flag.FlagSet = flag.NewFlagSet(progname, flag.ContinueOnError)
+		for _, verbosityFlag := range verbosityFlags(&values) {
+			if err := verbosityFlag.Apply(set); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := set.Parse(tc.args); err != nil {
+			t.Fatal(err)
+		}
+
+		if level, err := values.level(); err != nil {
+			t.Fatal(err)
+		} else if level != tc.expected {
+			t.Fatalf("expected %v to be the level %v, got %v", tc.args, tc.expected, level)
+		}
+	}
+
+	if _, err := (verbosityFlagValues{quiet: true, veryVerbose: true}).level(); err == nil {
+		t.Fatal("expected an error for mixing a quiet flag with a verbose flag")
+	}
+}
+
+func TestBootstrapVerbosityArgs(t *testing.T) {
+	defer func(level verbosityLevel) { progVerbosity = level }(progVerbosity)
+
+	for level, expected := range map[verbosityLevel][]string{
+		quietVerbosity:       nil,
+		normalVerbosity:      nil,
+		verboseVerbosity:     {"--verbose"},
+		veryVerboseVerbosity: {"--verbose"},
+	} {
+		progVerbosity = level
+		if args := bootstrapVerbosityArgs(); !reflect.DeepEqual(args, expected) {
+			t.Fatalf("expected %v at the level %v, got %v", expected, level, args)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The most drifted packages or files listed in a check's detail, the rest are
+// only counted.
+const maxDriftDetails = 5
+
+// A type used to store a file's checksum from a checksum manifest.
+type fileChecksum struct {
+	path string
+	sum  string
+}
+
+// Summarize the drift found by a check, e.g. '3 packages drifted: a, b, c'.
+func driftDetail(kind string, drift []string) string {
+	var listed []string = drift
+	if len(listed) > maxDriftDetails {
+		listed = append(append([]string{}, drift[:maxDriftDetails]...), fmt.Sprintf("and %v more", len(drift)-maxDriftDetails))
+	}
+
+	return fmt.Sprintf("%v %v drifted: %v", len(drift), kind, strings.Join(listed, ", "))
+}
+
+// Check the comprt's metadata is there and agrees with the lock (if any).
+func verifyMetadata(target string, lock *comprtLock) doctorResult {
+	var result doctorResult = doctorResult{name: "metadata"}
+	metadata, err := readComprtMetadata(target)
+	if err != nil {
+		result.status, result.detail = doctorFail, err.Error()
+		return result
+	} else if metadata == nil {
+		result.status, result.detail = doctorWarn, fmt.Sprintf("%v does not exist, the comprt was created before debcomprt kept metadata", comprtMetadataPath)
+		return result
+	}
+
+	if lock != nil && (metadata.CodeName != lock.CodeName || (lock.Arch != "" && metadata.Arch != lock.Arch)) {
+		result.status = doctorFail
+		result.detail = fmt.Sprintf("the comprt is %v (%v), the lockfile is for %v (%v)", metadata.CodeName, metadata.Arch, lock.CodeName, lock.Arch)
+		return result
+	}
+
+	result.status, result.detail = doctorPass, fmt.Sprintf("%v (%v) created %v", metadata.CodeName, metadata.Arch, metadata.Created.Format("2006-01-02"))
+	return result
+}
+
+// Check the comprt's packages are installed at the versions in the lock. Packages
+// installed since the comprt was locked are only warned about.
+func verifyPackages(target string, lock *comprtLock) doctorResult {
+	var result doctorResult = doctorResult{name: "packages"}
+	if lock == nil {
+		result.status, result.detail = doctorWarn, "no lockfile, the packages were not checked (see --lockfile)"
+		return result
+	}
+
+	installed, err := readInstalledPackages(target)
+	if err != nil {
+		result.status, result.detail = doctorFail, err.Error()
+		return result
+	}
+
+	var drift, added []string
+	for pkg, version := range lock.Packages {
+		if installedVersion, ok := installed[pkg]; !ok {
+			drift = append(drift, pkg+" is not installed")
+		} else if installedVersion != version {
+			drift = append(drift, fmt.Sprintf("%v %v -> %v", pkg, version, installedVersion))
+		}
+	}
+	for pkg := range installed {
+		if _, ok := lock.Packages[pkg]; !ok {
+			added = append(added, pkg+" was installed")
+		}
+	}
+	sort.Strings(drift)
+	sort.Strings(added)
+
+	switch {
+	case len(drift) > 0:
+		result.status, result.detail = doctorFail, driftDetail("packages", append(drift, added...))
+	case len(added) > 0:
+		result.status, result.detail = doctorWarn, driftDetail("packages", added)
+	default:
+		result.status, result.detail = doctorPass, fmt.Sprintf("%v packages at their locked versions", len(lock.Packages))
+	}
+	return result
+}
+
+// Check the user the chroot command logs in as still exists in the comprt.
+func verifyLoginUser(target string) doctorResult {
+	var result doctorResult = doctorResult{name: "user"}
+	loginName, err := comprtLoginName(target)
+	if err != nil {
+		result.status, result.detail = doctorFail, err.Error()
+		return result
+	}
+
+	var loginNameIndex, uidIndex int = 0, 2
+	uid, err := locateField(
+		filepath.Join(target, "/etc/passwd"),
+		regexp.MustCompile(":"),
+		loginNameIndex,
+		uidIndex,
+		regexp.MustCompile("^"+regexp.QuoteMeta(loginName)+"$"),
+	)
+	if err != nil {
+		result.status, result.detail = doctorFail, err.Error()
+	} else if uid == "" {
+		result.status, result.detail = doctorFail, fmt.Sprintf("%v does not exist in the comprt", loginName)
+	} else {
+		result.status, result.detail = doctorPass, fmt.Sprintf("%v (uid %v) exists", loginName, uid)
+	}
+	return result
+}
+
+// Check nothing is mounted under the comprt, chroot sessions mount into their own
+// mount namespace so anything mounted is unexpected.
+func verifyMounts(target string, mounts []mountInfo) doctorResult {
+	var result doctorResult = doctorResult{name: "mounts"}
+	var mountPoints []string
+	for _, mount := range mountsUnder(target, mounts) {
+		mountPoints = append(mountPoints, mount.mountPoint)
+	}
+
+	if len(mountPoints) > 0 {
+		result.status, result.detail = doctorFail, fmt.Sprintf("unexpectedly mounted: %v (see the cleanup command)", strings.Join(mountPoints, ", "))
+	} else {
+		result.status, result.detail = doctorPass, "nothing is mounted in the comprt"
+	}
+	return result
+}
+
+// Read in a checksum manifest in the format sha256sum writes (e.g.
+// '<sum>  /etc/motd'), the paths being in the comprt.
+func readChecksums(r io.Reader) ([]fileChecksum, error) {
+	var checksums []fileChecksum
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// the path may have spaces in it
+		var sum, path string = line, ""
+		if i := strings.IndexAny(line, " \t"); i > -1 {
+			sum, path = line[:i], strings.TrimSpace(line[i:])
+		}
+		if len(sum) != sha256.Size*2 || path == "" {
+			return nil, fmt.Errorf("line %v is not a sha256 checksum and path: %v", lineNum, line)
+		}
+		// sha256sum marks files read in binary mode with a '*'
+		checksums = append(checksums, fileChecksum{path: strings.TrimPrefix(path, "*"), sum: strings.ToLower(sum)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return checksums, nil
+}
+
+// Get the sha256 checksum of a file.
+func sha256File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Check the comprt's files match the checksums.
+func verifyChecksums(target string, checksums []fileChecksum) doctorResult {
+	var result doctorResult = doctorResult{name: "checksums"}
+	var drift []string
+	for _, checksum := range checksums {
+		sum, err := sha256File(filepath.Join(target, checksum.path))
+		if errors.Is(err, fs.ErrNotExist) {
+			drift = append(drift, checksum.path+" does not exist")
+		} else if err != nil {
+			result.status, result.detail = doctorFail, err.Error()
+			return result
+		} else if sum != checksum.sum {
+			drift = append(drift, checksum.path+" was changed")
+		}
+	}
+
+	if len(drift) > 0 {
+		result.status, result.detail = doctorFail, driftDetail("files", drift)
+	} else {
+		result.status, result.detail = doctorPass, fmt.Sprintf("%v files match their checksums", len(checksums))
+	}
+	return result
+}
+
+// Check the comprt has not drifted from how it was created. The lock and
+// checksums are optional (nil), their checks are skipped without them.
+func verifyComprt(target string, lock *comprtLock, checksums []fileChecksum) ([]doctorResult, error) {
+	mounts, err := readMountInfo(procSelfMountInfo)
+	if err != nil {
+		return nil, err
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []doctorResult = []doctorResult{
+		verifyMetadata(target, lock),
+		verifyPackages(target, lock),
+		verifyLoginUser(target),
+		verifyMounts(absTarget, mounts),
+		verifyDigest(target),
+	}
+	if checksums != nil {
+		results = append(results, verifyChecksums(target, checksums))
+	}
+
+	return results, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 Conner Crosby
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPackages(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if err := os.MkdirAll(filepath.Join(tempDirPath, filepath.Dir(dpkgStatusFile)), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(
+		filepath.Join(tempDirPath, dpkgStatusFile),
+		"Package: git\nStatus: install ok installed\nVersion: 1:2.20.1-2+deb10u3\n\n"+
+			"Package: curl\nStatus: install ok installed\nVersion: 7.64.0-4+deb10u2\n",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := verifyPackages(tempDirPath, nil); result.status != doctorWarn {
+		t.Fatalf("expected %v without a lockfile, got %v", doctorWarn, result.status)
+	}
+
+	var lock comprtLock = comprtLock{Packages: map[string]string{"git": "1:2.20.1-2+deb10u3", "curl": "7.64.0-4+deb10u2"}}
+	if result := verifyPackages(tempDirPath, &lock); result.status != doctorPass {
+		t.Fatalf("expected %v, got %v (%v)", doctorPass, result.status, result.detail)
+	}
+
+	lock.Packages = map[string]string{"git": "1:2.20.1-2+deb10u3"}
+	if result := verifyPackages(tempDirPath, &lock); result.status != doctorWarn {
+		t.Fatalf("expected %v for an added package, got %v (%v)", doctorWarn, result.status, result.detail)
+	}
+
+	lock.Packages = map[string]string{"git": "1:2.20.1-2", "curl": "7.64.0-4+deb10u2", "vim": "2:8.1.0875-5"}
+	result := verifyPackages(tempDirPath, &lock)
+	if result.status != doctorFail {
+		t.Fatalf("expected %v for drifted packages, got %v (%v)", doctorFail, result.status, result.detail)
+	}
+	for _, drift := range []string{"git 1:2.20.1-2 -> 1:2.20.1-2+deb10u3", "vim is not installed"} {
+		if !strings.Contains(result.detail, drift) {
+			t.Fatalf("expected %q in %q", drift, result.detail)
+		}
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	tempDirPath, err := os.MkdirTemp("", "_"+tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	if err := createTestFile(filepath.Join(tempDirPath, "foo bar"), "foo\n"); err != nil {
+		t.Fatal(err)
+	}
+	// the sha256 checksum of 'foo\n'
+	checksums, err := readChecksums(strings.NewReader(
+		"# comprt checksums\nb5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c  /foo bar\n",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := verifyChecksums(tempDirPath, checksums); result.status != doctorPass {
+		t.Fatalf("expected %v, got %v (%v)", doctorPass, result.status, result.detail)
+	}
+
+	if err := createTestFile(filepath.Join(tempDirPath, "foo bar"), "bar\n"); err != nil {
+		t.Fatal(err)
+	}
+	if result := verifyChecksums(tempDirPath, checksums); result.status != doctorFail {
+		t.Fatalf("expected %v for a changed file, got %v", doctorFail, result.status)
+	}
+
+	if _, err := readChecksums(strings.NewReader("foo  /etc/motd\n")); err == nil {
+		t.Fatal("a malformed checksum was read in")
+	}
+}
+
+func TestVerifyMounts(t *testing.T) {
+	var mounts []mountInfo = []mountInfo{{mountPoint: "/srv/comprt/proc"}, {mountPoint: "/srv/comprt2"}}
+	if result := verifyMounts("/srv/comprt", mounts); result.status != doctorFail {
+		t.Fatalf("expected %v, got %v", doctorFail, result.status)
+	} else if result := verifyMounts("/srv/comprt2", mounts); result.status != doctorPass {
+		t.Fatalf("expected %v, got %v (%v)", doctorPass, result.status, result.detail)
+	}
+}